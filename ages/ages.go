@@ -0,0 +1,189 @@
+package ages
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Unbounded is the oldest age of open-ended ages, such as "90+"
+const Unbounded = math.MaxInt32
+
+var (
+	// single matches a single age, such as "5", "Aged 5" or "5 years"
+	single = regexp.MustCompile(`^(\d+)$`)
+
+	// band matches a band of ages, such as "0-4", "0 to 4" or "Aged 0 to 4 years"
+	band = regexp.MustCompile(`^(\d+)\s*(?:-|–|to)\s*(\d+)$`)
+
+	// over matches open-ended ages, such as "90+", "90 and over" or "Aged 85 years and over"
+	over = regexp.MustCompile(`^(\d+)\s*(?:\+|plus|and over|or over|and above|or above|and older|or older)$`)
+
+	// under matches the ages below an age, such as "Under 1" or "Less than 16"
+	under = regexp.MustCompile(`^(?:under|less than|below)\s*(\d+)$`)
+
+	// noise matches the words around the ages in a label, which don't change the ages it stands for
+	noise = regexp.MustCompile(`\b(?:aged|age|ages|years|year|yrs|yr|old)\b`)
+
+	// spaces matches the runs of white space left once the noise is removed
+	spaces = regexp.MustCompile(`\s+`)
+)
+
+// Age is the range of ages in years an age option stands for, from Youngest to Oldest inclusive.
+// Open-ended ages have Unbounded as their oldest age.
+type Age struct {
+	Youngest int
+	Oldest   int
+}
+
+// Parse returns the ages an age label stands for. Labels that don't stand for ages, such as "Total" or
+// "All ages", are not parsed and false is returned.
+func Parse(label string) (Age, bool) {
+	s := strings.ToLower(strings.TrimSpace(label))
+	s = noise.ReplaceAllString(s, "")
+	s = strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+
+	if m := single.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return Age{}, false
+		}
+		return Age{Youngest: n, Oldest: n}, true
+	}
+	if m := band.FindStringSubmatch(s); m != nil {
+		from, err1 := strconv.Atoi(m[1])
+		to, err2 := strconv.Atoi(m[2])
+		if err1 != nil || err2 != nil || from > to {
+			return Age{}, false
+		}
+		return Age{Youngest: from, Oldest: to}, true
+	}
+	if m := over.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return Age{}, false
+		}
+		return Age{Youngest: n, Oldest: Unbounded}, true
+	}
+	if m := under.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n == 0 {
+			return Age{}, false
+		}
+		return Age{Youngest: 0, Oldest: n - 1}, true
+	}
+	return Age{}, false
+}
+
+// IsOpenEnded returns true if the age has no oldest age
+func (a Age) IsOpenEnded() bool {
+	return a.Oldest == Unbounded
+}
+
+// Within returns true if all the ages of a are within the ages from youngest to oldest
+func (a Age) Within(youngest, oldest Age) bool {
+	return a.Youngest >= youngest.Youngest && a.Oldest <= oldest.Oldest
+}
+
+// Option is an age option of a dimension, with the ages parsed from its label
+type Option struct {
+	Code  string
+	Label string
+	Age   Age
+}
+
+// Sort sorts age options from the youngest to the oldest. Options starting at the same age are sorted
+// from the narrowest to the widest, so that "5" comes before "5-9".
+func Sort(opts []Option) {
+	sort.SliceStable(opts, func(i, j int) bool {
+		if opts[i].Age.Youngest != opts[j].Age.Youngest {
+			return opts[i].Age.Youngest < opts[j].Age.Youngest
+		}
+		return opts[i].Age.Oldest < opts[j].Age.Oldest
+	})
+}
+
+// Between returns the codes of the options whose ages are all within the ages of the youngest and oldest labels,
+// so that "18" to "90+" selects every option from 18 up, and "0-4" to "10-14" selects three 5 year bands.
+// False is returned if either label can't be parsed.
+func Between(opts []Option, youngest, oldest string) ([]string, bool) {
+	from, ok := Parse(youngest)
+	if !ok {
+		return nil, false
+	}
+	to, ok := Parse(oldest)
+	if !ok {
+		return nil, false
+	}
+	if from.Youngest > to.Youngest {
+		from, to = to, from
+	}
+
+	var codes []string
+	for _, opt := range opts {
+		if opt.Age.Within(from, to) {
+			codes = append(codes, opt.Code)
+		}
+	}
+	return codes, true
+}
+
+// Band is a group of ages that are selected together, such as "5-9" or "65+"
+type Band struct {
+	Label string
+	Age   Age
+}
+
+// ParseBand returns the band of ages a label stands for, such as "0-15" or "65+"
+func ParseBand(label string) (Band, bool) {
+	a, ok := Parse(label)
+	if !ok {
+		return Band{}, false
+	}
+	return Band{Label: label, Age: a}, true
+}
+
+// Bands returns the bands of the provided number of years that cover the sorted options, starting from a multiple of
+// the width, so that 5 year bands are "0-4", "5-9" and so on. The band holding an open-ended option is open-ended
+// itself, and is the last one. Bands that have no options are left out.
+func Bands(opts []Option, width int) []Band {
+	if len(opts) == 0 || width < 1 {
+		return nil
+	}
+
+	var bands []Band
+	for from := opts[0].Age.Youngest / width * width; from <= opts[len(opts)-1].Age.Youngest; from += width {
+		b := Band{Age: Age{Youngest: from, Oldest: from + width - 1}}
+		for _, opt := range opts {
+			if opt.Age.IsOpenEnded() && opt.Age.Youngest <= b.Age.Oldest {
+				b.Age.Oldest = Unbounded
+			}
+		}
+		if b.Age.IsOpenEnded() {
+			b.Label = strconv.Itoa(from) + "+"
+		} else {
+			b.Label = strconv.Itoa(from) + "-" + strconv.Itoa(b.Age.Oldest)
+		}
+
+		if len(b.Codes(opts)) > 0 {
+			bands = append(bands, b)
+		}
+		if b.Age.IsOpenEnded() {
+			break
+		}
+	}
+	return bands
+}
+
+// Codes returns the codes of the options whose ages are all within the band
+func (b Band) Codes(opts []Option) []string {
+	var codes []string
+	for _, opt := range opts {
+		if opt.Age.Within(b.Age, b.Age) {
+			codes = append(codes, opt.Code)
+		}
+	}
+	return codes
+}
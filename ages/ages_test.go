@@ -0,0 +1,109 @@
+package ages
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Age labels are parsed whatever the codelist they come from", t, func() {
+		for label, expected := range map[string]Age{
+			"5":                      {Youngest: 5, Oldest: 5},
+			"Aged 5":                 {Youngest: 5, Oldest: 5},
+			"5 years":                {Youngest: 5, Oldest: 5},
+			"0-4":                    {Youngest: 0, Oldest: 4},
+			"0 - 4":                  {Youngest: 0, Oldest: 4},
+			"0 to 4":                 {Youngest: 0, Oldest: 4},
+			"Aged 0 to 4 years":      {Youngest: 0, Oldest: 4},
+			"90+":                    {Youngest: 90, Oldest: Unbounded},
+			"Aged 85 and over":       {Youngest: 85, Oldest: Unbounded},
+			"Aged 85 years and over": {Youngest: 85, Oldest: Unbounded},
+			"100 or older":           {Youngest: 100, Oldest: Unbounded},
+			"Under 1":                {Youngest: 0, Oldest: 0},
+			"Aged under 16":          {Youngest: 0, Oldest: 15},
+			"Less than 5 years":      {Youngest: 0, Oldest: 4},
+		} {
+			age, ok := Parse(label)
+			So(ok, ShouldBeTrue)
+			So(age, ShouldResemble, expected)
+		}
+	})
+
+	Convey("Labels that don't stand for ages are not parsed", t, func() {
+		for _, label := range []string{"Total", "All ages", "", "4-0", "Under 0", "Age"} {
+			_, ok := Parse(label)
+			So(ok, ShouldBeFalse)
+		}
+	})
+
+	Convey("Open-ended ages are reported as such", t, func() {
+		age, _ := Parse("90+")
+		So(age.IsOpenEnded(), ShouldBeTrue)
+		age, _ = Parse("90")
+		So(age.IsOpenEnded(), ShouldBeFalse)
+	})
+}
+
+func TestSortAndBetween(t *testing.T) {
+	var opts []Option
+	for code, label := range map[string]string{"a": "90+", "b": "10-14", "c": "Under 1", "d": "5", "e": "5-9", "f": "1-4"} {
+		age, _ := Parse(label)
+		opts = append(opts, Option{Code: code, Label: label, Age: age})
+	}
+	Sort(opts)
+
+	Convey("Age options are sorted from the youngest to the oldest", t, func() {
+		var codes []string
+		for _, opt := range opts {
+			codes = append(codes, opt.Code)
+		}
+		So(codes, ShouldResemble, []string{"c", "f", "d", "e", "b", "a"})
+	})
+
+	Convey("The options within a range of ages are selected, including open-ended ages", t, func() {
+		codes, ok := Between(opts, "5", "90+")
+		So(ok, ShouldBeTrue)
+		So(codes, ShouldResemble, []string{"d", "e", "b", "a"})
+
+		codes, ok = Between(opts, "14", "0")
+		So(ok, ShouldBeTrue)
+		So(codes, ShouldResemble, []string{"c", "f", "d", "e", "b"})
+	})
+
+	Convey("A range with an age that can't be parsed is rejected", t, func() {
+		_, ok := Between(opts, "five", "90+")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestBands(t *testing.T) {
+	var opts []Option
+	for i := 0; i < 90; i++ {
+		opts = append(opts, Option{Code: strconv.Itoa(i), Label: strconv.Itoa(i), Age: Age{Youngest: i, Oldest: i}})
+	}
+	opts = append(opts, Option{Code: "90+", Label: "90+", Age: Age{Youngest: 90, Oldest: Unbounded}})
+
+	Convey("Bands of single year options are computed from multiples of their width, ending with an open-ended band", t, func() {
+		bands := Bands(opts, 10)
+		So(bands, ShouldHaveLength, 10)
+		So(bands[0], ShouldResemble, Band{Label: "0-9", Age: Age{Youngest: 0, Oldest: 9}})
+		So(bands[8].Label, ShouldEqual, "80-89")
+		So(bands[9], ShouldResemble, Band{Label: "90+", Age: Age{Youngest: 90, Oldest: Unbounded}})
+		So(bands[9].Codes(opts), ShouldResemble, []string{"90+"})
+	})
+
+	Convey("Configured bands select the options within them", t, func() {
+		band, ok := ParseBand("16-64")
+		So(ok, ShouldBeTrue)
+		So(band.Codes(opts), ShouldHaveLength, 49)
+
+		band, ok = ParseBand("65+")
+		So(ok, ShouldBeTrue)
+		So(band.Codes(opts), ShouldHaveLength, 26)
+
+		_, ok = ParseBand("working age")
+		So(ok, ShouldBeFalse)
+	})
+}
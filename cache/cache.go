@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache keeps values up to a capacity, for a time to live, evicting the least recently used values once it is full.
+// Each value uses some of the capacity, such as its approximate size in bytes.
+// Callers asking for a value that is being loaded wait for it instead of loading it again, until their own context is done.
+type Cache[V any] struct {
+	capacity int
+	cost     func(V) int
+	used     int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // most recently used entries first
+	inFlight map[string]*call[V]
+	gen      uint64 // incremented by Flush, so that the values loaded before it are not kept
+}
+
+// entry is a value kept by the cache, until it expires
+type entry[V any] struct {
+	key     string
+	value   V
+	cost    int
+	expires time.Time
+}
+
+// call is the loading of a value, shared by all the callers asking for it
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// New returns a cache keeping up to size values for ttl
+func New[V any](size int, ttl time.Duration) *Cache[V] {
+	return NewWithCost(size, ttl, func(V) int { return 1 })
+}
+
+// NewWithCost returns a cache keeping values for ttl until the sum of their costs reaches capacity
+func NewWithCost[V any](capacity int, ttl time.Duration, cost func(V) int) *Cache[V] {
+	return &Cache[V]{
+		capacity: capacity,
+		cost:     cost,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		inFlight: make(map[string]*call[V]),
+	}
+}
+
+// Get returns the value kept for the key, or the value returned by load, which is kept if load doesn't fail.
+// The value is loaded with a context that isn't cancelled along with ctx, as it is shared by all the callers asking for
+// it, so that one of them giving up doesn't fail the others. Callers stop waiting for it once ctx is done.
+func (c *Cache[V]) Get(ctx context.Context, key string, load func(ctx context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[V])
+		if c.now().Before(e.expires) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return e.value, nil
+		}
+		c.remove(el)
+	}
+	cl, ok := c.inFlight[key]
+	if !ok {
+		cl = &call[V]{done: make(chan struct{})}
+		c.inFlight[key] = cl
+		go c.load(context.WithoutCancel(ctx), key, cl, c.gen, load)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.value, cl.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// load loads the value of the call, and keeps it unless the cache was flushed since the call started
+func (c *Cache[V]) load(ctx context.Context, key string, cl *call[V], gen uint64, load func(ctx context.Context) (V, error)) {
+	defer close(cl.done)
+	defer func() {
+		// the value is loaded outside of the callers' goroutines, so a panic is returned to them instead
+		if r := recover(); r != nil {
+			cl.err = fmt.Errorf("failed to load %s: %v", key, r)
+		}
+		c.mu.Lock()
+		if c.inFlight[key] == cl {
+			delete(c.inFlight, key)
+		}
+		if cl.err == nil && gen == c.gen {
+			c.add(key, cl.value)
+		}
+		c.mu.Unlock()
+	}()
+
+	cl.value, cl.err = load(ctx)
+}
+
+// Peek returns the value kept for the key, if it has not expired, without loading it
+func (c *Cache[V]) Peek(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*entry[V])
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Set keeps the value of the key for ttl, replacing the value kept before
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, value)
+}
+
+// Delete forgets the value of the key
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Len returns the number of values kept, including the ones that have expired but are not evicted yet
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Flush forgets all the values. Values being loaded are returned to their callers but not kept.
+func (c *Cache[V]) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.used = 0
+	c.inFlight = make(map[string]*call[V])
+	c.gen++
+}
+
+// add keeps the value of the key, evicting the least recently used values if the cache is full.
+// Values that cost more than the capacity of the cache are not kept.
+func (c *Cache[V]) add(key string, value V) {
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	cost := c.cost(value)
+	if cost > c.capacity {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: value, cost: cost, expires: c.now().Add(c.ttl)})
+	c.used += cost
+	for c.used > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove forgets the entry of the element
+func (c *Cache[V]) remove(el *list.Element) {
+	e := el.Value.(*entry[V])
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.used -= e.cost
+}
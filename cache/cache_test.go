@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// counter returns a load function returning the provided value, and the number of times it was called
+func counter(value string) (func(context.Context) (string, error), *int) {
+	calls := 0
+	return func(context.Context) (string, error) {
+		calls++
+		return value, nil
+	}, &calls
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Given a cache", t, func() {
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		c := New[string](2, time.Minute)
+		c.now = func() time.Time { return now }
+
+		Convey("Then a value is loaded once and kept until it expires", func() {
+			load, calls := counter("a")
+			v, err := c.Get(ctx, "k1", load)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "a")
+			_, _ = c.Get(ctx, "k1", load)
+			So(*calls, ShouldEqual, 1)
+
+			now = now.Add(time.Minute)
+			_, _ = c.Get(ctx, "k1", load)
+			So(*calls, ShouldEqual, 2)
+		})
+
+		Convey("Then the least recently used value is evicted once the cache is full", func() {
+			load1, calls1 := counter("1")
+			load2, calls2 := counter("2")
+			load3, _ := counter("3")
+			_, _ = c.Get(ctx, "k1", load1)
+			_, _ = c.Get(ctx, "k2", load2)
+			_, _ = c.Get(ctx, "k1", load1)
+			_, _ = c.Get(ctx, "k3", load3)
+			So(c.Len(), ShouldEqual, 2)
+
+			_, _ = c.Get(ctx, "k1", load1)
+			So(*calls1, ShouldEqual, 1)
+			_, _ = c.Get(ctx, "k2", load2)
+			So(*calls2, ShouldEqual, 2)
+		})
+
+		Convey("Then errors are returned but not kept", func() {
+			_, err := c.Get(ctx, "k1", func(context.Context) (string, error) { return "", errors.New("load error") })
+			So(err, ShouldNotBeNil)
+			So(c.Len(), ShouldEqual, 0)
+		})
+
+		Convey("Then Flush forgets all the values", func() {
+			load, calls := counter("a")
+			_, _ = c.Get(ctx, "k1", load)
+			c.Flush()
+			So(c.Len(), ShouldEqual, 0)
+			_, _ = c.Get(ctx, "k1", load)
+			So(*calls, ShouldEqual, 2)
+		})
+
+		Convey("Then values set directly are returned by Peek until they expire or are deleted", func() {
+			c.Set("k1", "a")
+			v, ok := c.Peek("k1")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "a")
+
+			c.Delete("k1")
+			_, ok = c.Peek("k1")
+			So(ok, ShouldBeFalse)
+
+			c.Set("k2", "b")
+			now = now.Add(time.Minute)
+			_, ok = c.Peek("k2")
+			So(ok, ShouldBeFalse)
+			So(c.Len(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given a cache limited by the cost of its values, then values are evicted until their costs fit", t, func() {
+		c := NewWithCost(10, time.Minute, func(v string) int { return len(v) })
+		_, _ = c.Get(ctx, "k1", func(context.Context) (string, error) { return "aaaa", nil })
+		_, _ = c.Get(ctx, "k2", func(context.Context) (string, error) { return "bbbb", nil })
+		So(c.Len(), ShouldEqual, 2)
+
+		_, _ = c.Get(ctx, "k3", func(context.Context) (string, error) { return "cccc", nil })
+		So(c.Len(), ShouldEqual, 2)
+		So(c.entries, ShouldNotContainKey, "k1")
+
+		_, _ = c.Get(ctx, "k4", func(context.Context) (string, error) { return "too long to keep", nil })
+		So(c.Len(), ShouldEqual, 2)
+		So(c.entries, ShouldNotContainKey, "k4")
+	})
+
+	Convey("Given concurrent callers asking for a value that is being loaded, then it is only loaded once", t, func() {
+		// the cache doesn't keep any value, so the callers can only get the value from the first caller's load
+		c := New[string](0, time.Minute)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		calls := 0
+		load := func(context.Context) (string, error) {
+			calls++
+			close(started)
+			<-release
+			return "a", nil
+		}
+
+		var wg sync.WaitGroup
+		results := make([]string, 5)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[0], _ = c.Get(ctx, "k1", load)
+		}()
+		<-started
+		for i := 1; i < len(results); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], _ = c.Get(ctx, "k1", load)
+			}()
+		}
+		// give the other callers time to find the value being loaded
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		So(calls, ShouldEqual, 1)
+		So(results, ShouldResemble, []string{"a", "a", "a", "a", "a"})
+	})
+
+	Convey("Given the first caller asking for a value gives up while it is being loaded", t, func() {
+		c := New[string](1, time.Minute)
+		release := make(chan struct{})
+		started := make(chan struct{})
+		loadErr := make(chan error, 1)
+		load := func(ctx context.Context) (string, error) {
+			close(started)
+			<-release
+			loadErr <- ctx.Err()
+			return "a", nil
+		}
+
+		firstCtx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			_, err := c.Get(firstCtx, "k1", load)
+			first <- err
+		}()
+		<-started
+		waiting := make(chan string, 1)
+		go func() {
+			v, _ := c.Get(ctx, "k1", load)
+			waiting <- v
+		}()
+		cancel()
+
+		Convey("Then it stops waiting, while the value is still loaded for the other callers and kept", func() {
+			So(<-first, ShouldEqual, context.Canceled)
+			close(release)
+			So(<-loadErr, ShouldBeNil)
+			So(<-waiting, ShouldEqual, "a")
+			v, ok := c.Peek("k1")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "a")
+		})
+	})
+
+	Convey("Given a load that panics, then the callers get an error", t, func() {
+		c := New[string](1, time.Minute)
+		_, err := c.Get(ctx, "k1", func(context.Context) (string, error) { panic("boom") })
+		So(err, ShouldNotBeNil)
+		So(c.Len(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	health "github.com/ONSdigital/dp-healthcheck/healthcheck"
+)
+
+// publishedVersions is the number of versions known to be published that are kept
+const publishedVersions = 10000
+
+// stringHeader is the number of bytes used by a string, besides its content
+const stringHeader = 16
+
+// errUnpublished is returned when a version is not published, so that it isn't kept as a published version
+var errUnpublished = errors.New("version is not published")
+
+// DatasetClient is the client of dataset API whose published versions are cached
+type DatasetClient interface {
+	Checker(ctx context.Context, check *health.CheckState) error
+	Get(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, datasetID string) (m dataset.DatasetDetails, err error)
+	GetVersion(ctx context.Context, userAuthToken, serviceAuthToken, downloadServiceToken, collectionID, datasetID, edition, version string) (m dataset.Version, err error)
+	GetVersionDimensions(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, id, edition, version string) (m dataset.VersionDimensions, err error)
+	GetOptions(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, datasetID, edition, version, dimension string, q *dataset.QueryParams) (m dataset.Options, err error)
+	GetOptionsInBatches(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, id, edition, version, dimension string, batchSize, maxWorkers int) (m dataset.Options, err error)
+	GetOptionsBatchProcess(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, id, edition, version, dimension string, optionIDs *[]string, processBatch dataset.OptionsBatchProcessor, batchSize, maxWorkers int) (err error)
+	GetVersionMetadata(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, datasetID, edition, version string) (m dataset.Metadata, err error)
+	GetEdition(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, datasetID, edition string) (m dataset.Edition, err error)
+}
+
+// Dataset is a DatasetClient that caches the option lists and the dimensions of published versions, which never
+// change. Pages of options are served from the cached option lists. Requests made in a collection are never cached, so that the unpublished content of the collection is
+// always fresh.
+type Dataset struct {
+	DatasetClient
+	versions  *Cache[versionData]
+	published *Cache[bool]
+}
+
+// versionData is the data of a published version kept by the cache: the options of one of its dimensions, or its
+// dimensions
+type versionData struct {
+	options    dataset.Options
+	dimensions dataset.VersionDimensions
+}
+
+// NewDataset returns a DatasetClient caching up to maxBytes of the option lists and dimensions of published versions
+// of the provided client for ttl
+func NewDataset(client DatasetClient, maxBytes int, ttl time.Duration) *Dataset {
+	return &Dataset{
+		DatasetClient: client,
+		versions:      NewWithCost(maxBytes, ttl, versionData.size),
+		published:     New[bool](publishedVersions, ttl),
+	}
+}
+
+// GetVersionDimensions returns the dimensions of a version
+func (d *Dataset) GetVersionDimensions(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, id, edition, version string) (dataset.VersionDimensions, error) {
+	if collectionID != "" || !d.isPublished(ctx, userAuthToken, serviceAuthToken, id, edition, version) {
+		return d.DatasetClient.GetVersionDimensions(ctx, userAuthToken, serviceAuthToken, collectionID, id, edition, version)
+	}
+	v, err := d.versions.Get(ctx, versionKey("dimensions", id, edition, version), func(ctx context.Context) (versionData, error) {
+		dims, err := d.DatasetClient.GetVersionDimensions(ctx, userAuthToken, serviceAuthToken, "", id, edition, version)
+		return versionData{dimensions: dims}, err
+	})
+	// callers sort the dimensions, so they get their own copy
+	dims := v.dimensions
+	dims.Items = slices.Clone(dims.Items)
+	return dims, err
+}
+
+// GetOptionsInBatches returns all the options of a dimension of a version
+func (d *Dataset) GetOptionsInBatches(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, id, edition, version, dimension string, batchSize, maxWorkers int) (dataset.Options, error) {
+	if collectionID != "" || !d.isPublished(ctx, userAuthToken, serviceAuthToken, id, edition, version) {
+		return d.DatasetClient.GetOptionsInBatches(ctx, userAuthToken, serviceAuthToken, collectionID, id, edition, version, dimension, batchSize, maxWorkers)
+	}
+	v, err := d.versions.Get(ctx, versionKey("options", id, edition, version, dimension), func(ctx context.Context) (versionData, error) {
+		opts, err := d.DatasetClient.GetOptionsInBatches(ctx, userAuthToken, serviceAuthToken, "", id, edition, version, dimension, batchSize, maxWorkers)
+		return versionData{options: opts}, err
+	})
+	// callers sort the options, so they get their own copy
+	opts := v.options
+	opts.Items = slices.Clone(opts.Items)
+	return opts, err
+}
+
+// GetOptions returns a page of the options of a dimension of a version, or its options with the provided IDs. They are
+// served from the cached options of the dimension if there are any, otherwise the page itself is cached.
+func (d *Dataset) GetOptions(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, datasetID, edition, version, dimension string, q *dataset.QueryParams) (dataset.Options, error) {
+	if q == nil || collectionID != "" || !d.isPublished(ctx, userAuthToken, serviceAuthToken, datasetID, edition, version) {
+		return d.DatasetClient.GetOptions(ctx, userAuthToken, serviceAuthToken, collectionID, datasetID, edition, version, dimension, q)
+	}
+	if err := q.Validate(); err != nil {
+		return dataset.Options{}, err
+	}
+	if v, ok := d.versions.Peek(versionKey("options", datasetID, edition, version, dimension)); ok {
+		return optionsPage(v.options.Items, q), nil
+	}
+
+	v, err := d.versions.Get(ctx, versionKey("page", datasetID, edition, version, dimension, queryKey(q)), func(ctx context.Context) (versionData, error) {
+		opts, err := d.DatasetClient.GetOptions(ctx, userAuthToken, serviceAuthToken, "", datasetID, edition, version, dimension, q)
+		return versionData{options: opts}, err
+	})
+	opts := v.options
+	opts.Items = slices.Clone(opts.Items)
+	return opts, err
+}
+
+// GetOptionsBatchProcess calls processBatch with the options of a dimension of a version in batches, or with its
+// options with the provided IDs. They are served from the cached options of the dimension, which are requested
+// if all the options are processed. Batches are processed one at a time, until processBatch aborts or fails.
+func (d *Dataset) GetOptionsBatchProcess(ctx context.Context, userAuthToken, serviceAuthToken, collectionID, id, edition, version, dimension string, optionIDs *[]string, processBatch dataset.OptionsBatchProcessor, batchSize, maxWorkers int) error {
+	if collectionID != "" || !d.isPublished(ctx, userAuthToken, serviceAuthToken, id, edition, version) {
+		return d.DatasetClient.GetOptionsBatchProcess(ctx, userAuthToken, serviceAuthToken, collectionID, id, edition, version, dimension, optionIDs, processBatch, batchSize, maxWorkers)
+	}
+
+	var items []dataset.Option
+	if optionIDs == nil {
+		opts, err := d.GetOptionsInBatches(ctx, userAuthToken, serviceAuthToken, "", id, edition, version, dimension, batchSize, maxWorkers)
+		if err != nil {
+			return err
+		}
+		items = opts.Items
+	} else {
+		// options with IDs are only served from the cache, as they are usually a few of a large codelist
+		v, ok := d.versions.Peek(versionKey("options", id, edition, version, dimension))
+		if !ok {
+			return d.DatasetClient.GetOptionsBatchProcess(ctx, userAuthToken, serviceAuthToken, "", id, edition, version, dimension, optionIDs, processBatch, batchSize, maxWorkers)
+		}
+		items = withIDs(v.options.Items, *optionIDs)
+	}
+
+	if batchSize <= 0 {
+		batchSize = max(len(items), 1)
+	}
+	for offset := 0; offset < len(items); offset += batchSize {
+		b := slices.Clone(items[offset:min(offset+batchSize, len(items))])
+		abort, err := processBatch(dataset.Options{Items: b, Count: len(b), Offset: offset, Limit: batchSize, TotalCount: len(items)})
+		if err != nil {
+			return err
+		}
+		if abort {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Flush forgets all the cached versions
+func (d *Dataset) Flush() {
+	d.versions.Flush()
+	d.published.Flush()
+}
+
+// isPublished returns true if the version is published. Versions found to be published are kept, as they can't be
+// unpublished, while the others are checked again every time. Versions that can't be checked are not cached.
+func (d *Dataset) isPublished(ctx context.Context, userAuthToken, serviceAuthToken, id, edition, version string) bool {
+	published, err := d.published.Get(ctx, versionKey("published", id, edition, version), func(ctx context.Context) (bool, error) {
+		v, err := d.DatasetClient.GetVersion(ctx, userAuthToken, serviceAuthToken, "", "", id, edition, version)
+		if err != nil {
+			return false, err
+		}
+		if v.State != dataset.StatePublished.String() {
+			return false, errUnpublished
+		}
+		return true, nil
+	})
+	return err == nil && published
+}
+
+// optionsPage returns the page of the options requested by the query, as dataset API would
+func optionsPage(items []dataset.Option, q *dataset.QueryParams) dataset.Options {
+	if len(q.IDs) > 0 {
+		page := withIDs(items, q.IDs)
+		return dataset.Options{Items: page, Count: len(page), Limit: len(page), TotalCount: len(page)}
+	}
+	start := min(q.Offset, len(items))
+	page := slices.Clone(items[start:min(start+q.Limit, len(items))])
+	return dataset.Options{Items: page, Count: len(page), Offset: q.Offset, Limit: q.Limit, TotalCount: len(items)}
+}
+
+// withIDs returns a copy of the options with the provided IDs, in the order of the codelist. The IDs are query
+// escaped, as dataset API expects them to be, so they're unescaped before being compared to the option codes.
+func withIDs(items []dataset.Option, ids []string) []dataset.Option {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if code, err := url.QueryUnescape(id); err == nil {
+			id = code
+		}
+		wanted[id] = true
+	}
+	found := make([]dataset.Option, 0, len(ids))
+	for i := range items {
+		if wanted[items[i].Option] {
+			found = append(found, items[i])
+		}
+	}
+	return found
+}
+
+// queryKey returns the part of the key of a page of options in the cache identifying the query
+func queryKey(q *dataset.QueryParams) string {
+	if len(q.IDs) > 0 {
+		return "ids=" + strings.Join(q.IDs, ",")
+	}
+	return fmt.Sprintf("offset=%d&limit=%d", q.Offset, q.Limit)
+}
+
+// versionKey returns the key of the data of a version in the cache
+func versionKey(kind string, parts ...string) string {
+	return kind + ":" + strings.Join(parts, "/")
+}
+
+// size returns the approximate number of bytes used by the data
+func (v versionData) size() int {
+	n := 0
+	for _, opt := range v.options.Items {
+		n += stringsSize(opt.DimensionID, opt.Label, opt.Option) + linksSize(opt.Links)
+	}
+	for _, dim := range v.dimensions.Items {
+		n += stringsSize(dim.ID, dim.Name, dim.Description, dim.Label, dim.URL, dim.Variable, dim.QualityStatementText, dim.QualityStatementURL) +
+			linksSize(dim.Links) + 16 // number of options and area type flag
+	}
+	return n
+}
+
+// linksSize returns the number of bytes used by the links of a dataset API resource
+func linksSize(l dataset.Links) int {
+	n := 0
+	for _, link := range []dataset.Link{l.AccessRights, l.Dataset, l.Dimensions, l.Edition, l.Editions, l.LatestVersion, l.Versions,
+		l.Self, l.CodeList, l.Options, l.Version, l.Code, l.Taxonomy, l.Job} {
+		n += stringsSize(link.URL, link.ID)
+	}
+	return n
+}
+
+// stringsSize returns the number of bytes used by the strings
+func stringsSize(ss ...string) int {
+	n := 0
+	for _, s := range ss {
+		n += stringHeader + len(s)
+	}
+	return n
+}
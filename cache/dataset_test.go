@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeDataset counts the calls made to dataset API, serving versions in the provided states
+type fakeDataset struct {
+	DatasetClient
+	states map[string]string
+	calls  map[string]int
+}
+
+func (f *fakeDataset) GetVersion(_ context.Context, _, _, _, _, datasetID, edition, version string) (dataset.Version, error) {
+	f.calls["version"]++
+	state, ok := f.states[datasetID+"/"+edition+"/"+version]
+	if !ok {
+		return dataset.Version{}, errors.New("version not found")
+	}
+	return dataset.Version{State: state}, nil
+}
+
+func (f *fakeDataset) GetVersionDimensions(_ context.Context, _, _, collectionID, _, _, _ string) (dataset.VersionDimensions, error) {
+	f.calls["dimensions"+collectionID]++
+	return dataset.VersionDimensions{Items: dataset.VersionDimensionItems{{Name: "time"}, {Name: "geography"}}}, nil
+}
+
+func (f *fakeDataset) GetOptionsInBatches(_ context.Context, _, _, collectionID, _, _, _, dimension string, _, _ int) (dataset.Options, error) {
+	f.calls["options"+collectionID]++
+	if dimension == "age" {
+		return dataset.Options{Items: []dataset.Option{{Option: "90+"}, {Option: "all ages"}, {Option: "0"}}, TotalCount: 3}, nil
+	}
+	return dataset.Options{Items: []dataset.Option{{Option: dimension + "-b"}, {Option: dimension + "-a"}}, TotalCount: 2}, nil
+}
+
+func (f *fakeDataset) GetOptions(_ context.Context, _, _, collectionID, _, _, _, dimension string, q *dataset.QueryParams) (dataset.Options, error) {
+	f.calls["page"+collectionID]++
+	return dataset.Options{Items: []dataset.Option{{Option: dimension + "-b"}}, Count: 1, Limit: q.Limit, TotalCount: 2}, nil
+}
+
+func (f *fakeDataset) GetOptionsBatchProcess(_ context.Context, _, _, collectionID, _, _, _, _ string, _ *[]string, _ dataset.OptionsBatchProcessor, _, _ int) error {
+	f.calls["batches"+collectionID]++
+	return nil
+}
+
+func TestDataset(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Given a cached dataset client", t, func() {
+		client := &fakeDataset{
+			states: map[string]string{"cpih01/time-series/1": "published", "cpih01/time-series/2": "associated"},
+			calls:  map[string]int{},
+		}
+		d := NewDataset(client, 1<<20, time.Hour)
+
+		Convey("Then the options and dimensions of a published version are only requested once", func() {
+			for i := 0; i < 3; i++ {
+				opts, err := d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+				So(err, ShouldBeNil)
+				So(opts.Items, ShouldResemble, []dataset.Option{{Option: "geography-b"}, {Option: "geography-a"}})
+				dims, err := d.GetVersionDimensions(ctx, "", "", "", "cpih01", "time-series", "1")
+				So(err, ShouldBeNil)
+				So(dims.Items, ShouldHaveLength, 2)
+			}
+			So(client.calls, ShouldResemble, map[string]int{"version": 1, "options": 1, "dimensions": 1})
+		})
+
+		Convey("Then sorting the returned options doesn't change the cached options", func() {
+			opts, _ := d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+			opts.Items[0], opts.Items[1] = opts.Items[1], opts.Items[0]
+			opts, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+			So(opts.Items[0].Option, ShouldEqual, "geography-b")
+		})
+
+		Convey("Then requests made in a collection are never cached", func() {
+			for i := 0; i < 2; i++ {
+				_, _ = d.GetOptionsInBatches(ctx, "", "", "collection1", "cpih01", "time-series", "1", "geography", 100, 10)
+				_, _ = d.GetVersionDimensions(ctx, "", "", "collection1", "cpih01", "time-series", "1")
+			}
+			So(client.calls, ShouldResemble, map[string]int{"optionscollection1": 2, "dimensionscollection1": 2})
+		})
+
+		Convey("Then unpublished versions, or versions that can't be checked, are not cached", func() {
+			for i := 0; i < 2; i++ {
+				_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "2", "geography", 100, 10)
+				_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "3", "geography", 100, 10)
+			}
+			So(client.calls, ShouldResemble, map[string]int{"version": 4, "options": 4})
+		})
+
+		Convey("Then pages of options are served from the cached options of the dimension", func() {
+			_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+
+			opts, err := d.GetOptions(ctx, "", "", "", "cpih01", "time-series", "1", "geography", &dataset.QueryParams{Offset: 1, Limit: 5})
+			So(err, ShouldBeNil)
+			So(opts, ShouldResemble, dataset.Options{Items: []dataset.Option{{Option: "geography-a"}}, Count: 1, Offset: 1, Limit: 5, TotalCount: 2})
+
+			opts, err = d.GetOptions(ctx, "", "", "", "cpih01", "time-series", "1", "geography", &dataset.QueryParams{IDs: []string{"geography-a", "unknown"}})
+			So(err, ShouldBeNil)
+			So(opts.Items, ShouldResemble, []dataset.Option{{Option: "geography-a"}})
+			So(opts.TotalCount, ShouldEqual, 1)
+			So(client.calls, ShouldResemble, map[string]int{"version": 1, "options": 1})
+		})
+
+		Convey("Then pages of options that aren't cached yet are requested once and kept", func() {
+			for i := 0; i < 2; i++ {
+				opts, err := d.GetOptions(ctx, "", "", "", "cpih01", "time-series", "1", "geography", &dataset.QueryParams{Offset: 0, Limit: 1})
+				So(err, ShouldBeNil)
+				So(opts.TotalCount, ShouldEqual, 2)
+			}
+			So(client.calls, ShouldResemble, map[string]int{"version": 1, "page": 1})
+		})
+
+		Convey("Then all the options of a dimension are processed in batches of the cached options", func() {
+			var batches []dataset.Options
+			processBatch := func(b dataset.Options) (bool, error) {
+				batches = append(batches, b)
+				return false, nil
+			}
+			for i := 0; i < 2; i++ {
+				So(d.GetOptionsBatchProcess(ctx, "", "", "", "cpih01", "time-series", "1", "geography", nil, processBatch, 1, 10), ShouldBeNil)
+			}
+			So(batches, ShouldHaveLength, 4)
+			So(batches[1], ShouldResemble, dataset.Options{Items: []dataset.Option{{Option: "geography-a"}}, Count: 1, Offset: 1, Limit: 1, TotalCount: 2})
+			So(client.calls, ShouldResemble, map[string]int{"version": 1, "options": 1})
+
+			Convey("And options with IDs are processed from the cached options too", func() {
+				batches = nil
+				ids := []string{"geography-a"}
+				So(d.GetOptionsBatchProcess(ctx, "", "", "", "cpih01", "time-series", "1", "geography", &ids, processBatch, 10, 10), ShouldBeNil)
+				So(batches, ShouldResemble, []dataset.Options{{Items: []dataset.Option{{Option: "geography-a"}}, Count: 1, Limit: 10, TotalCount: 1}})
+				So(client.calls, ShouldResemble, map[string]int{"version": 1, "options": 1})
+			})
+		})
+
+		Convey("Then options with IDs are matched to the cached options once unescaped, as they are sent to dataset API", func() {
+			_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "age", 100, 10)
+
+			var batches []dataset.Options
+			processBatch := func(b dataset.Options) (bool, error) {
+				batches = append(batches, b)
+				return false, nil
+			}
+			ids := []string{url.QueryEscape("all ages"), url.QueryEscape("90+")}
+			So(d.GetOptionsBatchProcess(ctx, "", "", "", "cpih01", "time-series", "1", "age", &ids, processBatch, 10, 10), ShouldBeNil)
+			So(batches, ShouldResemble, []dataset.Options{{Items: []dataset.Option{{Option: "90+"}, {Option: "all ages"}}, Count: 2, Limit: 10, TotalCount: 2}})
+
+			opts, err := d.GetOptions(ctx, "", "", "", "cpih01", "time-series", "1", "age", &dataset.QueryParams{IDs: ids})
+			So(err, ShouldBeNil)
+			So(opts.Items, ShouldResemble, []dataset.Option{{Option: "90+"}, {Option: "all ages"}})
+			So(client.calls, ShouldResemble, map[string]int{"version": 1, "options": 1})
+		})
+
+		Convey("Then options with IDs are requested from dataset API while the options of the dimension aren't cached", func() {
+			ids := []string{"geography-a"}
+			So(d.GetOptionsBatchProcess(ctx, "", "", "", "cpih01", "time-series", "1", "geography", &ids, nil, 10, 10), ShouldBeNil)
+			So(client.calls, ShouldResemble, map[string]int{"version": 1, "batches": 1})
+		})
+
+		Convey("Then flushed versions are requested again", func() {
+			_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+			d.Flush()
+			_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+			So(client.calls, ShouldResemble, map[string]int{"version": 2, "options": 2})
+		})
+	})
+
+	Convey("Given a dataset cache smaller than the options of a dimension, then the options are not kept", t, func() {
+		client := &fakeDataset{states: map[string]string{"cpih01/time-series/1": "published"}, calls: map[string]int{}}
+		d := NewDataset(client, 100, time.Hour)
+		for i := 0; i < 2; i++ {
+			_, _ = d.GetOptionsInBatches(ctx, "", "", "", "cpih01", "time-series", "1", "geography", 100, 10)
+		}
+		So(client.calls["options"], ShouldEqual, 2)
+		So(d.versions.Len(), ShouldEqual, 0)
+	})
+}
+
+func TestVersionDataSize(t *testing.T) {
+	Convey("The size of the data of a version grows with its options", t, func() {
+		one := versionData{options: dataset.Options{Items: []dataset.Option{{Option: "a", Label: "A"}}}}
+		two := versionData{options: dataset.Options{Items: []dataset.Option{{Option: "a", Label: "A"}, {Option: "b", Label: "Label of b"}}}}
+		So(one.size(), ShouldBeGreaterThan, 0)
+		So(two.size(), ShouldBeGreaterThan, 2*one.size())
+	})
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
+	health "github.com/ONSdigital/dp-healthcheck/healthcheck"
+)
+
+// HierarchyClient is the client of hierarchy API whose nodes are cached
+type HierarchyClient interface {
+	Checker(ctx context.Context, check *health.CheckState) error
+	GetRoot(ctx context.Context, instanceID, name string) (hierarchy.Model, error)
+	GetChild(ctx context.Context, instanceID, name, code string) (hierarchy.Model, error)
+}
+
+// Hierarchy is a HierarchyClient that caches the nodes returned by hierarchy API, which never change for an instance
+type Hierarchy struct {
+	HierarchyClient
+	nodes *Cache[hierarchy.Model]
+}
+
+// NewHierarchy returns a HierarchyClient caching up to size nodes of the provided client for ttl
+func NewHierarchy(client HierarchyClient, size int, ttl time.Duration) *Hierarchy {
+	return &Hierarchy{
+		HierarchyClient: client,
+		nodes:           New[hierarchy.Model](size, ttl),
+	}
+}
+
+// GetRoot returns the root node of the named hierarchy of an instance
+func (h *Hierarchy) GetRoot(ctx context.Context, instanceID, name string) (hierarchy.Model, error) {
+	m, err := h.nodes.Get(ctx, nodeKey(instanceID, name, ""), func(ctx context.Context) (hierarchy.Model, error) {
+		return h.HierarchyClient.GetRoot(ctx, instanceID, name)
+	})
+	return cloneModel(m), err
+}
+
+// GetChild returns the node with the provided code in the named hierarchy of an instance
+func (h *Hierarchy) GetChild(ctx context.Context, instanceID, name, code string) (hierarchy.Model, error) {
+	m, err := h.nodes.Get(ctx, nodeKey(instanceID, name, code), func(ctx context.Context) (hierarchy.Model, error) {
+		return h.HierarchyClient.GetChild(ctx, instanceID, name, code)
+	})
+	return cloneModel(m), err
+}
+
+// Flush forgets all the cached nodes
+func (h *Hierarchy) Flush() {
+	h.nodes.Flush()
+}
+
+// nodeKey returns the key of a node in the cache. Roots have an empty code.
+func nodeKey(instanceID, name, code string) string {
+	return strings.Join([]string{instanceID, name, code}, "/")
+}
+
+// cloneModel returns a copy of a cached node, so that callers appending to its children don't change the cached node
+func cloneModel(m hierarchy.Model) hierarchy.Model {
+	m.Children = slices.Clone(m.Children)
+	m.Breadcrumbs = slices.Clone(m.Breadcrumbs)
+	return m
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
+	health "github.com/ONSdigital/dp-healthcheck/healthcheck"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeHierarchy counts the calls made to hierarchy API for each node
+type fakeHierarchy struct {
+	calls map[string]int
+}
+
+func (f *fakeHierarchy) Checker(context.Context, *health.CheckState) error { return nil }
+
+func (f *fakeHierarchy) GetRoot(_ context.Context, instanceID, name string) (hierarchy.Model, error) {
+	f.calls[instanceID+"/"+name]++
+	return hierarchy.Model{Label: "root", Children: make([]hierarchy.Child, 1, 4)}, nil
+}
+
+func (f *fakeHierarchy) GetChild(_ context.Context, instanceID, name, code string) (hierarchy.Model, error) {
+	f.calls[instanceID+"/"+name+"/"+code]++
+	return hierarchy.Model{Label: code}, nil
+}
+
+func TestHierarchy(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("Given a cached hierarchy client", t, func() {
+		client := &fakeHierarchy{calls: map[string]int{}}
+		h := NewHierarchy(client, 10, time.Hour)
+
+		Convey("Then each node is only requested once per instance, name and code", func() {
+			for i := 0; i < 3; i++ {
+				_, err := h.GetRoot(ctx, "inst1", "geography")
+				So(err, ShouldBeNil)
+				m, err := h.GetChild(ctx, "inst1", "geography", "E92000001")
+				So(err, ShouldBeNil)
+				So(m.Label, ShouldEqual, "E92000001")
+			}
+			_, _ = h.GetRoot(ctx, "inst2", "geography")
+
+			So(client.calls, ShouldResemble, map[string]int{
+				"inst1/geography":           1,
+				"inst1/geography/E92000001": 1,
+				"inst2/geography":           1,
+			})
+		})
+
+		Convey("Then appending to the children of a node doesn't change the cached node", func() {
+			m, _ := h.GetRoot(ctx, "inst1", "geography")
+			m.Children = append(m.Children, hierarchy.Child{Label: "appended"})
+			m2, _ := h.GetRoot(ctx, "inst1", "geography")
+			m2.Children = append(m2.Children, hierarchy.Child{Label: "other"})
+			So(m.Children[1].Label, ShouldEqual, "appended")
+			So(m2.Children[1].Label, ShouldEqual, "other")
+		})
+
+		Convey("Then flushed nodes are requested again", func() {
+			_, _ = h.GetRoot(ctx, "inst1", "geography")
+			h.Flush()
+			_, _ = h.GetRoot(ctx, "inst1", "geography")
+			So(client.calls["inst1/geography"], ShouldEqual, 2)
+		})
+	})
+}
@@ -8,23 +8,42 @@ import (
 
 // Config represents service configuration for dp-frontend-filter-dataset-controller
 type Config struct {
+	AgeBands                   []string      `envconfig:"AGE_BANDS"`
 	APIRouterURL               string        `envconfig:"API_ROUTER_URL"`
 	BatchMaxWorkers            int           `envconfig:"BATCH_MAX_WORKERS"`
 	BatchSizeLimit             int           `envconfig:"BATCH_SIZE_LIMIT"`
 	BindAddr                   string        `envconfig:"BIND_ADDR"`
+	DatasetCacheSizeMB         int           `envconfig:"DATASET_CACHE_SIZE_MB"`
+	DatasetCacheTTL            time.Duration `envconfig:"DATASET_CACHE_TTL"`
 	Debug                      bool          `envconfig:"DEBUG"`
 	DownloadServiceURL         string        `envconfig:"DOWNLOAD_SERVICE_URL"`
 	EnableDatasetPreview       bool          `envconfig:"ENABLE_DATASET_PREVIEW"`
 	EnableProfiler             bool          `envconfig:"ENABLE_PROFILER"`
 	FeedbackAPIURL             string        `envconfig:"FEEDBACK_API_URL"`
+	FilterRetryAttempts        int           `envconfig:"FILTER_RETRY_ATTEMPTS"`
+	FilterRetryBackoff         time.Duration `envconfig:"FILTER_RETRY_BACKOFF"`
 	GracefulShutdownTimeout    time.Duration `envconfig:"GRACEFUL_SHUTDOWN_TIMEOUT"`
 	HealthCheckCriticalTimeout time.Duration `envconfig:"HEALTHCHECK_CRITICAL_TIMEOUT"`
 	HealthCheckInterval        time.Duration `envconfig:"HEALTHCHECK_INTERVAL"`
+	HierarchyCacheSize         int           `envconfig:"HIERARCHY_CACHE_SIZE"`
+	HierarchyCacheTTL          time.Duration `envconfig:"HIERARCHY_CACHE_TTL"`
+	HierarchyFlatteningPath    string        `envconfig:"HIERARCHY_FLATTENING_PATH"`
 	MaxDatasetOptions          int           `envconfig:"MAX_DATASET_OPTIONS"`
+	MaxUploadSizeMB            int           `envconfig:"MAX_UPLOAD_SIZE_MB"`
+	OrdinalDimensions          []string      `envconfig:"ORDINAL_DIMENSIONS"`
 	PatternLibraryAssetsPath   string        `envconfig:"PATTERN_LIBRARY_ASSETS_PATH"`
 	PprofToken                 string        `envconfig:"PPROF_TOKEN" json:"-"`
+	RelativeTimeMaxFilters     int           `envconfig:"RELATIVE_TIME_MAX_FILTERS"`
+	RelativeTimePath           string        `envconfig:"RELATIVE_TIME_PATH"`
+	RelativeTimeStore          string        `envconfig:"RELATIVE_TIME_STORE"`
+	RelativeTimeTTL            time.Duration `envconfig:"RELATIVE_TIME_TTL"`
 	SearchAPIAuthToken         string        `envconfig:"SEARCH_API_AUTH_TOKEN"  json:"-"`
 	SiteDomain                 string        `envconfig:"SITE_DOMAIN"`
+	UndoHistoryLimit           int           `envconfig:"UNDO_HISTORY_LIMIT"`
+	UndoHistoryMaxFilters      int           `envconfig:"UNDO_HISTORY_MAX_FILTERS"`
+	UndoHistoryPath            string        `envconfig:"UNDO_HISTORY_PATH"`
+	UndoHistoryStore           string        `envconfig:"UNDO_HISTORY_STORE"`
+	UndoHistoryTTL             time.Duration `envconfig:"UNDO_HISTORY_TTL"`
 	OTExporterOTLPEndpoint     string        `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 	OTServiceName              string        `envconfig:"OTEL_SERVICE_NAME"`
 	OTBatchTimeout             time.Duration `envconfig:"OTEL_BATCH_TIMEOUT"`
@@ -55,20 +74,39 @@ func get() (*Config, error) {
 	}
 
 	cfg = &Config{
+		AgeBands:                   []string{"0-15", "16-64", "65+"},
 		APIRouterURL:               "http://localhost:23200/v1",
 		BatchMaxWorkers:            100,
 		BatchSizeLimit:             1000,
 		BindAddr:                   "localhost:20001",
+		DatasetCacheSizeMB:         64,
+		DatasetCacheTTL:            time.Hour,
 		Debug:                      false,
 		DownloadServiceURL:         "http://localhost:23600",
 		EnableDatasetPreview:       false,
 		EnableProfiler:             false,
 		FeedbackAPIURL:             "http://localhost:23200/v1/feedback",
+		FilterRetryAttempts:        3,
+		FilterRetryBackoff:         50 * time.Millisecond,
 		GracefulShutdownTimeout:    5 * time.Second,
 		HealthCheckCriticalTimeout: 90 * time.Second,
 		HealthCheckInterval:        30 * time.Second,
+		HierarchyCacheSize:         1000,
+		HierarchyCacheTTL:          time.Hour,
+		HierarchyFlatteningPath:    "",
 		MaxDatasetOptions:          200,
+		MaxUploadSizeMB:            5,
+		OrdinalDimensions:          []string{},
+		RelativeTimeMaxFilters:     10000,
+		RelativeTimePath:           "",
+		RelativeTimeStore:          "memory",
+		RelativeTimeTTL:            30 * 24 * time.Hour,
 		SiteDomain:                 "localhost",
+		UndoHistoryLimit:           10,
+		UndoHistoryMaxFilters:      10000,
+		UndoHistoryPath:            "",
+		UndoHistoryStore:           "memory",
+		UndoHistoryTTL:             24 * time.Hour,
 		OTExporterOTLPEndpoint:     "localhost:4317",
 		OTServiceName:              "dp-frontend-filter-dataset-controller",
 		OTBatchTimeout:             5 * time.Second,
@@ -17,20 +17,39 @@ func TestConfig(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 			Convey("Then the values should be set to the expected defaults", func() {
+				So(cfg.AgeBands, ShouldResemble, []string{"0-15", "16-64", "65+"})
 				So(cfg.APIRouterURL, ShouldEqual, "http://localhost:23200/v1")
 				So(cfg.BatchMaxWorkers, ShouldEqual, 100)
 				So(cfg.BatchSizeLimit, ShouldEqual, 1000)
 				So(cfg.BindAddr, ShouldEqual, "localhost:20001")
+				So(cfg.DatasetCacheSizeMB, ShouldEqual, 64)
+				So(cfg.DatasetCacheTTL, ShouldEqual, time.Hour)
 				So(cfg.Debug, ShouldBeFalse)
 				So(cfg.DownloadServiceURL, ShouldEqual, "http://localhost:23600")
 				So(cfg.EnableDatasetPreview, ShouldBeFalse)
 				So(cfg.EnableProfiler, ShouldBeFalse)
+				So(cfg.FilterRetryAttempts, ShouldEqual, 3)
+				So(cfg.FilterRetryBackoff, ShouldEqual, 50*time.Millisecond)
 				So(cfg.GracefulShutdownTimeout, ShouldEqual, 5*time.Second)
 				So(cfg.HealthCheckCriticalTimeout, ShouldEqual, 90*time.Second)
 				So(cfg.HealthCheckInterval, ShouldEqual, 30*time.Second)
+				So(cfg.HierarchyCacheSize, ShouldEqual, 1000)
+				So(cfg.HierarchyCacheTTL, ShouldEqual, time.Hour)
+				So(cfg.HierarchyFlatteningPath, ShouldEqual, "")
 				So(cfg.MaxDatasetOptions, ShouldEqual, 200)
+				So(cfg.MaxUploadSizeMB, ShouldEqual, 5)
+				So(cfg.OrdinalDimensions, ShouldBeEmpty)
 				So(cfg.PatternLibraryAssetsPath, ShouldEqual, "//cdn.ons.gov.uk/dp-design-system/f3e1909")
+				So(cfg.RelativeTimeMaxFilters, ShouldEqual, 10000)
+				So(cfg.RelativeTimePath, ShouldBeEmpty)
+				So(cfg.RelativeTimeStore, ShouldEqual, "memory")
+				So(cfg.RelativeTimeTTL, ShouldEqual, 30*24*time.Hour)
 				So(cfg.SiteDomain, ShouldEqual, "localhost")
+				So(cfg.UndoHistoryLimit, ShouldEqual, 10)
+				So(cfg.UndoHistoryMaxFilters, ShouldEqual, 10000)
+				So(cfg.UndoHistoryPath, ShouldBeEmpty)
+				So(cfg.UndoHistoryStore, ShouldEqual, "memory")
+				So(cfg.UndoHistoryTTL, ShouldEqual, 24*time.Hour)
 				So(cfg.OTExporterOTLPEndpoint, ShouldEqual, "localhost:4317")
 				So(cfg.OTServiceName, ShouldEqual, "dp-frontend-filter-dataset-controller")
 				So(cfg.OTBatchTimeout, ShouldEqual, 5*time.Second)
@@ -26,11 +26,11 @@ func (p TimeSlice) Swap(i, j int) {
 func ConvertToReadable(dates []string) ([]time.Time, error) {
 	readableDates := make([]time.Time, 0, len(dates))
 	for _, val := range dates {
-		date, err := time.Parse("Jan-06", val)
+		period, err := Monthly.Parse(val)
 		if err != nil {
 			return readableDates, err
 		}
-		readableDates = append(readableDates, date)
+		readableDates = append(readableDates, period.Start)
 	}
 
 	return readableDates, nil
@@ -54,7 +54,7 @@ func Sort(dates []time.Time) TimeSlice {
 func ConvertToCoded(dates []time.Time) []string {
 	codedDates := make([]string, 0, len(dates))
 	for _, date := range dates {
-		codedDates = append(codedDates, date.Format("Jan-06"))
+		codedDates = append(codedDates, Monthly.Code(Period{Granularity: Month, Start: date}))
 	}
 
 	return codedDates
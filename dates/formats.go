@@ -0,0 +1,438 @@
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrUnknownFormat is returned when the codes of a time codelist don't match any of the registered formats
+var ErrUnknownFormat = errors.New("unrecognised time format")
+
+// Granularity is the length of the periods in a time codelist
+type Granularity int
+
+// Granularities of the registered formats
+const (
+	Day Granularity = iota + 1
+	Week
+	Month
+	Quarter
+	FinancialYear
+	Year
+)
+
+var granularityNames = map[Granularity]string{
+	Day:           "day",
+	Week:          "week",
+	Month:         "month",
+	Quarter:       "quarter",
+	FinancialYear: "financial year",
+	Year:          "year",
+}
+
+// String returns the name of the granularity as it's shown to users
+func (g Granularity) String() string {
+	return granularityNames[g]
+}
+
+// ParseGranularity returns the granularity with the provided name
+func ParseGranularity(name string) (Granularity, error) {
+	for g, n := range granularityNames {
+		if n == name {
+			return g, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown granularity: %q", name)
+}
+
+// MarshalText writes the granularity as its name, so that it can be stored
+func (g Granularity) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText reads a granularity written by MarshalText
+func (g *Granularity) UnmarshalText(text []byte) (err error) {
+	*g, err = ParseGranularity(string(text))
+	return err
+}
+
+// ChosenByDate returns true if periods are too short to be chosen by year, so they are chosen by date instead
+func (g Granularity) ChosenByDate() bool {
+	return g == Day || g == Week
+}
+
+// Parts returns the names of the groups periods are listed by, in order, such as the months of the year or the
+// days of the week, or nil if periods are a year long
+func (g Granularity) Parts() []string {
+	switch g {
+	case Day:
+		parts := make([]string, 0, 7)
+		for d := time.Monday; d <= time.Saturday; d++ {
+			parts = append(parts, d.String())
+		}
+		return append(parts, time.Sunday.String())
+	case Week:
+		parts := make([]string, 0, 53)
+		for w := 1; w <= 53; w++ {
+			parts = append(parts, fmt.Sprintf("Week %d", w))
+		}
+		return parts
+	case Month:
+		parts := make([]string, 0, 12)
+		for m := time.January; m <= time.December; m++ {
+			parts = append(parts, m.String())
+		}
+		return parts
+	case Quarter:
+		return []string{"Q1", "Q2", "Q3", "Q4"}
+	}
+	return nil
+}
+
+// Period returns the period of the year with the provided part name. The part is ignored for periods a year long
+func (g Granularity) Period(year int, part string) (Period, error) {
+	switch g {
+	case Year, FinancialYear:
+		return newPeriod(g, year, 1), nil
+	case Month, Quarter, Week:
+		if i := slices.Index(g.Parts(), part); i >= 0 {
+			if p := newPeriod(g, year, i+1); p.Year() == year {
+				return p, nil
+			}
+		}
+		return Period{}, fmt.Errorf("%q is not a %s of %d", part, g, year)
+	}
+	return Period{}, fmt.Errorf("%s periods can't be chosen by year", g)
+}
+
+// Containing returns the period that the time falls in
+func (g Granularity) Containing(t time.Time) Period {
+	year, month, day := t.Date()
+	switch g {
+	case Day:
+		return Period{Granularity: g, Start: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+	case Week:
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return Period{Granularity: g, Start: date.AddDate(0, 0, -daysSinceMonday(date))}
+	case Month:
+		return newPeriod(g, year, int(month))
+	case Quarter:
+		return newPeriod(g, year, (int(month)+2)/3)
+	case FinancialYear:
+		if month < time.April {
+			year--
+		}
+		return newPeriod(g, year, 1)
+	}
+	return newPeriod(Year, year, 1)
+}
+
+// daysSinceMonday returns the number of days since the start of the ISO week of the date
+func daysSinceMonday(date time.Time) int {
+	return (int(date.Weekday()) + 6) % 7
+}
+
+// YearLabel returns the year as it's shown to users. Financial years are shown with the year they end in
+func (g Granularity) YearLabel(year int) string {
+	if g == FinancialYear {
+		return fmt.Sprintf("%d-%02d", year, (year+1)%100)
+	}
+	return strconv.Itoa(year)
+}
+
+var yearPrefix = regexp.MustCompile(`^(\d{4})(?:-\d{2})?$`)
+
+// ParseYear returns the year of a label returned by Period.YearLabel
+func ParseYear(label string) (int, error) {
+	m := yearPrefix.FindStringSubmatch(label)
+	if m == nil {
+		return 0, fmt.Errorf("%q is not a year", label)
+	}
+	return strconv.Atoi(m[1])
+}
+
+// Period is a single time option, identified by its granularity and the day it starts on
+type Period struct {
+	Granularity Granularity
+	Start       time.Time
+}
+
+// newPeriod returns the period with the provided 1-based index within the year
+func newPeriod(g Granularity, year, part int) Period {
+	switch g {
+	case Month:
+		return Period{Granularity: g, Start: time.Date(year, time.Month(part), 1, 0, 0, 0, 0, time.UTC)}
+	case Quarter:
+		return Period{Granularity: g, Start: time.Date(year, time.Month(3*part-2), 1, 0, 0, 0, 0, time.UTC)}
+	case Week:
+		// the first ISO week of a year is the one with its 4th of January
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		return Period{Granularity: g, Start: jan4.AddDate(0, 0, 7*(part-1)-daysSinceMonday(jan4))}
+	case FinancialYear:
+		return Period{Granularity: g, Start: time.Date(year, time.April, 1, 0, 0, 0, 0, time.UTC)}
+	}
+	return Period{Granularity: g, Start: time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Year returns the year the period starts in, or the ISO year of weeks
+func (p Period) Year() int {
+	if p.Granularity == Week {
+		year, _ := p.Start.ISOWeek()
+		return year
+	}
+	return p.Start.Year()
+}
+
+// YearLabel returns the year the period belongs to, as it's shown to users
+func (p Period) YearLabel() string {
+	return p.Granularity.YearLabel(p.Year())
+}
+
+// Part returns the name of the period within its year, or an empty string if periods aren't grouped by year
+func (p Period) Part() string {
+	switch p.Granularity {
+	case Month:
+		return p.Start.Month().String()
+	case Quarter:
+		return fmt.Sprintf("Q%d", (int(p.Start.Month())+2)/3)
+	case Week:
+		_, week := p.Start.ISOWeek()
+		return fmt.Sprintf("Week %d", week)
+	case Day:
+		return p.Start.Weekday().String()
+	}
+	return ""
+}
+
+// Label returns the period as it's shown to users
+func (p Period) Label() string {
+	switch p.Granularity {
+	case Day:
+		return p.Start.Format("2 January 2006")
+	case Week, Month, Quarter:
+		return fmt.Sprintf("%s %d", p.Part(), p.Year())
+	}
+	return p.YearLabel()
+}
+
+// End returns the last day of the period
+func (p Period) End() time.Time {
+	switch p.Granularity {
+	case Day:
+		return p.Start
+	case Week:
+		return p.Start.AddDate(0, 0, 6)
+	case Month:
+		return p.Start.AddDate(0, 1, -1)
+	case Quarter:
+		return p.Start.AddDate(0, 3, -1)
+	}
+	return p.Start.AddDate(1, 0, -1)
+}
+
+// Before returns true if the period starts before the other one
+func (p Period) Before(other Period) bool {
+	return p.Start.Before(other.Start)
+}
+
+// Equal returns true if both periods are the same
+func (p Period) Equal(other Period) bool {
+	return p.Granularity == other.Granularity && p.Start.Equal(other.Start)
+}
+
+// Format reads and writes the codes of a time codelist
+type Format interface {
+	// Name identifies the format, for example in the forms of the time page
+	Name() string
+	// Granularity returns the length of the periods of the format
+	Granularity() Granularity
+	// Parse returns the period of a code, or an error if it isn't in this format
+	Parse(code string) (Period, error)
+	// Code returns the code of a period
+	Code(p Period) string
+}
+
+// layoutFormat is a format that can be parsed with a time layout
+type layoutFormat struct {
+	granularity Granularity
+	layout      string
+}
+
+// Layout returns a format for codes written with the provided time layout, which is also the name of the format
+func Layout(g Granularity, layout string) Format {
+	return layoutFormat{granularity: g, layout: layout}
+}
+
+func (f layoutFormat) Name() string             { return f.layout }
+func (f layoutFormat) Granularity() Granularity { return f.granularity }
+func (f layoutFormat) Code(p Period) string     { return p.Start.Format(f.layout) }
+
+func (f layoutFormat) Parse(code string) (Period, error) {
+	t, err := time.Parse(f.layout, code)
+	if err != nil {
+		return Period{}, err
+	}
+	return Period{Granularity: f.granularity, Start: t}, nil
+}
+
+// quarterFormat is a format for quarters, with the year either before or after the quarter
+type quarterFormat struct {
+	yearFirst bool
+}
+
+var (
+	quarterYear = regexp.MustCompile(`^Q([1-4]) (\d{4})$`)
+	yearQuarter = regexp.MustCompile(`^(\d{4}) Q([1-4])$`)
+)
+
+func (f quarterFormat) Granularity() Granularity { return Quarter }
+
+func (f quarterFormat) Name() string {
+	if f.yearFirst {
+		return "2006 Q1"
+	}
+	return "Q1 2006"
+}
+
+func (f quarterFormat) Code(p Period) string {
+	if f.yearFirst {
+		return fmt.Sprintf("%d %s", p.Year(), p.Part())
+	}
+	return p.Label()
+}
+
+func (f quarterFormat) Parse(code string) (Period, error) {
+	var quarter, year string
+	if f.yearFirst {
+		if m := yearQuarter.FindStringSubmatch(code); m != nil {
+			year, quarter = m[1], m[2]
+		}
+	} else if m := quarterYear.FindStringSubmatch(code); m != nil {
+		quarter, year = m[1], m[2]
+	}
+	if year == "" {
+		return Period{}, fmt.Errorf("%q is not a quarter in the format %q", code, f.Name())
+	}
+	y, _ := strconv.Atoi(year)
+	q, _ := strconv.Atoi(quarter)
+	return newPeriod(Quarter, y, q), nil
+}
+
+// weekFormat is the ISO 8601 format for weeks, such as '2006-W01'
+type weekFormat struct{}
+
+var isoWeek = regexp.MustCompile(`^(\d{4})-W(\d{2})$`)
+
+func (f weekFormat) Name() string             { return "2006-W01" }
+func (f weekFormat) Granularity() Granularity { return Week }
+
+func (f weekFormat) Code(p Period) string {
+	year, week := p.Start.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+func (f weekFormat) Parse(code string) (Period, error) {
+	m := isoWeek.FindStringSubmatch(code)
+	if m == nil {
+		return Period{}, fmt.Errorf("%q is not an ISO week", code)
+	}
+	year, _ := strconv.Atoi(m[1])
+	week, _ := strconv.Atoi(m[2])
+	p := newPeriod(Week, year, week)
+	if week < 1 || p.Year() != year {
+		return Period{}, fmt.Errorf("%q is not an ISO week", code)
+	}
+	return p, nil
+}
+
+// financialYearFormat is a format for financial years, written as the year they start in and the last two digits
+// of the year they end in
+type financialYearFormat struct{}
+
+var financialYear = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+
+func (f financialYearFormat) Name() string             { return "2006-07" }
+func (f financialYearFormat) Granularity() Granularity { return FinancialYear }
+func (f financialYearFormat) Code(p Period) string     { return p.YearLabel() }
+
+func (f financialYearFormat) Parse(code string) (Period, error) {
+	m := financialYear.FindStringSubmatch(code)
+	if m == nil {
+		return Period{}, fmt.Errorf("%q is not a financial year", code)
+	}
+	start, _ := strconv.Atoi(m[1])
+	end, _ := strconv.Atoi(m[2])
+	if (start+1)%100 != end {
+		return Period{}, fmt.Errorf("%q is not a financial year", code)
+	}
+	return newPeriod(FinancialYear, start, 1), nil
+}
+
+// Monthly is the format of the monthly codes used by most time series, such as 'Jan-06'
+var Monthly = Layout(Month, "Jan-06")
+
+var registry = []Format{
+	Monthly,
+	Layout(Year, "2006"),
+	quarterFormat{},
+	quarterFormat{yearFirst: true},
+	financialYearFormat{},
+	weekFormat{},
+	Layout(Day, "2006-01-02"),
+}
+
+// Register adds a format to the ones detected in time codelists. Formats are tried in the order they were
+// registered, after the built-in ones, so it should only be called while the service is starting up
+func Register(f Format) {
+	registry = append(registry, f)
+}
+
+// Lookup returns the registered format with the provided name
+func Lookup(name string) (Format, bool) {
+	for _, f := range registry {
+		if f.Name() == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Detect returns the first registered format that all the codes can be parsed with
+func Detect(codes []string) (Format, bool) {
+	if len(codes) == 0 {
+		return nil, false
+	}
+	for _, f := range registry {
+		if parsesAll(f, codes) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func parsesAll(f Format, codes []string) bool {
+	for _, code := range codes {
+		if _, err := f.Parse(code); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Option is a time option of a dimension, with the period it stands for
+type Option struct {
+	Code   string
+	Label  string
+	Period Period
+}
+
+// SortOptions orders the options from the earliest period to the latest one
+func SortOptions(opts []Option) {
+	slices.SortStableFunc(opts, func(a, b Option) int {
+		return a.Period.Start.Compare(b.Period.Start)
+	})
+}
@@ -0,0 +1,166 @@
+package dates
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDetect(t *testing.T) {
+	Convey("Given codelists in each of the built-in formats, then Detect returns the format with the right granularity", t, func() {
+		for _, tc := range []struct {
+			codes       []string
+			name        string
+			granularity Granularity
+		}{
+			{[]string{"Jan-06", "Dec-19"}, "Jan-06", Month},
+			{[]string{"2006", "2019"}, "2006", Year},
+			{[]string{"Q1 2006", "Q4 2019"}, "Q1 2006", Quarter},
+			{[]string{"2006 Q1", "2019 Q4"}, "2006 Q1", Quarter},
+			{[]string{"2006-07", "1999-00"}, "2006-07", FinancialYear},
+			{[]string{"2006-W01", "2019-W52"}, "2006-W01", Week},
+			{[]string{"2006-01-02", "2019-12-31"}, "2006-01-02", Day},
+		} {
+			format, ok := Detect(tc.codes)
+			So(ok, ShouldBeTrue)
+			So(format.Name(), ShouldEqual, tc.name)
+			So(format.Granularity(), ShouldEqual, tc.granularity)
+		}
+	})
+
+	Convey("Given a codelist that mixes formats, then no format is detected", t, func() {
+		_, ok := Detect([]string{"2019", "Q1 2019"})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Given a range of years that isn't a financial year, then no format is detected", t, func() {
+		_, ok := Detect([]string{"2006-09"})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Given an empty codelist, then no format is detected", t, func() {
+		_, ok := Detect(nil)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Given a format registered by the service, then it is detected and can be looked up by name", t, func() {
+		defer func(builtIn []Format) { registry = builtIn }(registry)
+		Register(Layout(Month, "January 2006"))
+
+		format, ok := Detect([]string{"March 2020"})
+		So(ok, ShouldBeTrue)
+		So(format.Name(), ShouldEqual, "January 2006")
+
+		_, ok = Lookup("January 2006")
+		So(ok, ShouldBeTrue)
+	})
+}
+
+func TestFormats(t *testing.T) {
+	Convey("Given a quarter code, then it is parsed to the quarter it stands for and written back the same way", t, func() {
+		format, _ := Lookup("2006 Q1")
+		period, err := format.Parse("2019 Q3")
+		So(err, ShouldBeNil)
+		So(period.Start, ShouldEqual, time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC))
+		So(period.Part(), ShouldEqual, "Q3")
+		So(period.Label(), ShouldEqual, "Q3 2019")
+		So(format.Code(period), ShouldEqual, "2019 Q3")
+	})
+
+	Convey("Given a financial year code, then it starts in April and is shown with the year it ends in", t, func() {
+		format, _ := Lookup("2006-07")
+		period, err := format.Parse("2019-20")
+		So(err, ShouldBeNil)
+		So(period.Start, ShouldEqual, time.Date(2019, time.April, 1, 0, 0, 0, 0, time.UTC))
+		So(period.Part(), ShouldBeEmpty)
+		So(period.Label(), ShouldEqual, "2019-20")
+		So(format.Code(period), ShouldEqual, "2019-20")
+	})
+
+	Convey("Given an ISO date code, then it is shown as a day", t, func() {
+		format, _ := Lookup("2006-01-02")
+		period, err := format.Parse("2020-03-09")
+		So(err, ShouldBeNil)
+		So(period.Label(), ShouldEqual, "9 March 2020")
+		So(period.Part(), ShouldEqual, "Monday")
+	})
+
+	Convey("Given an ISO week code, then it starts on the Monday of the week and keeps its ISO year", t, func() {
+		format, _ := Lookup("2006-W01")
+		period, err := format.Parse("2021-W01")
+		So(err, ShouldBeNil)
+		So(period.Start, ShouldEqual, time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC))
+		So(period.Label(), ShouldEqual, "Week 1 2021")
+		So(format.Code(period), ShouldEqual, "2021-W01")
+
+		period, err = format.Parse("2020-W53")
+		So(err, ShouldBeNil)
+		So(period.End(), ShouldEqual, time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC))
+		So(period.YearLabel(), ShouldEqual, "2020")
+	})
+
+	Convey("Given a week that its year doesn't have, then it isn't an ISO week", t, func() {
+		format, _ := Lookup("2006-W01")
+		_, err := format.Parse("2021-W53")
+		So(err, ShouldNotBeNil)
+		_, err = format.Parse("2021-W00")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestGranularity(t *testing.T) {
+	Convey("Given a month and a year chosen in a form, then Period returns the month", t, func() {
+		year, err := ParseYear("2019")
+		So(err, ShouldBeNil)
+		period, err := Month.Period(year, "May")
+		So(err, ShouldBeNil)
+		So(Monthly.Code(period), ShouldEqual, "May-19")
+	})
+
+	Convey("Given a financial year chosen in a form, then Period returns it whatever the month is", t, func() {
+		year, err := ParseYear("2019-20")
+		So(err, ShouldBeNil)
+		period, err := FinancialYear.Period(year, "Select")
+		So(err, ShouldBeNil)
+		So(period.YearLabel(), ShouldEqual, "2019-20")
+	})
+
+	Convey("Given a part that isn't one of the granularity's, then Period returns an error", t, func() {
+		_, err := Quarter.Period(2019, "May")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given a date picked in a form, then Containing returns the period it falls in", t, func() {
+		daily, _ := Lookup("2006-01-02")
+		weekly, _ := Lookup("2006-W01")
+		date := time.Date(2021, time.January, 2, 15, 4, 0, 0, time.UTC)
+		So(daily.Code(Day.Containing(date)), ShouldEqual, "2021-01-02")
+		So(weekly.Code(Week.Containing(date)), ShouldEqual, "2020-W53")
+		So(Monthly.Code(Month.Containing(date)), ShouldEqual, "Jan-21")
+		So(FinancialYear.Containing(date).YearLabel(), ShouldEqual, "2020-21")
+	})
+
+	Convey("Given daily periods, then they are listed by day of the week from Monday", t, func() {
+		So(Day.Parts(), ShouldResemble, []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"})
+		So(Week.Parts(), ShouldHaveLength, 53)
+		So(Day.ChosenByDate() && Week.ChosenByDate() && !Month.ChosenByDate(), ShouldBeTrue)
+	})
+
+	Convey("Given a year that wasn't chosen, then ParseYear returns an error", t, func() {
+		_, err := ParseYear("Select")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestSortOptions(t *testing.T) {
+	Convey("SortOptions orders options from the earliest period to the latest", t, func() {
+		opts := []Option{
+			{Code: "2020", Period: Period{Granularity: Year, Start: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+			{Code: "2018", Period: Period{Granularity: Year, Start: time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+			{Code: "2019", Period: Period{Granularity: Year, Start: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+		}
+		SortOptions(opts)
+		So([]string{opts[0].Code, opts[1].Code, opts[2].Code}, ShouldResemble, []string{"2018", "2019", "2020"})
+	})
+}
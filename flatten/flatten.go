@@ -0,0 +1,113 @@
+package flatten
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// codes of the geography nodes flattened in a single layer by the default rules
+const (
+	Uk              = "K02000001"
+	GreatBritain    = "K03000001"
+	EnglandAndWales = "K04000001"
+	England         = "E92000001"
+	NorthernIreland = "N92000002"
+	Scotland        = "S92000003"
+	Wales           = "W92000004"
+)
+
+// Rules are the rules flattening the top level of hierarchies, keyed by hierarchy name, such as "geography", or by
+// dataset ID and hierarchy name, such as "cpih01/geography", for the rules that only apply to the hierarchies of a dataset
+type Rules map[string]Rule
+
+// Rule lists the nodes promoted to the top level of a hierarchy, in the order they are shown when the hierarchy
+// doesn't define the order of its nodes
+type Rule []Node
+
+// Node is a node promoted to the top level of a hierarchy. The children of nodes promoted with their children can
+// be browsed by users, while the children of the other nodes are looked into for more nodes to promote.
+type Node struct {
+	Code     string `json:"code"`
+	Children bool   `json:"children,omitempty"`
+}
+
+// Default returns the rules flattening the UK geography hierarchy into Great Britain, England and Wales, and the
+// countries of the UK
+func Default() Rules {
+	return Rules{
+		"geography": {
+			{Code: GreatBritain},
+			{Code: EnglandAndWales},
+			{Code: England, Children: true},
+			{Code: NorthernIreland, Children: true},
+			{Code: Scotland, Children: true},
+			{Code: Wales, Children: true},
+		},
+	}
+}
+
+// Load returns the rules of the JSON file at path, or the default rules if no path is provided
+func Load(path string) (Rules, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	b, err := os.ReadFile(path) //nolint:gosec // the path is provided by the service configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hierarchy flattening rules: %w", err)
+	}
+	rules := Rules{}
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse hierarchy flattening rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Validate returns an error if a rule promotes a node without a code, or the same node twice
+func (r Rules) Validate() error {
+	for key, rule := range r {
+		seen := make(map[string]bool, len(rule))
+		for _, node := range rule {
+			if node.Code == "" {
+				return fmt.Errorf("hierarchy flattening rule %q promotes a node without a code", key)
+			}
+			if seen[node.Code] {
+				return fmt.Errorf("hierarchy flattening rule %q promotes node %s twice", key, node.Code)
+			}
+			seen[node.Code] = true
+		}
+	}
+	return nil
+}
+
+// For returns the rule flattening the named hierarchy of a dataset, preferring the rule of the dataset to the rule
+// of the hierarchy name. Rules without nodes leave the hierarchy as it is, so false is returned for them.
+func (r Rules) For(datasetID, name string) (Rule, bool) {
+	if rule, ok := r[datasetID+"/"+name]; ok && datasetID != "" {
+		return rule, len(rule) > 0
+	}
+	rule := r[name]
+	return rule, len(rule) > 0
+}
+
+// Find returns the node of the rule with the provided code, if the rule promotes it
+func (r Rule) Find(code string) (Node, bool) {
+	for _, node := range r {
+		if node.Code == code {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
+
+// Order returns the position of each promoted node in the rule, keyed by its code
+func (r Rule) Order() map[string]int {
+	order := make(map[string]int, len(r))
+	for i, node := range r {
+		order[node.Code] = i
+	}
+	return order
+}
@@ -0,0 +1,80 @@
+package flatten
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoad(t *testing.T) {
+	Convey("Given no path, then Load returns the default rules", t, func() {
+		rules, err := Load("")
+		So(err, ShouldBeNil)
+		So(rules, ShouldResemble, Default())
+	})
+
+	Convey("Given a file of rules, then Load returns them", t, func() {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		So(os.WriteFile(path, []byte(`{"admin-geography": [{"code": "E12000001"}, {"code": "E06000047", "children": true}]}`), 0o600), ShouldBeNil)
+
+		rules, err := Load(path)
+		So(err, ShouldBeNil)
+		So(rules, ShouldResemble, Rules{
+			"admin-geography": {{Code: "E12000001"}, {Code: "E06000047", Children: true}},
+		})
+	})
+
+	Convey("Given a missing file, or rules that aren't valid, then Load fails", t, func() {
+		dir := t.TempDir()
+		_, err := Load(filepath.Join(dir, "missing.json"))
+		So(err, ShouldNotBeNil)
+
+		for _, content := range []string{`[]`, `{"geography": [{"children": true}]}`, `{"geography": [{"code": "a"}, {"code": "a"}]}`} {
+			path := filepath.Join(dir, "rules.json")
+			So(os.WriteFile(path, []byte(content), 0o600), ShouldBeNil)
+			_, err = Load(path)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestRules(t *testing.T) {
+	rules := Rules{
+		"geography":        {{Code: "a"}, {Code: "b", Children: true}},
+		"cpih01/geography": {{Code: "c", Children: true}},
+		"mid/geography":    {},
+	}
+
+	Convey("The rule of a dataset is preferred to the rule of the hierarchy name", t, func() {
+		rule, ok := rules.For("cpih01", "geography")
+		So(ok, ShouldBeTrue)
+		So(rule, ShouldResemble, Rule{{Code: "c", Children: true}})
+
+		rule, ok = rules.For("other", "geography")
+		So(ok, ShouldBeTrue)
+		So(rule, ShouldResemble, rules["geography"])
+
+		rule, ok = rules.For("", "geography")
+		So(ok, ShouldBeTrue)
+		So(rule, ShouldResemble, rules["geography"])
+	})
+
+	Convey("Hierarchies without a rule, or with a rule without nodes, are not flattened", t, func() {
+		_, ok := rules.For("cpih01", "aggregate")
+		So(ok, ShouldBeFalse)
+		_, ok = rules.For("mid", "geography")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("A rule finds its nodes by code and orders them by position", t, func() {
+		rule := rules["geography"]
+		node, ok := rule.Find("b")
+		So(ok, ShouldBeTrue)
+		So(node, ShouldResemble, Node{Code: "b", Children: true})
+		_, ok = rule.Find("z")
+		So(ok, ShouldBeFalse)
+		So(rule.Order(), ShouldResemble, map[string]int{"a": 0, "b": 1})
+	})
+}
@@ -1,26 +1,25 @@
 package handlers
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
-	"regexp"
-	"sort"
-	"strconv"
-	"strings"
+	"slices"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
-	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 	"github.com/ONSdigital/log.go/v2/log"
 
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/ages"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
 	"github.com/gorilla/mux"
 )
 
-// UpdateAge is a handler which will update age values on a filter job
+// UpdateAge is a handler which will update age values on a filter job. The selection is validated before the filter
+// is changed, and replaces the selected age options at once, so that the existing selection is kept if the submitted
+// one is invalid or can't be saved
 func (f *Filter) UpdateAge() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
 		ctx := req.Context()
@@ -28,243 +27,297 @@ func (f *Filter) UpdateAge() http.HandlerFunc {
 		filterID := vars["filterID"]
 		dimensionName := age
 
-		eTag, err := f.FilterClient.RemoveDimension(ctx, userAccessToken, "", collectionID, filterID, dimensionName, headers.IfMatchAnyETag)
-		if err != nil {
-			log.Error(ctx, "failed to remove dimension", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
-			return
-		}
-		eTag, err = f.FilterClient.AddDimension(ctx, userAccessToken, "", collectionID, filterID, dimensionName, eTag)
-		if err != nil {
-			log.Error(ctx, "failed to add dimension", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
-			return
-		}
-
 		if fErr := req.ParseForm(); fErr != nil {
-			log.Error(ctx, "failed to parse form", fErr, log.Data{"filter_id": filterID, "e_tag": eTag})
-			setStatusCode(req, w, fErr)
+			log.Error(ctx, "failed to parse form", fErr, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, fErr)
 			return
 		}
 
+		eTag := submittedETag(req)
+
 		if req.Form.Get("add-all") != "" {
 			http.Redirect(w, req, fmt.Sprintf("/filters/%s/dimensions/age/add-all", filterID), http.StatusFound)
 			return
 		}
 
 		if req.Form.Get("remove-all") != "" {
-			http.Redirect(w, req, fmt.Sprintf("/filters/%s/dimensions/age/remove-all", filterID), http.StatusFound)
+			http.Redirect(w, req, withETag(fmt.Sprintf("/filters/%s/dimensions/age/remove-all", filterID), eTag), http.StatusFound)
 			return
 		}
 
 		log.Info(ctx, "age-selection", log.Data{dimensionName: req.Form.Get("age-selection")})
-		switch req.Form.Get("age-selection") {
-		case "all":
-			_, err = f.FilterClient.AddDimensionValue(ctx, userAccessToken, "", collectionID, filterID, dimensionName, req.Form.Get("all-ages-option"), eTag)
-			if err != nil {
-				log.Warn(ctx, "failed to add all ages option", log.FormatErrors([]error{err}), log.Data{"age_case": "all"})
-			}
-		case strRange:
-			_, err = f.addAgeRange(filterID, userAccessToken, collectionID, req, eTag)
-			if err != nil {
-				log.Warn(ctx, "failed to add age range", log.FormatErrors([]error{err}), log.Data{"age_case": strRange})
-			}
-		case list:
-			_, err = f.addAgeList(filterID, userAccessToken, collectionID, req, eTag)
-			if err != nil {
-				log.Warn(ctx, "failed to add age list", log.FormatErrors([]error{err}), log.Data{"age_case": list})
-			}
+		options, err := f.ageSelection(ctx, userAccessToken, collectionID, filterID, req.Form)
+		if fieldErr, ok := asFieldError(err); ok {
+			log.Warn(ctx, "invalid age selection", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID, "field": fieldErr.field})
+			f.ageSelector(w, req, lang, collectionID, userAccessToken, req.Form, err)
+			return
+		}
+		if err != nil {
+			log.Error(ctx, "failed to read age selection", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
 		}
 
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, dimensionName)
+		_, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, options, eTag)
+		if isConflict(err) {
+			log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": dimensionName})
+			forgetFilter(ctx, filterID)
+			f.ageSelector(w, req, lang, collectionID, userAccessToken, req.Form, nil)
+			return
+		}
+		if err != nil {
+			log.Error(ctx, "failed to set dimension values", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		forgetFilter(ctx, filterID)
+		rec.commit(ctx)
+
 		redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
 		http.Redirect(w, req, redirectURL, http.StatusFound)
 	})
 }
 
-func (f *Filter) addAgeList(filterID, userAccessToken, collectionID string, req *http.Request, eTag string) (newETag string, err error) {
-	ctx := req.Context()
-	dimensionName := age
+// ageSelection returns the age options chosen in the form, without changing the filter. Invalid choices are
+// returned as a fieldError
+func (f *Filter) ageSelection(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, error) {
+	switch form.Get("age-selection") {
+	case "all":
+		option := form.Get("all-ages-option")
+		if option == "" {
+			return nil, newFieldError("age-selection-latest", "This dataset has no option for all ages")
+		}
+		return []string{option}, nil
+	case strRange:
+		return f.ageRange(ctx, userAccessToken, collectionID, filterID, form)
+	case list:
+		return ageList(form)
+	case bands:
+		return f.ageBandOptions(ctx, userAccessToken, collectionID, filterID, form)
+	}
+	return nil, newFieldError("age-form", "Select how you want to choose the ages")
+}
+
+// ageBandKey is the name of the checkboxes of the bands of ages, whose values are the bands, such as "0-4" or "65+"
+const ageBandKey = "age-band"
 
+// ageFormKeys are the names of the age form fields that are not age options
+var ageFormKeys = []string{formETagKey, "age-selection", ageBandKey, "all-ages-option", "youngest-age", "oldest-age", "youngest", "oldest", "save-and-return", "add-all", "remove-all"}
+
+// ageList returns the age options ticked in the list of the form
+func ageList(form url.Values) ([]string, error) {
+	// the checkboxes of the list are named after the codes of the age options, whatever their labels
 	options := []string{}
-	for k := range req.Form {
-		if _, err = strconv.Atoi(k); err != nil {
-			if !strings.Contains(k, "+") {
-				continue
-			}
+	for k := range form {
+		if slices.Contains(ageFormKeys, k) {
+			continue
 		}
 
 		options = append(options, k)
 	}
 
-	newETag, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, options, eTag)
-	if err != nil {
-		log.Error(ctx, "failed to add dimension options", err)
+	if len(options) == 0 {
+		return nil, newFieldError("multiple-choice-content-list", "Select at least one age")
 	}
-
-	return newETag, nil
+	return options, nil
 }
 
-func (f *Filter) addAgeRange(filterID, userAccessToken, collectionID string, req *http.Request, eTag string) (newETag string, err error) {
-	youngest := req.Form.Get("youngest")
-	oldest := req.Form.Get("oldest")
-
-	reg := regexp.MustCompile(`\d+\+`)
-	ctx := req.Context()
-
-	dimensionName := age
-
-	oldestHasPlus := reg.MatchString(oldest)
-	if oldestHasPlus {
-		oldest = strings.Trim(oldest, "+")
+// ageRange returns the age options within the submitted youngest and oldest ages, which may be any age label
+// such as "18", "0-4" or "90+"
+func (f *Filter) ageRange(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, error) {
+	youngest, oldest := form.Get("youngest"), form.Get("oldest")
+	if _, ok := ages.Parse(youngest); !ok {
+		return nil, newFieldError("age-youngest", "Enter the youngest age, such as 18")
+	}
+	if _, ok := ages.Parse(oldest); !ok {
+		return nil, newFieldError("age-oldest", "Enter the oldest age, such as 65 or 90+")
 	}
 
-	values, labelIDMap, err := f.getDimensionValues(ctx, userAccessToken, collectionID, filterID, dimensionName)
+	opts, err := f.ageOptions(ctx, userAccessToken, collectionID, filterID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	intValues := []int{}
-	for _, val := range values {
-		intVal, err := strconv.Atoi(val)
-		if err != nil {
-			hasPlus := reg.MatchString(val)
-			if hasPlus {
-				val = strings.Trim(oldest, "+")
-				intVal, err = strconv.Atoi(val)
-				if err != nil {
-					break
-				}
-			}
-		}
-
-		intValues = append(intValues, intVal)
+	options, _ := ages.Between(opts, youngest, oldest)
+	if len(options) == 0 {
+		return nil, newFieldError("age-oldest", fmt.Sprintf("There is no data for ages %s to %s", youngest, oldest))
 	}
+	return options, nil
+}
 
-	sort.Ints(intValues)
+// ageBandOptions returns the age options within the submitted bands of ages
+func (f *Filter) ageBandOptions(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, error) {
+	if len(form[ageBandKey]) == 0 {
+		return nil, newFieldError("multiple-choice-content-bands", "Select at least one band of ages")
+	}
 
-	for i, val := range intValues {
-		values[i] = strconv.Itoa(val)
+	opts, err := f.ageOptions(ctx, userAccessToken, collectionID, filterID)
+	if err != nil {
+		return nil, err
 	}
 
-	var isInRange bool
-	var options []string
-	for i, age := range values {
-		if i == len(values)-1 && oldestHasPlus {
-			age += "+"
+	// bands of different sets may overlap, so each option is only added once
+	options := []string{}
+	for _, label := range form[ageBandKey] {
+		band, ok := ages.ParseBand(label)
+		if !ok {
+			return nil, newFieldError("multiple-choice-content-bands", fmt.Sprintf("%s is not a band of ages", label))
 		}
-
-		if youngest == age {
-			isInRange = true
+		for _, code := range band.Codes(opts) {
+			if !slices.Contains(options, code) {
+				options = append(options, code)
+			}
 		}
+	}
+	if len(options) == 0 {
+		return nil, newFieldError("multiple-choice-content-bands", "There is no data for these bands of ages")
+	}
+	return options, nil
+}
 
-		if isInRange {
-			options = append(options, labelIDMap[age])
-		}
+// ageOptions returns the age options of the filter's dataset version sorted from the youngest, leaving out
+// the options that don't stand for ages, such as "Total"
+func (f *Filter) ageOptions(ctx context.Context, userAccessToken, collectionID, filterID string) ([]ages.Option, error) {
+	values, labelIDMap, err := f.getDimensionValues(ctx, userAccessToken, collectionID, filterID, age)
+	if err != nil {
+		return nil, err
+	}
 
-		if oldest == age {
-			isInRange = false
+	var opts []ages.Option
+	for _, label := range values {
+		if a, ok := ages.Parse(label); ok {
+			opts = append(opts, ages.Option{Code: labelIDMap[label], Label: label, Age: a})
 		}
 	}
-	return f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, options, eTag)
+	ages.Sort(opts)
+	return opts, nil
 }
 
 // Age is a handler which will create age values on a filter job
 func (f *Filter) Age() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
-		vars := mux.Vars(req)
-		filterID := vars["filterID"]
-		ctx := req.Context()
-		dimensionName := age
+		f.ageSelector(w, req, lang, collectionID, userAccessToken, nil, nil)
+	})
+}
 
-		fj, eTag0, err := f.FilterClient.GetJobState(ctx, userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
+// ageSelector renders the age selector. If the form with pending changes is provided, they are shown instead of the options
+// currently selected in the filter, along with a message explaining that the filter was modified since the user loaded the page,
+// or explaining what is wrong with the form if it was invalid
+func (f *Filter) ageSelector(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string, pending url.Values, invalid error) {
+	vars := mux.Vars(req)
+	filterID := vars["filterID"]
+	ctx := req.Context()
+	dimensionName := age
 
-		versionURL, err := url.Parse(fj.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
-		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
-			return
-		}
+	fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+	if err != nil {
+		log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fj, eTag0, datasetID, edition, version := fc.Filter, fc.ETag, fc.DatasetID, fc.Edition, fc.Version
 
-		datasetDetails, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, datasetID)
-		if err != nil {
-			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
-			return
-		}
+	datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		// count number of options for the dimension in dataset API
-		opts, err := f.DatasetClient.GetOptions(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName,
-			&dataset.QueryParams{Offset: 0, Limit: 0})
-		if err != nil {
-			log.Error(ctx, "failed to get options from dataset client", err,
-				log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	// count number of options for the dimension in dataset API
+	opts, err := f.DatasetClient.GetOptions(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName,
+		&dataset.QueryParams{Offset: 0, Limit: 0})
+	if err != nil {
+		log.Error(ctx, "failed to get options from dataset client", err,
+			log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		if opts.TotalCount <= MaxNumOptionsOnPage {
-			mux.Vars(req)["name"] = dimensionName
-			f.DimensionSelector().ServeHTTP(w, req)
-			return
-		}
+	if opts.TotalCount <= MaxNumOptionsOnPage {
+		mux.Vars(req)["name"] = dimensionName
+		f.DimensionSelector().ServeHTTP(w, req)
+		return
+	}
 
-		dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
-		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err,
-				log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err,
+			log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		selValues, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, dimensionName, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
-			return
-		}
+	fc, selValues, err := f.consistentSelection(ctx, "age_selector", userAccessToken, collectionID, filterID, dimensionName, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fj, eTag0 = fc.Filter, fc.ETag
 
-		// The user might want to retry this handler if eTags don't match
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "dimension": dimensionName, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
-			return
-		}
+	allValues, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		log.Error(ctx, "failed to get options from dataset client", err,
+			log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		allValues, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from dataset client", err,
-				log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
 
-		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
-		if err != nil {
-			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
-		}
+	bp := f.RenderClient.NewBasePageModel()
+	p, err := mapper.CreateAgePage(req, bp, fj, datasetDetails, allValues, selValues, dims, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+	if err != nil {
+		log.Error(ctx, "failed to map data to page", err,
+			log.Data{"filter_id": filterID, "dataset_id": datasetID, "dimension": dimensionName})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	p.Data.ETag = eTag0
+	p.Data.Undo = f.undoLink(ctx, filterID, eTag0, fmt.Sprintf("/filters/%s/dimensions/%s", filterID, dimensionName))
+	p.Data.BandGroups = mapper.CreateAgeBandGroups(allValues, selValues, f.ageBands)
+	if pending == nil {
+		f.buildPage(w, req, p, age)
+		return
+	}
 
-		bp := f.RenderClient.NewBasePageModel()
-		p, err := mapper.CreateAgePage(req, bp, fj, datasetDetails, allValues, selValues, dims, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
-		if err != nil {
-			log.Error(ctx, "failed to map data to page", err,
-				log.Data{"filter_id": filterID, "dataset_id": datasetID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
-			return
+	applyPendingAge(&p, pending)
+	if fieldErr, ok := asFieldError(invalid); ok {
+		p.Error = invalidFormMessage(lang, fieldErr)
+		p.Data.FieldErrors = fieldErr.fieldErrors()
+		f.buildPageWithStatus(w, req, p, age, http.StatusBadRequest)
+		return
+	}
+	p.Error = conflictMessage(lang)
+	f.buildPageWithStatus(w, req, p, age, http.StatusConflict)
+}
+
+// applyPendingAge sets the selection submitted in the age form on the page
+func applyPendingAge(p *model.Age, form url.Values) {
+	if selection := form.Get("age-selection"); selection != "" {
+		p.Data.CheckedRadio = selection
+	}
+
+	switch p.Data.CheckedRadio {
+	case strRange:
+		p.Data.FirstSelected = form.Get("youngest")
+		p.Data.LastSelected = form.Get("oldest")
+	case list:
+		for i := range p.Data.Ages {
+			_, isSelected := form[p.Data.Ages[i].Option]
+			p.Data.Ages[i].IsSelected = isSelected
 		}
-		f.RenderClient.BuildPage(w, p, age)
-	})
+	case bands:
+		for i := range p.Data.BandGroups {
+			for j := range p.Data.BandGroups[i].Bands {
+				band := &p.Data.BandGroups[i].Bands[j]
+				band.IsSelected = slices.Contains(form[ageBandKey], band.Value)
+			}
+		}
+	}
 }
@@ -2,15 +2,21 @@ package handlers
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
 	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -57,9 +63,7 @@ func TestUpdateAge(t *testing.T) {
 	Convey("Given that a user selects age options from the list, then the redirect is successful and the expected calls are made to the filter API", t, func() {
 		options := []string{"30", "28", "90+"}
 		mockClient := NewMockFilterClient(mockCtrl)
-		mockClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", testETag(0)).Return(testETag(1), nil)
-		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", ItemsEq(options), testETag(1)).Return(testETag(2), nil)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", ItemsEq(options), headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "all-ages-option=total&youngest-age=0&oldest-age=90%2B&youngest=&oldest=&age-selection=list&28=28&30=30&90%2B=90%2B&save-and-return=Save+and+return"
 		w := callAgeUpdate(formData, mockClient, nil)
 		So(w.Code, ShouldEqual, 302)
@@ -68,9 +72,7 @@ func TestUpdateAge(t *testing.T) {
 	Convey("Given that a user selects all age options, then the redirect is successful and the expected calls are made to the filter API", t, func() {
 		option := "total"
 		mockClient := NewMockFilterClient(mockCtrl)
-		mockClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", testETag(0)).Return(testETag(1), nil)
-		mockClient.EXPECT().AddDimensionValue(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", option, testETag(1)).Return(testETag(2), nil)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", []string{option}, headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "age-selection=all&all-ages-option=total&youngest-age=0&oldest-age=90%2B&youngest=&oldest=&28=28&30=30&90%2B=90%2B&save-and-return=Save+and+return"
 		w := callAgeUpdate(formData, mockClient, nil)
 		So(w.Code, ShouldEqual, 302)
@@ -98,14 +100,200 @@ func TestUpdateAge(t *testing.T) {
 		filterOptions := []string{"18", "19", "20", "21", "22", "23", "24"}
 		mockFilterClient := NewMockFilterClient(mockCtrl)
 		mockDatasetClient := NewMockDatasetClient(mockCtrl)
-		mockFilterClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockFilterClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", testETag(0)).Return(testETag(1), nil)
 		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(expectedFilterModel, testETag(1), nil)
 		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "mid-2019-april-2020-geography", "1", "age",
 			batchSize, maxWorkers).Return(datasetOptions, nil)
-		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", filterOptions, testETag(1)).Return(testETag(2), nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", filterOptions, headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "all-ages-option=total&age-selection=range&youngest-age=0&oldest-age=90%2B&youngest=18&oldest=24&save-and-return=Save+and+return"
 		w := callAgeUpdate(formData, mockFilterClient, mockDatasetClient)
 		So(w.Code, ShouldEqual, 302)
 	})
+	Convey("Given that a user selects a range ending in an open-ended age, then the options within the range are set whatever the form of their labels", t, func() {
+		expectedFilterModel := filter.Model{
+			Links: filter.Links{
+				Version: filter.Link{
+					HRef: "http://localhost:23200/v1/datasets/mid-year-pop-est/editions/mid-2019-april-2020-geography/versions/1",
+				},
+			},
+		}
+		datasetOptions := dataset.Options{
+			Items: []dataset.Option{
+				{Label: "Aged 90 and over", Option: "90+"},
+				{Label: "Total", Option: "total"},
+				{Label: "Aged 85 to 89", Option: "85-89"},
+				{Label: "Aged 80 to 84", Option: "80-84"},
+				{Label: "Aged 75 to 79", Option: "75-79"},
+			},
+		}
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(expectedFilterModel, testETag(1), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "mid-2019-april-2020-geography", "1", "age",
+			batchSize, maxWorkers).Return(datasetOptions, nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", []string{"80-84", "85-89", "90+"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "all-ages-option=total&age-selection=range&youngest=80&oldest=90%2B&save-and-return=Save+and+return"
+		w := callAgeUpdate(formData, mockFilterClient, mockDatasetClient)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that a user selects overlapping bands of ages, then the options within the bands are set once", t, func() {
+		expectedFilterModel := filter.Model{
+			Links: filter.Links{
+				Version: filter.Link{
+					HRef: "http://localhost:23200/v1/datasets/mid-year-pop-est/editions/mid-2019-april-2020-geography/versions/1",
+				},
+			},
+		}
+		var datasetOptions dataset.Options
+		for i := 0; i < 20; i++ {
+			datasetOptions.Items = append(datasetOptions.Items, dataset.Option{Label: fmt.Sprint(i), Option: fmt.Sprint(i)})
+		}
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(expectedFilterModel, testETag(1), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "mid-2019-april-2020-geography", "1", "age",
+			batchSize, maxWorkers).Return(datasetOptions, nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age",
+			[]string{"0", "1", "2", "3", "4", "5", "6"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "age-selection=bands&age-band=0-4&age-band=3-6&save-and-return=Save+and+return"
+		w := callAgeUpdate(formData, mockFilterClient, mockDatasetClient)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that the form includes the filter ETag, then it is sent as If-Match to the filter API", t, func() {
+		mockClient := NewMockFilterClient(mockCtrl)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", []string{"total"}, testETag(5)).Return(testETag(6), nil)
+		formData := "etag=testETag5&age-selection=all&all-ages-option=total&save-and-return=Save+and+return"
+		w := callAgeUpdate(formData, mockClient, nil)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that the user removes all the ages, then the redirect includes the filter ETag", t, func() {
+		mockClient := NewMockFilterClient(mockCtrl)
+		formData := "etag=testETag5&remove-all=Remove+all"
+		w := callAgeUpdate(formData, mockClient, nil)
+		So(w.Code, ShouldEqual, 302)
+		So(w.Header().Get("Location"), ShouldEqual, "/filters/dimensions/age/remove-all?etag=testETag5")
+	})
+
+	Convey("Given that the filter was modified since the age page was loaded, then the page is rendered again with the submitted selection and a conflict status", t, func() {
+		filterModel := filter.Model{
+			FilterID: mockFilterID,
+			Links: filter.Links{
+				Version: filter.Link{
+					HRef: "http://localhost:23200/v1/datasets/mid-year-pop-est/editions/time-series/versions/1",
+				},
+			},
+		}
+		var ageOptions []dataset.Option
+		for i := 0; i <= MaxNumOptionsOnPage; i++ {
+			ageOptions = append(ageOptions, dataset.Option{Label: fmt.Sprint(i), Option: fmt.Sprint(i)})
+		}
+		allOptions := dataset.Options{Items: ageOptions, TotalCount: len(ageOptions)}
+
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", ItemsEq([]string{"2", "3"}), testETag(0)).
+			Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict})
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(filterModel, testETag(1), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", batchSize, maxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "1"}}}, testETag(1), nil)
+		mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est").Return(dataset.DatasetDetails{}, nil)
+		mockDatasetClient.EXPECT().GetOptions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "time-series", "1", "age", gomock.Any()).Return(allOptions, nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "time-series", "1").Return(dataset.VersionDimensions{}, nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "time-series", "1", "age", batchSize, maxWorkers).Return(allOptions, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+
+		var page model.Age
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "age").Do(func(w io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.Age)
+			w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+		})
+
+		target := fmt.Sprintf("/filters/%s/dimensions/age/update", mockFilterID)
+		req := httptest.NewRequest("POST", target, strings.NewReader("etag=testETag0&age-selection=list&2=2&3=3&save-and-return=Save+and+return"))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+		f.UpdateAge().ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(page.Error.Title, ShouldNotBeEmpty)
+		So(page.Data.ETag, ShouldEqual, testETag(1))
+		So(page.Data.CheckedRadio, ShouldEqual, "list")
+		var selected []string
+		for _, a := range page.Data.Ages {
+			if a.IsSelected {
+				selected = append(selected, a.Option)
+			}
+		}
+		So(selected, ShouldResemble, []string{"2", "3"})
+	})
+
+	Convey("Given a range with an oldest age that isn't an age, then the age page is rendered again with the error and the filter is not changed", t, func() {
+		filterModel := filter.Model{
+			FilterID: mockFilterID,
+			Links: filter.Links{
+				Version: filter.Link{
+					HRef: "http://localhost:23200/v1/datasets/mid-year-pop-est/editions/time-series/versions/1",
+				},
+			},
+		}
+		var ageOptions []dataset.Option
+		for i := 0; i <= MaxNumOptionsOnPage; i++ {
+			ageOptions = append(ageOptions, dataset.Option{Label: fmt.Sprint(i), Option: fmt.Sprint(i)})
+		}
+		allOptions := dataset.Options{Items: ageOptions, TotalCount: len(ageOptions)}
+
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+
+		mockFilterClient.EXPECT().SetDimensionValues(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(filterModel, testETag(1), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "age", batchSize, maxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "1"}}}, testETag(1), nil)
+		mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est").Return(dataset.DatasetDetails{}, nil)
+		mockDatasetClient.EXPECT().GetOptions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "time-series", "1", "age", gomock.Any()).Return(allOptions, nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "time-series", "1").Return(dataset.VersionDimensions{}, nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "mid-year-pop-est", "time-series", "1", "age", batchSize, maxWorkers).Return(allOptions, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+
+		var page model.Age
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "age").Do(func(w io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.Age)
+			w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+		})
+
+		target := fmt.Sprintf("/filters/%s/dimensions/age/update", mockFilterID)
+		req := httptest.NewRequest("POST", target, strings.NewReader("age-selection=range&youngest=18&oldest=old&save-and-return=Save+and+return"))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+		f.UpdateAge().ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(page.Error.ErrorItems, ShouldHaveLength, 1)
+		So(page.Data.FieldErrors, ShouldContainKey, "age-oldest")
+		So(page.Data.CheckedRadio, ShouldEqual, "range")
+		So(page.Data.FirstSelected, ShouldEqual, "18")
+		So(page.Data.LastSelected, ShouldEqual, "old")
+	})
+
+	Convey("Given a list with no ages ticked, then the selection is invalid", t, func() {
+		_, err := ageList(url.Values{"age-selection": {list}, "save-and-return": {"Save and return"}})
+		fieldErr, ok := asFieldError(err)
+		So(ok, ShouldBeTrue)
+		So(fieldErr.field, ShouldEqual, "multiple-choice-content-list")
+	})
 }
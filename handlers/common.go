@@ -19,6 +19,8 @@ var specialFormVars = map[string]bool{
 	"save-and-return": true,
 	":uri":            true,
 	"q":               true,
+	"leaves-only":     true,
+	formETagKey:       true,
 }
 
 // getOptionsAndRedirect iterates the provided form values and creates a list of options
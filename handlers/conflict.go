@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+)
+
+// formETagKey is the name of the form field, or query parameter, holding the filter ETag that was current when the page was rendered
+const formETagKey = "etag"
+
+// submittedETag returns the filter ETag submitted in the form or query of the request, to be sent as If-Match to filter API.
+// If none was submitted, any ETag is accepted, so that pages rendered before ETags were embedded in forms keep working.
+func submittedETag(req *http.Request) string {
+	if eTag := req.FormValue(formETagKey); eTag != "" {
+		return eTag
+	}
+	return headers.IfMatchAnyETag
+}
+
+// withETag adds the provided filter ETag to the query of the redirect URL, so that the handler it redirects to
+// can make its changes conditional on it
+func withETag(redirectURL, eTag string) string {
+	if eTag == "" || eTag == headers.IfMatchAnyETag {
+		return redirectURL
+	}
+	return redirectURL + "?" + url.Values{formETagKey: []string{eTag}}.Encode()
+}
+
+// isConflict returns true if filter API rejected a change because the filter was modified since the ETag sent as If-Match
+func isConflict(err error) bool {
+	var clientErr ClientError
+	return errors.As(err, &clientErr) && clientErr.Code() == http.StatusConflict
+}
+
+// conflictMessage returns the message shown when the changes submitted by the user could not be saved
+// because the filter was modified since the page was loaded
+func conflictMessage(lang string) core.Error {
+	return core.Error{
+		Title:       "This filter changed since you loaded it",
+		Description: "Your changes have not been saved. Check the selection below and save it again.",
+		Language:    lang,
+		ErrorCode:   http.StatusConflict,
+	}
+}
+
+// pendingSelection represents the changes to the selected options of a dimension that could not be saved
+type pendingSelection struct {
+	add     []string
+	remove  []string
+	replace bool
+}
+
+// apply returns the provided selected options with the pending changes applied to them
+func (p *pendingSelection) apply(selected []filter.DimensionOption) []filter.DimensionOption {
+	var result []filter.DimensionOption
+	if !p.replace {
+		for i := range selected {
+			if !slices.Contains(p.remove, selected[i].Option) {
+				result = append(result, selected[i])
+			}
+		}
+	}
+	for _, option := range p.add {
+		result = append(result, filter.DimensionOption{Option: option})
+	}
+	return result
+}
+
+// statusWriter is a http.ResponseWriter that writes the provided status code instead of the one set by the renderer
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(_ int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(w.status)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubmittedETag(t *testing.T) {
+	Convey("Given a request with an ETag in the query, then it is returned", t, func() {
+		req := httptest.NewRequest("GET", "/filters/12345/dimensions/sex/remove-all?etag=abc", http.NoBody)
+		So(submittedETag(req), ShouldEqual, "abc")
+	})
+
+	Convey("Given a request without an ETag, then any ETag is accepted", t, func() {
+		req := httptest.NewRequest("GET", "/filters/12345/dimensions/sex/remove-all", http.NoBody)
+		So(submittedETag(req), ShouldEqual, headers.IfMatchAnyETag)
+	})
+}
+
+func TestWithETag(t *testing.T) {
+	Convey("withETag adds the ETag to the query of the url", t, func() {
+		So(withETag("/filters/12345/dimensions/age/remove-all", "abc"), ShouldEqual, "/filters/12345/dimensions/age/remove-all?etag=abc")
+	})
+
+	Convey("withETag doesn't change the url if any ETag is accepted", t, func() {
+		So(withETag("/filters/12345/dimensions/age/remove-all", headers.IfMatchAnyETag), ShouldEqual, "/filters/12345/dimensions/age/remove-all")
+	})
+}
+
+func TestIsConflict(t *testing.T) {
+	Convey("isConflict is true for a conflict response from filter API", t, func() {
+		So(isConflict(&filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict}), ShouldBeTrue)
+		So(isConflict(filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict}), ShouldBeTrue)
+	})
+
+	Convey("isConflict is false for any other error", t, func() {
+		So(isConflict(&filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusNotFound}), ShouldBeFalse)
+		So(isConflict(errors.New("filter api failed")), ShouldBeFalse)
+		So(isConflict(nil), ShouldBeFalse)
+	})
+}
+
+func TestPendingSelection(t *testing.T) {
+	selected := []filter.DimensionOption{{Option: "male"}, {Option: "female"}}
+
+	Convey("A pending selection replacing the existing one only contains the added options", t, func() {
+		p := pendingSelection{add: []string{"all"}, replace: true}
+		So(p.apply(selected), ShouldResemble, []filter.DimensionOption{{Option: "all"}})
+	})
+
+	Convey("A pending removal of all options results in no selected options", t, func() {
+		p := pendingSelection{replace: true}
+		So(p.apply(selected), ShouldBeEmpty)
+	})
+
+	Convey("A pending removal of one option keeps the rest of the selection", t, func() {
+		p := pendingSelection{remove: []string{"male"}}
+		So(p.apply(selected), ShouldResemble, []filter.DimensionOption{{Option: "female"}})
+	})
+}
+
+func TestStatusWriter(t *testing.T) {
+	Convey("statusWriter writes its status code, regardless of the one set by the caller", t, func() {
+		rec := httptest.NewRecorder()
+		w := &statusWriter{ResponseWriter: rec, status: http.StatusConflict}
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("page"))
+		So(err, ShouldBeNil)
+		So(rec.Code, ShouldEqual, http.StatusConflict)
+		So(rec.Body.String(), ShouldEqual, "page")
+	})
+
+	Convey("statusWriter writes its status code when the body is written without setting one", t, func() {
+		rec := httptest.NewRecorder()
+		w := &statusWriter{ResponseWriter: rec, status: http.StatusConflict}
+		_, err := w.Write([]byte("page"))
+		So(err, ShouldBeNil)
+		So(rec.Code, ShouldEqual, http.StatusConflict)
+	})
+}
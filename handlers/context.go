@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
+)
+
+// filterContextsKey is the key of the filter contexts of a request
+type filterContextsKey struct{}
+
+// filterContext is a filter job, with the ETag it was returned with and the dataset version it filters
+type filterContext struct {
+	Filter    filter.Model
+	ETag      string
+	DatasetID string
+	Edition   string
+	Version   string
+
+	mu      sync.Mutex
+	dataset *dataset.DatasetDetails
+}
+
+// filterContexts keeps the filter contexts resolved during a request, by filter ID
+type filterContexts struct {
+	mu      sync.Mutex
+	filters map[string]*filterContext
+}
+
+// ResolveFilter is the middleware keeping the filter contexts of a request. The filter job and the details of its
+// dataset are requested the first time a handler, or one of the helpers it calls, needs them, then kept for the rest
+// of the request.
+func ResolveFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), filterContextsKey{}, &filterContexts{filters: make(map[string]*filterContext)})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// resolveFilter returns the context of the filter. Without the ResolveFilter middleware, the filter job is requested
+// every time.
+func (f *Filter) resolveFilter(ctx context.Context, userAccessToken, collectionID, filterID string) (*filterContext, error) {
+	contexts, ok := ctx.Value(filterContextsKey{}).(*filterContexts)
+	if !ok {
+		return f.newFilterContext(ctx, userAccessToken, collectionID, filterID)
+	}
+
+	contexts.mu.Lock()
+	defer contexts.mu.Unlock()
+	if fc, ok := contexts.filters[filterID]; ok {
+		return fc, nil
+	}
+	fc, err := f.newFilterContext(ctx, userAccessToken, collectionID, filterID)
+	if err != nil {
+		return nil, err
+	}
+	contexts.filters[filterID] = fc
+	return fc, nil
+}
+
+// forgetFilter forgets the context of the filter, so that it is requested again the next time it is needed.
+// It is called after the filter was modified, or found to be modified by someone else.
+func forgetFilter(ctx context.Context, filterID string) {
+	if contexts, ok := ctx.Value(filterContextsKey{}).(*filterContexts); ok {
+		contexts.mu.Lock()
+		delete(contexts.filters, filterID)
+		contexts.mu.Unlock()
+	}
+}
+
+// newFilterContext requests the filter job and extracts the dataset version it filters from its version link
+func (f *Filter) newFilterContext(ctx context.Context, userAccessToken, collectionID, filterID string) (*filterContext, error) {
+	fj, eTag, err := f.FilterClient.GetJobState(ctx, userAccessToken, "", "", collectionID, filterID)
+	if err != nil {
+		return nil, err
+	}
+
+	versionURL, err := url.Parse(fj.Links.Version.HRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version href: %w", err)
+	}
+	versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
+
+	datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract dataset info from path %q: %w", versionPath, err)
+	}
+
+	return &filterContext{Filter: fj, ETag: eTag, DatasetID: datasetID, Edition: edition, Version: version}, nil
+}
+
+// datasetDetails returns the details of the filtered dataset, requesting them the first time they are needed
+func (f *Filter) datasetDetails(ctx context.Context, userAccessToken, collectionID string, fc *filterContext) (dataset.DatasetDetails, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.dataset != nil {
+		return *fc.dataset, nil
+	}
+
+	d, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, fc.DatasetID)
+	if err != nil {
+		return dataset.DatasetDetails{}, err
+	}
+	fc.dataset = &d
+	return d, nil
+}
+
+// consistentSelection returns the options of the dimension selected in the filter, along with the filter context they are
+// consistent with. If the filter is modified after the provided context was resolved, both are read again, up to the
+// configured number of attempts. The read name identifies the page in logs and metrics.
+func (f *Filter) consistentSelection(ctx context.Context, read, userAccessToken, collectionID, filterID, name string, fc *filterContext) (*filterContext, filter.DimensionOptions, error) {
+	var selected filter.DimensionOptions
+	err := f.retryFilterReads(ctx, read, filterID, func() error {
+		var err error
+		if fc == nil {
+			if fc, err = f.resolveFilter(ctx, userAccessToken, collectionID, filterID); err != nil {
+				return err
+			}
+		}
+
+		var eTag string
+		selected, eTag, err = f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
+		if err == nil && eTag != fc.ETag {
+			err = errInconsistentFilter
+		}
+		if isETagMismatch(err) {
+			fc = nil
+		}
+		return err
+	})
+	return fc, selected, err
+}
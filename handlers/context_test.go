@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolveFilter(t *testing.T) {
+	t.Parallel()
+
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+	const batchSize = 100
+	const maxWorkers = 25
+
+	cfg := &config.Config{BatchSizeLimit: batchSize, BatchMaxWorkers: maxWorkers, FilterRetryAttempts: 2}
+	filterModel := filter.Model{
+		FilterID: filterID,
+		Links:    filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1"}},
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctx := gomock.Any()
+
+	// withFilterContexts calls fn with the context of a request served through the ResolveFilter middleware
+	withFilterContexts := func(fn func(ctx context.Context)) {
+		h := ResolveFilter(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fn(req.Context())
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/filters/12345/dimensions", nil))
+	}
+
+	Convey("Given a request served through the ResolveFilter middleware", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+
+		Convey("Then the filter job and the dataset are only requested once", func() {
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil).Times(1)
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "abcde").Return(dataset.DatasetDetails{Title: "Dataset"}, nil).Times(1)
+
+			withFilterContexts(func(reqCtx context.Context) {
+				for i := 0; i < 2; i++ {
+					fc, err := f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+					So(err, ShouldBeNil)
+					So(fc.Filter, ShouldResemble, filterModel)
+					So(fc.ETag, ShouldEqual, testETag(1))
+					So(fc.DatasetID, ShouldEqual, "abcde")
+					So(fc.Edition, ShouldEqual, "2017")
+					So(fc.Version, ShouldEqual, "1")
+
+					d, err := f.datasetDetails(reqCtx, mockUserAuthToken, mockCollectionID, fc)
+					So(err, ShouldBeNil)
+					So(d.Title, ShouldEqual, "Dataset")
+				}
+			})
+		})
+
+		Convey("Then the helpers called by the handlers share the filter job", func() {
+			options := dataset.Options{Items: []dataset.Option{{Label: "Jan-00", Option: "Jan-00"}}}
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil).Times(1)
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "abcde", "2017", "1", "time", batchSize, maxWorkers).Return(options, nil).Times(2)
+
+			withFilterContexts(func(reqCtx context.Context) {
+				for i := 0; i < 2; i++ {
+					values, labelIDs, err := f.getDimensionValues(reqCtx, mockUserAuthToken, mockCollectionID, filterID, "time")
+					So(err, ShouldBeNil)
+					So(values, ShouldResemble, []string{"Jan-00"})
+					So(labelIDs, ShouldResemble, map[string]string{"Jan-00": "Jan-00"})
+				}
+			})
+		})
+
+		Convey("Then a forgotten filter is requested again", func() {
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil)
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(2), nil)
+
+			withFilterContexts(func(reqCtx context.Context) {
+				fc, err := f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+				So(err, ShouldBeNil)
+				So(fc.ETag, ShouldEqual, testETag(1))
+
+				forgetFilter(reqCtx, filterID)
+				fc, err = f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+				So(err, ShouldBeNil)
+				So(fc.ETag, ShouldEqual, testETag(2))
+			})
+		})
+
+		Convey("Then retried filter reads get the filter job again", func() {
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil)
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(2), nil)
+
+			withFilterContexts(func(reqCtx context.Context) {
+				var eTags []string
+				err := f.retryFilterReads(reqCtx, "test", filterID, func() error {
+					fc, err := f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+					if err != nil {
+						return err
+					}
+					eTags = append(eTags, fc.ETag)
+					if fc.ETag != testETag(2) {
+						return errInconsistentFilter
+					}
+					return nil
+				})
+				So(err, ShouldBeNil)
+				So(eTags, ShouldResemble, []string{testETag(1), testETag(2)})
+			})
+		})
+
+		Convey("Then a failure to get the filter job is returned and not kept", func() {
+			getErr := errors.New("filter api failed")
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filter.Model{}, "", getErr)
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil)
+
+			withFilterContexts(func(reqCtx context.Context) {
+				_, err := f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+				So(err, ShouldEqual, getErr)
+				fc, err := f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+				So(err, ShouldBeNil)
+				So(fc.DatasetID, ShouldEqual, "abcde")
+			})
+		})
+
+		Convey("Then a filter whose version link has no dataset version is an error", func() {
+			invalid := filter.Model{Links: filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde"}}}
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(invalid, testETag(1), nil)
+
+			withFilterContexts(func(reqCtx context.Context) {
+				_, err := f.resolveFilter(reqCtx, mockUserAuthToken, mockCollectionID, filterID)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a request served without the ResolveFilter middleware, then the filter job is requested every time", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil).Times(2)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", cfg)
+
+		for i := 0; i < 2; i++ {
+			fc, err := f.resolveFilter(context.Background(), mockUserAuthToken, mockCollectionID, filterID)
+			So(err, ShouldBeNil)
+			So(fc.Version, ShouldEqual, "1")
+		}
+	})
+}
+
+func TestConsistentSelection(t *testing.T) {
+	t.Parallel()
+
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+	const batchSize = 100
+	const maxWorkers = 25
+
+	filterModel := filter.Model{
+		FilterID: filterID,
+		Links:    filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1"}},
+	}
+	selected := filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "Jan-00"}}}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ctx := gomock.Any()
+
+	Convey("Given a filter modified after it was resolved, then the filter and the selection are read again", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(2), nil)
+		gomock.InOrder(
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "time", batchSize, maxWorkers).Return(selected, testETag(2), nil),
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "time", batchSize, maxWorkers).Return(selected, testETag(2), nil),
+		)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", &config.Config{BatchSizeLimit: batchSize, BatchMaxWorkers: maxWorkers, FilterRetryAttempts: 2})
+
+		stale := &filterContext{Filter: filterModel, ETag: testETag(1), DatasetID: "abcde", Edition: "2017", Version: "1"}
+		fc, sel, err := f.consistentSelection(context.Background(), "test", mockUserAuthToken, mockCollectionID, filterID, "time", stale)
+		So(err, ShouldBeNil)
+		So(fc.ETag, ShouldEqual, testETag(2))
+		So(sel, ShouldResemble, selected)
+	})
+
+	Convey("Given a filter that keeps being modified, then the mismatch is returned after all the attempts", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "time", batchSize, maxWorkers).Return(selected, testETag(2), nil)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", &config.Config{BatchSizeLimit: batchSize, BatchMaxWorkers: maxWorkers})
+
+		stale := &filterContext{Filter: filterModel, ETag: testETag(1)}
+		_, _, err := f.consistentSelection(context.Background(), "test", mockUserAuthToken, mockCollectionID, filterID, "time", stale)
+		So(err, ShouldEqual, errInconsistentFilter)
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// CreateFilter creates a new filter blueprint for the dataset version in the path,
+// with all of its dimensions, and redirects to the filter overview
+func (f *Filter) CreateFilter() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		vars := mux.Vars(req)
+		datasetID := vars["datasetID"]
+		edition := vars["edition"]
+		version := vars["version"]
+		ctx := req.Context()
+
+		dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+		if err != nil {
+			log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		names := make([]string, 0, len(dims.Items))
+		for i := range dims.Items {
+			names = append(names, dims.Items[i].Name)
+		}
+
+		filterID, _, err := f.FilterClient.CreateBlueprint(ctx, userAccessToken, "", "", collectionID, datasetID, edition, version, names)
+		if err != nil {
+			log.Error(ctx, "failed to create filter blueprint", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
+		http.Redirect(w, req, redirectURL, http.StatusFound)
+	})
+}
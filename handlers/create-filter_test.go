@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCreateFilter(t *testing.T) {
+	ctx := gomock.Any()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25}
+
+	callCreateFilter := func(mockFilterClient *MockFilterClient, mockDatasetClient *MockDatasetClient) *httptest.ResponseRecorder {
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+		router := mux.NewRouter()
+		router.Path("/datasets/{datasetID}/editions/{edition}/versions/{version}/filter").Methods("POST").HandlerFunc(f.CreateFilter())
+		req := httptest.NewRequest("POST", "/datasets/cpih01/editions/time-series/versions/3/filter", http.NoBody)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("Given a dataset version with dimensions", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, "", "", "", "cpih01", "time-series", "3").Return(dataset.VersionDimensions{
+			Items: dataset.VersionDimensionItems{{Name: "time"}, {Name: "geography"}, {Name: "aggregate"}},
+		}, nil)
+
+		Convey("When CreateFilter is called, then a blueprint is created with all the dimensions and the user is redirected to the overview", func() {
+			mockFilterClient.EXPECT().CreateBlueprint(ctx, "", "", "", "", "cpih01", "time-series", "3", []string{"time", "geography", "aggregate"}).Return("new-filter-id", testETag(0), nil)
+
+			w := callCreateFilter(mockFilterClient, mockDatasetClient)
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/new-filter-id/dimensions")
+		})
+
+		Convey("When the blueprint can't be created, then a 500 status code is returned", func() {
+			mockFilterClient.EXPECT().CreateBlueprint(ctx, "", "", "", "", "cpih01", "time-series", "3", gomock.Any()).Return("", "", errors.New("filter api failed"))
+
+			w := callCreateFilter(mockFilterClient, mockDatasetClient)
+
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+
+	Convey("Given a dataset API that fails to return the version dimensions", t, func() {
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, "", "", "", "cpih01", "time-series", "3").Return(dataset.VersionDimensions{}, errors.New("dataset api failed"))
+
+		Convey("When CreateFilter is called, then no blueprint is created and a 500 status code is returned", func() {
+			w := callCreateFilter(NewMockFilterClient(mockCtrl), mockDatasetClient)
+
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
@@ -7,15 +7,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"strings"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
-	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
 	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
-	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 	"github.com/ONSdigital/log.go/v2/log"
@@ -35,61 +31,40 @@ func (f *Filter) GetAllDimensionOptionsJSON() http.HandlerFunc {
 		filterID := vars["filterID"]
 		ctx := req.Context()
 
-		fj, _, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
-		versionURL, err := url.Parse(fj.Links.Version.HRef)
+		idNameMap, err := f.getIDNameMap(ctx, userAccessToken, collectionID, fc, name)
 		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-
-		idNameMap, err := f.getIDNameMap(req.Context(), userAccessToken, collectionID, versionPath, name)
-		if err != nil {
-			log.Error(ctx, "failed to get name map", err, log.Data{"filter_id": filterID, "path": versionPath, "name": name})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to get name map", err, log.Data{"filter_id": filterID, "dataset_id": fc.DatasetID, "name": name})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		var lids []labelID
 
 		if name == strTime {
-			var codedDates []string
-			labelIDMap := make(map[string]string)
-			for k, v := range idNameMap {
-				codedDates = append(codedDates, v)
-				labelIDMap[v] = k
+			codes := make([]string, 0, len(idNameMap))
+			for id := range idNameMap {
+				codes = append(codes, id)
 			}
 
-			readableDates, dErr := dates.ConvertToReadable(codedDates)
-			if dErr != nil {
-				log.Error(ctx, "failed to convert dates", dErr, log.Data{"filter_id": filterID, "dates": codedDates})
-				setStatusCode(req, w, dErr)
+			lids, err = timeLabelIDs(idNameMap, codes)
+			if err != nil {
+				log.Error(ctx, "failed to convert dates", err, log.Data{"filter_id": filterID, "dimension": name})
+				f.setStatusCode(req, w, err)
 				return
 			}
-
-			readableDates = dates.Sort(readableDates)
-
-			for _, date := range readableDates {
-				lid := labelID{
-					Label: fmt.Sprintf("%s %d", date.Month(), date.Year()),
-					ID:    labelIDMap[date.Format("Jan-06")],
-				}
-
-				lids = append(lids, lid)
-			}
 		}
 
 		b, err := json.Marshal(lids)
 		if err != nil {
 			log.Error(ctx, "failed to marshal json", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -98,9 +73,46 @@ func (f *Filter) GetAllDimensionOptionsJSON() http.HandlerFunc {
 	})
 }
 
-func (f *Filter) getIDNameMap(ctx context.Context, userAccessToken, collectionID, versionURL, dimension string) (idNameMap map[string]string, err error) {
-	datasetID, edition, version, _ := helpers.ExtractDatasetInfoFromPath(ctx, versionURL)
-	opts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimension, f.BatchSize, f.BatchMaxWorkers)
+// timeLabelIDs returns the time options with the provided codes, from the earliest period to the latest one, labelled
+// as they're shown to users. The format of the labels is detected from the whole codelist, as a few options may parse
+// in more than one format.
+func timeLabelIDs(idNameMap map[string]string, codes []string) ([]labelID, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	labels := make([]string, 0, len(idNameMap))
+	for _, label := range idNameMap {
+		labels = append(labels, label)
+	}
+	format, ok := dates.Detect(labels)
+	if !ok {
+		return nil, dates.ErrUnknownFormat
+	}
+
+	times := make([]dates.Option, 0, len(codes))
+	for _, code := range codes {
+		label, ok := idNameMap[code]
+		if !ok {
+			return nil, fmt.Errorf("option %s is not in the time codelist", code)
+		}
+		period, err := format.Parse(label)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, dates.Option{Code: code, Label: label, Period: period})
+	}
+	dates.SortOptions(times)
+
+	lids := make([]labelID, 0, len(times))
+	for _, t := range times {
+		lids = append(lids, labelID{Label: t.Period.Label(), ID: t.Code})
+	}
+	return lids, nil
+}
+
+func (f *Filter) getIDNameMap(ctx context.Context, userAccessToken, collectionID string, fc *filterContext, dimension string) (idNameMap map[string]string, err error) {
+	opts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, fc.DatasetID, fc.Edition, fc.Version, dimension, f.BatchSize, f.BatchMaxWorkers)
 	if err != nil {
 		return nil, err
 	}
@@ -121,77 +133,40 @@ func (f *Filter) GetSelectedDimensionOptionsJSON() http.HandlerFunc {
 		filterID := vars["filterID"]
 		ctx := req.Context()
 
-		opts, eTag0, err := f.FilterClient.GetDimensionOptionsInBatches(req.Context(), userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
+		fc, opts, err := f.consistentSelection(ctx, "selected_options_json", userAccessToken, collectionID, filterID, name, nil)
 		if err != nil {
 			log.Error(ctx, "failed to get dimension options", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
-			// The user might want to retry this handler on ErrBatchETagMismatch
+			f.setStatusCode(req, w, err)
 			return
 		}
 
-		fj, eTag1, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
+		idNameMap, err := f.getIDNameMap(ctx, userAccessToken, collectionID, fc, name)
 		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-
-		// The user might want to retry this handler if eTags don't match
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "dimension": name, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
-			return
-		}
-
-		versionURL, err := url.Parse(fj.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-		idNameMap, err := f.getIDNameMap(req.Context(), userAccessToken, collectionID, versionPath, name)
-		if err != nil {
-			log.Error(ctx, "failed to get name map", err, log.Data{"filter_id": filterID, "path": versionPath, "name": name})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to get name map", err, log.Data{"filter_id": filterID, "dataset_id": fc.DatasetID, "name": name})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		var lids []labelID
 
 		if name == strTime {
-			var codedDates []string
-			labelIDMap := make(map[string]string)
+			codes := make([]string, 0, len(opts.Items))
 			for _, opt := range opts.Items {
-				codedDates = append(codedDates, idNameMap[opt.Option])
-				labelIDMap[idNameMap[opt.Option]] = opt.Option
+				codes = append(codes, opt.Option)
 			}
 
-			readableDates, dErr := dates.ConvertToReadable(codedDates)
-			if dErr != nil {
-				log.Error(ctx, "failed to convert dates", dErr, log.Data{"filter_id": filterID, "dates": codedDates})
-				setStatusCode(req, w, dErr)
+			lids, err = timeLabelIDs(idNameMap, codes)
+			if err != nil {
+				log.Error(ctx, "failed to convert dates", err, log.Data{"filter_id": filterID, "dimension": name, "options": codes})
+				f.setStatusCode(req, w, err)
 				return
 			}
-
-			readableDates = dates.Sort(readableDates)
-
-			for _, date := range readableDates {
-				lid := labelID{
-					Label: fmt.Sprintf("%s %d", date.Month(), date.Year()),
-					ID:    labelIDMap[date.Format("Jan-06")],
-				}
-
-				lids = append(lids, lid)
-			}
 		}
 
 		b, err := json.Marshal(lids)
 		if err != nil {
 			log.Error(ctx, "failed to marshal json", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -203,99 +178,114 @@ func (f *Filter) GetSelectedDimensionOptionsJSON() http.HandlerFunc {
 // DimensionSelector controls the render of the range selector template using data from Dataset API and Filter API
 func (f *Filter) DimensionSelector() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
-		vars := mux.Vars(req)
-		name := vars["name"]
-		filterID := vars["filterID"]
-		ctx := req.Context()
+		f.dimensionSelector(w, req, lang, collectionID, userAccessToken, nil)
+	})
+}
 
-		fj, eTag0, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
+// dimensionSelector renders the list selector for the dimension in the request. If pending changes are provided,
+// they are shown instead of the options currently selected in the filter, along with a message explaining that the
+// filter was modified since the user loaded the page
+func (f *Filter) dimensionSelector(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string, pending *pendingSelection) {
+	vars := mux.Vars(req)
+	name := vars["name"]
+	filterID := vars["filterID"]
+	ctx := req.Context()
 
-		versionURL, err := url.Parse(fj.Links.Version.HRef)
+	// get the filter and the selected options from filter API, retrying if the filter is modified between calls
+	var fc *filterContext
+	var selectedValues filter.DimensionOptions
+	var eTag string
+	err := f.retryFilterReads(ctx, "dimension_selector", filterID, func() error {
+		var err error
+		fc, err = f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			return err
 		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
 
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
+		selectedValues, eTag, err = f.FilterClient.GetDimensionOptionsInBatches(req.Context(), userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
 		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
-			return
+			log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": name})
+			return err
 		}
 
-		datasetDetails, err := f.DatasetClient.Get(req.Context(), userAccessToken, "", collectionID, datasetID)
-		if err != nil {
-			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
-			return
+		if fc.ETag != eTag {
+			return errInconsistentFilter
 		}
+		return nil
+	})
+	if err != nil {
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fj, datasetID, edition, version := fc.Filter, fc.DatasetID, fc.Edition, fc.Version
 
-		// TODO: This is a shortcut for now, if the hierarchy api returns a status 200
-		// then the dimension should be populated as a hierarchy
-		isHierarchy, err := f.isHierarchicalDimension(ctx, fj.InstanceID, name)
-		if err != nil {
-			setStatusCode(req, w, err)
-			return
-		}
+	datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		// count number of options for the dimension in dataset API
-		opts, err := f.DatasetClient.GetOptions(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, &dataset.QueryParams{Offset: 0, Limit: 0})
-		if err != nil {
-			setStatusCode(req, w, err)
-			return
-		}
+	// TODO: This is a shortcut for now, if the hierarchy api returns a status 200
+	// then the dimension should be populated as a hierarchy
+	isHierarchy, err := f.isHierarchicalDimension(ctx, fj.InstanceID, name)
+	if err != nil {
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		// if there are more than maxNumOptionsOnPage, then we need to use the hierarchy model
-		if isHierarchy && opts.TotalCount > MaxNumOptionsOnPage {
-			f.Hierarchy().ServeHTTP(w, req)
-			return
-		}
+	// count number of options for the dimension in dataset API
+	opts, err := f.DatasetClient.GetOptions(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, &dataset.QueryParams{Offset: 0, Limit: 0})
+	if err != nil {
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		dims, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
-		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	// if there are more than maxNumOptionsOnPage, then we need to use the hierarchy model
+	if isHierarchy && opts.TotalCount > MaxNumOptionsOnPage {
+		f.hierarchySelector(w, req, lang, collectionID, userAccessToken, fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name), pending)
+		return
+	}
 
-		selectedValues, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(req.Context(), userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
-			// The user might want to retry this handler on ErrBatchETagMismatch
-			return
-		}
+	dims, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		// The user might want to retry this handler if eTags don't match
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "dimension": name, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
-			return
-		}
+	allValues, err := f.DatasetClient.GetOptionsInBatches(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		allValues, err := f.DatasetClient.GetOptionsInBatches(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
 
-		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
-		if err != nil {
-			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
-		}
+	selected := selectedValues.Items
+	if pending != nil {
+		selected = pending.apply(selected)
+	}
 
-		f.listSelector(w, req, name, selectedValues.Items, allValues, fj, datasetDetails, dims, datasetID, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
-	})
+	bp := f.RenderClient.NewBasePageModel()
+	p := mapper.CreateListSelectorPage(req, bp, name, selected, allValues, fj, datasetDetails, dims, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+	p.Data.ETag = eTag
+	p.Data.Undo = f.undoLink(ctx, filterID, eTag, fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name))
+	if ordered, ok := f.orderedOptions(name, allValues); ok {
+		p.Data.OrdinalRange = mapper.CreateOrdinalRange(filterID, name, ordered, selected)
+	}
+	if pending == nil {
+		f.buildPage(w, req, p, "list-selector")
+		return
+	}
+
+	p.Error = conflictMessage(lang)
+	f.buildPageWithStatus(w, req, p, "list-selector", http.StatusConflict)
 }
 
 func (f *Filter) isHierarchicalDimension(ctx context.Context, instanceID, dimensionName string) (bool, error) {
@@ -317,59 +307,42 @@ func (f *Filter) isHierarchicalDimension(ctx context.Context, instanceID, dimens
 	return true, nil
 }
 
-// ListSelector controls the render of the age selector list template
-// Contains stubbed data for now - page to be populated by the API
-func (f *Filter) listSelector(w http.ResponseWriter, req *http.Request, name string, selectedValues []filter.DimensionOption, allValues dataset.Options, fm filter.Model, ds dataset.DatasetDetails, dims dataset.VersionDimensions, datasetID, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) {
-	bp := f.RenderClient.NewBasePageModel()
-	p := mapper.CreateListSelectorPage(req, bp, name, selectedValues, allValues, fm, ds, dims, datasetID, f.APIRouterVersion, lang, serviceMessage, emergencyBannerContent)
-	f.RenderClient.BuildPage(w, p, "list-selector")
-}
-
 // DimensionAddAll will add all dimension values to a basket
 func (f *Filter) DimensionAddAll() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
 		vars := mux.Vars(req)
 		name := vars["name"]
 		filterID := vars["filterID"]
-		f.addAll(w, req, fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name), collectionID, userAccessToken)
+		f.addAll(w, req, lang, fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name), userAccessToken, collectionID)
 	})
 }
 
-func (f *Filter) addAll(w http.ResponseWriter, req *http.Request, redirectURL, userAccessToken, collectionID string) {
+// addAll selects every option of the dimension in the request, unless the filter was modified since the page was loaded
+func (f *Filter) addAll(w http.ResponseWriter, req *http.Request, lang, redirectURL, userAccessToken, collectionID string) {
 	vars := mux.Vars(req)
 	name := vars["name"]
 	filterID := vars["filterID"]
 	ctx := req.Context()
 
-	fj, eTag, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
-	if err != nil {
-		log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-		setStatusCode(req, w, err)
-		// The user might want to retry this handler on ErrBatchETagMismatch
-		return
-	}
-
-	versionURL, err := url.Parse(fj.Links.Version.HRef)
+	fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 	if err != nil {
-		log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-		setStatusCode(req, w, err)
+		log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
 		return
 	}
-	versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
+	datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
 
-	datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
-	if err != nil {
-		log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-		setStatusCode(req, w, err)
-		return
-	}
+	// the options are only added if the filter wasn't modified since the page was loaded
+	eTag := submittedETag(req)
 
 	// function to add each batch of dataset dimension options to filter API
+	var added []string
 	processBatch := func(batch dataset.Options) (forceAbort bool, err error) {
 		var options []string
 		for i := range batch.Items {
 			options = append(options, batch.Items[i].Option)
 		}
+		added = append(added, options...)
 		// first batch, will overwrite any existing values in filter API
 		if batch.Offset == 0 {
 			eTag, err = f.FilterClient.SetDimensionValues(req.Context(), userAccessToken, "", collectionID, filterID, name, options, eTag)
@@ -380,17 +353,29 @@ func (f *Filter) addAll(w http.ResponseWriter, req *http.Request, redirectURL, u
 		return false, err
 	}
 
+	rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+
 	// call dataset API GetOptions in batches, and process each batch to add the options to filter API
-	if err := f.DatasetClient.GetOptionsBatchProcess(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version, name, nil, processBatch, f.BatchSize, f.BatchMaxWorkers); err != nil {
+	err = f.DatasetClient.GetOptionsBatchProcess(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version, name, nil, processBatch, f.BatchSize, f.BatchMaxWorkers)
+	if isConflict(err) {
+		log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": name})
+		forgetFilter(ctx, filterID)
+		f.renderAddAllConflict(w, req, lang, collectionID, userAccessToken, datasetID, edition, version, name)
+		return
+	}
+	if err != nil {
 		log.Error(ctx, "failed to process options from dataset api", err, log.Data{"filter_id": filterID, "dimension": name})
-		setStatusCode(req, w, err)
+		f.setStatusCode(req, w, err)
 		return
 	}
+	forgetFilter(ctx, filterID)
+	rec.commitSelected(ctx, map[string][]string{name: added})
 
 	http.Redirect(w, req, redirectURL, http.StatusFound)
 }
 
-// AddList sets a list of values, removing any existing value.
+// AddList sets a list of values, removing any existing value. The values can also be
+// uploaded as a CSV file, which may set the values of several dimensions.
 func (f *Filter) AddList() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
 		vars := mux.Vars(req)
@@ -398,9 +383,14 @@ func (f *Filter) AddList() http.HandlerFunc {
 		filterID := vars["filterID"]
 		ctx := req.Context()
 
+		if isUpload(req) {
+			f.uploadOptions(w, req, lang, collectionID, userAccessToken)
+			return
+		}
+
 		if err := req.ParseForm(); err != nil {
 			log.Error(ctx, "failed to parse form", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -408,28 +398,40 @@ func (f *Filter) AddList() http.HandlerFunc {
 
 		if len(req.Form["add-all"]) > 0 {
 			redirectURL = fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name)
-			f.addAll(w, req, redirectURL, userAccessToken, collectionID)
+			f.addAll(w, req, lang, redirectURL, userAccessToken, collectionID)
 			return
 		}
 
+		eTag := submittedETag(req)
+
 		if len(req.Form["remove-all"]) > 0 {
 			redirectURL = fmt.Sprintf("/filters/%s/dimensions/%s/remove-all", filterID, name)
-			http.Redirect(w, req, redirectURL, http.StatusFound)
+			http.Redirect(w, req, withETag(redirectURL, eTag), http.StatusFound)
 			return
 		}
 
 		var options []string
 		for k := range req.Form {
-			if k == ":uri" || k == "save-and-return" {
+			if k == ":uri" || k == "save-and-return" || k == formETagKey {
 				continue
 			}
 
 			options = append(options, k)
 		}
 
-		_, err := f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, options, headers.IfMatchAnyETag)
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+		_, err := f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, options, eTag)
+		if isConflict(err) {
+			log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": name, "e_tag": eTag})
+			forgetFilter(ctx, filterID)
+			f.dimensionSelector(w, req, lang, collectionID, userAccessToken, &pendingSelection{add: options, replace: true})
+			return
+		}
 		if err != nil {
 			log.Warn(ctx, "failed to add dimension values", log.FormatErrors([]error{err}))
+		} else {
+			forgetFilter(ctx, filterID)
+			rec.commit(ctx)
 		}
 
 		http.Redirect(w, req, redirectURL, http.StatusFound)
@@ -437,23 +439,12 @@ func (f *Filter) AddList() http.HandlerFunc {
 }
 
 func (f *Filter) getDimensionValues(ctx context.Context, userAccessToken, collectionID, filterID, name string) (values []string, labelIDMap map[string]string, err error) {
-	fj, _, err := f.FilterClient.GetJobState(ctx, userAccessToken, "", "", collectionID, filterID)
+	fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 	if err != nil {
 		return
 	}
 
-	versionURL, err := url.Parse(fj.Links.Version.HRef)
-	if err != nil {
-		return
-	}
-	versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-
-	datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
-	if err != nil {
-		return
-	}
-
-	vals, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
+	vals, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, fc.DatasetID, fc.Edition, fc.Version, name, f.BatchSize, f.BatchMaxWorkers)
 	if err != nil {
 		return
 	}
@@ -477,19 +468,28 @@ func (f *Filter) DimensionRemoveAll() http.HandlerFunc {
 
 		log.Info(ctx, "attempting to remove all options from dimension", log.Data{"dimension": name, "filterID": filterID})
 
-		eTag, err := f.FilterClient.RemoveDimension(req.Context(), userAccessToken, "", collectionID, filterID, name, headers.IfMatchAnyETag)
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+		eTag, err := f.FilterClient.RemoveDimension(req.Context(), userAccessToken, "", collectionID, filterID, name, submittedETag(req))
+		if isConflict(err) {
+			log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": name})
+			forgetFilter(ctx, filterID)
+			f.renderRemoveAllConflict(w, req, lang, collectionID, userAccessToken, name)
+			return
+		}
 		if err != nil {
 			log.Error(ctx, "failed to remove dimension", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		forgetFilter(ctx, filterID)
 
 		_, err = f.FilterClient.AddDimension(req.Context(), userAccessToken, "", collectionID, filterID, name, eTag)
 		if err != nil {
 			log.Error(ctx, "failed to add dimension", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		rec.commitSelected(ctx, nil)
 
 		redirectURL := fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name)
 		http.Redirect(w, req, redirectURL, http.StatusFound)
@@ -505,14 +505,54 @@ func (f *Filter) DimensionRemoveOne() http.HandlerFunc {
 		option := vars["option"]
 		ctx := req.Context()
 
-		_, err := f.FilterClient.RemoveDimensionValue(req.Context(), userAccessToken, "", collectionID, filterID, name, option, headers.IfMatchAnyETag)
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+		_, err := f.FilterClient.RemoveDimensionValue(req.Context(), userAccessToken, "", collectionID, filterID, name, option, submittedETag(req))
+		if isConflict(err) {
+			log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": name, "option": option})
+			forgetFilter(ctx, filterID)
+			f.dimensionSelector(w, req, lang, collectionID, userAccessToken, &pendingSelection{remove: []string{option}})
+			return
+		}
 		if err != nil {
 			log.Error(ctx, "failed to remove dimension option", err, log.Data{"filter_id": filterID, "dimension": name, "option": option})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		forgetFilter(ctx, filterID)
+		rec.commit(ctx)
 
 		redirectURL := fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name)
 		http.Redirect(w, req, redirectURL, http.StatusFound)
 	})
 }
+
+// renderAddAllConflict renders the selector of the dimension with all its options selected, after adding them failed
+// because the filter was modified since the user loaded the page
+func (f *Filter) renderAddAllConflict(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken, datasetID, edition, version, name string) {
+	ctx := req.Context()
+	opts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	options := make([]string, 0, len(opts.Items))
+	for i := range opts.Items {
+		options = append(options, opts.Items[i].Option)
+	}
+	f.dimensionSelector(w, req, lang, collectionID, userAccessToken, &pendingSelection{add: options, replace: true})
+}
+
+// renderRemoveAllConflict renders the selector of the dimension with no options selected, after removing all
+// its options failed because the filter was modified since the user loaded the page
+func (f *Filter) renderRemoveAllConflict(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken, name string) {
+	switch name {
+	case age:
+		f.ageSelector(w, req, lang, collectionID, userAccessToken, url.Values{"age-selection": []string{list}}, nil)
+	case strTime:
+		f.timeSelector(w, req, lang, collectionID, userAccessToken, url.Values{"time-selection": []string{list}}, nil)
+	default:
+		f.dimensionSelector(w, req, lang, collectionID, userAccessToken, &pendingSelection{replace: true})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -72,3 +73,26 @@ func Test_isHierarchicalDimension(t *testing.T) {
 		So(err, ShouldResemble, err)
 	})
 }
+
+func Test_timeLabelIDs(t *testing.T) {
+	idNameMap := map[string]string{"q3": "2006 Q3", "q1": "2006 Q1", "q2": "2006 Q2", "q4": "2007 Q4"}
+
+	Convey("Given options selected from a quarterly codelist, then they are sorted and labelled in the format of the codelist", t, func() {
+		lids, err := timeLabelIDs(idNameMap, []string{"q4", "q1", "q3"})
+
+		So(err, ShouldBeNil)
+		So(lids, ShouldResemble, []labelID{{Label: "Q1 2006", ID: "q1"}, {Label: "Q3 2006", ID: "q3"}, {Label: "Q4 2007", ID: "q4"}})
+	})
+
+	Convey("Given a codelist that mixes formats, then an error is returned", t, func() {
+		_, err := timeLabelIDs(map[string]string{"a": "2006", "b": "Jan-06"}, []string{"a"})
+
+		So(err, ShouldEqual, dates.ErrUnknownFormat)
+	})
+
+	Convey("Given a selected option that isn't in the codelist, then an error is returned", t, func() {
+		_, err := timeLabelIDs(idNameMap, []string{"q5"})
+
+		So(err, ShouldNotBeNil)
+	})
+}
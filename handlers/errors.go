@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-cookies/cookies"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// problemContentType is the media type of the error bodies returned to JSON clients, as defined by RFC 9457
+const problemContentType = "application/problem+json"
+
+// pageError is implemented by the errors that have their own error page, with links for the user to recover from them
+type pageError interface {
+	ClientError
+	// kind identifies the error in the name of its template and in the type of its problem details
+	kind() string
+	// title is a short summary of the error for JSON clients and the <title> element
+	title() string
+}
+
+// filterNotFoundError is returned when the filter requested by the user does not exist
+type filterNotFoundError struct {
+	filterID string
+}
+
+func (e filterNotFoundError) Error() string { return fmt.Sprintf("filter %s not found", e.filterID) }
+func (e filterNotFoundError) Code() int     { return http.StatusNotFound }
+func (e filterNotFoundError) kind() string  { return "filter-not-found" }
+func (e filterNotFoundError) title() string { return "Filter not found" }
+
+// filterExpiredError is returned when the filter requested by the user no longer exists because it has expired
+type filterExpiredError struct {
+	filterID string
+}
+
+func (e filterExpiredError) Error() string { return fmt.Sprintf("filter %s has expired", e.filterID) }
+func (e filterExpiredError) Code() int     { return http.StatusGone }
+func (e filterExpiredError) kind() string  { return "filter-expired" }
+func (e filterExpiredError) title() string { return "Filter expired" }
+
+// filterConflictError is returned when the filter was modified by someone else while the user was changing it
+type filterConflictError struct {
+	filterID string
+}
+
+func (e filterConflictError) Error() string {
+	return fmt.Sprintf("filter %s was modified concurrently", e.filterID)
+}
+func (e filterConflictError) Code() int     { return http.StatusConflict }
+func (e filterConflictError) kind() string  { return "filter-conflict" }
+func (e filterConflictError) title() string { return "Filter changed" }
+
+func (e formError) kind() string  { return "validation" }
+func (e formError) title() string { return "Invalid form value" }
+
+// downstreamError is returned when one of the APIs the filter journey depends on is unavailable or responds with an error
+type downstreamError struct {
+	service string
+	err     error
+}
+
+func (e downstreamError) Error() string { return fmt.Sprintf("%s unavailable: %v", e.service, e.err) }
+func (e downstreamError) Unwrap() error { return e.err }
+func (e downstreamError) Code() int     { return http.StatusBadGateway }
+func (e downstreamError) kind() string  { return "downstream-unavailable" }
+func (e downstreamError) title() string { return "Service unavailable" }
+
+// classifyError returns the error with its own error page corresponding to the provided error,
+// or nil if it should be shown as a generic error
+func classifyError(err error, filterID string) pageError {
+	if err == nil {
+		return nil
+	}
+
+	var pageErr pageError
+	if errors.As(err, &pageErr) {
+		return pageErr
+	}
+
+	if isETagMismatch(err) {
+		return filterConflictError{filterID}
+	}
+
+	if status, ok := filterAPIStatus(err); ok {
+		switch {
+		case status == http.StatusNotFound && isFilterJobRead(err):
+			return filterNotFoundError{filterID}
+		case status == http.StatusNotFound:
+			// a dimension or an option of the filter was not found, which is shown as a generic not found page
+			return nil
+		case status == http.StatusGone:
+			return filterExpiredError{filterID}
+		case status == http.StatusConflict:
+			return filterConflictError{filterID}
+		case status == 0 || status >= http.StatusInternalServerError:
+			return downstreamError{"filter-api", err}
+		}
+	}
+
+	// only the value error is returned by filter API reads, which were reported as a bad gateway before
+	var readErr filter.ErrInvalidFilterAPIResponse
+	if errors.As(err, &readErr) {
+		return downstreamError{"filter-api", err}
+	}
+
+	var clientErr ClientError
+	if errors.As(err, &clientErr) && clientErr.Code() >= http.StatusInternalServerError {
+		return downstreamError{"api", err}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return downstreamError{"api", err}
+	}
+
+	return nil
+}
+
+// filterAPIStatus returns the status code of a filter API error response
+func filterAPIStatus(err error) (int, bool) {
+	var ptrErr *filter.ErrInvalidFilterAPIResponse
+	if errors.As(err, &ptrErr) {
+		return ptrErr.ActualCode, true
+	}
+	var valErr filter.ErrInvalidFilterAPIResponse
+	if errors.As(err, &valErr) {
+		return valErr.ActualCode, true
+	}
+	return 0, false
+}
+
+// isFilterJobRead returns true if the filter API error was returned for the filter job or the filter output itself,
+// as read by GetJobState and GetOutput, rather than for one of their dimensions, options or previews
+func isFilterJobRead(err error) bool {
+	var uri string
+	var ptrErr *filter.ErrInvalidFilterAPIResponse
+	var valErr filter.ErrInvalidFilterAPIResponse
+	switch {
+	case errors.As(err, &ptrErr):
+		uri = ptrErr.URI
+	case errors.As(err, &valErr):
+		uri = valErr.URI
+	}
+
+	u, parseErr := url.Parse(uri)
+	if parseErr != nil {
+		return false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return false
+	}
+	resource := segments[len(segments)-2]
+	return resource == "filters" || resource == "filter-outputs"
+}
+
+// errorStatus returns the status code of the response for the provided error
+func errorStatus(err error) int {
+	switch err := err.(type) {
+	case filter.ErrInvalidFilterAPIResponse:
+		if err.ActualCode == http.StatusNotFound {
+			return http.StatusNotFound
+		}
+		return http.StatusBadGateway
+	case ClientError:
+		return err.Code()
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// problem is the body of the error responses returned to JSON clients
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// writeProblem writes the problem details of an error to JSON clients
+func writeProblem(w http.ResponseWriter, req *http.Request, status int, pageErr pageError) {
+	p := problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: req.URL.Path,
+	}
+	if pageErr != nil {
+		p.Type = pageErr.kind()
+		p.Title = pageErr.title()
+	}
+	if formErr, ok := pageErr.(formError); ok {
+		p.Detail = formErr.msg
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		log.Error(req.Context(), "failed to marshal problem details", err)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		log.Error(req.Context(), "failed to write problem details", err)
+	}
+}
+
+// renderErrorPage renders the error page of the provided error, with links for the user to recover from it
+func (f *Filter) renderErrorPage(w http.ResponseWriter, req *http.Request, status int, pageErr pageError) {
+	filterID := mux.Vars(req)["filterID"]
+	lang := dprequest.GetLocaleCode(req)
+
+	p := model.FilterError{Page: f.RenderClient.NewBasePageModel()}
+	p.Language = lang
+	p.Type = "filter-error"
+	p.Metadata.Title = pageErr.title()
+	p.Error = core.Error{
+		Title:     pageErr.title(),
+		Language:  lang,
+		ErrorCode: status,
+	}
+	p.Data.FilterID = filterID
+	p.Data.DatasetURL = datasetReferer(req)
+	if filterID != "" {
+		p.Data.FilterURL = fmt.Sprintf("/filters/%s/dimensions", filterID)
+	}
+	if formErr, ok := pageErr.(formError); ok {
+		p.Data.Detail = formErr.msg
+	}
+	if req.Method == http.MethodGet {
+		p.Data.RetryURL = req.URL.RequestURI()
+	} else {
+		p.Data.RetryURL = p.Data.FilterURL
+	}
+
+	f.RenderClient.BuildPage(&statusWriter{ResponseWriter: w, status: status}, p, "filter-errors/"+pageErr.kind())
+}
+
+// datasetReferer returns the path of the dataset page the user came from, if any,
+// so that they can start their filter journey again from it
+func datasetReferer(req *http.Request) string {
+	ref, err := url.Parse(req.Referer())
+	if err != nil || (ref.Host != "" && ref.Host != req.Host) || !strings.HasPrefix(ref.Path, "/datasets/") {
+		return ""
+	}
+	return ref.Path
+}
+
+// ErrorPageRenderer renders the generic error pages of the site
+type ErrorPageRenderer interface {
+	NewBasePageModel() core.Page
+	BuildErrorPage(w io.Writer, pageModel core.Page, statusCode int)
+}
+
+// ErrorPages is middleware that renders the generic error page for the error responses written without a body.
+// Unlike the renderror middleware, it leaves alone the error responses that set their own content type,
+// such as the filter error pages and the problem details returned to JSON clients.
+func ErrorPages(rc ErrorPageRenderer) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			h.ServeHTTP(&errorPageWriter{ResponseWriter: w, req: req, rc: rc}, req)
+		})
+	}
+}
+
+// errorPageWriter is a http.ResponseWriter that renders the generic error page for error responses without a content type
+type errorPageWriter struct {
+	http.ResponseWriter
+	req         *http.Request
+	rc          ErrorPageRenderer
+	intercepted bool
+}
+
+func (w *errorPageWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest || w.Header().Get("Content-Type") != "" {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	log.Info(w.req.Context(), "rendering generic error page", log.Data{"status": status})
+	w.intercepted = true
+	switch status {
+	case http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError:
+		p := w.rc.NewBasePageModel()
+		preferencesCookie := cookies.GetCookiePreferences(w.req)
+		p.CookiesPreferencesSet = preferencesCookie.IsPreferenceSet
+		p.CookiesPolicy.Essential = preferencesCookie.Policy.Essential
+		p.CookiesPolicy.Usage = preferencesCookie.Policy.Usage
+		w.rc.BuildErrorPage(w.ResponseWriter, p, status)
+	default:
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *errorPageWriter) Write(b []byte) (int, error) {
+	if w.intercepted {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClassifyError(t *testing.T) {
+	Convey("Filter API responses are classified by their status code", t, func() {
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusNotFound, URI: "http://localhost:22100/filters/12345"}, "12345"), ShouldResemble, filterNotFoundError{"12345"})
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusNotFound, URI: "http://localhost:22100/filter-outputs/67890"}, "12345"), ShouldResemble, filterNotFoundError{"12345"})
+		So(classifyError(filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusGone}, "12345"), ShouldResemble, filterExpiredError{"12345"})
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusConflict}, "12345"), ShouldResemble, filterConflictError{"12345"})
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusServiceUnavailable}, "12345"), ShouldHaveSameTypeAs, downstreamError{})
+		So(classifyError(filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusBadRequest}, "12345"), ShouldHaveSameTypeAs, downstreamError{})
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusBadRequest}, "12345"), ShouldBeNil)
+	})
+
+	Convey("Filter API responses for the dimensions of a filter that was found are not classified as a missing filter", t, func() {
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusNotFound, URI: "http://localhost:22100/filters/12345/dimensions/geography/options"}, "12345"), ShouldBeNil)
+		So(classifyError(filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusNotFound, URI: "http://localhost:22100/filters/12345/dimensions/geography"}, "12345"), ShouldBeNil)
+		So(classifyError(&filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusNotFound, URI: "http://localhost:22100/filter-outputs/67890/preview"}, "12345"), ShouldBeNil)
+		So(errorStatus(filter.ErrInvalidFilterAPIResponse{ActualCode: http.StatusNotFound}), ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Filters modified while being read are classified as a conflict", t, func() {
+		So(classifyError(filter.ErrBatchETagMismatch, "12345"), ShouldResemble, filterConflictError{"12345"})
+		So(classifyError(errInconsistentFilter, "12345"), ShouldResemble, filterConflictError{"12345"})
+	})
+
+	Convey("Invalid form values are classified as a validation failure", t, func() {
+		So(classifyError(errMissingVersion, "12345"), ShouldResemble, errMissingVersion)
+	})
+
+	Convey("Unreachable APIs are classified as downstream unavailable", t, func() {
+		err := &url.Error{Op: "Get", URL: "http://localhost:22400", Err: &timeoutError{}}
+		So(classifyError(err, "12345"), ShouldHaveSameTypeAs, downstreamError{})
+	})
+
+	Convey("Other errors are not classified", t, func() {
+		So(classifyError(errors.New("internal error"), "12345"), ShouldBeNil)
+		So(classifyError(&testCliError{}, "12345"), ShouldBeNil)
+		So(classifyError(nil, "12345"), ShouldBeNil)
+	})
+}
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func TestSetStatusCodeErrorPages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	setStatusCode := func(f *Filter, req *http.Request, err error) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.PathPrefix("/filters/{filterID}/").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			f.setStatusCode(req, w, err)
+		})
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("Given an error that has its own error page", t, func() {
+		err := &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict}
+
+		Convey("When the page is requested by a browser, then the error page is rendered with links to recover from it", func() {
+			mockRend := NewMockRenderClient(mockCtrl)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+			var page model.FilterError
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "filter-errors/filter-conflict").Do(func(w io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.FilterError)
+				w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions/age", http.NoBody)
+			req.Header.Set("Referer", "http://example.com/datasets/cpih01/editions/time-series/versions/1")
+			w := setStatusCode(&Filter{RenderClient: mockRend}, req, err)
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+			So(page.Error.ErrorCode, ShouldEqual, http.StatusConflict)
+			So(page.Data.FilterID, ShouldEqual, "12345")
+			So(page.Data.FilterURL, ShouldEqual, "/filters/12345/dimensions")
+			So(page.Data.RetryURL, ShouldEqual, "/filters/12345/dimensions/age")
+			So(page.Data.DatasetURL, ShouldEqual, "/datasets/cpih01/editions/time-series/versions/1")
+		})
+
+		Convey("When the page is requested by a JSON client, then the problem details are returned", func() {
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions/age?format=json", http.NoBody)
+			w := setStatusCode(&Filter{}, req, err)
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+			So(w.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+			So(w.Body.String(), ShouldEqual, `{"type":"filter-conflict","title":"Filter changed","status":409,"instance":"/filters/12345/dimensions/age"}`)
+		})
+	})
+
+	Convey("Given a form submitted with an invalid value, then the validation page is rendered with the reason", t, func() {
+		mockRend := NewMockRenderClient(mockCtrl)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+		var page model.FilterError
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "filter-errors/validation").Do(func(w io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.FilterError)
+			w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest("POST", "/filters/12345/use-version", http.NoBody)
+		w := setStatusCode(&Filter{RenderClient: mockRend}, req, errMissingVersion)
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(page.Data.Detail, ShouldEqual, "no target version provided")
+		So(page.Data.RetryURL, ShouldEqual, "/filters/12345/dimensions")
+		So(page.Data.DatasetURL, ShouldBeEmpty)
+	})
+
+	Convey("Given an error without its own error page", t, func() {
+		err := errors.New("internal error")
+
+		Convey("When the page is requested by a browser, then only the status is written", func() {
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions", http.NoBody)
+			w := setStatusCode(&Filter{}, req, err)
+
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(w.Body.Len(), ShouldEqual, 0)
+		})
+
+		Convey("When the page is requested by a JSON client, then generic problem details are returned", func() {
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions", http.NoBody)
+			req.Header.Set("Accept", "application/json")
+			w := setStatusCode(&Filter{}, req, err)
+
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(w.Body.String(), ShouldEqual, `{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/filters/12345/dimensions"}`)
+		})
+	})
+}
+
+type fakeErrorPageRenderer struct {
+	statuses []int
+}
+
+func (r *fakeErrorPageRenderer) NewBasePageModel() core.Page { return core.Page{} }
+
+func (r *fakeErrorPageRenderer) BuildErrorPage(w io.Writer, _ core.Page, statusCode int) {
+	r.statuses = append(r.statuses, statusCode)
+	w.(http.ResponseWriter).WriteHeader(statusCode)
+	_, _ = w.Write([]byte("generic error page"))
+}
+
+func TestErrorPages(t *testing.T) {
+	serve := func(rc ErrorPageRenderer, h http.HandlerFunc) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ErrorPages(rc)(h).ServeHTTP(w, httptest.NewRequest("GET", "/filters/12345/dimensions", http.NoBody))
+		return w
+	}
+
+	Convey("Given an error response without a body, then the generic error page is rendered", t, func() {
+		rc := &fakeErrorPageRenderer{}
+		w := serve(rc, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		So(rc.statuses, ShouldResemble, []int{http.StatusNotFound})
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+		So(w.Body.String(), ShouldEqual, "generic error page")
+	})
+
+	Convey("Given an error response rendered by a handler, then it is left untouched", t, func() {
+		rc := &fakeErrorPageRenderer{}
+		w := serve(rc, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte("filter conflict page"))
+		})
+
+		So(rc.statuses, ShouldBeEmpty)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Body.String(), ShouldEqual, "filter conflict page")
+	})
+
+	Convey("Given an error response without a generic error page, then only the status is written", t, func() {
+		rc := &fakeErrorPageRenderer{}
+		w := serve(rc, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("bad gateway"))
+		})
+
+		So(rc.statuses, ShouldBeEmpty)
+		So(w.Code, ShouldEqual, http.StatusBadGateway)
+		So(w.Body.Len(), ShouldEqual, 0)
+	})
+}
@@ -1,17 +1,14 @@
 package handlers
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"sort"
-	"strings"
 	"unicode"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 
 	"github.com/ONSdigital/log.go/v2/log"
@@ -22,131 +19,148 @@ import (
 // Contains stubbed data for now - page to be populated by the API
 func (f *Filter) FilterOverview() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
-		vars := mux.Vars(req)
-		filterID := vars["filterID"]
-		ctx := req.Context()
-
-		hasUnsetDimensions := req.URL.Query().Get("hasUnsetDimensions")
+		f.filterOverview(w, req, lang, collectionID, userAccessToken, false)
+	})
+}
 
-		dims, eTag0, err := f.FilterClient.GetDimensions(req.Context(), userAccessToken, "", collectionID, filterID, nil)
+// filterOverview renders the filter overview. If conflict is true, it explains that the changes submitted by the user
+// could not be saved because the filter was modified since the page was loaded.
+func (f *Filter) filterOverview(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string, conflict bool) {
+	vars := mux.Vars(req)
+	filterID := vars["filterID"]
+	ctx := req.Context()
+
+	hasUnsetDimensions := req.URL.Query().Get("hasUnsetDimensions")
+
+	// get the filter, its dimensions and the selected options for each dimension from filter API,
+	// retrying if the filter is modified between calls
+	var dims filter.Dimensions
+	var fc *filterContext
+	var selectedOptions []filter.DimensionOptions
+	err := f.retryFilterReads(ctx, "filter_overview", filterID, func() error {
+		var eTag0 string
+		var err error
+		dims, eTag0, err = f.FilterClient.GetDimensions(req.Context(), userAccessToken, "", collectionID, filterID, nil)
 		if err != nil {
 			log.Error(ctx, "failed to get dimensions", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-
-		fj, eTag1, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-
-		// The user might want to retry this handler if eTags don't match
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
-			return
-		}
-
-		versionURL, err := url.Parse(fj.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
+			return err
 		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
 
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
+		fc, err = f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
-			return
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			return err
 		}
 
-		datasetDimensions, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
-		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
+		if eTag0 != fc.ETag {
+			return errInconsistentFilter
 		}
 
-		// get selected options from filter API for each dimension and then get the labels from dataset API for each option
-		var dimensions FilterModelDimensions
+		selectedOptions = make([]filter.DimensionOptions, len(dims.Items))
 		for i := range dims.Items {
-			selVals, eTag2, oErr := f.FilterClient.GetDimensionOptionsInBatches(req.Context(), userAccessToken, "", collectionID, filterID, dims.Items[i].Name, f.BatchSize, f.BatchMaxWorkers)
-			if oErr != nil {
-				log.Error(ctx, "failed to get options from filter client", oErr, log.Data{"filter_id": filterID, "dimension": dims.Items[i].Name})
-				setStatusCode(req, w, oErr)
-				return
-			}
-
-			// The user might want to retry this handler if eTags don't match
-			if eTag2 != eTag1 {
-				conflictErr := errors.New("inconsistent filter data")
-				log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-					log.Data{"filter_id": filterID, "e_tag_1": eTag1, "e_tag_2": eTag2})
-				setStatusCode(req, w, conflictErr)
-				return
-			}
-
-			selValsLabelMap, oErr := f.getIDNameLookupFromDatasetAPI(ctx, userAccessToken, collectionID, datasetID, edition, version, dims.Items[i].Name, selVals)
-			if oErr != nil {
-				log.Error(ctx, "failed to get options from dataset client", oErr, log.Data{"dimension": dims.Items[i].Name, "dataset_id": datasetID, "edition": edition, "version": version})
-				setStatusCode(req, w, oErr)
-				return
+			var eTag2 string
+			selectedOptions[i], eTag2, err = f.FilterClient.GetDimensionOptionsInBatches(req.Context(), userAccessToken, "", collectionID, filterID, dims.Items[i].Name, f.BatchSize, f.BatchMaxWorkers)
+			if err != nil {
+				log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": dims.Items[i].Name})
+				return err
 			}
 
-			labels := []string{}
-			for _, label := range selValsLabelMap {
-				labels = append(labels, label)
+			if eTag2 != fc.ETag {
+				return errInconsistentFilter
 			}
-
-			dimensions = append(dimensions, filter.ModelDimension{
-				Name:   dims.Items[i].Name,
-				Values: labels,
-			})
 		}
-		sort.Sort(dimensions)
+		return nil
+	})
+	if err != nil {
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fj, eTag, datasetID, edition, version := fc.Filter, fc.ETag, fc.DatasetID, fc.Edition, fc.Version
 
-		dataset, err := f.DatasetClient.Get(req.Context(), userAccessToken, "", collectionID, datasetID)
-		if err != nil {
-			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
+	datasetDimensions, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	// get the labels from dataset API for the selected options of each dimension
+	var dimensions FilterModelDimensions
+	for i := range dims.Items {
+		selValsLabelMap, oErr := f.getIDNameLookupFromDatasetAPI(ctx, userAccessToken, collectionID, datasetID, edition, version, dims.Items[i].Name, selectedOptions[i])
+		if oErr != nil {
+			log.Error(ctx, "failed to get options from dataset client", oErr, log.Data{"dimension": dims.Items[i].Name, "dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, oErr)
 			return
 		}
 
-		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
-		if err != nil {
-			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+		labels := []string{}
+		for _, label := range selValsLabelMap {
+			labels = append(labels, label)
 		}
 
-		bp := f.RenderClient.NewBasePageModel()
-		p := mapper.CreateFilterOverview(req, bp, dimensions, datasetDimensions.Items, fj, dataset, filterID, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+		dimensions = append(dimensions, filter.ModelDimension{
+			Name:   dims.Items[i].Name,
+			Values: labels,
+		})
+	}
+	sort.Sort(dimensions)
 
-		editionDetails, err := f.DatasetClient.GetEdition(req.Context(), userAccessToken, "", collectionID, datasetID, edition)
-		if err != nil {
-			log.Error(ctx, "failed to get edition details", err, log.Data{"dataset": datasetID, "edition": edition})
-			setStatusCode(req, w, err)
-			return
-		}
+	dataset, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		latestVersionInEditionPath := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, editionDetails.Links.LatestVersion.ID)
-		if latestVersionInEditionPath == versionPath {
-			p.Data.IsLatestVersion = true
-		}
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
 
-		p.Data.LatestVersion.DatasetLandingPageURL = latestVersionInEditionPath
-		p.Data.LatestVersion.FilterJourneyWithLatestJourney = fmt.Sprintf("/filters/%s/use-latest-version", filterID)
+	bp := f.RenderClient.NewBasePageModel()
+	p := mapper.CreateFilterOverview(req, bp, dimensions, datasetDimensions.Items, fj, dataset, filterID, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
 
-		if hasUnsetDimensions == "true" {
-			p.Data.HasUnsetDimensions = true
-		}
+	editionDetails, err := f.DatasetClient.GetEdition(req.Context(), userAccessToken, "", collectionID, datasetID, edition)
+	if err != nil {
+		log.Error(ctx, "failed to get edition details", err, log.Data{"dataset": datasetID, "edition": edition})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		f.RenderClient.BuildPage(w, p, "filter-overview")
-	})
+	latestVersionInEditionPath := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, editionDetails.Links.LatestVersion.ID)
+	if editionDetails.Links.LatestVersion.ID == version {
+		p.Data.IsLatestVersion = true
+	}
+
+	p.Data.LatestVersion.DatasetLandingPageURL = latestVersionInEditionPath
+	p.Data.LatestVersion.FilterJourneyWithLatestJourney = fmt.Sprintf("/filters/%s/use-latest-version", filterID)
+
+	if hasUnsetDimensions == "true" {
+		p.Data.HasUnsetDimensions = true
+	}
+	p.Data.Undo = f.undoLink(ctx, filterID, eTag, req.URL.Path)
+	p.Data.Share = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/permalink", filterID),
+		Label: "Share these filter options",
+	}
+	p.Data.Export = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/selections.json", filterID),
+		Label: "Download my selections",
+	}
+	p.Data.Import = model.Link{
+		URL:   "/filters/import",
+		Label: "Start a new filter from downloaded selections",
+	}
+
+	p.Data.ClearAll.URL = withETag(p.Data.ClearAll.URL, eTag)
+	if !conflict {
+		f.buildPage(w, req, p, "filter-overview")
+		return
+	}
+
+	p.Error = conflictMessage(lang)
+	f.buildPageWithStatus(w, req, p, "filter-overview", http.StatusConflict)
 }
 
 // FilterOverviewClearAll removes all selected options for all dimensions
@@ -156,27 +170,45 @@ func (f *Filter) FilterOverviewClearAll() http.HandlerFunc {
 		filterID := vars["filterID"]
 		ctx := req.Context()
 
-		dims, eTag, err := f.FilterClient.GetDimensions(req.Context(), userAccessToken, "", collectionID, filterID, nil)
+		dims, _, err := f.FilterClient.GetDimensions(req.Context(), userAccessToken, "", collectionID, filterID, nil)
 		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err)
+			log.Error(ctx, "failed to get dimensions", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
+		// the options are only cleared if the filter wasn't modified since the page was loaded
+		eTag := submittedETag(req)
+
+		names := make([]string, 0, len(dims.Items))
+		for i := range dims.Items {
+			names = append(names, dims.Items[i].Name)
+		}
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, names...)
+
 		for i := range dims.Items {
 			eTag, err = f.FilterClient.RemoveDimension(req.Context(), userAccessToken, "", collectionID, filterID, dims.Items[i].Name, eTag)
+			if isConflict(err) {
+				log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID})
+				forgetFilter(ctx, filterID)
+				f.filterOverview(w, req, lang, collectionID, userAccessToken, true)
+				return
+			}
 			if err != nil {
 				log.Error(ctx, "failed to remove dimension", err, log.Data{"filter_id": filterID, "dimension": dims.Items[i].Name})
-				setStatusCode(req, w, err)
+				f.setStatusCode(req, w, err)
 				return
 			}
 
 			eTag, err = f.FilterClient.AddDimension(req.Context(), userAccessToken, "", collectionID, filterID, dims.Items[i].Name, eTag)
 			if err != nil {
 				log.Error(ctx, "failed to add dimension", err, log.Data{"filter_id": filterID, "dimension": dims.Items[i].Name})
-				setStatusCode(req, w, err)
+				f.setStatusCode(req, w, err)
 				return
 			}
 		}
+		forgetFilter(ctx, filterID)
+		rec.commitSelected(ctx, nil)
 
 		redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
 
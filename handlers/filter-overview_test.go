@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -8,6 +9,7 @@ import (
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
 	core "github.com/ONSdigital/dp-renderer/v2/model"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -105,7 +107,7 @@ func TestUnitFilterOverview(t *testing.T) {
 			mockFilterClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, filterID, "Goods and Services", testETag(4)).Return(testETag(5), nil)
 			mockFilterClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, filterID, "Goods and Services", testETag(5)).Return(testETag(6), nil)
 
-			req := httptest.NewRequest("GET", "/filters/12345/dimensions/clear-all", http.NoBody)
+			req := httptest.NewRequest("GET", withETag("/filters/12345/dimensions/clear-all", testETag(0)), http.NoBody)
 			w := httptest.NewRecorder()
 
 			router := mux.NewRouter()
@@ -117,5 +119,50 @@ func TestUnitFilterOverview(t *testing.T) {
 			So(w.Code, ShouldEqual, http.StatusFound)
 			So(w.Header().Get("Location"), ShouldEqual, "/filters/12345/dimensions")
 		})
+
+		Convey("test FilterOverviewClearAll renders the overview again if the filter was modified since the page was loaded", func() {
+			mockFilterClient := NewMockFilterClient(mockCtrl)
+			mockFilterClient.EXPECT().GetDimensions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, filterID, nil).
+				Return(
+					filter.Dimensions{
+						Items: []filter.Dimension{{Name: "geography"}},
+					}, testETag(1), nil).Times(2)
+			mockFilterClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, filterID, "geography", testETag(0)).
+				Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict})
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, filterID, "geography", batchSize, maxWorkers).Return(filterGeographyOptions, testETag(1), nil)
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, mockDownloadToken, mockCollectionID, filterID).Return(filter.Model{Links: filter.Links{Version: filter.Link{HRef: "/v1/datasets/95c4669b-3ae9-4ba7-b690-87e890a1c67c/editions/2016/versions/1"}}}, testETag(1), nil)
+
+			mockDatasetClient := NewMockDatasetClient(mockCtrl)
+			mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016", "1").Return(dataset.VersionDimensions{
+				Items: []dataset.VersionDimension{{Name: "geography"}}}, nil)
+			mockDatasetClient.EXPECT().GetOptionsBatchProcess(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016", "1", "geography",
+				&[]string{"geoUK"}, gomock.Any(), maxDatasetOptions, maxWorkers).Return(nil)
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c").Return(dataset.DatasetDetails{}, nil)
+			mockDatasetClient.EXPECT().GetEdition(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016").Return(dataset.Edition{}, nil)
+
+			mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+			mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/")
+
+			var page model.Overview
+			mockRend := NewMockRenderClient(mockCtrl)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "filter-overview").Do(func(w io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.Overview)
+				w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", withETag("/filters/12345/dimensions/clear-all", testETag(0)), http.NoBody)
+			w := httptest.NewRecorder()
+
+			router := mux.NewRouter()
+			f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+			router.Path("/filters/{filterID}/dimensions/clear-all").HandlerFunc(f.FilterOverviewClearAll())
+
+			router.ServeHTTP(w, req)
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+			So(page.Error.Title, ShouldNotBeEmpty)
+			So(page.Data.ClearAll.URL, ShouldEqual, withETag("/filters/12345/dimensions/clear-all", testETag(1)))
+		})
 	})
 }
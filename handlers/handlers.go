@@ -1,20 +1,43 @@
 package handlers
 
 import (
+	"encoding/json"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/flatten"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/history"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
 	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
 )
 
 // Constants
 const (
-	age       = "age"
-	geography = "geography"
-	list      = "list"
-	strRange  = "range"
-	strTime   = "time"
+	age      = "age"
+	bands    = "bands"
+	isoDate  = "2006-01-02"
+	list     = "list"
+	relTime  = "relative"
+	single   = "single"
+	strRange = "range"
+	strTime  = "time"
+)
+
+// Codes of the UK geography hierarchy, kept for existing users of the package.
+//
+// Deprecated: use the constants of the flatten package, which defines the rules the hierarchies are flattened with.
+const (
+	Uk              = flatten.Uk
+	GreatBritain    = flatten.GreatBritain
+	EnglandAndWales = flatten.EnglandAndWales
+	England         = flatten.England
+	NorthernIreland = flatten.NorthernIreland
+	Scotland        = flatten.Scotland
+	Wales           = flatten.Wales
 )
 
 // Filter represents the handlers for Filtering
@@ -25,6 +48,9 @@ type Filter struct {
 	ZebedeeClient        ZebedeeClient
 	HierarchyClient      HierarchyClient
 	SearchClient         SearchClient
+	History              history.Store
+	RelativeTime         relative.Store
+	Flattening           flatten.Rules
 	SearchAPIAuthToken   string
 	downloadServiceURL   string
 	EnableDatasetPreview bool
@@ -32,6 +58,11 @@ type Filter struct {
 	BatchSize            int
 	BatchMaxWorkers      int
 	maxDatasetOptions    int
+	maxUploadSize        int64
+	ordinalDimensions    []string
+	ageBands             []string
+	retryAttempts        int
+	retryBackoff         time.Duration
 }
 
 // NewFilter creates a new instance of Filter
@@ -44,6 +75,7 @@ func NewFilter(rc RenderClient, fc FilterClient, dc DatasetClient, hc HierarchyC
 		HierarchyClient:      hc,
 		SearchClient:         sc,
 		ZebedeeClient:        zc,
+		Flattening:           flatten.Default(),
 		APIRouterVersion:     apiRouterVersion,
 		downloadServiceURL:   cfg.DownloadServiceURL,
 		EnableDatasetPreview: cfg.EnableDatasetPreview,
@@ -51,21 +83,90 @@ func NewFilter(rc RenderClient, fc FilterClient, dc DatasetClient, hc HierarchyC
 		BatchSize:            cfg.BatchSizeLimit,
 		BatchMaxWorkers:      cfg.BatchMaxWorkers,
 		maxDatasetOptions:    cfg.MaxDatasetOptions,
+		maxUploadSize:        int64(cfg.MaxUploadSizeMB) << 20,
+		ordinalDimensions:    cfg.OrdinalDimensions,
+		ageBands:             cfg.AgeBands,
+		retryAttempts:        cfg.FilterRetryAttempts,
+		retryBackoff:         cfg.FilterRetryBackoff,
 	}
 }
 
-func setStatusCode(req *http.Request, w http.ResponseWriter, err error) {
+// formError is returned when a form submitted by the user is missing a value or has an invalid one
+type formError struct {
+	msg string
+}
+
+func (e formError) Error() string { return e.msg }
+func (e formError) Code() int     { return http.StatusBadRequest }
+
+// setStatusCode writes the response for the provided error. Errors that have their own error page are rendered
+// with links for the user to recover from them, others are left to the generic error pages.
+// JSON clients get the problem details of the error instead.
+func (f *Filter) setStatusCode(req *http.Request, w http.ResponseWriter, err error) {
 	status := http.StatusOK
+	var pageErr pageError
 	if err != nil {
-		switch err := err.(type) {
-		case filter.ErrInvalidFilterAPIResponse:
-			status = http.StatusBadGateway
-		case ClientError:
-			status = err.Code()
-		default:
-			status = http.StatusInternalServerError
+		status = errorStatus(err)
+		if pageErr = classifyError(err, mux.Vars(req)["filterID"]); pageErr != nil {
+			status = pageErr.Code()
 		}
 	}
 	log.Info(req.Context(), "setting response status", log.FormatErrors([]error{err}), log.Data{"status": status})
+
+	switch {
+	case status < http.StatusBadRequest:
+		w.WriteHeader(status)
+	case wantsJSON(req):
+		writeProblem(w, req, status, pageErr)
+	case pageErr != nil:
+		f.renderErrorPage(w, req, status, pageErr)
+	default:
+		w.WriteHeader(status)
+	}
+}
+
+// wantsJSON returns true if the client asked for a JSON representation of the page,
+// either with a '?format=json' query parameter or an 'Accept: application/json' header
+func wantsJSON(req *http.Request) bool {
+	if req.URL.Query().Get("format") == "json" {
+		return true
+	}
+
+	for _, accepted := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPage renders the page model with the provided template, or marshals it as JSON if the client requested it
+func (f *Filter) buildPage(w http.ResponseWriter, req *http.Request, pageModel interface{}, templateName string) {
+	f.buildPageWithStatus(w, req, pageModel, templateName, http.StatusOK)
+}
+
+// buildPageWithStatus builds the page like buildPage, responding with the provided status code
+func (f *Filter) buildPageWithStatus(w http.ResponseWriter, req *http.Request, pageModel interface{}, templateName string, status int) {
+	w.Header().Add("Vary", "Accept")
+
+	if !wantsJSON(req) {
+		if status != http.StatusOK {
+			w = &statusWriter{ResponseWriter: w, status: status}
+		}
+		f.RenderClient.BuildPage(w, pageModel, templateName)
+		return
+	}
+
+	b, err := json.Marshal(pageModel)
+	if err != nil {
+		log.Error(req.Context(), "failed to marshal page model", err, log.Data{"template": templateName})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
+	//nolint:errcheck // ignore error
+	w.Write(b)
 }
@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -15,13 +17,15 @@ func (e *testCliError) Error() string { return "client error" }
 func (e *testCliError) Code() int     { return http.StatusNotFound }
 
 func TestUnitHandlers(t *testing.T) {
+	f := &Filter{}
+
 	Convey("test setStatusCode", t, func() {
 		Convey("test status code handles 404 response from client", func() {
 			req := httptest.NewRequest("GET", "http://localhost:20000", http.NoBody)
 			w := httptest.NewRecorder()
 			err := &testCliError{}
 
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 
 			So(w.Code, ShouldEqual, http.StatusNotFound)
 		})
@@ -31,9 +35,56 @@ func TestUnitHandlers(t *testing.T) {
 			w := httptest.NewRecorder()
 			err := errors.New("internal server error")
 
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 
 			So(w.Code, ShouldEqual, http.StatusInternalServerError)
 		})
 	})
 }
+
+func TestBuildPage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	p := model.Overview{FilterID: "12345"}
+
+	Convey("Given a filter with a mocked render client", t, func() {
+		mockRend := NewMockRenderClient(mockCtrl)
+		f := &Filter{RenderClient: mockRend}
+
+		Convey("When a page is requested without any JSON indication, then the template is rendered", func() {
+			mockRend.EXPECT().BuildPage(gomock.Any(), p, "filter-overview")
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions", http.NoBody)
+			req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+			w := httptest.NewRecorder()
+
+			f.buildPage(w, req, p, "filter-overview")
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Vary"), ShouldEqual, "Accept")
+		})
+
+		Convey("When a page is requested with an 'Accept: application/json' header, then the page model is returned as JSON", func() {
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions", http.NoBody)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+
+			f.buildPage(w, req, p, "filter-overview")
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			So(w.Body.String(), ShouldContainSubstring, `"filter_id":"12345"`)
+		})
+
+		Convey("When a page is requested with a 'format=json' query parameter, then the page model is returned as JSON", func() {
+			req := httptest.NewRequest("GET", "/filters/12345/dimensions?format=json", http.NoBody)
+			w := httptest.NewRecorder()
+
+			f.buildPage(w, req, p, "filter-overview")
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			So(w.Body.String(), ShouldContainSubstring, `"filter_id":"12345"`)
+		})
+	})
+}
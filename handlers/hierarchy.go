@@ -2,34 +2,20 @@ package handlers
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"sort"
-	"strings"
+	"sync"
 
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/flatten"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 
-	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/gorilla/mux"
 )
 
-// codes for geography nodes that need to be flattened in a single layer
-const (
-	Uk              = "K02000001"
-	GreatBritain    = "K03000001"
-	EnglandAndWales = "K04000001"
-	England         = "E92000001"
-	NorthernIreland = "N92000002"
-	Scotland        = "S92000003"
-	Wales           = "W92000004"
-)
-
 // HierarchyUpdate controls the updating of a hierarchy job
 func (f *Filter) HierarchyUpdate() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
@@ -56,27 +42,37 @@ func (f *Filter) HierarchyUpdate() http.HandlerFunc {
 			}
 		}
 
-		fil, eTag, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
+		// the changes are only saved if the filter wasn't modified since the page was loaded
+		eTag := submittedETag(req)
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+
 		if len(req.Form["add-all"]) > 0 {
-			f.addAllHierarchyLevel(w, req, fil, name, code, redirectURI, userAccessToken, collectionID, eTag)
+			f.addAllHierarchyLevel(w, req, lang, fc, name, code, redirectURI, userAccessToken, collectionID, eTag, rec)
 			return
 		}
 
 		if len(req.Form["remove-all"]) > 0 {
-			f.removeAllHierarchyLevel(w, req, fil, name, code, redirectURI, userAccessToken, collectionID, eTag)
+			f.removeAllHierarchyLevel(w, req, lang, fc, name, code, redirectURI, userAccessToken, collectionID, eTag, rec)
+			return
+		}
+
+		if len(req.Form["add-all-below"]) > 0 || len(req.Form["remove-all-below"]) > 0 {
+			remove := len(req.Form["remove-all-below"]) > 0
+			f.allBelowHierarchyLevel(w, req, lang, fc, name, code, redirectURI, userAccessToken, collectionID, eTag, rec, remove)
 			return
 		}
 
-		h, err := f.buildHierarchyModel(ctx, fil, name, code)
+		h, err := f.buildHierarchyModel(ctx, fc, name, code)
 		if err != nil {
 			log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": filterID, "dimension": name, "code": code})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -92,25 +88,25 @@ func (f *Filter) HierarchyUpdate() http.HandlerFunc {
 		addOptions := getOptionsAndRedirect(req.Form, &redirectURI)
 
 		_, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, addOptions, removeOptions, f.BatchSize, eTag)
+		if f.hierarchyConflict(w, req, lang, collectionID, userAccessToken, name, code, err, &pendingSelection{add: addOptions, remove: removeOptions}) {
+			return
+		}
 		if err != nil {
 			log.Error(ctx, "failed to patch dimension values", err, log.Data{"filter_id": filterID, "dimension": name, "code": code})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		forgetFilter(ctx, filterID)
+		rec.commit(ctx)
 		http.Redirect(w, req, redirectURI, http.StatusFound)
 	})
 }
 
-func (f *Filter) buildHierarchyModel(ctx context.Context, fil filter.Model, name, code string) (h hierarchy.Model, err error) {
+func (f *Filter) buildHierarchyModel(ctx context.Context, fc *filterContext, name, code string) (h hierarchy.Model, err error) {
 	if code != "" {
-		return f.HierarchyClient.GetChild(ctx, fil.InstanceID, name, code)
+		return f.HierarchyClient.GetChild(ctx, fc.Filter.InstanceID, name, code)
 	}
-	if name == geography {
-		h, err = f.flattenGeographyTopLevel(ctx, fil.InstanceID)
-	} else {
-		h, err = f.HierarchyClient.GetRoot(ctx, fil.InstanceID, name)
-	}
-
+	h, err = f.hierarchyRoot(ctx, fc, name)
 	if err != nil {
 		return h, err
 	}
@@ -124,23 +120,13 @@ func (f *Filter) buildHierarchyModel(ctx context.Context, fil filter.Model, name
 	return h, err
 }
 
-func (f *Filter) addAllHierarchyLevel(w http.ResponseWriter, req *http.Request, fil filter.Model, name, code, redirectURI, userAccessToken, collectionID, eTag string) {
+func (f *Filter) addAllHierarchyLevel(w http.ResponseWriter, req *http.Request, lang string, fc *filterContext, name, code, redirectURI, userAccessToken, collectionID, eTag string, rec *changeRecorder) {
 	ctx := req.Context()
-	var err error
 
-	var h hierarchy.Model
-	if code != "" {
-		h, err = f.HierarchyClient.GetChild(ctx, fil.InstanceID, name, code)
-	} else {
-		if name == geography {
-			h, err = f.flattenGeographyTopLevel(ctx, fil.InstanceID)
-		} else {
-			h, err = f.HierarchyClient.GetRoot(ctx, fil.InstanceID, name)
-		}
-	}
+	h, err := f.hierarchyNode(ctx, fc, name, code)
 	if err != nil {
-		log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": fil.FilterID, "dimension": name, "code": code})
-		setStatusCode(req, w, err)
+		log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": fc.Filter.FilterID, "dimension": name, "code": code})
+		f.setStatusCode(req, w, err)
 		return
 	}
 
@@ -148,31 +134,26 @@ func (f *Filter) addAllHierarchyLevel(w http.ResponseWriter, req *http.Request,
 	for _, child := range h.Children {
 		options = append(options, child.Links.Code.ID)
 	}
-	_, err = f.FilterClient.SetDimensionValues(req.Context(), userAccessToken, "", collectionID, fil.FilterID, name, options, eTag)
+	_, err = f.FilterClient.SetDimensionValues(req.Context(), userAccessToken, "", collectionID, fc.Filter.FilterID, name, options, eTag)
+	if f.hierarchyConflict(w, req, lang, collectionID, userAccessToken, name, code, err, &pendingSelection{add: options, replace: true}) {
+		return
+	}
 	if err != nil {
 		log.Error(ctx, "failed to add dimension values", err)
+	} else {
+		forgetFilter(ctx, fc.Filter.FilterID)
+		rec.commit(ctx)
 	}
 
 	http.Redirect(w, req, redirectURI, http.StatusFound)
 }
 
-func (f *Filter) removeAllHierarchyLevel(w http.ResponseWriter, req *http.Request, fil filter.Model, name, code, redirectURI, userAccessToken, collectionID, eTag string) {
+func (f *Filter) removeAllHierarchyLevel(w http.ResponseWriter, req *http.Request, lang string, fc *filterContext, name, code, redirectURI, userAccessToken, collectionID, eTag string, rec *changeRecorder) {
 	ctx := req.Context()
-	var h hierarchy.Model
-	var err error
-
-	if code != "" {
-		h, err = f.HierarchyClient.GetChild(ctx, fil.InstanceID, name, code)
-	} else {
-		if name == geography {
-			h, err = f.flattenGeographyTopLevel(ctx, fil.InstanceID)
-		} else {
-			h, err = f.HierarchyClient.GetRoot(ctx, fil.InstanceID, name)
-		}
-	}
+	h, err := f.hierarchyNode(ctx, fc, name, code)
 	if err != nil {
-		log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": fil.FilterID, "dimension": name, "code": code})
-		setStatusCode(req, w, err)
+		log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": fc.Filter.FilterID, "dimension": name, "code": code})
+		f.setStatusCode(req, w, err)
 		return
 	}
 
@@ -183,109 +164,231 @@ func (f *Filter) removeAllHierarchyLevel(w http.ResponseWriter, req *http.Reques
 	}
 
 	// remove all items
-	_, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, fil.FilterID, name, []string{}, removeOptions, f.BatchSize, eTag)
+	_, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, fc.Filter.FilterID, name, []string{}, removeOptions, f.BatchSize, eTag)
+	if f.hierarchyConflict(w, req, lang, collectionID, userAccessToken, name, code, err, &pendingSelection{remove: removeOptions}) {
+		return
+	}
 	if err != nil {
-		log.Error(ctx, "failed to remove dimension values using a patch", err, log.Data{"filter_id": fil.FilterID, "dimension": name, "code": code, "options": removeOptions})
+		log.Error(ctx, "failed to remove dimension values using a patch", err, log.Data{"filter_id": fc.Filter.FilterID, "dimension": name, "code": code, "options": removeOptions})
+	} else {
+		forgetFilter(ctx, fc.Filter.FilterID)
+		rec.commit(ctx)
 	}
 
 	http.Redirect(w, req, redirectURI, http.StatusFound)
 }
 
-// Hierarchy controls the creation of a hierarchy page
-func (f *Filter) Hierarchy() http.HandlerFunc {
-	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
-		vars := mux.Vars(req)
-		filterID := vars["filterID"]
-		name := vars["name"]
-		code := vars["code"]
-		ctx := req.Context()
+// allBelowHierarchyLevel adds every node with data below the current node to the filter, or removes them if remove
+// is true. Only the leaves of the hierarchy are added or removed if the user asked for them.
+func (f *Filter) allBelowHierarchyLevel(w http.ResponseWriter, req *http.Request, lang string, fc *filterContext, name, code, redirectURI, userAccessToken, collectionID, eTag string, rec *changeRecorder, remove bool) {
+	ctx := req.Context()
+	leavesOnly := len(req.Form["leaves-only"]) > 0
 
-		fil, eTag0, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
+	var h hierarchy.Model
+	var err error
+	if leavesOnly && code == "" {
+		// the flattened top level lists some nodes without their children, so the leaves are looked for from the root
+		h, err = f.HierarchyClient.GetRoot(ctx, fc.Filter.InstanceID, name)
+	} else {
+		h, err = f.hierarchyNode(ctx, fc, name, code)
+	}
+	if err != nil {
+		log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": fc.Filter.FilterID, "dimension": name, "code": code})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		var h hierarchy.Model
-		if code != "" {
-			h, err = f.HierarchyClient.GetChild(ctx, fil.InstanceID, name, code)
-		} else {
-			if name == geography {
-				h, err = f.flattenGeographyTopLevel(ctx, fil.InstanceID)
-			} else {
-				h, err = f.HierarchyClient.GetRoot(ctx, fil.InstanceID, name)
+	options, err := f.hierarchyDescendants(ctx, fc.Filter.InstanceID, name, h, leavesOnly)
+	if err != nil {
+		log.Error(ctx, "failed to get hierarchy descendants", err, log.Data{"filter_id": fc.Filter.FilterID, "dimension": name, "code": code})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	addOptions, removeOptions := options, []string{}
+	if remove {
+		addOptions, removeOptions = []string{}, options
+	}
+	_, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, fc.Filter.FilterID, name, addOptions, removeOptions, f.BatchSize, eTag)
+	if f.hierarchyConflict(w, req, lang, collectionID, userAccessToken, name, code, err, &pendingSelection{add: addOptions, remove: removeOptions}) {
+		return
+	}
+	if err != nil {
+		log.Error(ctx, "failed to patch hierarchy descendants", err,
+			log.Data{"filter_id": fc.Filter.FilterID, "dimension": name, "code": code, "remove": remove, "leaves_only": leavesOnly, "options": len(options)})
+	} else {
+		forgetFilter(ctx, fc.Filter.FilterID)
+		rec.commit(ctx)
+	}
+
+	http.Redirect(w, req, redirectURI, http.StatusFound)
+}
+
+// hierarchyDescendants returns the codes of the nodes with data below the provided node, level by level, or only the
+// codes of the ones without children if leavesOnly is true
+func (f *Filter) hierarchyDescendants(ctx context.Context, instanceID, name string, h hierarchy.Model, leavesOnly bool) ([]string, error) {
+	codes := []string{}
+	level := h.Children
+	for len(level) > 0 {
+		parents := []string{}
+		for _, child := range level {
+			if child.NumberofChildren > 0 {
+				parents = append(parents, child.Links.Code.ID)
+			}
+			if child.HasData && (!leavesOnly || child.NumberofChildren == 0) {
+				codes = append(codes, child.Links.Code.ID)
 			}
 		}
 
-		if err != nil {
-			log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": filterID, "dimension": name, "code": code})
-			setStatusCode(req, w, err)
-			return
+		var err error
+		if level, err = f.hierarchyChildren(ctx, instanceID, name, parents); err != nil {
+			return nil, err
 		}
+	}
+	return codes, nil
+}
 
-		selVals, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(req.Context(), userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
-			return
+// hierarchyChildren returns the children of the nodes with the provided codes, in the order of the codes, getting
+// the nodes from hierarchy API with up to BatchMaxWorkers concurrent calls. No more calls are made once the context
+// is done.
+func (f *Filter) hierarchyChildren(ctx context.Context, instanceID, name string, codes []string) ([]hierarchy.Child, error) {
+	nodes := make([]hierarchy.Model, len(codes))
+	errs := make([]error, len(codes))
+
+	workers := make(chan struct{}, max(f.BatchMaxWorkers, 1))
+	var wg sync.WaitGroup
+	for i, code := range codes {
+		workers <- struct{}{}
+		if err := ctx.Err(); err != nil {
+			// the request was cancelled, so no more nodes are requested
+			wg.Wait()
+			return nil, err
 		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			nodes[i], errs[i] = f.HierarchyClient.GetChild(ctx, instanceID, name, code)
+		}()
+	}
+	wg.Wait()
 
-		// The user might want to retry this handler if eTags don't match
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "dimension": name, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
-			return
+	children := []hierarchy.Child{}
+	for i := range nodes {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
+		children = append(children, nodes[i].Children...)
+	}
+	return children, nil
+}
 
-		versionURL, err := url.Parse(fil.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
-		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
-			return
-		}
+// Hierarchy controls the creation of a hierarchy page
+func (f *Filter) Hierarchy() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		f.hierarchySelector(w, req, lang, collectionID, userAccessToken, req.URL.Path, nil)
+	})
+}
 
-		d, err := f.DatasetClient.Get(req.Context(), userAccessToken, "", collectionID, datasetID)
-		if err != nil {
-			log.Error(req.Context(), "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
-			return
-		}
+// hierarchyConflict renders the hierarchy page again with the changes that could not be saved, and returns true,
+// if filter API rejected them because the filter was modified since the page was loaded
+func (f *Filter) hierarchyConflict(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken, name, code string, err error, pending *pendingSelection) bool {
+	if !isConflict(err) {
+		return false
+	}
 
-		dims, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
-		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err,
-				log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	ctx := req.Context()
+	filterID := mux.Vars(req)["filterID"]
+	log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": name, "code": code})
+	forgetFilter(ctx, filterID)
 
-		selValsLabelMap, err := f.getIDNameLookupFromDatasetAPI(ctx, userAccessToken, collectionID, datasetID, edition, version, name, selVals)
-		if err != nil {
-			log.Error(ctx, "failed to get options from dataset client for the selected values", err,
-				log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	curPath := fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name)
+	if code != "" {
+		curPath += "/" + code
+	}
+	f.hierarchySelector(w, req, lang, collectionID, userAccessToken, curPath, pending)
+	return true
+}
 
-		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
-		if err != nil {
-			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
-		}
+// hierarchySelector renders the hierarchy page of the node in the request, at curPath. If pending changes are provided,
+// they are shown instead of the options currently selected in the filter, along with a message explaining that the
+// filter was modified since the user loaded the page
+func (f *Filter) hierarchySelector(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken, curPath string, pending *pendingSelection) {
+	vars := mux.Vars(req)
+	filterID := vars["filterID"]
+	name := vars["name"]
+	code := vars["code"]
+	ctx := req.Context()
 
-		bp := f.RenderClient.NewBasePageModel()
-		p := mapper.CreateHierarchyPage(req, bp, h, d, fil, selValsLabelMap, dims, name, req.URL.Path, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
-		f.RenderClient.BuildPage(w, p, "hierarchy")
-	})
+	fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+	if err != nil {
+		log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	fc, selVals, err := f.consistentSelection(ctx, "hierarchy", userAccessToken, collectionID, filterID, name, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": name})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fil, eTag0, datasetID, edition, version := fc.Filter, fc.ETag, fc.DatasetID, fc.Edition, fc.Version
+
+	h, err := f.hierarchyNode(ctx, fc, name, code)
+	if err != nil {
+		log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": filterID, "dimension": name, "code": code})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	d, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+	if err != nil {
+		log.Error(req.Context(), "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	dims, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err,
+			log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	if pending != nil {
+		selVals.Items = pending.apply(selVals.Items)
+	}
+
+	selValsLabelMap, err := f.getIDNameLookupFromDatasetAPI(ctx, userAccessToken, collectionID, datasetID, edition, version, name, selVals)
+	if err != nil {
+		log.Error(ctx, "failed to get options from dataset client for the selected values", err,
+			log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
+
+	bp := f.RenderClient.NewBasePageModel()
+	p := mapper.CreateHierarchyPage(req, bp, h, d, fil, selValsLabelMap, dims, name, curPath, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+	p.Data.ETag = eTag0
+	p.Data.AddAllFilters.URL = withETag(p.Data.AddAllFilters.URL, eTag0)
+	p.Data.RemoveAll.URL = withETag(p.Data.RemoveAll.URL, eTag0)
+	p.Data.Undo = f.undoLink(ctx, filterID, eTag0, curPath)
+	if pending == nil {
+		f.buildPage(w, req, p, "hierarchy")
+		return
+	}
+
+	p.Error = conflictMessage(lang)
+	f.buildPageWithStatus(w, req, p, "hierarchy", http.StatusConflict)
 }
 
 type flatNodes struct {
@@ -389,11 +492,28 @@ func (n *flatNodes) sort() {
 	}
 }
 
-// Flatten the geography hierarchy - please note this will only work for this particular hierarchy,
-// need helper functions for other geog hierarchies too.
-func (f *Filter) flattenGeographyTopLevel(ctx context.Context, instanceID string) (h hierarchy.Model, err error) {
+// hierarchyNode returns the node of the hierarchy with the provided code, or its top level if there is no code
+func (f *Filter) hierarchyNode(ctx context.Context, fc *filterContext, name, code string) (hierarchy.Model, error) {
+	if code != "" {
+		return f.HierarchyClient.GetChild(ctx, fc.Filter.InstanceID, name, code)
+	}
+	return f.hierarchyRoot(ctx, fc, name)
+}
+
+// hierarchyRoot returns the top level of the named hierarchy of the filter's dataset, flattened if there is a rule
+// for the hierarchy
+func (f *Filter) hierarchyRoot(ctx context.Context, fc *filterContext, name string) (hierarchy.Model, error) {
+	if rule, ok := f.Flattening.For(fc.DatasetID, name); ok {
+		return f.flattenTopLevel(ctx, fc.Filter.InstanceID, name, rule)
+	}
+	return f.HierarchyClient.GetRoot(ctx, fc.Filter.InstanceID, name)
+}
+
+// flattenTopLevel flattens the top level of a hierarchy into the nodes promoted by the rule, sorted by their order
+// in the hierarchy, or by their position in the rule as a fallback
+func (f *Filter) flattenTopLevel(ctx context.Context, instanceID, name string, rule flatten.Rule) (h hierarchy.Model, err error) {
 	// obtain root element
-	root, err := f.HierarchyClient.GetRoot(ctx, instanceID, geography)
+	root, err := f.HierarchyClient.GetRoot(ctx, instanceID, name)
 	if err != nil {
 		return h, err
 	}
@@ -405,51 +525,14 @@ func (f *Filter) flattenGeographyTopLevel(ctx context.Context, instanceID string
 		h.HasData = root.HasData
 	}
 
-	// create nodes struct with default order
+	// create nodes struct with the order of the rule as default order
 	nodes := flatNodes{
 		list:         []hierarchy.Child{},
-		defaultOrder: map[string]int{GreatBritain: 0, EnglandAndWales: 1, England: 2, NorthernIreland: 3, Scotland: 4, Wales: 5},
+		defaultOrder: rule.Order(),
 	}
 
-	// add items to flatNodes
-	for _, val := range root.Children {
-		if val.Links.Code.ID == GreatBritain {
-			nodes.addWithoutChildren(val)
-
-			child, childErr := f.HierarchyClient.GetChild(ctx, instanceID, geography, GreatBritain)
-			if childErr != nil {
-				return h, childErr
-			}
-
-			for _, childVal := range child.Children {
-				if childVal.Links.Code.ID == EnglandAndWales {
-					nodes.addWithoutChildren(childVal)
-
-					grandChild, cErr := f.HierarchyClient.GetChild(ctx, instanceID, geography, childVal.Links.Code.ID)
-					if cErr != nil {
-						return h, cErr
-					}
-
-					for _, grandChildVal := range grandChild.Children {
-						if grandChildVal.Links.Code.ID == England {
-							nodes.addWithChildren(grandChildVal)
-						}
-
-						if grandChildVal.Links.Code.ID == Wales {
-							nodes.addWithChildren(grandChildVal)
-						}
-					}
-				}
-
-				if childVal.Links.Code.ID == Scotland {
-					nodes.addWithChildren(childVal)
-				}
-			}
-		}
-
-		if val.Links.Code.ID == NorthernIreland {
-			nodes.addWithChildren(val)
-		}
+	if err := f.promoteNodes(ctx, instanceID, name, rule, root.Children, &nodes); err != nil {
+		return h, err
 	}
 
 	// sort nodes according to their defined order, or the defaultOrder as a fallback
@@ -462,5 +545,30 @@ func (f *Filter) flattenGeographyTopLevel(ctx context.Context, instanceID string
 		h.Children = nodes.list
 	}
 
-	return h, err
+	return h, nil
+}
+
+// promoteNodes adds the children promoted by the rule to the nodes. The children promoted without their own
+// children are looked into for more nodes to promote, while the other children are ignored.
+func (f *Filter) promoteNodes(ctx context.Context, instanceID, name string, rule flatten.Rule, children []hierarchy.Child, nodes *flatNodes) error {
+	for _, val := range children {
+		node, ok := rule.Find(val.Links.Code.ID)
+		if !ok {
+			continue
+		}
+		if node.Children {
+			nodes.addWithChildren(val)
+			continue
+		}
+		nodes.addWithoutChildren(val)
+
+		child, err := f.HierarchyClient.GetChild(ctx, instanceID, name, node.Code)
+		if err != nil {
+			return err
+		}
+		if err := f.promoteNodes(ctx, instanceID, name, rule, child.Children, nodes); err != nil {
+			return err
+		}
+	}
+	return nil
 }
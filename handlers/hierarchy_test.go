@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
@@ -14,6 +16,8 @@ import (
 	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
 	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/flatten"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
 	dprequest "github.com/ONSdigital/dp-net/v3/request"
 	core "github.com/ONSdigital/dp-renderer/v2/model"
 	"github.com/golang/mock/gomock"
@@ -154,6 +158,46 @@ func TestHierarchy(t *testing.T) {
 			So(w.Code, ShouldEqual, http.StatusOK)
 		})
 
+		Convey("A hierarchy update rejected because the filter was modified renders the page again with the pending selection", func() {
+			node := hierarchy.Model{Children: []hierarchy.Child{
+				{Label: "Child 1", Links: hierarchy.Links{Code: hierarchy.Link{ID: "c1"}}},
+				{Label: "Child 2", Links: hierarchy.Links{Code: hierarchy.Link{ID: "c2"}}},
+			}}
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(1), nil).Times(2)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, mockCode).Return(node, nil).Times(2)
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, dimensionName, []string{"c1"}, []string{"c2"}, batchSize, testETag(0)).
+				Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict})
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, dimensionName,
+				batchSize, maxWorkers).Return(testSelectedOptions, testETag(1), nil)
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, mockDatasetID).Return(testDatasetDetails, nil)
+			mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, mockDatasetID, mockEdition, mockVersion).Return(testVersionDimensions, nil)
+			mockDatasetClient.EXPECT().GetOptionsBatchProcess(ctx, mockUserAuthToken, "", mockCollectionID, mockDatasetID, mockEdition, mockVersion, dimensionName,
+				&[]string{"op1", "op2", "c1"}, gomock.Any(), maxDatasetOptions, maxWorkers).Return(nil)
+			mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+			var page model.Hierarchy
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "hierarchy").Do(func(w io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.Hierarchy)
+				w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+			})
+
+			form := url.Values{"c1": []string{"on"}, formETagKey: []string{testETag(0)}}
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/filters/%s/dimensions/%s/%s/update", filterID, dimensionName, mockCode), strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+			req.AddCookie(&http.Cookie{Name: dprequest.CollectionIDCookieKey, Value: mockCollectionID})
+			router := mux.NewRouter()
+			w := httptest.NewRecorder()
+			f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, mockHierarchyClient, nil, mockZebedeeClient, "/v1", cfg)
+			router.Path("/filters/{filterID}/dimensions/{name}/{code}/update").HandlerFunc(f.HierarchyUpdate())
+			router.ServeHTTP(w, req)
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+			So(page.Error.Title, ShouldNotBeEmpty)
+			So(page.Data.ETag, ShouldEqual, testETag(1))
+			So(page.Data.SaveAndReturn.URL, ShouldEqual, fmt.Sprintf("/filters/%s/dimensions/%s/%s/update", filterID, dimensionName, mockCode))
+		})
+
 		Convey("Hierarchy called for the root node calls the expected methods. If dataset GetOption fails, an InternalServerError status code is returned", func() {
 			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, dimensionName).Return(hierarchy.Model{}, nil)
@@ -190,6 +234,9 @@ func TestHierarchyUpdate(t *testing.T) {
 	filterModel := filter.Model{
 		InstanceID: testInstanceID,
 		FilterID:   filterID,
+		Links: filter.Links{
+			Version: filter.Link{HRef: "http://localhost:1234/v1/datasets/cpih01/editions/time-series/versions/1"},
+		},
 	}
 
 	cfg := &config.Config{
@@ -228,6 +275,11 @@ func TestHierarchyUpdate(t *testing.T) {
 			cookie := http.Cookie{Name: dprequest.CollectionIDCookieKey, Value: mockCollectionID}
 			req.AddCookie(&cookie)
 			req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+			// the page was rendered with the first ETag of the filter
+			if form == nil {
+				form = make(map[string][]string)
+			}
+			form.Set(formETagKey, testETag(0))
 			req.Form = form
 
 			router := mux.NewRouter()
@@ -338,6 +390,80 @@ func TestHierarchyUpdate(t *testing.T) {
 			So(w.Body.String(), ShouldEqual, "<a href=\"/filters/12345/dimensions/myDimension/testCode\">Found</a>.\n\n")
 		})
 
+		Convey("Given a node with a tree of descendants", func() {
+			node := func(code string, children int, hasData bool) hierarchy.Child {
+				return hierarchy.Child{Links: hierarchy.Links{Code: hierarchy.Link{ID: code}}, NumberofChildren: children, HasData: hasData}
+			}
+			region := hierarchy.Model{Children: []hierarchy.Child{node("la1", 2, true), node("la2", 1, false), node("la3", 0, true)}}
+			la1 := hierarchy.Model{Children: []hierarchy.Child{node("ward1", 0, true), node("ward2", 0, true)}}
+			la2 := hierarchy.Model{Children: []hierarchy.Child{node("ward3", 0, true)}}
+
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, mockCode).Return(region, nil)
+			updateURL := fmt.Sprintf("/filters/%s/dimensions/%s/%s/update", filterID, dimensionName, mockCode)
+
+			Convey("Then 'add-all-below' walks the tree and adds every descendant with data in a single patch", func() {
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la1").Return(la1, nil)
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la2").Return(la2, nil)
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, dimensionName,
+					[]string{"la1", "la3", "ward1", "ward2", "ward3"}, []string{}, batchSize, testETag(0)).Return(testETag(1), nil)
+
+				w := callUpdateHierarchy(updateURL, url.Values{"add-all-below": []string{"true"}})
+				So(w.Code, ShouldEqual, http.StatusFound)
+				So(w.Header().Get("Location"), ShouldEqual, "/filters/12345/dimensions/myDimension/testCode")
+			})
+
+			Convey("Then 'add-all-below' with 'leaves-only' only adds the descendants without children", func() {
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la1").Return(la1, nil)
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la2").Return(la2, nil)
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, dimensionName,
+					[]string{"la3", "ward1", "ward2", "ward3"}, []string{}, batchSize, testETag(0)).Return(testETag(1), nil)
+
+				w := callUpdateHierarchy(updateURL, url.Values{"add-all-below": []string{"true"}, "leaves-only": []string{"true"}})
+				So(w.Code, ShouldEqual, http.StatusFound)
+			})
+
+			Convey("Then 'remove-all-below' removes every descendant with data in a single patch", func() {
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la1").Return(la1, nil)
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la2").Return(la2, nil)
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, dimensionName,
+					[]string{}, []string{"la1", "la3", "ward1", "ward2", "ward3"}, batchSize, testETag(0)).Return(testETag(1), nil)
+
+				w := callUpdateHierarchy(updateURL, url.Values{"remove-all-below": []string{"true"}})
+				So(w.Code, ShouldEqual, http.StatusFound)
+			})
+
+			Convey("Then if a descendant can't be obtained, the filter is not patched and a 500 status code is returned", func() {
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la1").Return(la1, nil).AnyTimes()
+				mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, dimensionName, "la2").Return(hierarchy.Model{}, errors.New("hierarchy error"))
+
+				w := callUpdateHierarchy(updateURL, url.Values{"add-all-below": []string{"true"}})
+				So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+
+		Convey("Given a flattened geography hierarchy, then 'add-all-below' with 'leaves-only' on the top level adds the leaves of the whole hierarchy", func() {
+			node := func(code string, children int) hierarchy.Child {
+				return hierarchy.Child{Links: hierarchy.Links{Code: hierarchy.Link{ID: code}}, NumberofChildren: children, HasData: true}
+			}
+			uk := hierarchy.Model{Links: hierarchy.Links{Code: hierarchy.Link{ID: flatten.Uk}}, HasData: true,
+				Children: []hierarchy.Child{node(flatten.NorthernIreland, 1), node(flatten.GreatBritain, 2)}}
+			ni := hierarchy.Model{Children: []hierarchy.Child{node("ni-lgd", 0)}}
+			gb := hierarchy.Model{Children: []hierarchy.Child{node(flatten.Scotland, 0), node(flatten.EnglandAndWales, 2)}}
+			englandAndWales := hierarchy.Model{Children: []hierarchy.Child{node(flatten.England, 0), node(flatten.Wales, 0)}}
+
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
+			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, "geography").Return(uk, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, "geography", flatten.NorthernIreland).Return(ni, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, "geography", flatten.GreatBritain).Return(gb, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, "geography", flatten.EnglandAndWales).Return(englandAndWales, nil)
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography",
+				[]string{"ni-lgd", flatten.Scotland, flatten.England, flatten.Wales}, []string{}, batchSize, testETag(0)).Return(testETag(1), nil)
+
+			w := callUpdateHierarchy(fmt.Sprintf("/filters/%s/dimensions/geography/update", filterID), url.Values{"add-all-below": []string{"true"}, "leaves-only": []string{"true"}})
+			So(w.Code, ShouldEqual, http.StatusFound)
+		})
+
 		Convey("Then if GetJobState fails, the hierarchy update is aborted and a 500 status code is returned", func() {
 			errGetJobState := errors.New("error getting job state")
 			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filter.Model{}, "", errGetJobState)
@@ -347,7 +473,22 @@ func TestHierarchyUpdate(t *testing.T) {
 	})
 }
 
-func TestFlattenGeographyTopLevel(t *testing.T) {
+func TestHierarchyChildren(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	Convey("Given a cancelled request context, then hierarchyChildren returns its error without requesting any node", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		f := &Filter{HierarchyClient: NewMockHierarchyClient(mockCtrl), BatchMaxWorkers: 2}
+
+		children, err := f.hierarchyChildren(ctx, "testInstanceID", "geography", []string{"a", "b", "c"})
+		So(err, ShouldEqual, context.Canceled)
+		So(children, ShouldBeNil)
+	})
+}
+
+func TestHierarchyRoot(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
@@ -356,6 +497,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 	mockSearchAPIAuthToken := "testServiceAuthToken"
 	batchSize := 100
 	testInstanceID := "testInstanceID"
+	testFilter := &filterContext{Filter: filter.Model{InstanceID: testInstanceID}}
 
 	expectedDimensionName := "geography"
 
@@ -371,8 +513,8 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(hierarchy.Model{}, nil)
 		f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-		Convey("then flattenGeographyTopLevel returns an empty hierarchy without error", func() {
-			h, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+		Convey("then hierarchyRoot returns an empty hierarchy without error", func() {
+			h, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 			So(err, ShouldBeNil)
 			So(h, ShouldResemble, hierarchy.Model{})
 		})
@@ -382,7 +524,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		testUK := hierarchy.Model{
 			Label: "United Kingdom",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: Uk},
+				Code: hierarchy.Link{ID: flatten.Uk},
 			},
 			HasData:  true,
 			Children: []hierarchy.Child{},
@@ -392,8 +534,8 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
 		f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-		Convey("then flattenGeographyTopLevel returns the root item without error", func() {
-			h, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+		Convey("then hierarchyRoot returns the root item without error", func() {
+			h, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 			So(err, ShouldBeNil)
 			So(h, ShouldResemble, testUK)
 		})
@@ -410,7 +552,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		chWales := hierarchy.Child{
 			Label: "Wales",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: Wales},
+				Code: hierarchy.Link{ID: flatten.Wales},
 			},
 			HasData: true,
 			Order:   &order0,
@@ -419,7 +561,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		chEngland := hierarchy.Child{
 			Label: "England",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: England},
+				Code: hierarchy.Link{ID: flatten.England},
 			},
 			HasData: true,
 			Order:   &order1,
@@ -428,7 +570,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		chNorthernIreland := hierarchy.Child{
 			Label: "Northern Ireland",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: NorthernIreland},
+				Code: hierarchy.Link{ID: flatten.NorthernIreland},
 			},
 			HasData: true,
 			Order:   &order2,
@@ -437,7 +579,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		chScotland := hierarchy.Child{
 			Label: "Scotland",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: Scotland},
+				Code: hierarchy.Link{ID: flatten.Scotland},
 			},
 			HasData: true,
 			Order:   &order3,
@@ -446,7 +588,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		chGreatBritain := hierarchy.Child{
 			Label: "Great Britain",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: GreatBritain},
+				Code: hierarchy.Link{ID: flatten.GreatBritain},
 			},
 			HasData: true,
 			Order:   &order4,
@@ -455,7 +597,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		chEnglandAndWales := hierarchy.Child{
 			Label: "England and Wales",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: EnglandAndWales},
+				Code: hierarchy.Link{ID: flatten.EnglandAndWales},
 			},
 			HasData: true,
 			Order:   &order5,
@@ -464,7 +606,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		testUK := hierarchy.Model{
 			Label: "United Kingdom",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: Uk},
+				Code: hierarchy.Link{ID: flatten.Uk},
 			},
 			HasData:          true,
 			NumberofChildren: 2,
@@ -474,7 +616,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		testGB := hierarchy.Model{
 			Label: "Great Britain",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: GreatBritain},
+				Code: hierarchy.Link{ID: flatten.GreatBritain},
 			},
 			HasData:          true,
 			Order:            &order4,
@@ -485,7 +627,7 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		testEnglandAndWales := hierarchy.Model{
 			Label: "England and Wales",
 			Links: hierarchy.Links{
-				Code: hierarchy.Link{ID: EnglandAndWales},
+				Code: hierarchy.Link{ID: flatten.EnglandAndWales},
 			},
 			HasData:          true,
 			Order:            &order5,
@@ -496,21 +638,21 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 		Convey("And a successful hierarchy client mock where all models contain order", func() {
 			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, GreatBritain).Return(testGB, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, EnglandAndWales).Return(testEnglandAndWales, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.GreatBritain).Return(testGB, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.EnglandAndWales).Return(testEnglandAndWales, nil)
 			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-			Convey("then flattenGeographyTopLevel returns a flat list of geography nodes sorted in the order defined by the children order property", func() {
+			Convey("then hierarchyRoot returns a flat list of geography nodes sorted in the order defined by the children order property", func() {
 				expectedFlatGeography := hierarchy.Model{
 					Label:   "United Kingdom",
 					HasData: true,
 					Links: hierarchy.Links{
-						Code: hierarchy.Link{ID: Uk},
+						Code: hierarchy.Link{ID: flatten.Uk},
 					},
 					Children: []hierarchy.Child{chWales, chEngland, chNorthernIreland, chScotland, chGreatBritain, chEnglandAndWales},
 				}
 
-				h, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+				h, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 				So(err, ShouldBeNil)
 				So(h, ShouldResemble, expectedFlatGeography)
 			})
@@ -525,21 +667,21 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 
 			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, GreatBritain).Return(testGB, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, EnglandAndWales).Return(testEnglandAndWales, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.GreatBritain).Return(testGB, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.EnglandAndWales).Return(testEnglandAndWales, nil)
 			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-			Convey("then flattenGeographyTopLevel returns a flat list of geography nodes sorted according to the default hardcoded order", func() {
+			Convey("then hierarchyRoot returns a flat list of geography nodes sorted according to the default order of the rule", func() {
 				expectedFlatGeography := hierarchy.Model{
 					Label:   "United Kingdom",
 					HasData: true,
 					Links: hierarchy.Links{
-						Code: hierarchy.Link{ID: Uk},
+						Code: hierarchy.Link{ID: flatten.Uk},
 					},
 					Children: []hierarchy.Child{chGreatBritain, chEnglandAndWales, chEngland, chNorthernIreland, chScotland, chWales},
 				}
 
-				h, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+				h, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 				So(err, ShouldBeNil)
 				So(h, ShouldResemble, expectedFlatGeography)
 			})
@@ -567,21 +709,21 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 
 			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, GreatBritain).Return(testGB, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, EnglandAndWales).Return(testEnglandAndWales, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.GreatBritain).Return(testGB, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.EnglandAndWales).Return(testEnglandAndWales, nil)
 			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-			Convey("then flattenGeographyTopLevel returns a flat list of geography nodes sorted according to the default hardcoded order", func() {
+			Convey("then hierarchyRoot returns a flat list of geography nodes sorted according to the default order of the rule", func() {
 				expectedFlatGeography := hierarchy.Model{
 					Label:   "United Kingdom",
 					HasData: true,
 					Links: hierarchy.Links{
-						Code: hierarchy.Link{ID: Uk},
+						Code: hierarchy.Link{ID: flatten.Uk},
 					},
 					Children: []hierarchy.Child{chGreatBritain, chEnglandAndWales, chEngland, chNorthernIreland, chScotland, chWales},
 				}
 
-				h, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+				h, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 				So(err, ShouldBeNil)
 				So(h, ShouldResemble, expectedFlatGeography)
 			})
@@ -593,8 +735,8 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(hierarchy.Model{}, testErr)
 			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-			Convey("then flattenGeographyTopLevel fails with the same error and no other call is performed", func() {
-				_, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+			Convey("then hierarchyRoot fails with the same error and no other call is performed", func() {
+				_, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 				So(err, ShouldResemble, testErr)
 			})
 		})
@@ -603,11 +745,11 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 			testErr := errors.New("testError")
 			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, GreatBritain).Return(hierarchy.Model{}, testErr)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.GreatBritain).Return(hierarchy.Model{}, testErr)
 			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-			Convey("then flattenGeographyTopLevel fails with the same error and no other call is performed", func() {
-				_, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+			Convey("then hierarchyRoot fails with the same error and no other call is performed", func() {
+				_, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 				So(err, ShouldResemble, testErr)
 			})
 		})
@@ -616,15 +758,44 @@ func TestFlattenGeographyTopLevel(t *testing.T) {
 			testErr := errors.New("testError")
 			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
 			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, GreatBritain).Return(testGB, nil)
-			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, EnglandAndWales).Return(hierarchy.Model{}, testErr)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.GreatBritain).Return(testGB, nil)
+			mockHierarchyClient.EXPECT().GetChild(ctx, testInstanceID, expectedDimensionName, flatten.EnglandAndWales).Return(hierarchy.Model{}, testErr)
 			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
 
-			Convey("then flattenGeographyTopLevel fails with the same error and no other call is performed", func() {
-				_, err := f.flattenGeographyTopLevel(ctx, testInstanceID)
+			Convey("then hierarchyRoot fails with the same error and no other call is performed", func() {
+				_, err := f.hierarchyRoot(ctx, testFilter, expectedDimensionName)
 				So(err, ShouldResemble, testErr)
 			})
 		})
+
+		Convey("And a rule for the geography of the filter's dataset that promotes Great Britain with its children", func() {
+			chGreatBritain.NumberofChildren = 2
+			testUK.Children[1].NumberofChildren = 2
+			datasetFilter := &filterContext{Filter: filter.Model{InstanceID: testInstanceID}, DatasetID: "cpih01", Edition: "time-series", Version: "1"}
+
+			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
+			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, expectedDimensionName).Return(testUK, nil)
+			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
+			f.Flattening["cpih01/geography"] = flatten.Rule{{Code: flatten.GreatBritain, Children: true}, {Code: flatten.NorthernIreland, Children: true}}
+
+			Convey("then hierarchyRoot returns the nodes of the dataset's rule without looking into Great Britain", func() {
+				h, err := f.hierarchyRoot(ctx, datasetFilter, expectedDimensionName)
+				So(err, ShouldBeNil)
+				So(h.Children, ShouldResemble, []hierarchy.Child{chNorthernIreland, chGreatBritain})
+			})
+		})
+
+		Convey("And no rule for the hierarchy", func() {
+			mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
+			mockHierarchyClient.EXPECT().GetRoot(ctx, testInstanceID, "aggregate").Return(testUK, nil)
+			f := NewFilter(nil, nil, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
+
+			Convey("then hierarchyRoot returns the root of the hierarchy as it is", func() {
+				h, err := f.hierarchyRoot(ctx, testFilter, "aggregate")
+				So(err, ShouldBeNil)
+				So(h, ShouldResemble, testUK)
+			})
+		})
 	})
 }
 
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/ordinal"
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// rangeFromKey and rangeToKey are the names of the inputs holding the codes of the first and last options of a range
+	rangeFromKey = "range-from"
+	rangeToKey   = "range-to"
+)
+
+// UpdateRange sets the options of a dimension to the range of its ordered options between the submitted first and
+// last options, removing any existing value
+func (f *Filter) UpdateRange() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		vars := mux.Vars(req)
+		name := vars["name"]
+		filterID := vars["filterID"]
+		ctx := req.Context()
+
+		if err := req.ParseForm(); err != nil {
+			log.Error(ctx, "failed to parse form", err, log.Data{"filter_id": filterID, "dimension": name})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		from, to := req.FormValue(rangeFromKey), req.FormValue(rangeToKey)
+		if from == "" || to == "" {
+			f.setStatusCode(req, w, formError{"select the first and last options of the range"})
+			return
+		}
+
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+		if err != nil {
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
+
+		allValues, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
+		if err != nil {
+			log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		ordered, ok := f.orderedOptions(name, allValues)
+		if !ok {
+			f.setStatusCode(req, w, formError{fmt.Sprintf("the options of %s can't be selected as a range", name)})
+			return
+		}
+		options, err := ordinal.Between(ordered, from, to)
+		if errors.Is(err, ordinal.ErrNotInRange) {
+			f.setStatusCode(req, w, formError{err.Error()})
+			return
+		}
+
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+		_, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, options, submittedETag(req))
+		if isConflict(err) {
+			log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": name})
+			forgetFilter(ctx, filterID)
+			f.dimensionSelector(w, req, lang, collectionID, userAccessToken, &pendingSelection{add: options, replace: true})
+			return
+		}
+		if err != nil {
+			log.Error(ctx, "failed to set dimension values", err, log.Data{"filter_id": filterID, "dimension": name})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		forgetFilter(ctx, filterID)
+		rec.commit(ctx)
+
+		redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
+		http.Redirect(w, req, redirectURL, http.StatusFound)
+	})
+}
+
+// orderedOptions returns the options of a dimension in order, if they have one. Dimensions configured as ordinal
+// keep the order dataset API returns their options in; the order of the others is inferred from their labels.
+func (f *Filter) orderedOptions(name string, opts dataset.Options) ([]ordinal.Option, bool) {
+	options := make([]ordinal.Option, 0, len(opts.Items))
+	for i := range opts.Items {
+		options = append(options, ordinal.Option{Code: opts.Items[i].Option, Label: opts.Items[i].Label})
+	}
+
+	if slices.Contains(f.ordinalDimensions, name) {
+		return options, len(options) > 1
+	}
+	return ordinal.Infer(options)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/ordinal"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpdateRange(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+	const name = "household-size"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filterModel := filter.Model{
+		FilterID: filterID,
+		Links: filter.Links{
+			Version: filter.Link{HRef: "http://localhost:22400/v1/datasets/census/editions/2021/versions/1"},
+		},
+	}
+	allOptions := dataset.Options{Items: []dataset.Option{
+		{Option: "4", Label: "4 or more people"},
+		{Option: "1", Label: "1 person"},
+		{Option: "3", Label: "3 people"},
+		{Option: "2", Label: "2 people"},
+	}}
+
+	submit := func(f *Filter, from, to string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/dimensions/{name}/range").HandlerFunc(f.UpdateRange())
+		form := url.Values{rangeFromKey: []string{from}, rangeToKey: []string{to}, formETagKey: []string{testETag(0)}}
+		req := httptest.NewRequest("POST", "/filters/12345/dimensions/household-size/range?format=json", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("Given a dimension with numeric option labels", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "census", "2021", "1", name, cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(allOptions, nil)
+
+		Convey("When a range is submitted, then the options between its ends in label order are set and the user is sent to the overview", func() {
+			mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name, []string{"2", "3", "4"}, testETag(0)).
+				Return(testETag(1), nil)
+
+			w := submit(f, "4", "2")
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/12345/dimensions")
+		})
+
+		Convey("When a range ends in an option the dimension does not have, then a validation error is returned", func() {
+			w := submit(f, "1", "9")
+
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+
+	Convey("Given a dimension configured as ordinal, then its options keep the order of dataset API", t, func() {
+		f := NewFilter(nil, nil, nil, nil, nil, nil, "/v1", &config.Config{OrdinalDimensions: []string{name}})
+
+		ordered, ok := f.orderedOptions(name, allOptions)
+		So(ok, ShouldBeTrue)
+		So(ordered[0], ShouldResemble, ordinal.Option{Code: "4", Label: "4 or more people"})
+
+		ordered, ok = f.orderedOptions("sex", dataset.Options{Items: []dataset.Option{{Option: "1", Label: "Male"}, {Option: "2", Label: "Female"}}})
+		So(ok, ShouldBeFalse)
+		So(ordered, ShouldBeNil)
+	})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// pasteOptionsKey is the name of the textarea the list of codes or labels is pasted into
+const pasteOptionsKey = "paste-options"
+
+// PasteOptions adds to a dimension the options matching a pasted list of codes or labels, and lists
+// the entries of the list that did not match any option back to the user
+func (f *Filter) PasteOptions() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		vars := mux.Vars(req)
+		name := vars["name"]
+		filterID := vars["filterID"]
+		ctx := req.Context()
+
+		if err := req.ParseForm(); err != nil {
+			log.Error(ctx, "failed to parse form", err, log.Data{"filter_id": filterID, "dimension": name})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		redirectURL := fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name)
+
+		entries := parsePastedOptions(req.FormValue(pasteOptionsKey))
+		if len(entries) == 0 {
+			http.Redirect(w, req, redirectURL, http.StatusFound)
+			return
+		}
+
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+		if err != nil {
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
+
+		labels, err := f.pastedOptionLabels(ctx, userAccessToken, collectionID, datasetID, edition, version, name, entries)
+		if err != nil {
+			log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		codes, added, unmatched, ambiguous := matchPastedOptions(entries, labels)
+
+		if len(codes) > 0 {
+			rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+			if _, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, codes, []string{}, f.BatchSize, submittedETag(req)); err != nil {
+				log.Error(ctx, "failed to add pasted options", err, log.Data{"filter_id": filterID, "dimension": name})
+				f.setStatusCode(req, w, err)
+				return
+			}
+			forgetFilter(ctx, filterID)
+			rec.commit(ctx)
+		}
+
+		if len(unmatched) == 0 && len(ambiguous) == 0 {
+			http.Redirect(w, req, redirectURL, http.StatusFound)
+			return
+		}
+
+		log.Info(ctx, "pasted entries did not match exactly one option", log.Data{"filter_id": filterID, "dimension": name, "added": len(codes), "unmatched": len(unmatched), "ambiguous": len(ambiguous)})
+
+		datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+		if err != nil {
+			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+		if err != nil {
+			log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+		if err != nil {
+			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+		}
+
+		bp := f.RenderClient.NewBasePageModel()
+		p := mapper.CreatePasteResultsPage(req, bp, datasetDetails, dims, added, unmatched, ambiguous, filterID, name, datasetID, edition, version, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+		f.buildPage(w, req, p, "paste-results")
+	})
+}
+
+// pastedOptionLabels returns the labels of the dimension options the pasted entries may match, keyed by option code.
+// Entries that are exact option codes are looked up first, so that the full list of options, which may be large,
+// is only requested when some entries are labels or differ from the codes in case or spacing.
+func (f *Filter) pastedOptionLabels(ctx context.Context, userAccessToken, collectionID, datasetID, edition, version, name string, entries []string) (map[string]string, error) {
+	candidates := filter.DimensionOptions{}
+	for _, entry := range entries {
+		candidates.Items = append(candidates.Items, filter.DimensionOption{Option: entry})
+	}
+
+	labels, err := f.getIDNameLookupFromDatasetAPI(ctx, userAccessToken, collectionID, datasetID, edition, version, name, candidates)
+	if err != nil {
+		// dataset API rejects lookups of codes that don't exist, so fall back to matching against all the options
+		log.Warn(ctx, "failed to look up pasted entries as option codes", log.FormatErrors([]error{err}), log.Data{"dimension": name, "dataset_id": datasetID})
+		labels = map[string]string{}
+	}
+
+	if allCodes(entries, labels) {
+		return labels, nil
+	}
+
+	// all the options are keyed by code, as several options may have the same label
+	opts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		return nil, err
+	}
+	for i := range opts.Items {
+		labels[opts.Items[i].Option] = opts.Items[i].Label
+	}
+	return labels, nil
+}
+
+// allCodes returns true if every pasted entry is exactly the code of one of the provided options
+func allCodes(entries []string, labels map[string]string) bool {
+	for _, entry := range entries {
+		if _, ok := labels[entry]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePastedOptions splits a pasted list of codes or labels into its entries. A list of several lines has an entry
+// on each line, as labels such as "Bristol, City of" may contain commas, while a single line is split on commas.
+func parsePastedOptions(text string) []string {
+	separator := func(r rune) bool { return r == ',' }
+	if strings.ContainsAny(strings.TrimSpace(text), "\r\n") {
+		separator = func(r rune) bool { return r == '\n' || r == '\r' }
+	}
+	fields := strings.FieldsFunc(text, separator)
+
+	var entries []string
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		entry := strings.TrimSpace(field)
+		if entry == "" || seen[normaliseOption(entry)] {
+			continue
+		}
+		seen[normaliseOption(entry)] = true
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// matchPastedOptions resolves each pasted entry to the code of the option whose code or label it matches, ignoring case and
+// spacing. It returns the codes and labels of the matched options, the entries that did not match any option, and the
+// entries that are the label of several options, which are left for the user to paste the code of the one they meant.
+func matchPastedOptions(entries []string, labels map[string]string) (codes, added, unmatched, ambiguous []string) {
+	index, ambiguousLabels := optionIndex(labels)
+	matched := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		code, ok := index[normaliseOption(entry)]
+		if !ok && ambiguousLabels[normaliseOption(entry)] {
+			ambiguous = append(ambiguous, entry)
+			continue
+		}
+		if !ok {
+			unmatched = append(unmatched, entry)
+			continue
+		}
+		if matched[code] {
+			continue
+		}
+		matched[code] = true
+		codes = append(codes, code)
+		added = append(added, labelOrCode(labels, code))
+	}
+	return codes, added, unmatched, ambiguous
+}
+
+// optionIndex returns a lookup of option codes keyed by the normalised code and label of each option, and the
+// normalised labels shared by several options, which are left out of the lookup
+func optionIndex(labels map[string]string) (index map[string]string, ambiguous map[string]bool) {
+	index = make(map[string]string, 2*len(labels))
+	ambiguous = make(map[string]bool)
+	for code, label := range labels {
+		key := normaliseOption(label)
+		if other, ok := index[key]; ok && other != code {
+			ambiguous[key] = true
+			continue
+		}
+		index[key] = code
+	}
+	for key := range ambiguous {
+		delete(index, key)
+	}
+	// codes take precedence over labels, as they are unique
+	for code := range labels {
+		index[normaliseOption(code)] = code
+		delete(ambiguous, normaliseOption(code))
+	}
+	return index, ambiguous
+}
+
+// normaliseOption returns the form of a code or label used to match pasted entries, ignoring case and spacing
+func normaliseOption(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParsePastedOptions(t *testing.T) {
+	Convey("Pasted lines are split on new lines only, ignoring blank and repeated entries", t, func() {
+		entries := parsePastedOptions("K04000001\r\n\n  England  and Wales \nk04000001\nBristol, City of\nengland and wales\n")
+		So(entries, ShouldResemble, []string{"K04000001", "England  and Wales", "Bristol, City of"})
+		So(parsePastedOptions(" \n \n"), ShouldBeEmpty)
+	})
+
+	Convey("A single pasted line is split on commas", t, func() {
+		So(parsePastedOptions("K04000001, w92000004,,k04000001\n"), ShouldResemble, []string{"K04000001", "w92000004"})
+		So(parsePastedOptions(" , "), ShouldBeEmpty)
+	})
+}
+
+func TestMatchPastedOptions(t *testing.T) {
+	Convey("Pasted entries are matched against option codes and labels, ignoring case and spacing", t, func() {
+		labels := map[string]string{
+			"K04000001": "England and Wales",
+			"W92000004": "Wales",
+		}
+		codes, added, unmatched, ambiguous := matchPastedOptions([]string{"w92000004", "ENGLAND   and wales", "Wales", "Atlantis"}, labels)
+		So(codes, ShouldResemble, []string{"W92000004", "K04000001"})
+		So(added, ShouldResemble, []string{"Wales", "England and Wales"})
+		So(unmatched, ShouldResemble, []string{"Atlantis"})
+		So(ambiguous, ShouldBeEmpty)
+	})
+
+	Convey("Pasted labels containing commas are matched as a whole", t, func() {
+		labels := map[string]string{
+			"E06000023": "Bristol, City of",
+			"E06000022": "Bath and North East Somerset",
+		}
+		codes, added, unmatched, _ := matchPastedOptions(parsePastedOptions("bristol, city of\nBath and North East Somerset"), labels)
+		So(codes, ShouldResemble, []string{"E06000023", "E06000022"})
+		So(added, ShouldResemble, []string{"Bristol, City of", "Bath and North East Somerset"})
+		So(unmatched, ShouldBeEmpty)
+	})
+
+	Convey("Pasted labels shared by several options are reported as ambiguous, while their codes are still matched", t, func() {
+		labels := map[string]string{
+			"W06000022": "Newport",
+			"E05012345": "Newport",
+			"W92000004": "Wales",
+		}
+		codes, added, unmatched, ambiguous := matchPastedOptions([]string{"newport", "W06000022", "Wales"}, labels)
+		So(codes, ShouldResemble, []string{"W06000022", "W92000004"})
+		So(added, ShouldResemble, []string{"Newport", "Wales"})
+		So(unmatched, ShouldBeEmpty)
+		So(ambiguous, ShouldResemble, []string{"newport"})
+	})
+}
+
+func TestPasteOptions(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+	const name = "geography"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25, MaxDatasetOptions: 10}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filterModel := filter.Model{
+		FilterID: filterID,
+		Links: filter.Links{
+			Version: filter.Link{HRef: "http://localhost:22400/v1/datasets/cpih01/editions/time-series/versions/1"},
+		},
+	}
+	allOptions := dataset.Options{Items: []dataset.Option{
+		{Option: "K04000001", Label: "England and Wales"},
+		{Option: "W92000004", Label: "Wales"},
+	}}
+
+	// processOptions calls the batch processor with the options requested by code that exist in the dataset
+	processOptions := func(_ interface{}, _, _, _, _, _, _, _ string, optionIDs *[]string, processBatch dataset.OptionsBatchProcessor, _, _ int) error {
+		batch := dataset.Options{}
+		for _, opt := range allOptions.Items {
+			for _, id := range *optionIDs {
+				if id == opt.Option {
+					batch.Items = append(batch.Items, opt)
+				}
+			}
+		}
+		_, err := processBatch(batch)
+		return err
+	}
+
+	paste := func(f *Filter, pasted, target string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/dimensions/{name}/paste").HandlerFunc(f.PasteOptions())
+		form := url.Values{pasteOptionsKey: []string{pasted}, formETagKey: []string{testETag(0)}}
+		req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("Given a pasted list of option codes", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetOptionsBatchProcess(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", name,
+			&[]string{"K04000001", "W92000004"}, gomock.Any(), cfg.MaxDatasetOptions, cfg.BatchMaxWorkers).DoAndReturn(processOptions)
+
+		Convey("When all the codes match, then the options are added conditionally on the page ETag and the user is sent back to the dimension", func() {
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
+				[]string{"K04000001", "W92000004"}, []string{}, cfg.BatchSizeLimit, testETag(0)).Return(testETag(1), nil)
+
+			w := paste(f, "K04000001\nW92000004", "/filters/12345/dimensions/geography/paste")
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/12345/dimensions/geography")
+		})
+
+		Convey("When the filter was modified since the page was loaded, then the conflict is reported", func() {
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
+				[]string{"K04000001", "W92000004"}, []string{}, cfg.BatchSizeLimit, testETag(0)).
+				Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict})
+
+			w := paste(f, "K04000001,W92000004", "/filters/12345/dimensions/geography/paste?format=json")
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+		})
+	})
+
+	Convey("Given a pasted list of labels, some of which don't match any option", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetOptionsBatchProcess(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", name,
+			&[]string{"england+and+wales", "Atlantis"}, gomock.Any(), cfg.MaxDatasetOptions, cfg.BatchMaxWorkers).DoAndReturn(processOptions)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", name,
+			cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(allOptions, nil)
+		mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
+			[]string{"K04000001"}, []string{}, cfg.BatchSizeLimit, testETag(0)).Return(testETag(1), nil)
+		mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1").Return(dataset.VersionDimensions{}, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+
+		var page model.PasteResults
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "paste-results").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.PasteResults)
+		})
+
+		w := paste(f, "england and wales\nAtlantis", fmt.Sprintf("/filters/%s/dimensions/%s/paste", filterID, name))
+
+		Convey("Then the matched options are added and the unmatched entries are listed back to the user", func() {
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(page.Data.Added, ShouldResemble, []string{"England and Wales"})
+			So(page.Data.Unmatched, ShouldResemble, []string{"Atlantis"})
+			So(page.Data.Continue.URL, ShouldEqual, "/filters/12345/dimensions/geography")
+		})
+	})
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/permalink"
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// permalinkSpecKey is the query parameter holding the encoded selections of a filter in its permalink
+const permalinkSpecKey = "spec"
+
+// Permalink renders the page with the link that recreates the selections of a filter, which, unlike the
+// filter ID, keeps working once the filter has expired
+func (f *Filter) Permalink() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		filterID := mux.Vars(req)["filterID"]
+		ctx := req.Context()
+
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+		if err != nil {
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
+
+		spec, err := f.filterSpec(ctx, userAccessToken, collectionID, filterID, datasetID, edition, version)
+		if err != nil {
+			log.Error(ctx, "failed to read filter selections", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		permalinkURL := "/filters/new?" + url.Values{permalinkSpecKey: []string{permalink.Encode(spec)}}.Encode()
+
+		datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+		if err != nil {
+			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+		if err != nil {
+			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+		}
+
+		bp := f.RenderClient.NewBasePageModel()
+		p := mapper.CreatePermalinkPage(req, bp, datasetDetails, permalinkURL, filterID, datasetID, edition, version, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+		f.buildPage(w, req, p, "permalink")
+	})
+}
+
+// filterSpec returns the selections of a filter, retrying if the filter is modified while they are read. Dimensions with
+// all of their options selected are marked as such, so that their permalink stays short.
+func (f *Filter) filterSpec(ctx context.Context, userAccessToken, collectionID, filterID, datasetID, edition, version string) (permalink.Spec, error) {
+	spec := permalink.Spec{DatasetID: datasetID, Edition: edition, Version: version}
+	err := f.retryFilterReads(ctx, "permalink", filterID, func() error {
+		dims, eTag0, err := f.FilterClient.GetDimensions(ctx, userAccessToken, "", collectionID, filterID, nil)
+		if err != nil {
+			return err
+		}
+
+		spec.Dimensions = make([]permalink.Dimension, 0, len(dims.Items))
+		for i := range dims.Items {
+			name := dims.Items[i].Name
+			opts, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
+			if err != nil {
+				return err
+			}
+			if eTag1 != eTag0 {
+				return errInconsistentFilter
+			}
+			if len(opts.Items) == 0 {
+				continue
+			}
+
+			d := permalink.Dimension{Name: name}
+			allOpts, err := f.DatasetClient.GetOptions(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, &dataset.QueryParams{Offset: 0, Limit: 1})
+			if err != nil {
+				return err
+			}
+			if allOpts.TotalCount == len(opts.Items) {
+				d.All = true
+			} else {
+				for j := range opts.Items {
+					d.Options = append(d.Options, opts.Items[j].Option)
+				}
+			}
+			spec.Dimensions = append(spec.Dimensions, d)
+		}
+		return nil
+	})
+	return spec, err
+}
+
+// ConfirmNewFilterFromPermalink renders the page a permalink opens, listing the selections it encodes and asking the user
+// to confirm the new filter is started. Following the link doesn't create a filter, so that crawlers and browsers
+// prefetching it don't create filters either.
+func (f *Filter) ConfirmNewFilterFromPermalink() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		ctx := req.Context()
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		encodedSpec := req.URL.Query().Get(permalinkSpecKey)
+		spec, dims, err := f.permalinkSpec(ctx, userAccessToken, collectionID, encodedSpec)
+		if err != nil {
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		datasetDetails, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, spec.DatasetID)
+		if err != nil {
+			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": spec.DatasetID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+		if err != nil {
+			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+		}
+
+		bp := f.RenderClient.NewBasePageModel()
+		p := mapper.CreateNewFilterPage(req, bp, datasetDetails, dims, spec, encodedSpec, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+		f.buildPage(w, req, p, "permalink-new")
+	})
+}
+
+// permalinkSpec decodes the selections encoded in a permalink, and checks their dimensions are in the dataset version.
+// It returns the dimensions of the dataset version along with the selections.
+func (f *Filter) permalinkSpec(ctx context.Context, userAccessToken, collectionID, encodedSpec string) (permalink.Spec, dataset.VersionDimensions, error) {
+	spec, err := permalink.Decode(encodedSpec)
+	if err != nil {
+		log.Warn(ctx, "failed to decode filter permalink", log.FormatErrors([]error{err}))
+		return permalink.Spec{}, dataset.VersionDimensions{}, formError{err.Error()}
+	}
+	logData := log.Data{"dataset_id": spec.DatasetID, "edition": spec.Edition, "version": spec.Version}
+
+	dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, spec.DatasetID, spec.Edition, spec.Version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err, logData)
+		return permalink.Spec{}, dataset.VersionDimensions{}, err
+	}
+
+	for _, d := range spec.Dimensions {
+		if !slices.ContainsFunc(dims.Items, func(dim dataset.VersionDimension) bool { return dim.Name == d.Name }) {
+			err = formError{fmt.Sprintf("dimension %s is not in this version of the dataset", d.Name)}
+			log.Warn(ctx, "filter permalink has an unknown dimension", log.FormatErrors([]error{err}), logData)
+			return permalink.Spec{}, dataset.VersionDimensions{}, err
+		}
+	}
+	return spec, dims, nil
+}
+
+// NewFilterFromPermalink creates a new filter blueprint with the selections encoded in a permalink, once the user has
+// confirmed it on the page the permalink opens, and redirects to the filter overview
+func (f *Filter) NewFilterFromPermalink() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		ctx := req.Context()
+
+		spec, dims, err := f.permalinkSpec(ctx, userAccessToken, collectionID, req.FormValue(permalinkSpecKey))
+		if err != nil {
+			f.setStatusCode(req, w, err)
+			return
+		}
+		logData := log.Data{"dataset_id": spec.DatasetID, "edition": spec.Edition, "version": spec.Version}
+
+		names := make([]string, 0, len(dims.Items))
+		for i := range dims.Items {
+			names = append(names, dims.Items[i].Name)
+		}
+
+		filterID, eTag, err := f.FilterClient.CreateBlueprint(ctx, userAccessToken, "", "", collectionID, spec.DatasetID, spec.Edition, spec.Version, names)
+		if err != nil {
+			log.Error(ctx, "failed to create filter blueprint", err, logData)
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		for _, d := range spec.Dimensions {
+			options := d.Options
+			if d.All {
+				opts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, spec.DatasetID, spec.Edition, spec.Version, d.Name, f.BatchSize, f.BatchMaxWorkers)
+				if err != nil {
+					log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": d.Name, "dataset_id": spec.DatasetID})
+					f.setStatusCode(req, w, err)
+					return
+				}
+				options = make([]string, 0, len(opts.Items))
+				for i := range opts.Items {
+					options = append(options, opts.Items[i].Option)
+				}
+			}
+			if len(options) == 0 {
+				continue
+			}
+
+			// the options are sent to filter API in batches of BatchSize
+			eTag, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, d.Name, options, []string{}, f.BatchSize, eTag)
+			if err != nil {
+				log.Error(ctx, "failed to add options from filter permalink", err, log.Data{"filter_id": filterID, "dimension": d.Name})
+				f.setStatusCode(req, w, err)
+				return
+			}
+		}
+
+		redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
+		http.Redirect(w, req, redirectURL, http.StatusFound)
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/permalink"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPermalink(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	serve := func(f *Filter, method, path, target string, form url.Values, h http.HandlerFunc) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.Path(path).HandlerFunc(h)
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	spec := permalink.Spec{
+		DatasetID: "cpih01",
+		Edition:   "time-series",
+		Version:   "1",
+		Dimensions: []permalink.Dimension{
+			{Name: "aggregate", All: true},
+			{Name: "geography", Options: []string{"K04000001"}},
+		},
+	}
+
+	Convey("Given a filter with all the options of a dimension and some of another selected", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filter.Model{
+			FilterID: filterID,
+			Links:    filter.Links{Version: filter.Link{HRef: "http://localhost:22400/v1/datasets/cpih01/editions/time-series/versions/1"}},
+		}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensions(ctx, mockUserAuthToken, "", mockCollectionID, filterID, nil).Return(filter.Dimensions{
+			Items: []filter.Dimension{{Name: "geography"}, {Name: "aggregate"}, {Name: "time"}},
+		}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "K04000001"}}}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "aggregate", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "cpih1dim1A0"}, {Option: "cpih1dim1G10100"}}}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "time", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(filter.DimensionOptions{}, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetOptions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography", &dataset.QueryParams{Offset: 0, Limit: 1}).
+			Return(dataset.Options{TotalCount: 2}, nil)
+		mockDatasetClient.EXPECT().GetOptions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "aggregate", &dataset.QueryParams{Offset: 0, Limit: 1}).
+			Return(dataset.Options{TotalCount: 2}, nil)
+		mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+		var page model.Permalink
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "permalink").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.Permalink)
+		})
+
+		w := serve(f, "GET", "/filters/{filterID}/permalink", "/filters/12345/permalink", nil, f.Permalink())
+
+		Convey("Then its permalink encodes the dataset version and the selections, with all the options of a dimension in short form", func() {
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(page.Data.URL, ShouldEqual, "/filters/new?spec="+permalink.Encode(spec))
+			So(page.Data.Back.URL, ShouldEqual, "/filters/12345/dimensions")
+		})
+	})
+
+	Convey("Given a filter permalink", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+		form := url.Values{"spec": []string{permalink.Encode(spec)}}
+
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1").Return(dataset.VersionDimensions{
+			Items: dataset.VersionDimensionItems{{Name: "time"}, {Name: "geography", Label: "Geography"}, {Name: "aggregate", Label: "Aggregate"}},
+		}, nil)
+
+		Convey("When it is followed, then the user is asked to confirm the new filter and none is created", func() {
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+			mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+			var page model.NewFilter
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "permalink-new").Do(func(w io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.NewFilter)
+				w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+			})
+
+			w := serve(f, "GET", "/filters/new", "/filters/new?"+form.Encode(), nil, f.ConfirmNewFilterFromPermalink())
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get("X-Robots-Tag"), ShouldEqual, "noindex")
+			So(page.Data.Spec, ShouldEqual, permalink.Encode(spec))
+			So(page.Data.Submit.URL, ShouldEqual, "/filters/new")
+			So(page.Data.Dimensions, ShouldResemble, []model.PermalinkDimension{
+				{Name: "aggregate", Label: "Aggregate", All: true},
+				{Name: "geography", Label: "Geography", Options: 1},
+			})
+		})
+
+		Convey("When the new filter is confirmed, then it is created with its selections and the user is sent to its overview", func() {
+			mockFilterClient.EXPECT().CreateBlueprint(ctx, mockUserAuthToken, "", "", mockCollectionID, "cpih01", "time-series", "1", []string{"time", "geography", "aggregate"}).
+				Return("67890", testETag(0), nil)
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "aggregate", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+				Return(dataset.Options{Items: []dataset.Option{{Option: "cpih1dim1A0"}, {Option: "cpih1dim1G10100"}}}, nil)
+			gomock.InOrder(
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, "67890", "aggregate",
+					[]string{"cpih1dim1A0", "cpih1dim1G10100"}, []string{}, cfg.BatchSizeLimit, testETag(0)).Return(testETag(1), nil),
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, "67890", "geography",
+					[]string{"K04000001"}, []string{}, cfg.BatchSizeLimit, testETag(1)).Return(testETag(2), nil),
+			)
+
+			w := serve(f, "POST", "/filters/new", "/filters/new", form, f.NewFilterFromPermalink())
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/67890/dimensions")
+		})
+	})
+
+	Convey("Given a permalink that can't be decoded, then a validation error is returned", t, func() {
+		f := NewFilter(nil, NewMockFilterClient(mockCtrl), NewMockDatasetClient(mockCtrl), nil, nil, nil, "/v1", cfg)
+
+		w := serve(f, "GET", "/filters/new", "/filters/new?spec=not-a-spec&format=json", nil, f.ConfirmNewFilterFromPermalink())
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+	})
+}
@@ -34,29 +34,31 @@ func (f Filter) Submit() http.HandlerFunc {
 		filterID := vars["filterID"]
 		ctx := req.Context()
 
-		fil, eTag, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		// make sure dataset struct is empty
+		fil := fc.Filter
 		fil.Dataset = filter.Dataset{}
 
-		mdl, _, err := f.FilterClient.UpdateBlueprint(req.Context(), userAccessToken, "", "", collectionID, fil, true, eTag)
+		mdl, _, err := f.FilterClient.UpdateBlueprint(req.Context(), userAccessToken, "", "", collectionID, fil, true, fc.ETag)
 		if err != nil {
 			log.Error(ctx, "failed to submit filter blueprint", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		forgetFilter(ctx, filterID)
 
 		filterOutputID := mdl.Links.FilterOutputs.ID
 
 		checkOptionsAdded, err := helpers.CheckAllDimensionsHaveAnOption(mdl.Dimensions)
 		if err != nil {
 			log.Error(ctx, "failed to check options on dimensions", err)
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 		if !checkOptionsAdded {
@@ -81,7 +83,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 		fj, err := f.FilterClient.GetOutput(req.Context(), userAccessToken, "", "", collectionID, filterOutputID)
 		if err != nil {
 			log.Error(ctx, "failed to get filter output", err, log.Data{"filter_output_id": filterOutputID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -92,28 +94,28 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 			prev, pErr := f.FilterClient.GetPreview(req.Context(), userAccessToken, "", "", collectionID, filterOutputID)
 			if pErr != nil {
 				log.Error(ctx, "failed to get preview", pErr, log.Data{"filter_output_id": filterOutputID})
-				setStatusCode(req, w, pErr)
+				f.setStatusCode(req, w, pErr)
 				return
 			}
 
 			if len(prev.Headers) < 1 {
 				pErr = errors.New("no preview headers returned")
 				log.Error(ctx, "failed to format header", pErr, log.Data{"filter_output_id": filterOutputID})
-				setStatusCode(req, w, pErr)
+				f.setStatusCode(req, w, pErr)
 				return
 			}
 
 			if len(prev.Headers[0]) < 4 || strings.ToUpper(prev.Headers[0][0:3]) != "V4_" {
 				pErr = errors.New("unexpected format - expected `V4_N` in header")
 				log.Error(ctx, "failed to format header", pErr, log.Data{"filter_output_id": filterOutputID, "header": prev.Headers})
-				setStatusCode(req, w, pErr)
+				f.setStatusCode(req, w, pErr)
 				return
 			}
 
 			markingsColumnCount, pErr := strconv.Atoi(prev.Headers[0][3:])
 			if pErr != nil {
 				log.Error(ctx, "failed to get column count from header cell", pErr, log.Data{"filter_output_id": filterOutputID, "header": prev.Headers[0]})
-				setStatusCode(req, w, pErr)
+				f.setStatusCode(req, w, pErr)
 				return
 			}
 
@@ -122,7 +124,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 				log.Error(ctx, "failed to verify column count", pErr, log.Data{
 					"filter_output_id": filterOutputID, "header_count": len(prev.Headers), "column_count": markingsColumnCount,
 				})
-				setStatusCode(req, w, pErr)
+				f.setStatusCode(req, w, pErr)
 				return
 			}
 
@@ -149,7 +151,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 						log.Error(ctx, "failed to read row", pErr, log.Data{
 							"filter_output_id": filterOutputID, "row_length": len(row), "column_count": markingsColumnCount,
 						})
-						setStatusCode(req, w, pErr)
+						f.setStatusCode(req, w, pErr)
 						return
 					}
 
@@ -170,7 +172,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 		versionURL, err := url.Parse(fj.Links.Version.HRef)
 		if err != nil {
 			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_output_id": filterOutputID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -178,28 +180,28 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
 		if err != nil {
 			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_output_id": filterOutputID, "path": versionPath})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		datasetDetails, err := f.DatasetClient.Get(req.Context(), userAccessToken, "", collectionID, datasetID)
 		if err != nil {
 			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		ver, err := f.DatasetClient.GetVersion(req.Context(), userAccessToken, "", "", collectionID, datasetID, edition, version)
 		if err != nil {
 			log.Error(ctx, "failed to get version", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		latestURL, err := url.Parse(datasetDetails.Links.LatestVersion.URL)
 		if err != nil {
 			log.Error(ctx, "failed to parse latest version href", err, log.Data{"filter_output_id": filterOutputID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -215,7 +217,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 		editionDetails, err := f.DatasetClient.GetEdition(req.Context(), userAccessToken, "", collectionID, datasetID, edition)
 		if err != nil {
 			log.Error(ctx, "failed to get edition details", err, log.Data{"dataset": datasetID, "edition": edition})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -227,14 +229,14 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 		metadata, err := f.DatasetClient.GetVersionMetadata(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
 		if err != nil {
 			log.Error(ctx, "failed to get version metadata", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
 		dims, err := f.DatasetClient.GetVersionDimensions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version)
 		if err != nil {
 			log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -244,7 +246,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 		if err != nil {
 			if err != errTooManyOptions {
 				log.Error(ctx, "failed to get metadata text size", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-				setStatusCode(req, w, err)
+				f.setStatusCode(req, w, err)
 				return
 			}
 			log.Warn(ctx, "failed to get metadata text size because at least a dimension has too many options", log.Data{"dataset_id": datasetID, "edition": edition, "version": version, "max_metadata_options": maxMetadataOptions})
@@ -255,7 +257,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 			opts, err := f.DatasetClient.GetOptions(req.Context(), userAccessToken, "", collectionID, datasetID, edition, version, dims.Items[i].Name, &dataset.QueryParams{Offset: 0, Limit: 1})
 			if err != nil {
 				log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": dims.Items[i].Name, "dataset_id": datasetID, "edition": edition, "version": version})
-				setStatusCode(req, w, err)
+				f.setStatusCode(req, w, err)
 				return
 			}
 
@@ -266,7 +268,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 					log.Error(ctx, "failed to build dimensions", err, log.Data{
 						"filter_output_id": filterOutputID, "opts.TotalCount": opts.TotalCount, "opts.Items length": len(opts.Items),
 					})
-					setStatusCode(req, w, err)
+					f.setStatusCode(req, w, err)
 					return
 				}
 				p.Data.SingleValueDimensions = append(p.Data.SingleValueDimensions, model.PreviewDimension{
@@ -291,7 +293,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 			if f.downloadServiceURL != "" {
 				downloadURL, err := url.Parse(d.URI)
 				if err != nil {
-					setStatusCode(req, w, err)
+					f.setStatusCode(req, w, err)
 					return
 				}
 
@@ -308,7 +310,7 @@ func (f *Filter) OutputPage() http.HandlerFunc {
 			URI:       fmt.Sprintf("/datasets/%s/editions/%s/versions/%s/metadata.txt", datasetID, edition, version),
 		})
 
-		f.RenderClient.BuildPage(w, p, "preview")
+		f.buildPage(w, req, p, "preview")
 	})
 }
 
@@ -323,7 +325,7 @@ func (f *Filter) GetFilterJob() http.HandlerFunc {
 		prev, err := f.FilterClient.GetOutput(req.Context(), accessToken, "", "", collectionID, filterOutputID)
 		if err != nil {
 			log.Error(ctx, "failed to get filter output", err, log.Data{"filter_output_id": filterOutputID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -335,7 +337,7 @@ func (f *Filter) GetFilterJob() http.HandlerFunc {
 			downloadURL, uErr := url.Parse(download.URL)
 			if uErr != nil {
 				log.Error(ctx, "failed to parse download url", uErr, log.Data{"filter_output_id": filterOutputID})
-				setStatusCode(req, w, uErr)
+				f.setStatusCode(req, w, uErr)
 				return
 			}
 
@@ -348,7 +350,7 @@ func (f *Filter) GetFilterJob() http.HandlerFunc {
 		b, err := json.Marshal(prev)
 		if err != nil {
 			log.Error(ctx, "failed to marshal json", err, log.Data{"filter_output_id": filterOutputID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/log.go/v2/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// errInconsistentFilter is returned when the filter is modified between the calls made to read it
+var errInconsistentFilter = errors.New("inconsistent filter data")
+
+// filterReadRetries counts the filter API read sequences that were retried because the filter was modified between calls.
+// If the instrument can't be created, otel returns a no-op counter, so the error is ignored.
+var filterReadRetries, _ = otel.Meter("github.com/ONSdigital/dp-frontend-filter-dataset-controller/handlers").Int64Counter(
+	"filter.read.retries",
+	metric.WithDescription("Number of times a sequence of filter API reads was retried because the filter ETag changed between calls"),
+)
+
+// isETagMismatch returns true if the provided error was caused by the filter being modified while it was being read
+func isETagMismatch(err error) bool {
+	return errors.Is(err, errInconsistentFilter) || errors.Is(err, filter.ErrBatchETagMismatch)
+}
+
+// retryFilterReads calls read, which is expected to perform a sequence of filter API reads, until it succeeds or fails
+// with an error that is not an ETag mismatch. It is attempted up to the configured number of times, waiting a jittered
+// backoff between attempts. The name identifies the read sequence in logs and metrics.
+func (f *Filter) retryFilterReads(ctx context.Context, name, filterID string, read func() error) error {
+	attempts := max(f.retryAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := read()
+		if err == nil || !isETagMismatch(err) {
+			return err
+		}
+
+		logData := log.Data{"filter_id": filterID, "reads": name, "attempt": attempt, "max_attempts": attempts}
+		if attempt >= attempts {
+			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", err, logData)
+			return err
+		}
+
+		backoff := retryBackoff(f.retryBackoff, attempt)
+		logData["backoff"] = backoff.String()
+		log.Info(ctx, "filter was modified between calls, retrying", logData)
+		filterReadRetries.Add(ctx, 1, metric.WithAttributes(attribute.String("reads", name)))
+		forgetFilter(ctx, filterID)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// retryBackoff returns the time to wait after the provided attempt. The base backoff is doubled for every
+// previous attempt and jittered by up to 50% either way, so that concurrent requests don't retry in lockstep.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	backoff := base << (attempt - 1)
+	return backoff/2 + rand.N(backoff) //nolint:gosec // jitter does not need a secure random number
+}
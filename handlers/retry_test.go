@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRetryFilterReads(t *testing.T) {
+	Convey("Given a filter configured to attempt filter API reads 3 times", t, func() {
+		f := NewFilter(nil, nil, nil, nil, nil, nil, "/v1", &config.Config{FilterRetryAttempts: 3})
+		calls := 0
+
+		Convey("When the reads succeed at the first attempt, then they are not retried", func() {
+			err := f.retryFilterReads(context.Background(), "test", "12345", func() error {
+				calls++
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("When the filter is modified between calls once, then the reads are retried until they succeed", func() {
+			err := f.retryFilterReads(context.Background(), "test", "12345", func() error {
+				calls++
+				if calls == 1 {
+					return errInconsistentFilter
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("When the filter keeps being modified, then the mismatch error is returned after all the attempts", func() {
+			err := f.retryFilterReads(context.Background(), "test", "12345", func() error {
+				calls++
+				return filter.ErrBatchETagMismatch
+			})
+			So(err, ShouldEqual, filter.ErrBatchETagMismatch)
+			So(calls, ShouldEqual, 3)
+		})
+
+		Convey("When the reads fail with any other error, then they are not retried", func() {
+			readErr := errors.New("filter api failed")
+			err := f.retryFilterReads(context.Background(), "test", "12345", func() error {
+				calls++
+				return readErr
+			})
+			So(err, ShouldEqual, readErr)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("When the context is cancelled while waiting to retry, then the context error is returned", func() {
+			f.retryBackoff = time.Minute
+			ctx, cancel := context.WithCancel(context.Background())
+			err := f.retryFilterReads(ctx, "test", "12345", func() error {
+				calls++
+				cancel()
+				return errInconsistentFilter
+			})
+			So(err, ShouldEqual, context.Canceled)
+			So(calls, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given a filter with no configured attempts, then the reads are attempted once", t, func() {
+		f := NewFilter(nil, nil, nil, nil, nil, nil, "/v1", &config.Config{})
+		calls := 0
+		err := f.retryFilterReads(context.Background(), "test", "12345", func() error {
+			calls++
+			return errInconsistentFilter
+		})
+		So(err, ShouldEqual, errInconsistentFilter)
+		So(calls, ShouldEqual, 1)
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	Convey("The backoff is doubled for each attempt and jittered by up to 50% either way", t, func() {
+		base := 100 * time.Millisecond
+		for attempt := 1; attempt <= 3; attempt++ {
+			expected := base << (attempt - 1)
+			for i := 0; i < 20; i++ {
+				backoff := retryBackoff(base, attempt)
+				So(backoff, ShouldBeGreaterThanOrEqualTo, expected/2)
+				So(backoff, ShouldBeLessThan, expected*3/2)
+			}
+		}
+	})
+
+	Convey("There is no backoff if the base backoff is not set", t, func() {
+		So(retryBackoff(0, 2), ShouldEqual, 0)
+	})
+}
+
+func TestFilterReadRetriesMetric(t *testing.T) {
+	Convey("Given a registered MeterProvider, then every retry of a read sequence is counted with its name", t, func() {
+		reader := sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+		f := NewFilter(nil, nil, nil, nil, nil, nil, "/v1", &config.Config{FilterRetryAttempts: 3})
+		calls := 0
+		err := f.retryFilterReads(context.Background(), "metric_test", "12345", func() error {
+			calls++
+			if calls < 3 {
+				return errInconsistentFilter
+			}
+			return nil
+		})
+		So(err, ShouldBeNil)
+
+		var rm metricdata.ResourceMetrics
+		So(reader.Collect(context.Background(), &rm), ShouldBeNil)
+		So(retriesCounted(rm, "metric_test"), ShouldEqual, 2)
+	})
+}
+
+// retriesCounted returns the number of retries of the named read sequence in the collected metrics
+func retriesCounted(rm metricdata.ResourceMetrics, reads string) int64 {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "filter.read.retries" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				if v, ok := dp.Attributes.Value(attribute.Key("reads")); ok && v.AsString() == reads {
+					return dp.Value
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -5,10 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"strings"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/search"
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 	"github.com/ONSdigital/log.go/v2/log"
@@ -30,47 +28,18 @@ func (f *Filter) Search() http.HandlerFunc {
 			searchConfig = append(searchConfig, search.Config{InternalToken: f.SearchAPIAuthToken, FlorenceToken: req.Header.Get("X-Florence-Token")})
 		}
 
-		fil, eTag0, err := f.FilterClient.GetJobState(ctx, userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-
-		selVals, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
+		fc, selVals, err := f.consistentSelection(ctx, "search", userAccessToken, collectionID, filterID, name, nil)
 		if err != nil {
 			log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
-			return
-		}
-
-		// The user might want to retry this handler if eTags don't match
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "dimension": name, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
-			return
-		}
-
-		versionURL, err := url.Parse(fil.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
-		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		fil, datasetID, edition, version := fc.Filter, fc.DatasetID, fc.Edition, fc.Version
 
-		d, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, datasetID)
+		d, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
 		if err != nil {
 			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -78,7 +47,7 @@ func (f *Filter) Search() http.HandlerFunc {
 		if err != nil {
 			log.Error(ctx, "failed to get options from dataset client for the selected values", err,
 				log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -86,7 +55,7 @@ func (f *Filter) Search() http.HandlerFunc {
 		if err != nil {
 			log.Error(ctx, "failed to get dimension from search client", err,
 				log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version, "query": q})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -94,7 +63,7 @@ func (f *Filter) Search() http.HandlerFunc {
 		if err != nil {
 			log.Error(ctx, "failed to get dimensions", err,
 				log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -105,7 +74,7 @@ func (f *Filter) Search() http.HandlerFunc {
 
 		bp := f.RenderClient.NewBasePageModel()
 		p := mapper.CreateHierarchySearchPage(req, bp, searchRes.Items, d, fil, selValsLabelMap, dims.Items, name, req.URL.Path, datasetID, req.Referer(), req.URL.Query().Get("q"), f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
-		f.RenderClient.BuildPage(w, p, "hierarchy")
+		f.buildPage(w, req, p, "hierarchy")
 	})
 }
 
@@ -130,26 +99,13 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 
 		redirectURI := fmt.Sprintf("/filters/%s/dimensions", filterID)
 
-		fil, eTag, err := f.FilterClient.GetJobState(ctx, userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-
-		versionURL, err := url.Parse(fil.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
+		eTag, datasetID, edition, version := fc.ETag, fc.DatasetID, fc.Edition, fc.Version
 
 		searchRes, err := f.SearchClient.Dimension(ctx, datasetID, edition, version, name, q, searchConfig...)
 		if err != nil {
@@ -158,6 +114,8 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 			return
 		}
 
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, name)
+
 		if len(req.Form["add-all"]) > 0 {
 			var options []string
 			for _, item := range searchRes.Items {
@@ -166,9 +124,11 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 			_, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, options, eTag)
 			if err != nil {
 				log.Error(ctx, "failed to add all dimension options", err, log.Data{"filter_id": filterID, "dimension": name})
-				setStatusCode(req, w, err)
+				f.setStatusCode(req, w, err)
 				return
 			}
+			forgetFilter(ctx, filterID)
+			rec.commit(ctx)
 			return
 		}
 
@@ -180,9 +140,11 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 			_, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, []string{}, options, f.BatchSize, eTag)
 			if err != nil {
 				log.Error(ctx, "failed to remove all dimension options, via patch", err, log.Data{"filter_id": filterID, "dimension": name})
-				setStatusCode(req, w, err)
+				f.setStatusCode(req, w, err)
 				return
 			}
+			forgetFilter(ctx, filterID)
+			rec.commit(ctx)
 			return
 		}
 
@@ -190,7 +152,7 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 		opts, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
 		if err != nil {
 			log.Warn(ctx, "failed to retrieve dimension options", log.FormatErrors([]error{err}))
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
 
@@ -199,7 +161,7 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 			conflictErr := errors.New("inconsistent filter data")
 			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between get calls", conflictErr,
 				log.Data{"filter_id": filterID, "dimension": name, "e_tag_0": eTag, "e_tag_1": eTag1})
-			setStatusCode(req, w, conflictErr)
+			f.setStatusCode(req, w, conflictErr)
 			return
 		}
 
@@ -222,9 +184,11 @@ func (f *Filter) SearchUpdate() http.HandlerFunc {
 		_, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, name, addOptions, removeOptions, f.BatchSize, eTag1)
 		if err != nil {
 			log.Error(ctx, "failed to patch dimension values", err, log.Data{"filter_id": filterID, "dimension": name})
-			setStatusCode(req, w, err)
+			f.setStatusCode(req, w, err)
 			return
 		}
+		forgetFilter(ctx, filterID)
+		rec.commit(ctx)
 
 		http.Redirect(w, req, redirectURI, http.StatusFound)
 	})
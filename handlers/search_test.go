@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -49,6 +50,7 @@ func TestUnitSearch(t *testing.T) {
 		MaxDatasetOptions:    maxDatasetOptions,
 		BatchMaxWorkers:      maxWorkers,
 		EnableDatasetPreview: false,
+		FilterRetryAttempts:  2,
 	}
 
 	testSelectedOptions := filter.DimensionOptions{
@@ -112,6 +114,54 @@ func TestUnitSearch(t *testing.T) {
 			So(w.Code, ShouldEqual, http.StatusOK)
 		})
 
+		Convey("Then search retries the filter API reads and loads the page if the filter is modified between calls", func() {
+			testFilter := filter.Model{
+				Links: filter.Links{
+					Version: filter.Link{
+						HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1",
+					},
+				},
+			}
+			gomock.InOrder(
+				mfc.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(testFilter, testETag(0), nil),
+				mfc.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
+					batchSize, maxWorkers).Return(testSelectedOptions, testETag(1), nil),
+				mfc.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(testFilter, testETag(1), nil),
+				mfc.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
+					batchSize, maxWorkers).Return(testSelectedOptions, testETag(1), nil),
+			)
+			mdc.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, datasetID).Return(dataset.DatasetDetails{}, nil)
+			mdc.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, datasetID, edition, version).Return(dataset.VersionDimensions{}, nil)
+			mzc.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+			mdc.EXPECT().GetOptionsBatchProcess(ctx, mockUserAuthToken, "", mockCollectionID, datasetID, edition, version, name,
+				&[]string{"op1", "op2"}, gomock.Any(), maxDatasetOptions, maxWorkers).Return(nil)
+			msc.EXPECT().Dimension(ctx, datasetID, edition, version, name, query, expectedSearchClientConfigs).Return(&search.Model{}, nil)
+			mrc.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+			mrc.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "hierarchy")
+
+			w := callSearch()
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Then search renders the filter conflict page if the filter keeps being modified after all the attempts", func() {
+			mfc.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filter.Model{
+				Links: filter.Links{
+					Version: filter.Link{
+						HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1",
+					},
+				},
+			}, testETag(0), nil).Times(2)
+			mfc.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
+				batchSize, maxWorkers).Return(filter.DimensionOptions{}, "", filter.ErrBatchETagMismatch).Times(2)
+			mrc.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+			mrc.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "filter-errors/filter-conflict").Do(func(w io.Writer, _ interface{}, _ string) {
+				w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+			})
+
+			w := callSearch()
+			So(w.Code, ShouldEqual, http.StatusConflict)
+		})
+
 		Convey("Then search returns server error if GetJobState errors", func() {
 			mfc.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filter.Model{}, "", errors.New("get job state error"))
 
@@ -194,8 +244,6 @@ func TestUnitSearch(t *testing.T) {
 					},
 				},
 			}, testETag(0), nil)
-			mfc.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, name,
-				batchSize, maxWorkers).Return(filter.DimensionOptions{}, testETag(0), nil)
 
 			w := callSearch()
 			So(w.Code, ShouldEqual, http.StatusInternalServerError)
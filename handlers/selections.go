@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/selections"
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// importFileKey is the name of the file input the selections document is imported with
+	importFileKey = "selections-file"
+
+	// maxImportMemory is the size of the imported form kept in memory, the rest being stored in temporary files
+	maxImportMemory = 1024 * 1024
+)
+
+// ExportSelections downloads the dataset version and the selected options of a filter as a JSON document,
+// from which the filter can be recreated with ImportSelections
+func (f *Filter) ExportSelections() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		filterID := mux.Vars(req)["filterID"]
+		ctx := req.Context()
+
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+		if err != nil {
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
+
+		var dims filter.Dimensions
+		var selected []filter.DimensionOptions
+		err = f.retryFilterReads(ctx, "export_selections", filterID, func() error {
+			var eTag0 string
+			dims, eTag0, err = f.FilterClient.GetDimensions(ctx, userAccessToken, "", collectionID, filterID, nil)
+			if err != nil {
+				return err
+			}
+			selected = make([]filter.DimensionOptions, len(dims.Items))
+			for i := range dims.Items {
+				var eTag1 string
+				selected[i], eTag1, err = f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, dims.Items[i].Name, f.BatchSize, f.BatchMaxWorkers)
+				if err != nil {
+					return err
+				}
+				if eTag1 != eTag0 {
+					return errInconsistentFilter
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error(ctx, "failed to read filter selections", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+		if err != nil {
+			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		versionDims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+		if err != nil {
+			log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		dimLabels := make(map[string]string, len(versionDims.Items))
+		for i := range versionDims.Items {
+			dimLabels[versionDims.Items[i].Name] = versionDims.Items[i].Label
+		}
+
+		doc := selections.Document{
+			Dataset: selections.Dataset{ID: datasetID, Title: datasetDetails.Title, Edition: edition, Version: version},
+		}
+		for i := range dims.Items {
+			name := dims.Items[i].Name
+			labels, err := f.getIDNameLookupFromDatasetAPI(ctx, userAccessToken, collectionID, datasetID, edition, version, name, selected[i])
+			if err != nil {
+				log.Error(ctx, "failed to get options from dataset client for the selected values", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+				f.setStatusCode(req, w, err)
+				return
+			}
+
+			d := selections.Dimension{Name: name, Label: dimLabels[name], Options: make([]selections.Option, 0, len(selected[i].Items))}
+			for _, opt := range selected[i].Items {
+				d.Options = append(d.Options, selections.Option{Code: opt.Option, Label: labels[opt.Option]})
+			}
+			doc.Dimensions = append(doc.Dimensions, d)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s-v%s-selections.json", datasetID, edition, version)))
+		if err := selections.Write(w, doc); err != nil {
+			log.Error(ctx, "failed to write selections document", err, log.Data{"filter_id": filterID})
+		}
+	})
+}
+
+// ImportSelections creates a new filter blueprint from an uploaded selections document, selecting the options of the
+// document that still exist in the dataset version. The options that no longer exist are listed back to the user.
+func (f *Filter) ImportSelections() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		ctx := req.Context()
+		f.limitUploadSize(w, req)
+
+		if err := req.ParseMultipartForm(maxImportMemory); err != nil {
+			log.Warn(ctx, "failed to parse form", log.FormatErrors([]error{err}))
+			f.setStatusCode(req, w, uploadError(err, formError{"no selections document uploaded"}))
+			return
+		}
+		file, _, err := req.FormFile(importFileKey)
+		if err != nil {
+			log.Warn(ctx, "no selections document uploaded", log.FormatErrors([]error{err}))
+			f.setStatusCode(req, w, formError{"no selections document uploaded"})
+			return
+		}
+		defer file.Close()
+
+		doc, err := selections.Read(file)
+		if err != nil {
+			log.Warn(ctx, "failed to read selections document", log.FormatErrors([]error{err}))
+			f.setStatusCode(req, w, formError{err.Error()})
+			return
+		}
+		datasetID, edition, version := doc.Dataset.ID, doc.Dataset.Edition, doc.Dataset.Version
+		logData := log.Data{"dataset_id": datasetID, "edition": edition, "version": version}
+
+		versionDims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+		if err != nil {
+			log.Error(ctx, "failed to get dimensions", err, logData)
+			f.setStatusCode(req, w, err)
+			return
+		}
+		names := make([]string, 0, len(versionDims.Items))
+		for i := range versionDims.Items {
+			names = append(names, versionDims.Items[i].Name)
+		}
+
+		filterID, eTag, err := f.FilterClient.CreateBlueprint(ctx, userAccessToken, "", "", collectionID, datasetID, edition, version, names)
+		if err != nil {
+			log.Error(ctx, "failed to create filter blueprint", err, logData)
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		var changes []model.DimensionChanges
+		for _, d := range doc.Dimensions {
+			var valid []string
+			dropped := model.DimensionChanges{Name: d.Name, Label: d.Label}
+			if slices.Contains(names, d.Name) {
+				valid, dropped.Dropped, err = f.validOptions(ctx, userAccessToken, collectionID, datasetID, edition, version, d)
+				if err != nil {
+					log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": d.Name, "dataset_id": datasetID})
+					f.setStatusCode(req, w, err)
+					return
+				}
+			} else {
+				// the dimension does not exist in the dataset version, so none of its options can be selected
+				for _, opt := range d.Options {
+					dropped.Dropped = append(dropped.Dropped, optionLabelOrCode(opt))
+				}
+			}
+			if len(dropped.Dropped) > 0 {
+				changes = append(changes, dropped)
+			}
+			if len(valid) == 0 {
+				continue
+			}
+
+			eTag, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, d.Name, valid, []string{}, f.BatchSize, eTag)
+			if err != nil {
+				log.Error(ctx, "failed to add imported options", err, log.Data{"filter_id": filterID, "dimension": d.Name})
+				f.setStatusCode(req, w, err)
+				return
+			}
+		}
+
+		if len(changes) == 0 {
+			redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
+			http.Redirect(w, req, redirectURL, http.StatusFound)
+			return
+		}
+
+		log.Info(ctx, "imported options no longer exist", log.Data{"filter_id": filterID, "dimensions_changed": len(changes)})
+
+		datasetDetails, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, datasetID)
+		if err != nil {
+			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+		if err != nil {
+			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+		}
+
+		bp := f.RenderClient.NewBasePageModel()
+		p := mapper.CreateImportResultsPage(req, bp, datasetDetails, changes, filterID, datasetID, edition, version, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+		f.buildPage(w, req, p, "import-results")
+	})
+}
+
+// validOptions splits the imported options of a dimension into the codes of the ones that exist in the dataset version,
+// and the labels of the ones that no longer do
+func (f *Filter) validOptions(ctx context.Context, userAccessToken, collectionID, datasetID, edition, version string, d selections.Dimension) (valid, dropped []string, err error) {
+	opts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, d.Name, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		return nil, nil, err
+	}
+	labels := optionLabels(opts)
+	for _, opt := range d.Options {
+		if _, ok := labels[opt.Code]; ok {
+			valid = append(valid, opt.Code)
+		} else {
+			dropped = append(dropped, optionLabelOrCode(opt))
+		}
+	}
+	return valid, dropped, nil
+}
+
+// optionLabelOrCode returns the label of an imported option, or its code if the document has no label for it
+func optionLabelOrCode(opt selections.Option) string {
+	if opt.Label != "" {
+		return opt.Label
+	}
+	return opt.Code
+}
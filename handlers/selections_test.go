@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/selections"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelections(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25, MaxDatasetOptions: 200}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	serve := func(f *Filter, path string, h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.Path(path).HandlerFunc(h)
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	upload := func(doc string) *http.Request {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, err := mw.CreateFormFile(importFileKey, "selections.json")
+		So(err, ShouldBeNil)
+		_, err = fw.Write([]byte(doc))
+		So(err, ShouldBeNil)
+		So(mw.Close(), ShouldBeNil)
+
+		req := httptest.NewRequest("POST", "/filters/import", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	versionDims := dataset.VersionDimensions{Items: dataset.VersionDimensionItems{
+		{Name: "geography", Label: "Geographic area"},
+		{Name: "aggregate", Label: "Aggregate"},
+	}}
+
+	Convey("Given a filter with options selected in one of its dimensions", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filter.Model{
+			FilterID: filterID,
+			Links:    filter.Links{Version: filter.Link{HRef: "http://localhost:22400/v1/datasets/cpih01/editions/time-series/versions/1"}},
+		}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensions(ctx, mockUserAuthToken, "", mockCollectionID, filterID, nil).Return(filter.Dimensions{
+			Items: []filter.Dimension{{Name: "geography"}, {Name: "aggregate"}},
+		}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "K04000001"}}}, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "aggregate", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(filter.DimensionOptions{}, testETag(0), nil)
+		mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1").Return(versionDims, nil)
+		mockDatasetClient.EXPECT().GetOptionsBatchProcess(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography",
+			&[]string{"K04000001"}, gomock.Any(), cfg.MaxDatasetOptions, cfg.BatchMaxWorkers).
+			DoAndReturn(func(_, _, _, _, _, _, _, _ interface{}, _ *[]string, processBatch dataset.OptionsBatchProcessor, _, _ int) error {
+				_, err := processBatch(dataset.Options{Items: []dataset.Option{{Option: "K04000001", Label: "England and Wales"}}})
+				return err
+			})
+
+		Convey("When its selections are exported", func() {
+			w := serve(f, "/filters/{filterID}/selections.json", f.ExportSelections(), httptest.NewRequest("GET", "/filters/12345/selections.json", http.NoBody))
+
+			Convey("Then a document with the dataset version and the codes and labels of the selected options is downloaded", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Content-Disposition"), ShouldEqual, `attachment; filename="cpih01-time-series-v1-selections.json"`)
+
+				doc, err := selections.Read(w.Body)
+				So(err, ShouldBeNil)
+				So(doc, ShouldResemble, selections.Document{
+					SchemaVersion: selections.SchemaVersion,
+					Dataset:       selections.Dataset{ID: "cpih01", Title: "CPIH", Edition: "time-series", Version: "1"},
+					Dimensions: []selections.Dimension{
+						{Name: "geography", Label: "Geographic area", Options: []selections.Option{{Code: "K04000001", Label: "England and Wales"}}},
+						{Name: "aggregate", Label: "Aggregate", Options: []selections.Option{}},
+					},
+				})
+			})
+		})
+	})
+
+	Convey("Given a selections document", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1").Return(versionDims, nil)
+		mockFilterClient.EXPECT().CreateBlueprint(ctx, mockUserAuthToken, "", "", mockCollectionID, "cpih01", "time-series", "1", []string{"geography", "aggregate"}).
+			Return("67890", testETag(0), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(dataset.Options{Items: []dataset.Option{{Option: "K04000001", Label: "England and Wales"}}}, nil)
+
+		Convey("When all of its options still exist, then a new filter is created with them and the user is sent to its overview", func() {
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, "67890", "geography",
+				[]string{"K04000001"}, []string{}, cfg.BatchSizeLimit, testETag(0)).Return(testETag(1), nil)
+
+			w := serve(f, "/filters/import", f.ImportSelections(), upload(`{"schema_version":1,"dataset":{"id":"cpih01","edition":"time-series","version":"1"},
+				"dimensions":[{"name":"geography","options":[{"code":"K04000001"}]}]}`))
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/67890/dimensions")
+		})
+
+		Convey("When some of its options no longer exist, then the ones that do are selected and the others are listed", func() {
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, "67890", "geography",
+				[]string{"K04000001"}, []string{}, cfg.BatchSizeLimit, testETag(0)).Return(testETag(1), nil)
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+			mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+			var page model.ImportResults
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "import-results").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.ImportResults)
+			})
+
+			w := serve(f, "/filters/import", f.ImportSelections(), upload(`{"schema_version":1,"dataset":{"id":"cpih01","edition":"time-series","version":"1"},
+				"dimensions":[
+					{"name":"geography","label":"Geographic area","options":[{"code":"K04000001"},{"code":"E92000001","label":"England"}]},
+					{"name":"sex","options":[{"code":"1"}]}
+				]}`))
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(page.Data.Dimensions, ShouldResemble, []model.DimensionChanges{
+				{Name: "geography", Label: "Geographic area", Dropped: []string{"England"}},
+				{Name: "sex", Label: "sex", Dropped: []string{"1"}},
+			})
+			So(page.Data.Continue.URL, ShouldEqual, "/filters/67890/dimensions")
+		})
+	})
+
+	Convey("Given a document that can't be read, then a validation error is returned", t, func() {
+		f := NewFilter(nil, NewMockFilterClient(mockCtrl), NewMockDatasetClient(mockCtrl), nil, nil, nil, "/v1", cfg)
+
+		req := upload(`{"schema_version":99}`)
+		req.Header.Set("Accept", "application/json")
+		w := serve(f, "/filters/import", f.ImportSelections(), req)
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(strings.HasPrefix(w.Header().Get("Content-Type"), problemContentType), ShouldBeTrue)
+	})
+
+	Convey("Given a document larger than the configured maximum, then it is rejected before creating a filter", t, func() {
+		f := NewFilter(nil, NewMockFilterClient(mockCtrl), NewMockDatasetClient(mockCtrl), nil, nil, nil, "/v1", cfg)
+		f.maxUploadSize = 64
+
+		req := upload(`{"schema_version":1,"dataset":{"id":"cpih01","edition":"time-series","version":"1"},"dimensions":[]}`)
+		req.Header.Set("Accept", "application/json")
+		w := serve(f, "/filters/import", f.ImportSelections(), req)
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldContainSubstring, errUploadTooLarge.msg)
+	})
+}
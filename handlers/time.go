@@ -1,29 +1,39 @@
 package handlers
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
-	"regexp"
+	"slices"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
-	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/gorilla/mux"
 )
 
-var acceptedReg = regexp.MustCompile(`^\w{3}-\d{2}$`)
+// isTimePageFormat returns true if the options of the time codelist are in a format that can be chosen with the time page
+func isTimePageFormat(opts []dataset.Option) bool {
+	labels := make([]string, 0, len(opts))
+	for i := range opts {
+		labels = append(labels, opts[i].Label)
+	}
+	_, ok := dates.Detect(labels)
+	return ok
+}
 
-// UpdateTime will update the time filter based on the radio selected filters by the user
+// UpdateTime will update the time filter based on the radio selected filters by the user. The selection is validated
+// before the filter is changed, and replaces the selected time options at once, so that the existing selection is kept
+// if the submitted one is invalid or can't be saved
 func (f *Filter) UpdateTime() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
 		vars := mux.Vars(req)
@@ -31,57 +41,58 @@ func (f *Filter) UpdateTime() http.HandlerFunc {
 		ctx := req.Context()
 		dimensionName := strTime
 
-		eTag, err := f.FilterClient.RemoveDimension(ctx, userAccessToken, "", collectionID, filterID, dimensionName, headers.IfMatchAnyETag)
-		if err != nil {
-			log.Error(ctx, "failed to remove dimension", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
+		if fErr := req.ParseForm(); fErr != nil {
+			log.Error(ctx, "failed to parse form", fErr, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, fErr)
 			return
 		}
 
-		eTag, err = f.FilterClient.AddDimension(ctx, userAccessToken, "", collectionID, filterID, dimensionName, eTag)
-		if err != nil {
-			log.Error(ctx, "failed to add dimension", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
+		eTag := submittedETag(req)
+
+		if req.Form.Get("add-all") != "" {
+			f.forgetRelativeTime(ctx, filterID)
+			http.Redirect(w, req, fmt.Sprintf("/filters/%s/dimensions/time/add-all", filterID), http.StatusFound)
 			return
 		}
 
-		if fErr := req.ParseForm(); fErr != nil {
-			log.Error(ctx, "failed to parse form", fErr, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, fErr)
+		if req.Form.Get("remove-all") != "" {
+			f.forgetRelativeTime(ctx, filterID)
+			http.Redirect(w, req, withETag(fmt.Sprintf("/filters/%s/dimensions/time/remove-all", filterID), eTag), http.StatusFound)
 			return
 		}
 
-		if req.Form.Get("add-all") != "" {
-			http.Redirect(w, req, fmt.Sprintf("/filters/%s/dimensions/time/add-all", filterID), http.StatusFound)
+		options, rule, err := f.timeSelection(ctx, userAccessToken, collectionID, filterID, req.Form)
+		if fieldErr, ok := asFieldError(err); ok {
+			log.Warn(ctx, "invalid time selection", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID, "field": fieldErr.field})
+			f.timeSelector(w, req, lang, collectionID, userAccessToken, req.Form, err)
+			return
+		}
+		if err != nil {
+			log.Error(ctx, "failed to read time selection", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
-		if req.Form.Get("remove-all") != "" {
-			http.Redirect(w, req, fmt.Sprintf("/filters/%s/dimensions/time/remove-all", filterID), http.StatusFound)
+		rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, dimensionName)
+		_, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, options, eTag)
+		if isConflict(err) {
+			log.Warn(ctx, "filter was modified since the page was loaded", log.Data{"filter_id": filterID, "dimension": dimensionName})
+			forgetFilter(ctx, filterID)
+			f.timeSelector(w, req, lang, collectionID, userAccessToken, req.Form, nil)
+			return
+		}
+		if err != nil {
+			log.Error(ctx, "failed to set dimension values", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
+			f.setStatusCode(req, w, err)
 			return
 		}
+		forgetFilter(ctx, filterID)
+		rec.commit(ctx)
 
-		switch req.Form.Get("time-selection") {
-		case "latest":
-			_, err = f.FilterClient.AddDimensionValue(ctx, userAccessToken, "", collectionID, filterID, dimensionName, req.Form.Get("latest-option"), eTag)
-			if err != nil {
-				log.Error(ctx, "failed to add dimension value", err)
-			}
-		case "single":
-			_, err = f.addSingleTime(filterID, userAccessToken, collectionID, req, eTag)
-			if err != nil {
-				log.Error(ctx, "failed to add single time", err)
-			}
-		case "range":
-			_, err = f.addTimeRange(filterID, userAccessToken, collectionID, req, eTag)
-			if err != nil {
-				log.Error(ctx, "failed to add range of times", err)
-			}
-		case "list":
-			_, err = f.addTimeList(filterID, userAccessToken, collectionID, req, eTag)
-			if err != nil {
-				log.Error(ctx, "failed to add list of times", err)
-			}
+		if req.Form.Get("time-selection") == relTime {
+			f.setRelativeTime(ctx, filterID, rule)
+		} else {
+			f.forgetRelativeTime(ctx, filterID)
 		}
 
 		redirectURL := fmt.Sprintf("/filters/%s/dimensions", filterID)
@@ -89,205 +100,473 @@ func (f *Filter) UpdateTime() http.HandlerFunc {
 	})
 }
 
-func (f *Filter) addSingleTime(filterID, userAccessToken, collectionID string, req *http.Request, eTag string) (newETag string, err error) {
-	ctx := req.Context()
+// timeSelection returns the time options chosen in the form, without changing the filter. The rule is only returned
+// for relative selections. Invalid choices are returned as a fieldError
+func (f *Filter) timeSelection(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, relative.Rule, error) {
+	switch form.Get("time-selection") {
+	case "latest":
+		option := form.Get("latest-option")
+		if option == "" {
+			return nil, relative.Rule{}, newFieldError("time-selection-latest", "The latest time period is unknown, reload the page and try again")
+		}
+		return []string{option}, relative.Rule{}, nil
+	case single:
+		options, err := singleTime(form)
+		return options, relative.Rule{}, err
+	case strRange:
+		options, err := f.timeRange(ctx, userAccessToken, collectionID, filterID, form)
+		return options, relative.Rule{}, err
+	case list:
+		options, err := f.timeList(ctx, userAccessToken, collectionID, filterID, form)
+		return options, relative.Rule{}, err
+	case relTime:
+		return f.relativeTimes(ctx, userAccessToken, collectionID, filterID, form)
+	}
+	return nil, relative.Rule{}, newFieldError("time-form", "Select how you want to choose the time periods")
+}
 
-	month := req.Form.Get("month-single")
-	year := req.Form.Get("year-single")
-	dimensionName := strTime
+// timeFormat returns the format of the time codes the form was rendered for. Forms that don't say are for monthly codes
+func timeFormat(form url.Values) (dates.Format, error) {
+	name := form.Get("time-format")
+	if name == "" {
+		return dates.Monthly, nil
+	}
+	format, ok := dates.Lookup(name)
+	if !ok {
+		return nil, formError{fmt.Sprintf("unknown time format: %q", name)}
+	}
+	return format, nil
+}
+
+// formPeriod returns the period chosen with the year and month selectors of the form. The month is ignored if the
+// periods are a year long
+func formPeriod(format dates.Format, form url.Values, yearKey, partKey string) (dates.Period, error) {
+	g := format.Granularity()
+	y, err := dates.ParseYear(form.Get(yearKey))
+	if err != nil {
+		return dates.Period{}, newFieldError(yearKey, "Select a year")
+	}
+	period, err := g.Period(y, form.Get(partKey))
+	if err != nil {
+		return dates.Period{}, newFieldError(partKey, fmt.Sprintf("Select a %s of %s", g, g.YearLabel(y)))
+	}
+	return period, nil
+}
+
+// formDatePeriod returns the period containing the date chosen with a date picker of the form
+func formDatePeriod(format dates.Format, form url.Values, key string) (dates.Period, error) {
+	t, err := time.Parse(isoDate, form.Get(key))
+	if err != nil {
+		return dates.Period{}, newFieldError(key, "Enter a date, such as 2021-01-31")
+	}
+	return format.Granularity().Containing(t), nil
+}
 
-	date, err := time.Parse("January 2006", fmt.Sprintf("%s %s", month, year))
+// singleTime returns the time option chosen with the single selectors of the form
+func singleTime(form url.Values) ([]string, error) {
+	format, err := timeFormat(form)
 	if err != nil {
-		return eTag, err
+		return nil, err
 	}
 
-	return f.FilterClient.AddDimensionValue(ctx, userAccessToken, "", collectionID, filterID, dimensionName, date.Format("Jan-06"), eTag)
+	var period dates.Period
+	if format.Granularity().ChosenByDate() {
+		period, err = formDatePeriod(format, form, "date-single")
+	} else {
+		period, err = formPeriod(format, form, "year-single", "month-single")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{format.Code(period)}, nil
 }
 
-// addTimeList will save form time grouped list form data to the filter
-func (f *Filter) addTimeList(filterID, userAccessToken, collectionID string, req *http.Request, eTag string) (newETag string, err error) {
-	ctx := req.Context()
+// timeList returns the time options chosen with the grouped list of the form: the chosen months, or other parts of
+// the year, of each year in the range
+func (f *Filter) timeList(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, error) {
 	dimensionName := strTime
 
-	var options []string
-	startYearStr := req.Form.Get("start-year-grouped")
-	endYearStr := req.Form.Get("end-year-grouped")
-	startYearInt, err := strconv.Atoi(startYearStr)
+	format, err := timeFormat(form)
 	if err != nil {
-		log.Error(ctx, "failed to convert filter start year string to integer", err)
-		return eTag, err
+		return nil, err
 	}
-	endYearInt, err := strconv.Atoi(endYearStr)
+	g := format.Granularity()
+
+	startYear, err := dates.ParseYear(form.Get("start-year-grouped"))
+	if err != nil {
+		return nil, newFieldError("start-year-grouped", "Select the first year")
+	}
+	endYear, err := dates.ParseYear(form.Get("end-year-grouped"))
 	if err != nil {
-		log.Error(ctx, "failed to convert filter end year string to integer", err)
-		return eTag, err
+		return nil, newFieldError("end-year-grouped", "Select the last year")
+	}
+	if endYear < startYear {
+		return nil, newFieldError("end-year-grouped", "The last year must not be before the first year")
+	}
+
+	// periods a year long have no months to choose, so every year in the range is added
+	selectedMonths := form["months"]
+	if len(g.Parts()) == 0 {
+		selectedMonths = []string{""}
 	}
+	if len(selectedMonths) == 0 {
+		part := g.String()
+		if g == dates.Day {
+			part = "day of the week"
+		}
+		return nil, newFieldError("multiple-choice-content-list", fmt.Sprintf("Select at least one %s", part))
+	}
+
+	var options []string
 
-	selectedMonths := req.Form["months"]
+	// days and weeks are listed by day of the week or ISO week, which not every year has, so the options
+	// of the dataset are grouped the same way
+	if g.ChosenByDate() {
+		values, labelIDMap, vErr := f.getDimensionValues(ctx, userAccessToken, collectionID, filterID, dimensionName)
+		if vErr != nil {
+			return nil, vErr
+		}
+		times, tErr := timeOptions(format, values, labelIDMap)
+		if tErr != nil {
+			return nil, tErr
+		}
+		dates.SortOptions(times)
+		for _, t := range times {
+			year := t.Period.Year()
+			if year >= startYear && year <= endYear && slices.Contains(selectedMonths, t.Period.Part()) {
+				options = append(options, t.Code)
+			}
+		}
+		if len(options) == 0 {
+			return nil, newFieldError("multiple-choice-content-list", "There is no data for these years")
+		}
+		return options, nil
+	}
 
-	for year := startYearInt; year <= endYearInt; year++ {
-		yearStr := strconv.Itoa(year)
+	for year := startYear; year <= endYear; year++ {
 		for _, month := range selectedMonths {
-			monthYearComboStr := fmt.Sprintf("%s %s", month, yearStr)
-			monthYearComboTime, tErr := time.Parse("January 2006", monthYearComboStr)
-			if tErr != nil {
-				log.Error(ctx, "failed to convert filtered month and year combo to time format", tErr)
-				return eTag, tErr
+			period, pErr := g.Period(year, month)
+			if pErr != nil {
+				return nil, newFieldError("multiple-choice-content-list", fmt.Sprintf("%s is not a %s", month, g))
 			}
-			monthYearCombo := monthYearComboTime.Format("Jan-06")
-			options = append(options, monthYearCombo)
+			options = append(options, format.Code(period))
 		}
 	}
+	return options, nil
+}
+
+// timeRange returns the time options between the start and end chosen in the form
+func (f *Filter) timeRange(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, error) {
+	dimensionName := strTime
+
+	format, err := timeFormat(form)
+	if err != nil {
+		return nil, err
+	}
+
+	byDate := format.Granularity().ChosenByDate()
+	endKey := "end-year"
+	if byDate {
+		endKey = "end-date"
+	}
 
-	newETag, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, options, eTag)
+	var start, end dates.Period
+	if byDate {
+		start, err = formDatePeriod(format, form, "start-date")
+	} else {
+		start, err = formPeriod(format, form, "start-year", "start-month")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if byDate {
+		end, err = formDatePeriod(format, form, endKey)
+	} else {
+		end, err = formPeriod(format, form, endKey, "end-month")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if end.Before(start) {
+		return nil, newFieldError(endKey, fmt.Sprintf("The end of the range must not be before %s", start.Label()))
+	}
+
+	values, labelIDMap, err := f.getDimensionValues(ctx, userAccessToken, collectionID, filterID, dimensionName)
 	if err != nil {
-		log.Error(ctx, "failed to add dimension values", err)
-		return eTag, err
+		return nil, err
 	}
-	return newETag, nil
+
+	times, err := timeOptions(format, values, labelIDMap)
+	if err != nil {
+		return nil, err
+	}
+	dates.SortOptions(times)
+
+	var options []string
+	for _, t := range times {
+		if !t.Period.Before(start) && !end.Before(t.Period) {
+			options = append(options, t.Code)
+		}
+	}
+	if len(options) == 0 {
+		return nil, newFieldError(endKey, fmt.Sprintf("There is no data from %s to %s", start.Label(), end.Label()))
+	}
+	return options, nil
 }
 
-func (f *Filter) addTimeRange(filterID, userAccessToken, collectionID string, req *http.Request, eTag string) (newETag string, err error) {
-	startMonth := req.Form.Get("start-month")
-	startYear := req.Form.Get("start-year")
-	endMonth := req.Form.Get("end-month")
-	endYear := req.Form.Get("end-year")
-	ctx := req.Context()
+// relativeTimes returns the latest periods chosen in the form, along with the rule selecting them so that the same
+// periods are selected again relative to the latest one when the filter is moved to a new version
+func (f *Filter) relativeTimes(ctx context.Context, userAccessToken, collectionID, filterID string, form url.Values) ([]string, relative.Rule, error) {
 	dimensionName := strTime
 
-	values, labelIDMap, err := f.getDimensionValues(ctx, userAccessToken, collectionID, filterID, dimensionName)
+	rule, err := relativeRule(form)
 	if err != nil {
-		return "", err
+		return nil, relative.Rule{}, err
 	}
 
-	dats, err := dates.ConvertToReadable(values)
+	format, err := timeFormat(form)
 	if err != nil {
-		return "", err
+		return nil, relative.Rule{}, err
 	}
-	dats = dates.Sort(dats)
 
-	start, err := time.Parse("01 January 2006", fmt.Sprintf("01 %s %s", startMonth, startYear))
+	values, labelIDMap, err := f.getDimensionValues(ctx, userAccessToken, collectionID, filterID, dimensionName)
 	if err != nil {
-		return "", err
+		return nil, relative.Rule{}, err
 	}
 
-	end, err := time.Parse("01 January 2006", fmt.Sprintf("01 %s %s", endMonth, endYear))
+	times, err := timeOptions(format, values, labelIDMap)
 	if err != nil {
-		return "", err
+		return nil, relative.Rule{}, err
 	}
 
-	if end.Before(start) {
-		return "", fmt.Errorf("start date: %s before end date: %s", start.String(), end.String())
+	return rule.Resolve(times), rule, nil
+}
+
+// relativeRule returns the relative time rule chosen in the form
+func relativeRule(form url.Values) (relative.Rule, error) {
+	count, err := strconv.Atoi(form.Get("relative-count"))
+	if err != nil {
+		return relative.Rule{}, newFieldError("relative-count", "The number of latest periods must be a whole number")
+	}
+	unit, err := dates.ParseGranularity(form.Get("relative-unit"))
+	if err != nil {
+		return relative.Rule{}, newFieldError("relative-unit", "Select the unit of the latest periods")
+	}
+	rule := relative.Rule{Count: count, Unit: unit}
+	if err := rule.Validate(); err != nil {
+		return relative.Rule{}, newFieldError("relative-count", "The number of latest periods must be at least 1")
 	}
+	return rule, nil
+}
 
-	values = dates.ConvertToCoded(dats)
-	var options []string
-	for i, dat := range dats {
-		if dat.Equal(start) || dat.After(start) && dat.Before(end) || dat.Equal(end) {
-			options = append(options, labelIDMap[values[i]])
+// timeOptions parses the labels of the time options of a dataset version with the format of the time codes
+func timeOptions(format dates.Format, labels []string, labelIDMap map[string]string) ([]dates.Option, error) {
+	times := make([]dates.Option, 0, len(labels))
+	for _, label := range labels {
+		period, err := format.Parse(label)
+		if err != nil {
+			return nil, err
 		}
+		times = append(times, dates.Option{Code: labelIDMap[label], Label: label, Period: period})
+	}
+	return times, nil
+}
+
+// detectTimeOptions parses the time options of a dataset version, detecting the format of their labels
+func detectTimeOptions(opts dataset.Options) ([]dates.Option, error) {
+	labels := make([]string, 0, len(opts.Items))
+	labelIDMap := make(map[string]string, len(opts.Items))
+	for i := range opts.Items {
+		labels = append(labels, opts.Items[i].Label)
+		labelIDMap[opts.Items[i].Label] = opts.Items[i].Option
 	}
+	format, ok := dates.Detect(labels)
+	if !ok {
+		return nil, dates.ErrUnknownFormat
+	}
+	return timeOptions(format, labels, labelIDMap)
+}
+
+// relativeTime returns the relative time rule of a filter, if it has one. Failing to read it is only logged, as
+// the filter can still be used without it
+func (f *Filter) relativeTime(ctx context.Context, filterID string) (relative.Rule, bool) {
+	if f.RelativeTime == nil {
+		return relative.Rule{}, false
+	}
+	rule, ok, err := f.RelativeTime.Get(ctx, filterID)
+	if err != nil {
+		log.Warn(ctx, "failed to read relative time rule", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+		return relative.Rule{}, false
+	}
+	return rule, ok
+}
+
+// setRelativeTime records the relative time rule of a filter. Failing to record it is only logged, as the
+// periods it selects are already in the filter
+func (f *Filter) setRelativeTime(ctx context.Context, filterID string, rule relative.Rule) {
+	if f.RelativeTime == nil {
+		return
+	}
+	if err := f.RelativeTime.Set(ctx, filterID, rule); err != nil {
+		log.Warn(ctx, "failed to record relative time rule", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+	}
+}
 
-	return f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, options, eTag)
+// forgetRelativeTime removes the relative time rule of a filter, once its times are chosen some other way
+func (f *Filter) forgetRelativeTime(ctx context.Context, filterID string) {
+	if f.RelativeTime == nil {
+		return
+	}
+	if err := f.RelativeTime.Delete(ctx, filterID); err != nil {
+		log.Warn(ctx, "failed to remove relative time rule", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+	}
 }
 
 // Time specifically handles the data for the time dimension page
 func (f *Filter) Time() http.HandlerFunc {
 	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
-		vars := mux.Vars(req)
-		filterID := vars["filterID"]
-		ctx := req.Context()
-		dimensionName := strTime
+		f.timeSelector(w, req, lang, collectionID, userAccessToken, nil, nil)
+	})
+}
 
-		fj, eTag0, err := f.FilterClient.GetJobState(ctx, userAccessToken, "", "", collectionID, filterID)
-		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
+// timeSelector renders the time selector. If the form with pending changes is provided, they are shown instead of the options
+// currently selected in the filter, along with a message explaining that the filter was modified since the user loaded the page,
+// or explaining what is wrong with the form if it was invalid
+func (f *Filter) timeSelector(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string, pending url.Values, invalid error) {
+	vars := mux.Vars(req)
+	filterID := vars["filterID"]
+	ctx := req.Context()
+	dimensionName := strTime
 
-		versionURL, err := url.Parse(fj.Links.Version.HRef)
-		if err != nil {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
-			return
-		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
-		datasetID, edition, version, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
-		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
-			return
-		}
+	fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+	if err != nil {
+		log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fj, eTag0, datasetID, edition, version := fc.Filter, fc.ETag, fc.DatasetID, fc.Edition, fc.Version
 
-		datasetDetails, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, datasetID)
-		if err != nil {
-			log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
-			setStatusCode(req, w, err)
-			return
-		}
+	datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		// count number of options for the dimension in dataset API
-		opts, err := f.DatasetClient.GetOptions(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName, &dataset.QueryParams{Offset: 0, Limit: 1})
-		if err != nil {
-			log.Error(ctx, "failed to get options from dataset client", err,
-				log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	allValues, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		log.Error(ctx, "failed to get options from dataset client", err,
+			log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		// use normal list format unless a specially recognized time format
-		if opts.TotalCount <= MaxNumOptionsOnPage || !acceptedReg.MatchString(opts.Items[0].Option) {
-			mux.Vars(req)["name"] = dimensionName
-			f.DimensionSelector().ServeHTTP(w, req)
-			return
-		}
+	// use normal list format unless the whole codelist is in a specially recognized time format
+	if len(allValues.Items) <= MaxNumOptionsOnPage || !isTimePageFormat(allValues.Items) {
+		mux.Vars(req)["name"] = dimensionName
+		f.DimensionSelector().ServeHTTP(w, req)
+		return
+	}
 
-		dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
-		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err,
-				log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err,
+			log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		selValues, eTag1, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, dimensionName, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
-			return
-		}
+	fc, selValues, err := f.consistentSelection(ctx, "time_selector", userAccessToken, collectionID, filterID, dimensionName, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get options from filter client", err, log.Data{"filter_id": filterID, "dimension": dimensionName})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	fj, eTag0 = fc.Filter, fc.ETag
 
-		if eTag0 != eTag1 {
-			conflictErr := errors.New("inconsistent filter data")
-			log.Error(ctx, "data consistency cannot be guaranteed because filter was modified between calls", conflictErr,
-				log.Data{"filter_id": filterID, "e_tag_0": eTag0, "e_tag_1": eTag1})
-			// The user might want to retry this handler in this case
-			setStatusCode(req, w, conflictErr)
-			return
-		}
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
 
-		allValues, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, dimensionName, f.BatchSize, f.BatchMaxWorkers)
-		if err != nil {
-			log.Error(ctx, "failed to get options from dataset client", err,
-				log.Data{"dimension": dimensionName, "dataset_id": datasetID, "edition": edition, "version": version})
-			setStatusCode(req, w, err)
-			return
-		}
+	bp := f.RenderClient.NewBasePageModel()
+	p, err := mapper.CreateTimePage(req, bp, fj, datasetDetails, allValues, selValues.Items, dims, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+	if err != nil {
+		log.Error(ctx, "failed to map data to page", err, log.Data{"filter_id": filterID, "dataset_id": datasetID, "dimension": dimensionName})
+		f.setStatusCode(req, w, err)
+		return
+	}
 
-		homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
-		if err != nil {
-			log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
-		}
+	p.Data.ETag = eTag0
+	p.Data.Undo = f.undoLink(ctx, filterID, eTag0, fmt.Sprintf("/filters/%s/dimensions/%s", filterID, dimensionName))
+	if rule, ok := f.relativeTime(ctx, filterID); ok {
+		applyRelativeTime(ctx, &p, rule, allValues, selValues.Items)
+	}
+	if pending == nil {
+		f.buildPage(w, req, p, strTime)
+		return
+	}
 
-		bp := f.RenderClient.NewBasePageModel()
-		p, err := mapper.CreateTimePage(req, bp, fj, datasetDetails, allValues, selValues.Items, dims, datasetID, f.APIRouterVersion, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
-		if err != nil {
-			log.Error(ctx, "failed to map data to page", err, log.Data{"filter_id": filterID, "dataset_id": datasetID, "dimension": dimensionName})
-			setStatusCode(req, w, err)
-			return
-		}
+	applyPendingTime(&p, pending)
+	if fieldErr, ok := asFieldError(invalid); ok {
+		p.Error = invalidFormMessage(lang, fieldErr)
+		p.Data.FieldErrors = fieldErr.fieldErrors()
+		f.buildPageWithStatus(w, req, p, strTime, http.StatusBadRequest)
+		return
+	}
+	p.Error = conflictMessage(lang)
+	f.buildPageWithStatus(w, req, p, strTime, http.StatusConflict)
+}
 
-		f.RenderClient.BuildPage(w, p, strTime)
-	})
+// applyRelativeTime shows the relative time rule of the filter as its selection, if the rule still selects the
+// options selected in the filter
+func applyRelativeTime(ctx context.Context, p *model.Time, rule relative.Rule, allValues dataset.Options, selValues []filter.DimensionOption) {
+	times, err := detectTimeOptions(allValues)
+	if err != nil {
+		log.Warn(ctx, "unable to parse time options", log.FormatErrors([]error{err}))
+		return
+	}
+	selected := make([]string, 0, len(selValues))
+	for _, opt := range selValues {
+		selected = append(selected, opt.Option)
+	}
+	if !rule.Matches(times, selected) {
+		return
+	}
+	p.Data.CheckedRadio = relTime
+	p.Data.RelativeCount = strconv.Itoa(rule.Count)
+	p.Data.RelativeUnit = rule.Unit.String()
+}
+
+// applyPendingTime sets the selection submitted in the time form on the page
+func applyPendingTime(p *model.Time, form url.Values) {
+	if selection := form.Get("time-selection"); selection != "" {
+		p.Data.CheckedRadio = selection
+	}
+
+	switch p.Data.CheckedRadio {
+	case single:
+		p.Data.SelectedStartMonth = form.Get("month-single")
+		p.Data.SelectedStartYear = form.Get("year-single")
+		p.Data.SelectedStartDate = form.Get("date-single")
+	case strRange:
+		p.Data.SelectedStartMonth = form.Get("start-month")
+		p.Data.SelectedStartYear = form.Get("start-year")
+		p.Data.SelectedEndMonth = form.Get("end-month")
+		p.Data.SelectedEndYear = form.Get("end-year")
+		p.Data.SelectedStartDate = form.Get("start-date")
+		p.Data.SelectedEndDate = form.Get("end-date")
+	case relTime:
+		p.Data.RelativeCount = form.Get("relative-count")
+		p.Data.RelativeUnit = form.Get("relative-unit")
+	case list:
+		p.Data.GroupedSelection.YearStart = form.Get("start-year-grouped")
+		p.Data.GroupedSelection.YearEnd = form.Get("end-year-grouped")
+		for i := range p.Data.GroupedSelection.Months {
+			p.Data.GroupedSelection.Months[i].IsSelected = slices.Contains(form["months"], p.Data.GroupedSelection.Months[i].Name)
+		}
+	}
 }
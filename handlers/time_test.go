@@ -1,16 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
 	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -53,9 +63,7 @@ func TestUpdateTime(t *testing.T) {
 	Convey("Given that a user has selected time options via the list time-selection, then the redirect is successful and the expected calls are made to filter API", t, func() {
 		options := []string{"Aug-11", "Aug-12"}
 		mockClient := NewMockFilterClient(mockCtrl)
-		mockClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", testETag(0)).Return(testETag(1), nil)
-		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", options, testETag(1)).Return(testETag(2), nil)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", options, headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "latest-option=Nov-17&latest-month=November&latest-year=2017&month-single=Select&year-single=Select&start-month=Select&start-year=Select&end-month=Select&end-year=Select&time-selection=list&months=August&start-year-grouped=2011&end-year-grouped=2012&save-and-return=Save+and+return"
 		w := callTimeUpdate(formData, mockClient, nil)
 		So(w.Code, ShouldEqual, 302)
@@ -64,9 +72,7 @@ func TestUpdateTime(t *testing.T) {
 	Convey("Given that a user has slected the latest time option, then the redirect is successful and the expected calls are made to Filter API", t, func() {
 		option := "Jul-20"
 		mockClient := NewMockFilterClient(mockCtrl)
-		mockClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", testETag(0)).Return(testETag(1), nil)
-		mockClient.EXPECT().AddDimensionValue(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", option, testETag(1)).Return(testETag(2), nil)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{option}, headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "time-selection=latest&latest-option=Jul-20&latest-month=July&latest-year=2020&first-year=1988&first-month=January&month-single=Select&year-single=Select&start-month=Select&start-year=Select&end-month=Select&end-year=Select&months=February&start-year-grouped=2000&end-year-grouped=2002&save-and-return=Save+and+return"
 		w := callTimeUpdate(formData, mockClient, nil)
 		So(w.Code, ShouldEqual, 302)
@@ -75,9 +81,7 @@ func TestUpdateTime(t *testing.T) {
 	Convey("Given that a user has selected a time option via the single selection, then the redirect is successful and the expected calls are made to Filter API", t, func() {
 		option := "May-19"
 		mockClient := NewMockFilterClient(mockCtrl)
-		mockClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", testETag(0)).Return(testETag(1), nil)
-		mockClient.EXPECT().AddDimensionValue(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", option, testETag(1)).Return(testETag(2), nil)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{option}, headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "latest-option=Jul-20&latest-month=July&latest-year=2020&first-year=1988&first-month=January&time-selection=single&month-single=May&year-single=2019&start-month=Select&start-year=Select&end-month=Select&end-year=Select&start-year-grouped=Select&end-year-grouped=Select&save-and-return=Save+and+return"
 		w := callTimeUpdate(formData, mockClient, nil)
 		So(w.Code, ShouldEqual, 302)
@@ -101,14 +105,163 @@ func TestUpdateTime(t *testing.T) {
 		filterOptions := []string{"Jan-00", "Feb-00", "Mar-00"}
 		mockFilterClient := NewMockFilterClient(mockCtrl)
 		mockDatasetClient := NewMockDatasetClient(mockCtrl)
-		mockFilterClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", headers.IfMatchAnyETag).Return(testETag(0), nil)
-		mockFilterClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", testETag(0)).Return(testETag(1), nil)
 		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(expectedFilterModel, testETag(1), nil)
 		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde", "2017", "1", "time",
 			batchSize, maxWorkers).Return(datasetOptions, nil)
-		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", filterOptions, testETag(1)).Return(testETag(2), nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", filterOptions, headers.IfMatchAnyETag).Return(testETag(2), nil)
 		formData := "latest-option=Jul-20&latest-month=July&latest-year=2020&first-year=1988&first-month=January&month-single=Select&year-single=Select&time-selection=range&start-month=January&start-year=2000&end-month=March&end-year=2000&start-year-grouped=Select&end-year-grouped=Select&save-and-return=Save+and+return"
 		w := callTimeUpdate(formData, mockFilterClient, mockDatasetClient)
 		So(w.Code, ShouldEqual, 302)
 	})
+
+	Convey("Given that a user has selected a single quarter, then the option is written in the format of the time codes", t, func() {
+		mockClient := NewMockFilterClient(mockCtrl)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{"2019 Q2"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "time-format=2006+Q1&time-selection=single&month-single=Q2&year-single=2019&save-and-return=Save+and+return"
+		w := callTimeUpdate(formData, mockClient, nil)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that a user has selected a list of financial years, then every year in the range is added", t, func() {
+		mockClient := NewMockFilterClient(mockCtrl)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{"2018-19", "2019-20", "2020-21"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "time-format=2006-07&time-selection=list&start-year-grouped=2018-19&end-year-grouped=2020-21&save-and-return=Save+and+return"
+		w := callTimeUpdate(formData, mockClient, nil)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that a user has picked a range of dates of a daily series, then the days between them are selected", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(filter.Model{
+			Links: filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1"}},
+		}, testETag(1), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde", "2017", "1", "time", batchSize, maxWorkers).
+			Return(dataset.Options{Items: []dataset.Option{
+				{Label: "2021-01-04", Option: "2021-01-04"}, {Label: "2021-01-01", Option: "2021-01-01"}, {Label: "2021-01-02", Option: "2021-01-02"},
+			}}, nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{"2021-01-02", "2021-01-04"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "time-format=2006-01-02&time-selection=range&start-date=2021-01-02&end-date=2021-01-04&save-and-return=Save+and+return"
+		w := callTimeUpdate(formData, mockFilterClient, mockDatasetClient)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that a user has listed Sundays of a daily series, then the Sundays within the years are selected", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(filter.Model{
+			Links: filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1"}},
+		}, testETag(1), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde", "2017", "1", "time", batchSize, maxWorkers).
+			Return(dataset.Options{Items: []dataset.Option{
+				{Label: "2020-12-27", Option: "2020-12-27"}, {Label: "2021-01-03", Option: "2021-01-03"}, {Label: "2021-01-04", Option: "2021-01-04"},
+			}}, nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{"2021-01-03"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "time-format=2006-01-02&time-selection=list&months=Sunday&start-year-grouped=2021&end-year-grouped=2021&save-and-return=Save+and+return"
+		w := callTimeUpdate(formData, mockFilterClient, mockDatasetClient)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that a user has picked a date of a weekly series, then the week containing it is selected", t, func() {
+		mockClient := NewMockFilterClient(mockCtrl)
+		mockClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{"2020-W53"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+		formData := "time-format=2006-W01&time-selection=single&date-single=2021-01-02&save-and-return=Save+and+return"
+		w := callTimeUpdate(formData, mockClient, nil)
+		So(w.Code, ShouldEqual, 302)
+	})
+
+	Convey("Given that a user has selected the latest months, then they are selected and the rule is recorded for new versions", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(filter.Model{
+			Links: filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1"}},
+		}, testETag(1), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde", "2017", "1", "time", batchSize, maxWorkers).
+			Return(dataset.Options{Items: []dataset.Option{
+				{Label: "Mar-00", Option: "Mar-00"}, {Label: "Jan-00", Option: "Jan-00"}, {Label: "Feb-00", Option: "Feb-00"},
+			}}, nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", []string{"Feb-00", "Mar-00"}, headers.IfMatchAnyETag).Return(testETag(2), nil)
+
+		req := httptest.NewRequest("POST", "/filters/dimensions/time/update", strings.NewReader("time-selection=relative&relative-count=2&relative-unit=month"))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+		f.RelativeTime = relative.NewMemory(100, time.Hour)
+		f.UpdateTime().ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, 302)
+
+		rule, ok, err := f.RelativeTime.Get(context.Background(), mockFilterID)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(rule, ShouldResemble, relative.Rule{Count: 2, Unit: dates.Month})
+	})
+
+	Convey("Given a range that ends before it starts, then the time page is rendered again with the error next to the end and the filter is not changed", t, func() {
+		filterModel := filter.Model{
+			FilterID: mockFilterID,
+			Links:    filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/abcde/editions/2017/versions/1"}},
+		}
+		var timeOptions []dataset.Option
+		for _, month := range []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"} {
+			for _, year := range []string{"00", "01"} {
+				timeOptions = append(timeOptions, dataset.Option{Label: month + "-" + year, Option: month + "-" + year})
+			}
+		}
+		allOptions := dataset.Options{Items: timeOptions, TotalCount: len(timeOptions)}
+
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+
+		mockFilterClient.EXPECT().SetDimensionValues(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, mockServiceAuthToken, "", mockCollectionID, mockFilterID).Return(filterModel, testETag(1), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockFilterID, "time", batchSize, maxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "Jan-00"}}}, testETag(1), nil)
+		mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde").Return(dataset.DatasetDetails{}, nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde", "2017", "1").Return(dataset.VersionDimensions{}, nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "abcde", "2017", "1", "time", batchSize, maxWorkers).Return(allOptions, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+
+		var page model.Time
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "time").Do(func(w io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.Time)
+			w.(http.ResponseWriter).WriteHeader(http.StatusOK)
+		})
+
+		formData := "time-selection=range&start-month=May&start-year=2001&end-month=March&end-year=2000&save-and-return=Save+and+return"
+		req := httptest.NewRequest("POST", "/filters/dimensions/time/update", strings.NewReader(formData))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+		f.UpdateTime().ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(page.Error.ErrorItems, ShouldHaveLength, 1)
+		So(page.Error.ErrorItems[0].URL, ShouldEqual, "#end-year")
+		So(page.Data.FieldErrors, ShouldContainKey, "end-year")
+		So(page.Data.CheckedRadio, ShouldEqual, "range")
+		So(page.Data.SelectedStartMonth, ShouldEqual, "May")
+		So(page.Data.SelectedEndYear, ShouldEqual, "2000")
+	})
+
+	Convey("Given that a user hasn't chosen how to select the times, then the selection is invalid", t, func() {
+		_, _, err := NewFilter(nil, nil, nil, nil, nil, nil, "/v1", cfg).timeSelection(context.Background(), mockUserAuthToken, mockCollectionID, mockFilterID, url.Values{})
+		fieldErr, ok := asFieldError(err)
+		So(ok, ShouldBeTrue)
+		So(fieldErr.field, ShouldEqual, "time-form")
+	})
+
+	Convey("Given a single month that wasn't chosen, then the error is for the month selector", t, func() {
+		_, err := singleTime(url.Values{"year-single": {"2019"}, "month-single": {"Select"}})
+		fieldErr, ok := asFieldError(err)
+		So(ok, ShouldBeTrue)
+		So(fieldErr.field, ShouldEqual, "month-single")
+		So(fieldErr.Code(), ShouldEqual, http.StatusBadRequest)
+	})
 }
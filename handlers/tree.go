@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// HierarchyTree returns the children of the hierarchy node with the code provided in the query, with their selection
+// state, for tree widgets to expand nodes in place. The top level of the hierarchy, flattened if there is a rule for
+// it, is returned when no code is provided.
+func (f *Filter) HierarchyTree() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		vars := mux.Vars(req)
+		filterID := vars["filterID"]
+		name := vars["name"]
+		code := req.URL.Query().Get("code")
+		ctx := req.Context()
+
+		fc, selected, err := f.consistentSelection(ctx, "hierarchy_tree", userAccessToken, collectionID, filterID, name, nil)
+		if err != nil {
+			log.Error(ctx, "failed to read filter selections", err, log.Data{"filter_id": filterID, "dimension": name})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		h, err := f.hierarchyNode(ctx, fc, name, code)
+		if err != nil {
+			log.Error(ctx, "failed to get hierarchy node", err, log.Data{"filter_id": filterID, "dimension": name, "code": code})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		tree := mapper.CreateHierarchyTree(h, selected, filterID, name)
+		tree.ETag = fc.ETag
+
+		b, err := json.Marshal(tree)
+		if err != nil {
+			log.Error(ctx, "failed to marshal json", err, log.Data{"filter_id": filterID, "dimension": name, "code": code})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		//nolint:errcheck // ignore error
+		w.Write(b)
+	})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHierarchyTree(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+	const instanceID = "instance1"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25, FilterRetryAttempts: 2}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	fil := filter.Model{
+		FilterID:   filterID,
+		InstanceID: instanceID,
+		Links:      filter.Links{Version: filter.Link{HRef: "http://localhost:23200/v1/datasets/cpih01/editions/time-series/versions/1"}},
+	}
+	selected := filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "E12000001"}, {Option: "E06000047"}}}
+
+	callTree := func(f *Filter, target string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/dimensions/{name}/tree.json").HandlerFunc(f.HierarchyTree())
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("Given a filter with options selected in a hierarchy", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(fil, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "admin-geography", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+			Return(selected, testETag(0), nil)
+
+		Convey("When the tree of a node is requested", func() {
+			mockHierarchyClient.EXPECT().GetChild(ctx, instanceID, "admin-geography", "E12000001").Return(hierarchy.Model{
+				Label:   "North East",
+				HasData: true,
+				Links:   hierarchy.Links{Code: hierarchy.Link{ID: "E12000001"}},
+				Children: []hierarchy.Child{
+					{Label: "County Durham", HasData: true, NumberofChildren: 63, Links: hierarchy.Links{Code: hierarchy.Link{ID: "E06000047"}}},
+					{Label: "Darlington", HasData: true, Links: hierarchy.Links{Code: hierarchy.Link{ID: "E06000005"}}},
+				},
+			}, nil)
+			w := callTree(f, "/filters/12345/dimensions/admin-geography/tree.json?code=E12000001")
+
+			Convey("Then its children are returned with their selection state and links to their own children", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+				var tree model.HierarchyTree
+				So(json.Unmarshal(w.Body.Bytes(), &tree), ShouldBeNil)
+				So(tree, ShouldResemble, model.HierarchyTree{
+					Code:     "E12000001",
+					Label:    "North East",
+					HasData:  true,
+					Selected: true,
+					Children: []model.TreeNode{
+						{
+							Code: "E06000047", Label: "County Durham", HasData: true, Selected: true, NumberOfChildren: 63,
+							URL: "/filters/12345/dimensions/admin-geography/tree.json?code=E06000047",
+						},
+						{Code: "E06000005", Label: "Darlington", HasData: true},
+					},
+					ETag: testETag(0),
+				})
+			})
+		})
+
+		Convey("When the tree is requested without a code", func() {
+			mockHierarchyClient.EXPECT().GetRoot(ctx, instanceID, "admin-geography").Return(hierarchy.Model{
+				Label:    "England",
+				Links:    hierarchy.Links{Code: hierarchy.Link{ID: "E92000001"}},
+				Children: []hierarchy.Child{{Label: "North East", HasData: true, NumberofChildren: 12, Links: hierarchy.Links{Code: hierarchy.Link{ID: "E12000001"}}}},
+			}, nil)
+			w := callTree(f, "/filters/12345/dimensions/admin-geography/tree.json")
+
+			Convey("Then the top level of the hierarchy is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusOK)
+				var tree model.HierarchyTree
+				So(json.Unmarshal(w.Body.Bytes(), &tree), ShouldBeNil)
+				So(tree.Code, ShouldEqual, "E92000001")
+				So(tree.Children, ShouldResemble, []model.TreeNode{{
+					Code: "E12000001", Label: "North East", HasData: true, Selected: true, NumberOfChildren: 12,
+					URL: "/filters/12345/dimensions/admin-geography/tree.json?code=E12000001",
+				}})
+			})
+		})
+
+		Convey("When the hierarchy node can't be obtained", func() {
+			mockHierarchyClient.EXPECT().GetChild(ctx, instanceID, "admin-geography", "unknown").Return(hierarchy.Model{}, errors.New("hierarchy error"))
+			w := callTree(f, "/filters/12345/dimensions/admin-geography/tree.json?code=unknown")
+
+			Convey("Then a 500 status code is returned", func() {
+				So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+	})
+
+	Convey("Given a filter that is modified while its selections are read", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockHierarchyClient := NewMockHierarchyClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, nil, mockHierarchyClient, nil, nil, "/v1", cfg)
+
+		gomock.InOrder(
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(fil, testETag(0), nil),
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "admin-geography", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+				Return(filter.DimensionOptions{}, testETag(1), nil),
+			mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(fil, testETag(1), nil),
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "admin-geography", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+				Return(selected, testETag(1), nil),
+		)
+		mockHierarchyClient.EXPECT().GetChild(ctx, instanceID, "admin-geography", "E12000001").Return(hierarchy.Model{}, nil)
+
+		Convey("Then the reads are retried and the tree is returned with the latest ETag", func() {
+			w := callTree(f, "/filters/12345/dimensions/admin-geography/tree.json?code=E12000001")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			var tree model.HierarchyTree
+			So(json.Unmarshal(w.Body.Bytes(), &tree), ShouldBeNil)
+			So(tree.ETag, ShouldEqual, testETag(1))
+		})
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/history"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+// undoReturnKey is the query parameter holding the page the user is sent back to once a change is undone
+const undoReturnKey = "return"
+
+// changeRecorder records the change made to the selected options of some dimensions of a filter in its undo history
+type changeRecorder struct {
+	f               *Filter
+	userAccessToken string
+	collectionID    string
+	filterID        string
+	names           []string
+	before          map[string][]string
+}
+
+// recordChange starts recording the change about to be made to the provided dimensions of a filter, by reading
+// their selected options. It returns nil if there is no undo history, or the options can't be read, so that
+// failing to record a change never prevents the user from making it.
+// Recording a change reads all the selected options of the dimensions before and after it, which can take
+// several batches for large dimensions, so changes whose result is known are committed with commitSelected.
+func (f *Filter) recordChange(ctx context.Context, userAccessToken, collectionID, filterID string, names ...string) *changeRecorder {
+	if f.History == nil {
+		return nil
+	}
+	before, err := f.selectedOptions(ctx, userAccessToken, collectionID, filterID, names)
+	if err != nil {
+		log.Warn(ctx, "failed to read selected options, the change won't be undoable", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID, "dimensions": names})
+		return nil
+	}
+	return &changeRecorder{
+		f:               f,
+		userAccessToken: userAccessToken,
+		collectionID:    collectionID,
+		filterID:        filterID,
+		names:           names,
+		before:          before,
+	}
+}
+
+// commit adds the change made since the recording started to the undo history of the filter
+func (r *changeRecorder) commit(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	after, err := r.f.selectedOptions(ctx, r.userAccessToken, r.collectionID, r.filterID, r.names)
+	if err != nil {
+		log.Warn(ctx, "failed to read selected options, the change won't be undoable", log.FormatErrors([]error{err}), log.Data{"filter_id": r.filterID, "dimensions": r.names})
+		return
+	}
+	r.commitSelected(ctx, after)
+}
+
+// commitSelected adds the change made since the recording started to the undo history of the filter, given the
+// options selected in the dimensions after it, such as all the options after adding all of them, or none after
+// removing all of them, without reading them again
+func (r *changeRecorder) commitSelected(ctx context.Context, after map[string][]string) {
+	if r == nil {
+		return
+	}
+
+	var change history.Change
+	for _, name := range r.names {
+		if diff := history.Diff(name, r.before[name], after[name]); len(diff.Added) > 0 || len(diff.Removed) > 0 {
+			change.Dimensions = append(change.Dimensions, diff)
+		}
+	}
+	if change.IsEmpty() {
+		return
+	}
+
+	if err := r.f.History.Push(ctx, r.filterID, change); err != nil {
+		log.Warn(ctx, "failed to record change in undo history", log.FormatErrors([]error{err}), log.Data{"filter_id": r.filterID})
+	}
+}
+
+// selectedOptions returns the options selected in the provided dimensions of a filter
+func (f *Filter) selectedOptions(ctx context.Context, userAccessToken, collectionID, filterID string, names []string) (map[string][]string, error) {
+	selected := make(map[string][]string, len(names))
+	for _, name := range names {
+		opts, _, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
+		if err != nil {
+			return nil, err
+		}
+		for i := range opts.Items {
+			selected[name] = append(selected[name], opts.Items[i].Option)
+		}
+	}
+	return selected, nil
+}
+
+// undoLink returns the link to undo the last change made to a filter, from the page at returnPath,
+// or an empty link if there is nothing to undo
+func (f *Filter) undoLink(ctx context.Context, filterID, eTag, returnPath string) model.Link {
+	if f.History == nil {
+		return model.Link{}
+	}
+	_, ok, err := f.History.Last(ctx, filterID)
+	if err != nil {
+		log.Warn(ctx, "failed to read undo history", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+		return model.Link{}
+	}
+	if !ok {
+		return model.Link{}
+	}
+
+	query := url.Values{undoReturnKey: []string{returnPath}}
+	if eTag != "" {
+		query.Set(formETagKey, eTag)
+	}
+	return model.Link{
+		URL:   fmt.Sprintf("/filters/%s/undo?%s", filterID, query.Encode()),
+		Label: "Undo last change",
+	}
+}
+
+// Undo reverts the last change made to a filter, by patching its dimensions with the inverse of the change
+func (f *Filter) Undo() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		filterID := mux.Vars(req)["filterID"]
+		ctx := req.Context()
+		redirectURL := undoReturnURL(req, filterID)
+
+		if f.History == nil {
+			http.Redirect(w, req, redirectURL, http.StatusFound)
+			return
+		}
+
+		change, ok, err := f.History.Last(ctx, filterID)
+		if err != nil {
+			log.Error(ctx, "failed to read undo history", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		if !ok {
+			http.Redirect(w, req, redirectURL, http.StatusFound)
+			return
+		}
+
+		eTag := submittedETag(req)
+		for _, d := range change.Inverse().Dimensions {
+			eTag, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, d.Name, d.Added, d.Removed, f.BatchSize, eTag)
+			if err != nil {
+				log.Error(ctx, "failed to undo change", err, log.Data{"filter_id": filterID, "dimension": d.Name})
+				f.setStatusCode(req, w, err)
+				return
+			}
+		}
+		forgetFilter(ctx, filterID)
+
+		if err := f.History.Pop(ctx, filterID); err != nil {
+			log.Warn(ctx, "failed to remove undone change from history", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+		}
+
+		http.Redirect(w, req, redirectURL, http.StatusFound)
+	})
+}
+
+// undoReturnURL returns the page of the filter the user is sent back to once a change is undone,
+// which defaults to the filter overview so that the user can't be redirected away from the filter
+func undoReturnURL(req *http.Request, filterID string) string {
+	overview := fmt.Sprintf("/filters/%s/dimensions", filterID)
+	returnPath := path.Clean(req.URL.Query().Get(undoReturnKey))
+	if returnPath == overview || strings.HasPrefix(returnPath, overview+"/") {
+		return returnPath
+	}
+	return overview
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/history"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUndo(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 100, BatchMaxWorkers: 25}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	serve := func(f *Filter, method, path, target string, h http.HandlerFunc, headers ...string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.Path(path).HandlerFunc(h)
+		req := httptest.NewRequest(method, target, http.NoBody)
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	change := history.Change{Dimensions: []history.DimensionChange{{Name: "sex", Added: []string{"all"}, Removed: []string{"male", "female"}}}}
+
+	Convey("Given a filter with a change in its undo history", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", cfg)
+		f.History = history.NewMemory(10, 100, time.Hour)
+		So(f.History.Push(context.Background(), filterID, change), ShouldBeNil)
+
+		Convey("When the change is undone, then its inverse is patched conditionally on the page ETag and the user is sent back to the page", func() {
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex",
+				[]string{"male", "female"}, []string{"all"}, cfg.BatchSizeLimit, testETag(0)).Return(testETag(1), nil)
+
+			w := serve(f, "GET", "/filters/{filterID}/undo", "/filters/12345/undo?etag=testETag0&return=%2Ffilters%2F12345%2Fdimensions%2Fsex", f.Undo())
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/12345/dimensions/sex")
+			_, ok, _ := f.History.Last(context.Background(), filterID)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("When the filter was modified since the page was loaded, then the change is kept in the history", func() {
+			mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex",
+				[]string{"male", "female"}, []string{"all"}, cfg.BatchSizeLimit, testETag(0)).
+				Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict})
+
+			w := serve(f, "GET", "/filters/{filterID}/undo", "/filters/12345/undo?etag=testETag0&format=json", f.Undo())
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+			last, ok, _ := f.History.Last(context.Background(), filterID)
+			So(ok, ShouldBeTrue)
+			So(last, ShouldResemble, change)
+		})
+
+		Convey("Then the undo link of its pages includes the page ETag and the page to return to", func() {
+			link := f.undoLink(context.Background(), filterID, testETag(0), "/filters/12345/dimensions")
+			So(link.URL, ShouldEqual, "/filters/12345/undo?etag=testETag0&return=%2Ffilters%2F12345%2Fdimensions")
+			So(link.Label, ShouldEqual, "Undo last change")
+		})
+	})
+
+	Convey("Given a filter without any change to undo", t, func() {
+		f := NewFilter(nil, NewMockFilterClient(mockCtrl), nil, nil, nil, nil, "/v1", cfg)
+		f.History = history.NewMemory(10, 100, time.Hour)
+
+		Convey("Then undo sends the user back to the filter overview", func() {
+			w := serve(f, "GET", "/filters/{filterID}/undo", "/filters/12345/undo", f.Undo())
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/12345/dimensions")
+		})
+
+		Convey("Then its pages don't have an undo link", func() {
+			So(f.undoLink(context.Background(), filterID, testETag(0), "/filters/12345/dimensions").URL, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an option removed from a dimension, then the change is recorded in the undo history", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", cfg)
+		f.History = history.NewMemory(10, 100, time.Hour)
+
+		gomock.InOrder(
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+				Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "male"}, {Option: "female"}}}, testETag(0), nil),
+			mockFilterClient.EXPECT().RemoveDimensionValue(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex", "male", testETag(0)).Return(testETag(1), nil),
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+				Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "female"}}}, testETag(1), nil),
+		)
+
+		w := serve(f, "GET", "/filters/{filterID}/dimensions/{name}/remove/{option}", "/filters/12345/dimensions/sex/remove/male?etag=testETag0", f.DimensionRemoveOne())
+
+		So(w.Code, ShouldEqual, http.StatusFound)
+		last, ok, err := f.History.Last(context.Background(), filterID)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(last, ShouldResemble, history.Change{Dimensions: []history.DimensionChange{{Name: "sex", Removed: []string{"male"}}}})
+	})
+
+	Convey("Given all the options removed from a dimension, then the change is recorded without reading the options again", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", cfg)
+		f.History = history.NewMemory(10, 100, time.Hour)
+
+		gomock.InOrder(
+			mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex", cfg.BatchSizeLimit, cfg.BatchMaxWorkers).
+				Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "male"}, {Option: "female"}}}, testETag(0), nil).Times(1),
+			mockFilterClient.EXPECT().RemoveDimension(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex", testETag(0)).Return(testETag(1), nil),
+			mockFilterClient.EXPECT().AddDimension(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "sex", testETag(1)).Return(testETag(2), nil),
+		)
+
+		w := serve(f, "GET", "/filters/{filterID}/dimensions/{name}/remove-all", "/filters/12345/dimensions/sex/remove-all?etag=testETag0", f.DimensionRemoveAll())
+
+		So(w.Code, ShouldEqual, http.StatusFound)
+		last, ok, err := f.History.Last(context.Background(), filterID)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(last, ShouldResemble, history.Change{Dimensions: []history.DimensionChange{{Name: "sex", Removed: []string{"male", "female"}}}})
+	})
+}
+
+func TestUndoReturnURL(t *testing.T) {
+	Convey("undoReturnURL only sends the user back to a page of the filter", t, func() {
+		returnURL := func(target string) string {
+			return undoReturnURL(httptest.NewRequest("GET", target, http.NoBody), "12345")
+		}
+		So(returnURL("/filters/12345/undo?return=/filters/12345/dimensions/age"), ShouldEqual, "/filters/12345/dimensions/age")
+		So(returnURL("/filters/12345/undo?return=/filters/12345/dimensions"), ShouldEqual, "/filters/12345/dimensions")
+		So(returnURL("/filters/12345/undo?return=//evil.example.com/filters/12345/dimensions"), ShouldEqual, "/filters/12345/dimensions")
+		So(returnURL("/filters/12345/undo?return=/filters/12345/dimensions/../../67890/dimensions"), ShouldEqual, "/filters/12345/dimensions")
+		So(returnURL("/filters/12345/undo"), ShouldEqual, "/filters/12345/dimensions")
+	})
+}
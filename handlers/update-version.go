@@ -4,17 +4,21 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strings"
 
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	dphandlers "github.com/ONSdigital/dp-net/v3/handlers"
 
-	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/gorilla/mux"
 )
 
+// errMissingVersion is returned when a filter is copied without providing the target version
+var errMissingVersion = formError{"no target version provided"}
+
 // UseLatest will create a new filter job for the same dataset with the
 // latest version in that edition
 func (f *Filter) UseLatest() http.HandlerFunc {
@@ -23,84 +27,289 @@ func (f *Filter) UseLatest() http.HandlerFunc {
 		filterID := vars["filterID"]
 		ctx := req.Context()
 
-		oldJob, _, err := f.FilterClient.GetJobState(req.Context(), userAccessToken, "", "", collectionID, filterID)
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to get job state", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
+		datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
 
-		dims, _, err := f.FilterClient.GetDimensions(req.Context(), userAccessToken, "", collectionID, filterID, nil)
+		editionDetails, err := f.DatasetClient.GetEdition(req.Context(), userAccessToken, "", collectionID, datasetID, edition)
 		if err != nil {
-			log.Error(ctx, "failed to get dimensions", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to get edition details", err, log.Data{"dataset": datasetID, "edition": edition})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		f.copyFilter(w, req, lang, userAccessToken, collectionID, filterID, datasetID, edition, version, edition, editionDetails.Links.LatestVersion.ID)
+	})
+}
+
+// UseVersion will create a new filter job for the same dataset with the edition and
+// version provided in the form or query, copying the options selected in the current filter
+func (f *Filter) UseVersion() http.HandlerFunc {
+	return dphandlers.ControllerHandler(func(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+		vars := mux.Vars(req)
+		filterID := vars["filterID"]
+		ctx := req.Context()
+
+		if err := req.ParseForm(); err != nil {
+			log.Error(ctx, "failed to parse form", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
-		versionURL, err := url.Parse(oldJob.Links.Version.HRef)
-		if err != nil || versionURL.Path == "" {
-			log.Error(ctx, "failed to parse version href", err, log.Data{"filter_id": filterID})
-			setStatusCode(req, w, err)
+		targetEdition := req.Form.Get("edition")
+		targetVersion := req.Form.Get("version")
+		if targetVersion == "" {
+			err := errMissingVersion
+			log.Error(ctx, "no target version provided", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
-		versionPath := strings.TrimPrefix(versionURL.Path, f.APIRouterVersion)
 
-		datasetID, edition, _, err := helpers.ExtractDatasetInfoFromPath(ctx, versionPath)
+		fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
 		if err != nil {
-			log.Error(ctx, "failed to extract dataset info from path", err, log.Data{"filter_id": filterID, "path": versionPath})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+			f.setStatusCode(req, w, err)
 			return
 		}
+		datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
 
-		editionDetails, err := f.DatasetClient.GetEdition(req.Context(), userAccessToken, "", collectionID, datasetID, edition)
+		if targetEdition == "" {
+			targetEdition = edition
+		}
+
+		// make sure that the target version exists before creating the new blueprint
+		if _, err = f.DatasetClient.GetVersion(ctx, userAccessToken, "", "", collectionID, datasetID, targetEdition, targetVersion); err != nil {
+			log.Error(ctx, "failed to get version", err, log.Data{"dataset_id": datasetID, "edition": targetEdition, "version": targetVersion})
+			f.setStatusCode(req, w, err)
+			return
+		}
+
+		f.copyFilter(w, req, lang, userAccessToken, collectionID, filterID, datasetID, edition, version, targetEdition, targetVersion)
+	})
+}
+
+// copyFilter creates a new filter blueprint for the provided dataset version and copies all the dimensions and
+// selected options from the existing filter that are still valid in that version. If any selected option is dropped,
+// or new options are available, a page listing them is rendered; otherwise it redirects to the overview of the new filter
+//
+//nolint:gocyclo // cyclomatic complexity 16
+func (f *Filter) copyFilter(w http.ResponseWriter, req *http.Request, lang, userAccessToken, collectionID, filterID, datasetID, oldEdition, oldVersion, edition, version string) {
+	ctx := req.Context()
+
+	dims, _, err := f.FilterClient.GetDimensions(ctx, userAccessToken, "", collectionID, filterID, nil)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	newDims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get version dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	newDimLabels := make(map[string]string, len(newDims.Items))
+	for i := range newDims.Items {
+		newDimLabels[newDims.Items[i].Name] = newDims.Items[i].Label
+	}
+
+	newFilterID, newFilterETag, err := f.FilterClient.CreateBlueprint(ctx, userAccessToken, "", "", collectionID, datasetID, edition, version, []string{})
+	if err != nil {
+		log.Error(ctx, "failed to create filter blueprint", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	var changes []model.DimensionChanges
+	for i := range dims.Items {
+		name := dims.Items[i].Name
+
+		oldOpts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, oldEdition, oldVersion, name, f.BatchSize, f.BatchMaxWorkers)
 		if err != nil {
-			log.Error(ctx, "failed to get edition details", err, log.Data{"dataset": datasetID, "edition": edition})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": oldEdition, "version": oldVersion})
+			f.setStatusCode(req, w, err)
+			return
+		}
+		oldLabels := optionLabels(oldOpts)
+
+		dimLabel, ok := newDimLabels[name]
+		if !ok {
+			// the dimension does not exist in the new version, so none of its selected options can be copied
+			var dropped []string
+			processBatch := func(batch filter.DimensionOptions, _ string) (forceAbort bool, err error) {
+				for _, opt := range batch.Items {
+					dropped = append(dropped, labelOrCode(oldLabels, opt.Option))
+				}
+				return false, nil
+			}
+			if _, err = f.FilterClient.GetDimensionOptionsBatchProcess(ctx, userAccessToken, "", collectionID, filterID, name, processBatch, f.BatchSize, f.BatchMaxWorkers, true); err != nil {
+				log.Error(ctx, "failed to get and process options from filter client in batches", err, log.Data{"filter_id": filterID, "dimension": name})
+				f.setStatusCode(req, w, err)
+				return
+			}
+			if len(dropped) > 0 {
+				changes = append(changes, model.DimensionChanges{Name: name, Dropped: dropped})
+			}
+			continue
+		}
+
+		newOpts, err := f.DatasetClient.GetOptionsInBatches(ctx, userAccessToken, "", collectionID, datasetID, edition, version, name, f.BatchSize, f.BatchMaxWorkers)
+		if err != nil {
+			log.Error(ctx, "failed to get options from dataset client", err, log.Data{"dimension": name, "dataset_id": datasetID, "edition": edition, "version": version})
+			f.setStatusCode(req, w, err)
 			return
 		}
+		newLabels := optionLabels(newOpts)
 
-		newFilterID, newFilterETag, err := f.FilterClient.CreateBlueprint(req.Context(), userAccessToken, "", "", collectionID, datasetID, edition, editionDetails.Links.LatestVersion.ID, []string{})
+		// Copy dimension to new filter
+		newFilterETag, err = f.FilterClient.AddDimension(ctx, userAccessToken, "", collectionID, newFilterID, name, newFilterETag)
 		if err != nil {
-			log.Error(ctx, "failed to create filter blueprint", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": editionDetails.Links.LatestVersion.ID})
-			setStatusCode(req, w, err)
+			log.Error(ctx, "failed to add dimension", err, log.Data{"filter_id": filterID, "dimension": name})
+			f.setStatusCode(req, w, err)
 			return
 		}
 
-		for i := range dims.Items {
-			// Copy dimension to new filter
-			newFilterETag, err = f.FilterClient.AddDimension(req.Context(), userAccessToken, "", collectionID, newFilterID, dims.Items[i].Name, newFilterETag)
+		var dropped []string
+		if rule, codes, ok := f.relativeTimeCodes(ctx, userAccessToken, collectionID, filterID, name, oldOpts, newOpts); ok {
+			// the latest periods of the new version are selected instead of the ones selected in the old version
+			newFilterETag, err = f.FilterClient.SetDimensionValues(ctx, userAccessToken, "", collectionID, newFilterID, name, codes, newFilterETag)
 			if err != nil {
-				log.Error(ctx, "failed to add dimension", err, log.Data{"filter_id": filterID, "dimension": dims.Items[i].Name})
-				setStatusCode(req, w, err)
+				log.Error(ctx, "failed to set dimension values", err, log.Data{"filter_id": newFilterID, "dimension": name})
+				f.setStatusCode(req, w, err)
 				return
 			}
-
-			// Copy each batch of options to the new filter dimension via PATCH operations.
-			processBatch := f.batchAddOptions(req.Context(), userAccessToken, collectionID, newFilterID, dims.Items[i].Name, newFilterETag)
+			f.setRelativeTime(ctx, newFilterID, rule)
+		} else {
+			// Copy each batch of valid options to the new filter dimension via PATCH operations.
+			processBatch := f.batchAddOptions(ctx, userAccessToken, collectionID, newFilterID, name, newFilterETag, newLabels, &dropped)
 
 			// Call filter API GetOptions in batches and aggregate the responses
-			newFilterETag, err = f.FilterClient.GetDimensionOptionsBatchProcess(req.Context(), userAccessToken, "", collectionID, filterID, dims.Items[i].Name, processBatch, f.BatchSize, f.BatchMaxWorkers, true)
+			newFilterETag, err = f.FilterClient.GetDimensionOptionsBatchProcess(ctx, userAccessToken, "", collectionID, filterID, name, processBatch, f.BatchSize, f.BatchMaxWorkers, true)
 			if err != nil {
-				log.Error(ctx, "failed to get and process options from filter client in batches", err, log.Data{"filter_id": filterID, "dimension": dims.Items[i].Name})
-				setStatusCode(req, w, err)
+				log.Error(ctx, "failed to get and process options from filter client in batches", err, log.Data{"filter_id": filterID, "dimension": name})
+				f.setStatusCode(req, w, err)
 				return
 			}
 		}
 
+		dimChanges := model.DimensionChanges{Name: name, Label: dimLabel}
+		for _, opt := range dropped {
+			dimChanges.Dropped = append(dimChanges.Dropped, labelOrCode(oldLabels, opt))
+		}
+		for j := range newOpts.Items {
+			if _, ok := oldLabels[newOpts.Items[j].Option]; !ok {
+				dimChanges.Added = append(dimChanges.Added, labelOrCode(newLabels, newOpts.Items[j].Option))
+			}
+		}
+		if len(dimChanges.Dropped) > 0 || len(dimChanges.Added) > 0 {
+			changes = append(changes, dimChanges)
+		}
+	}
+
+	if len(changes) == 0 {
 		redirectURL := fmt.Sprintf("/filters/%s/dimensions", newFilterID)
 		http.Redirect(w, req, redirectURL, http.StatusFound)
-	})
+		return
+	}
+
+	log.Info(ctx, "filter options changed when copying filter to another version", log.Data{"filter_id": filterID, "new_filter_id": newFilterID, "dimensions_changed": len(changes)})
+
+	datasetDetails, err := f.DatasetClient.Get(ctx, userAccessToken, "", collectionID, datasetID)
+	if err != nil {
+		log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
+
+	bp := f.RenderClient.NewBasePageModel()
+	p := mapper.CreateVersionChangesPage(req, bp, datasetDetails, changes, newFilterID, datasetID, edition, version, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+	f.buildPage(w, req, p, "version-changes")
+}
+
+// relativeTimeCodes returns the options of the new version selected by the relative time rule of the filter, if the
+// dimension is time and the options selected in the filter are still the ones the rule selects in the old version
+func (f *Filter) relativeTimeCodes(ctx context.Context, userAccessToken, collectionID, filterID, name string, oldOpts, newOpts dataset.Options) (relative.Rule, []string, bool) {
+	if name != strTime {
+		return relative.Rule{}, nil, false
+	}
+	rule, ok := f.relativeTime(ctx, filterID)
+	if !ok {
+		return relative.Rule{}, nil, false
+	}
+
+	oldTimes, err := detectTimeOptions(oldOpts)
+	if err != nil {
+		log.Warn(ctx, "unable to parse time options of the old version", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+		return relative.Rule{}, nil, false
+	}
+	newTimes, err := detectTimeOptions(newOpts)
+	if err != nil {
+		log.Warn(ctx, "unable to parse time options of the new version", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+		return relative.Rule{}, nil, false
+	}
+
+	selected, _, err := f.FilterClient.GetDimensionOptionsInBatches(ctx, userAccessToken, "", collectionID, filterID, name, f.BatchSize, f.BatchMaxWorkers)
+	if err != nil {
+		log.Warn(ctx, "failed to get selected time options", log.FormatErrors([]error{err}), log.Data{"filter_id": filterID})
+		return relative.Rule{}, nil, false
+	}
+	codes := make([]string, 0, len(selected.Items))
+	for _, opt := range selected.Items {
+		codes = append(codes, opt.Option)
+	}
+	if !rule.Matches(oldTimes, codes) {
+		log.Info(ctx, "time options were changed since the relative time rule was chosen, copying them instead", log.Data{"filter_id": filterID})
+		return relative.Rule{}, nil, false
+	}
+
+	resolved := rule.Resolve(newTimes)
+	return rule, resolved, len(resolved) > 0
 }
 
 // batchAddOptions generates a batch processor to add the dimension options for each provided batch to filter API, by calling the patch endpoint.
-func (f *Filter) batchAddOptions(ctx context.Context, userAccessToken, collectionID, filterID, dimensionName, initialETag string) filter.DimensionOptionsBatchProcessor {
+// Options that are not in validOptions are not added, and are appended to dropped instead.
+func (f *Filter) batchAddOptions(ctx context.Context, userAccessToken, collectionID, filterID, dimensionName, initialETag string, validOptions map[string]string, dropped *[]string) filter.DimensionOptionsBatchProcessor {
 	currentETag := initialETag
 	return func(batch filter.DimensionOptions, oldFilterETag string) (forceAbort bool, err error) {
 		var vals []string
 		for _, val := range batch.Items {
+			if _, ok := validOptions[val.Option]; !ok {
+				*dropped = append(*dropped, val.Option)
+				continue
+			}
 			vals = append(vals, val.Option)
 		}
+		if len(vals) == 0 {
+			return false, nil
+		}
 		currentETag, err = f.FilterClient.PatchDimensionValues(ctx, userAccessToken, "", collectionID, filterID, dimensionName, vals, []string{}, f.BatchSize, currentETag)
 		return false, err
 	}
 }
+
+// optionLabels returns a lookup of the labels of the provided dataset options, keyed by option code
+func optionLabels(opts dataset.Options) map[string]string {
+	labels := make(map[string]string, len(opts.Items))
+	for i := range opts.Items {
+		labels[opts.Items[i].Option] = opts.Items[i].Label
+	}
+	return labels
+}
+
+// labelOrCode returns the label for the provided option code, or the code itself if it has no label
+func labelOrCode(labels map[string]string, code string) string {
+	if label := labels[code]; label != "" {
+		return label
+	}
+	return code
+}
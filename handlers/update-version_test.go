@@ -2,13 +2,21 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	. "github.com/smartystreets/goconvey/convey"
@@ -55,6 +63,8 @@ func TestUseLatest(t *testing.T) {
 					Items: []filter.Dimension{{Name: "Day"}},
 				}, testETag(0), nil)
 		mockDatasetClient.EXPECT().GetEdition(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016").Return(dataset.Edition{Links: mockEditionLinks}, nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016", "2").Return(dataset.VersionDimensions{Items: dataset.VersionDimensionItems{{Name: "Day"}}}, nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016", gomock.Any(), "Day", batchSize, maxWorkers).Return(dataset.Options{Items: []dataset.Option{{Option: "monday", Label: "Monday"}}}, nil).Times(2)
 		mockFilterClient.EXPECT().CreateBlueprint(ctx, mockUserAuthToken, mockServiceAuthToken, mockDownloadToken, mockCollectionID, "95c4669b-3ae9-4ba7-b690-87e890a1c67c", "2016", "2", []string{}).Return(mockNewFilterID, testETag(1), nil)
 		mockFilterClient.EXPECT().AddDimension(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockNewFilterID, "Day", testETag(1)).Return(testETag(2), nil)
 		mockFilterClient.EXPECT().GetDimensionOptionsBatchProcess(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, filterID, "Day", gomock.Any(), batchSize, maxWorkers, true).Return(testETag(0), nil)
@@ -91,9 +101,242 @@ func TestUseLatest(t *testing.T) {
 		mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockNewFilterID, "Day", []string{mockDimensionOptionsBatch.Items[0].Option}, []string{}, batchSize, testETag(0)).Return(testETag(1), nil)
 		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", cfg)
 
-		batchProcessor := f.batchAddOptions(context.Background(), mockUserAuthToken, mockCollectionID, mockNewFilterID, "Day", testETag(0))
+		var dropped []string
+		batchProcessor := f.batchAddOptions(context.Background(), mockUserAuthToken, mockCollectionID, mockNewFilterID, "Day", testETag(0), map[string]string{"monday": "Monday"}, &dropped)
 		forceAbort, err := batchProcessor(mockDimensionOptionsBatch, testETag(0))
 		So(err, ShouldBeNil)
 		So(forceAbort, ShouldBeFalse)
+		So(dropped, ShouldBeEmpty)
+	})
+
+	Convey("The batch processor function only patches the options that are valid in the new version", t, func() {
+		mockDimensionOptionsBatch := filter.DimensionOptions{
+			Items: []filter.DimensionOption{
+				{Option: "monday"},
+				{Option: "funday"},
+				{Option: "tuesday"},
+			},
+		}
+
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, mockServiceAuthToken, mockCollectionID, mockNewFilterID, "Day", []string{"monday", "tuesday"}, []string{}, batchSize, testETag(0)).Return(testETag(1), nil)
+		f := NewFilter(nil, mockFilterClient, nil, nil, nil, nil, "/v1", cfg)
+
+		var dropped []string
+		batchProcessor := f.batchAddOptions(context.Background(), mockUserAuthToken, mockCollectionID, mockNewFilterID, "Day", testETag(0), map[string]string{"monday": "Monday", "tuesday": "Tuesday"}, &dropped)
+		forceAbort, err := batchProcessor(mockDimensionOptionsBatch, testETag(0))
+		So(err, ShouldBeNil)
+		So(forceAbort, ShouldBeFalse)
+		So(dropped, ShouldResemble, []string{"funday"})
+	})
+
+	Convey("Test UseLatest renders the changed options when selected options are not in the latest version", t, func() {
+		datasetID := "95c4669b-3ae9-4ba7-b690-87e890a1c67c"
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, "", "", "", "", filterID).Return(
+			filter.Model{Links: filter.Links{Version: filter.Link{HRef: "/v1/datasets/" + datasetID + "/editions/2016/versions/1"}}}, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetEdition(ctx, "", "", "", datasetID, "2016").Return(dataset.Edition{Links: dataset.Links{LatestVersion: dataset.Link{ID: "2"}}}, nil)
+		mockFilterClient.EXPECT().GetDimensions(ctx, "", "", "", filterID, nil).Return(filter.Dimensions{Items: []filter.Dimension{{Name: "Day"}, {Name: "Sex"}}}, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, "", "", "", datasetID, "2016", "2").Return(dataset.VersionDimensions{Items: dataset.VersionDimensionItems{{Name: "Day", Label: "Day of week"}}}, nil)
+		mockFilterClient.EXPECT().CreateBlueprint(ctx, "", "", "", "", datasetID, "2016", "2", []string{}).Return(mockNewFilterID, testETag(1), nil)
+
+		// Day exists in both versions, but funday was removed and wednesday added in the latest one
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, "", "", "", datasetID, "2016", "1", "Day", batchSize, maxWorkers).Return(dataset.Options{Items: []dataset.Option{
+			{Option: "monday", Label: "Monday"}, {Option: "funday", Label: "Funday"},
+		}}, nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, "", "", "", datasetID, "2016", "2", "Day", batchSize, maxWorkers).Return(dataset.Options{Items: []dataset.Option{
+			{Option: "monday", Label: "Monday"}, {Option: "wednesday", Label: "Wednesday"},
+		}}, nil)
+		mockFilterClient.EXPECT().AddDimension(ctx, "", "", "", mockNewFilterID, "Day", testETag(1)).Return(testETag(2), nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsBatchProcess(ctx, "", "", "", filterID, "Day", gomock.Any(), batchSize, maxWorkers, true).DoAndReturn(
+			func(_ context.Context, _, _, _, _, _ string, processBatch filter.DimensionOptionsBatchProcessor, _, _ int, _ bool) (string, error) {
+				_, err := processBatch(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "monday"}, {Option: "funday"}}}, testETag(0))
+				return testETag(0), err
+			})
+		mockFilterClient.EXPECT().PatchDimensionValues(ctx, "", "", "", mockNewFilterID, "Day", []string{"monday"}, []string{}, batchSize, testETag(2)).Return(testETag(3), nil)
+
+		// Sex does not exist in the latest version, so all its selected options are dropped
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, "", "", "", datasetID, "2016", "1", "Sex", batchSize, maxWorkers).Return(dataset.Options{Items: []dataset.Option{
+			{Option: "male", Label: "Male"},
+		}}, nil)
+		mockFilterClient.EXPECT().GetDimensionOptionsBatchProcess(ctx, "", "", "", filterID, "Sex", gomock.Any(), batchSize, maxWorkers, true).DoAndReturn(
+			func(_ context.Context, _, _, _, _, _ string, processBatch filter.DimensionOptionsBatchProcessor, _, _ int, _ bool) (string, error) {
+				_, err := processBatch(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "male"}}}, testETag(0))
+				return testETag(0), err
+			})
+
+		mockDatasetClient.EXPECT().Get(ctx, "", "", "", datasetID).Return(dataset.DatasetDetails{ID: datasetID, Title: "Dataset"}, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, "", "", "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+
+		var page model.VersionChanges
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "version-changes").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.VersionChanges)
+		})
+
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/use-latest-version").HandlerFunc(f.UseLatest())
+		req := httptest.NewRequest("GET", "/filters/current-filter-id/use-latest-version", http.NoBody)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(page.Data.Continue.URL, ShouldEqual, "/filters/new-filter-id/dimensions")
+		So(page.Data.Dimensions, ShouldResemble, []model.DimensionChanges{
+			{Name: "Day", Label: "Day of week", Dropped: []string{"Funday"}, Added: []string{"Wednesday"}},
+			{Name: "Sex", Label: "Sex", Dropped: []string{"Male"}},
+		})
+	})
+
+	Convey("Test UseLatest selects the latest periods of the new version when the filter has a relative time rule", t, func() {
+		datasetID := "cpih01"
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, "", "", "", "", filterID).Return(
+			filter.Model{Links: filter.Links{Version: filter.Link{HRef: "/v1/datasets/" + datasetID + "/editions/time-series/versions/1"}}}, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetEdition(ctx, "", "", "", datasetID, "time-series").Return(dataset.Edition{Links: dataset.Links{LatestVersion: dataset.Link{ID: "2"}}}, nil)
+		mockFilterClient.EXPECT().GetDimensions(ctx, "", "", "", filterID, nil).Return(filter.Dimensions{Items: []filter.Dimension{{Name: "time"}}}, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, "", "", "", datasetID, "time-series", "2").Return(dataset.VersionDimensions{Items: dataset.VersionDimensionItems{{Name: "time", Label: "Time"}}}, nil)
+		mockFilterClient.EXPECT().CreateBlueprint(ctx, "", "", "", "", datasetID, "time-series", "2", []string{}).Return(mockNewFilterID, testETag(1), nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, "", "", "", datasetID, "time-series", "1", "time", batchSize, maxWorkers).Return(dataset.Options{Items: []dataset.Option{
+			{Option: "Jan-20", Label: "Jan-20"}, {Option: "Feb-20", Label: "Feb-20"}, {Option: "Mar-20", Label: "Mar-20"},
+		}}, nil)
+		mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, "", "", "", datasetID, "time-series", "2", "time", batchSize, maxWorkers).Return(dataset.Options{Items: []dataset.Option{
+			{Option: "Jan-20", Label: "Jan-20"}, {Option: "Feb-20", Label: "Feb-20"}, {Option: "Mar-20", Label: "Mar-20"}, {Option: "Apr-20", Label: "Apr-20"},
+		}}, nil)
+		mockFilterClient.EXPECT().AddDimension(ctx, "", "", "", mockNewFilterID, "time", testETag(1)).Return(testETag(2), nil)
+
+		// the latest 2 months were selected in the old version, so the latest 2 months of the new one are selected
+		mockFilterClient.EXPECT().GetDimensionOptionsInBatches(ctx, "", "", "", filterID, "time", batchSize, maxWorkers).
+			Return(filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "Feb-20"}, {Option: "Mar-20"}}}, testETag(0), nil)
+		mockFilterClient.EXPECT().SetDimensionValues(ctx, "", "", "", mockNewFilterID, "time", []string{"Mar-20", "Apr-20"}, testETag(2)).Return(testETag(3), nil)
+
+		mockDatasetClient.EXPECT().Get(ctx, "", "", "", datasetID).Return(dataset.DatasetDetails{ID: datasetID, Title: "CPIH"}, nil)
+		mockZebedeeClient.EXPECT().GetHomepageContent(ctx, "", "", "en", "/").Return(zebedee.HomepageContent{}, nil)
+		mockRend.EXPECT().NewBasePageModel().Return(core.NewPage(cfg.PatternLibraryAssetsPath, cfg.SiteDomain))
+		var page model.VersionChanges
+		mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "version-changes").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+			page = pageModel.(model.VersionChanges)
+		})
+
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+		f.RelativeTime = relative.NewMemory(100, time.Hour)
+		rule := relative.Rule{Count: 2, Unit: dates.Month}
+		So(f.RelativeTime.Set(context.Background(), filterID, rule), ShouldBeNil)
+
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/use-latest-version").HandlerFunc(f.UseLatest())
+		req := httptest.NewRequest("GET", "/filters/current-filter-id/use-latest-version", http.NoBody)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(page.Data.Dimensions, ShouldResemble, []model.DimensionChanges{{Name: "time", Label: "Time", Added: []string{"Apr-20"}}})
+
+		newRule, ok, err := f.RelativeTime.Get(context.Background(), mockNewFilterID)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(newRule, ShouldResemble, rule)
+	})
+}
+
+func TestUseVersion(t *testing.T) {
+	ctx := gomock.Any()
+	filterID := "current-filter-id"
+	mockNewFilterID := "new-filter-id"
+	datasetID := "95c4669b-3ae9-4ba7-b690-87e890a1c67c"
+	batchSize := 100
+	maxWorkers := 25
+
+	cfg := &config.Config{
+		BatchSizeLimit:  batchSize,
+		BatchMaxWorkers: maxWorkers,
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	callUseVersion := func(target string, mockFilterClient *MockFilterClient, mockDatasetClient *MockDatasetClient) *httptest.ResponseRecorder {
+		f := NewFilter(nil, mockFilterClient, mockDatasetClient, nil, nil, nil, "/v1", cfg)
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/use-version").HandlerFunc(f.UseVersion())
+		req := httptest.NewRequest("GET", target, http.NoBody)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	currentFilter := filter.Model{Links: filter.Links{Version: filter.Link{HRef: "/v1/datasets/" + datasetID + "/editions/2016/versions/3"}}}
+
+	Convey("Given a filter for version 3 of a dataset edition", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, "", "", "", "", filterID).Return(currentFilter, testETag(0), nil)
+
+		Convey("When UseVersion is called with only a version, then a new filter is created for that version in the same edition", func() {
+			mockDatasetClient.EXPECT().GetVersion(ctx, "", "", "", "", datasetID, "2016", "1").Return(dataset.Version{}, nil)
+			mockFilterClient.EXPECT().GetDimensions(ctx, "", "", "", filterID, nil).Return(filter.Dimensions{Items: []filter.Dimension{{Name: "Day"}}}, testETag(0), nil)
+			mockDatasetClient.EXPECT().GetVersionDimensions(ctx, "", "", "", datasetID, "2016", "1").Return(dataset.VersionDimensions{Items: dataset.VersionDimensionItems{{Name: "Day"}}}, nil)
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, "", "", "", datasetID, "2016", gomock.Any(), "Day", batchSize, maxWorkers).Return(dataset.Options{}, nil).Times(2)
+			mockFilterClient.EXPECT().CreateBlueprint(ctx, "", "", "", "", datasetID, "2016", "1", []string{}).Return(mockNewFilterID, testETag(1), nil)
+			mockFilterClient.EXPECT().AddDimension(ctx, "", "", "", mockNewFilterID, "Day", testETag(1)).Return(testETag(2), nil)
+			mockFilterClient.EXPECT().GetDimensionOptionsBatchProcess(ctx, "", "", "", filterID, "Day", gomock.Any(), batchSize, maxWorkers, true).Return(testETag(0), nil)
+
+			w := callUseVersion("/filters/current-filter-id/use-version?version=1", mockFilterClient, mockDatasetClient)
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/new-filter-id/dimensions")
+		})
+
+		Convey("When UseVersion is called with an edition and version, then a new filter is created for that edition and version", func() {
+			mockDatasetClient.EXPECT().GetVersion(ctx, "", "", "", "", datasetID, "2017", "2").Return(dataset.Version{}, nil)
+			mockFilterClient.EXPECT().GetDimensions(ctx, "", "", "", filterID, nil).Return(filter.Dimensions{}, testETag(0), nil)
+			mockDatasetClient.EXPECT().GetVersionDimensions(ctx, "", "", "", datasetID, "2017", "2").Return(dataset.VersionDimensions{}, nil)
+			mockFilterClient.EXPECT().CreateBlueprint(ctx, "", "", "", "", datasetID, "2017", "2", []string{}).Return(mockNewFilterID, testETag(1), nil)
+
+			w := callUseVersion("/filters/current-filter-id/use-version?edition=2017&version=2", mockFilterClient, mockDatasetClient)
+
+			So(w.Code, ShouldEqual, http.StatusFound)
+			So(w.Header().Get("Location"), ShouldEqual, "/filters/new-filter-id/dimensions")
+		})
+
+		Convey("When UseVersion is called for a version that does not exist, then no blueprint is created and the dataset API status is returned", func() {
+			mockDatasetClient.EXPECT().GetVersion(ctx, "", "", "", "", datasetID, "2016", "9").Return(dataset.Version{}, dataset.NewDatasetAPIResponse(&http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, "/datasets"))
+
+			w := callUseVersion("/filters/current-filter-id/use-version?version=9", mockFilterClient, mockDatasetClient)
+
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Convey("When UseVersion is called without a version, then a bad request status is returned", t, func() {
+		f := NewFilter(nil, NewMockFilterClient(mockCtrl), NewMockDatasetClient(mockCtrl), nil, nil, nil, "/v1", cfg)
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/use-version").HandlerFunc(f.UseVersion())
+		req := httptest.NewRequest("GET", "/filters/current-filter-id/use-version", http.NoBody)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Header().Get("Content-Type"), ShouldEqual, problemContentType)
+		So(w.Body.String(), ShouldContainSubstring, `"detail":"no target version provided"`)
+	})
+
+	Convey("When the filter job can't be obtained, then UseVersion fails with the filter API error", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockFilterClient.EXPECT().GetJobState(ctx, "", "", "", "", filterID).Return(filter.Model{}, "", errors.New("filter api failed"))
+
+		w := callUseVersion("/filters/current-filter-id/use-version?version=1", mockFilterClient, NewMockDatasetClient(mockCtrl))
+
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
 	})
 }
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/headers"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/mapper"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/log.go/v2/log"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// uploadFileKey is the name of the file input the CSV file of options is uploaded with
+	uploadFileKey = "options-file"
+
+	// maxRejectedRows is the number of rejected rows listed on the upload summary page, so that the
+	// summary of a large file made of invalid rows stays small. Further rejected rows are only counted.
+	maxRejectedRows = 100
+)
+
+var (
+	// errNoUploadFile is returned when a multipart form is submitted without a CSV file of options
+	errNoUploadFile = formError{"no file uploaded"}
+	// errInvalidCSV is returned when the uploaded file can't be read as CSV
+	errInvalidCSV = formError{"the uploaded file is not a valid CSV file"}
+	// errUploadTooLarge is returned when the uploaded form is larger than the configured maximum
+	errUploadTooLarge = formError{"the uploaded file is too large"}
+)
+
+// limitUploadSize limits the size of the body of a request uploading a file to the configured maximum, if any
+func (f *Filter) limitUploadSize(w http.ResponseWriter, req *http.Request) {
+	if f.maxUploadSize > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, f.maxUploadSize)
+	}
+}
+
+// uploadError returns errUploadTooLarge if the uploaded form could not be read because it is too large, or the provided error
+func uploadError(err, otherwise error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errUploadTooLarge
+	}
+	return otherwise
+}
+
+// isUpload returns true if the request is the multipart form the CSV file of options is uploaded with
+func isUpload(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// uploadOptions sets the selected options of one or several dimensions from an uploaded CSV file, made either of a single column
+// of options for the dimension of the page, or of two dimension,option columns. Every row of the file is validated before the
+// accepted options are applied in chunks of BatchSizeLimit, then a summary of the accepted and rejected rows is rendered.
+// If applying the options fails part way, the summary lists how many of them were applied to each dimension.
+func (f *Filter) uploadOptions(w http.ResponseWriter, req *http.Request, lang, collectionID, userAccessToken string) {
+	vars := mux.Vars(req)
+	name := vars["name"]
+	filterID := vars["filterID"]
+	ctx := req.Context()
+	f.limitUploadSize(w, req)
+
+	fc, err := f.resolveFilter(ctx, userAccessToken, collectionID, filterID)
+	if err != nil {
+		log.Error(ctx, "failed to resolve filter", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	datasetID, edition, version := fc.DatasetID, fc.Edition, fc.Version
+
+	filterDims, _, err := f.FilterClient.GetDimensions(ctx, userAccessToken, "", collectionID, filterID, nil)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err, log.Data{"filter_id": filterID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	dims, err := f.DatasetClient.GetVersionDimensions(ctx, userAccessToken, "", collectionID, datasetID, edition, version)
+	if err != nil {
+		log.Error(ctx, "failed to get dimensions", err, log.Data{"dataset_id": datasetID, "edition": edition, "version": version})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	u := &optionsUpload{
+		f:               f,
+		userAccessToken: userAccessToken,
+		collectionID:    collectionID,
+		filterID:        filterID,
+		datasetID:       datasetID,
+		edition:         edition,
+		version:         version,
+		pageDimension:   name,
+		eTag:            headers.IfMatchAnyETag,
+		dimensionNames:  make(map[string]string),
+		dimensions:      make(map[string]*uploadedDimension),
+	}
+	names := make([]string, 0, len(filterDims.Items))
+	for i := range filterDims.Items {
+		u.addDimensionName(filterDims.Items[i].Name, filterDims.Items[i].Name)
+		names = append(names, filterDims.Items[i].Name)
+	}
+	for i := range dims.Items {
+		u.addDimensionName(dims.Items[i].Label, dims.Items[i].Name)
+	}
+
+	if err = u.read(ctx, req); err != nil {
+		log.Error(ctx, "failed to upload options", err, log.Data{"filter_id": filterID, "dimension": name})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	rec := f.recordChange(ctx, userAccessToken, collectionID, filterID, names...)
+	err = u.apply(ctx)
+	incomplete := err != nil
+	if incomplete && !u.applied() {
+		log.Error(ctx, "failed to apply uploaded options", err, log.Data{"filter_id": filterID, "dimension": name})
+		f.setStatusCode(req, w, err)
+		return
+	}
+	if incomplete {
+		// the options already applied are kept, so the summary lists them for the user to check their filter
+		log.Error(ctx, "failed to apply all the uploaded options", err, log.Data{"filter_id": filterID, "dimension": name})
+	}
+	forgetFilter(ctx, filterID)
+	rec.commit(ctx)
+
+	log.Info(ctx, "options uploaded", log.Data{"filter_id": filterID, "dimensions": len(u.order), "rejected": u.rejectedCount, "incomplete": incomplete})
+
+	datasetDetails, err := f.datasetDetails(ctx, userAccessToken, collectionID, fc)
+	if err != nil {
+		log.Error(ctx, "failed to get dataset", err, log.Data{"dataset_id": datasetID})
+		f.setStatusCode(req, w, err)
+		return
+	}
+
+	homepageContent, err := f.ZebedeeClient.GetHomepageContent(ctx, userAccessToken, collectionID, lang, "/")
+	if err != nil {
+		log.Warn(ctx, "unable to get homepage content", log.FormatErrors([]error{err}), log.Data{"homepage_content": err})
+	}
+
+	uploaded := make([]model.UploadedDimension, 0, len(u.order))
+	for _, dimName := range u.order {
+		d := u.dimensions[dimName]
+		uploaded = append(uploaded, model.UploadedDimension{Name: dimName, Accepted: len(d.codes), Applied: d.applied})
+	}
+
+	bp := f.RenderClient.NewBasePageModel()
+	p := mapper.CreateUploadSummaryPage(req, bp, datasetDetails, dims, uploaded, u.rejected, u.rejectedCount, incomplete, filterID, datasetID, edition, version, lang, homepageContent.ServiceMessage, homepageContent.EmergencyBanner)
+	f.buildPage(w, req, p, "upload-summary")
+}
+
+// optionsUpload applies the rows of an uploaded CSV file of options to the dimensions of a filter
+type optionsUpload struct {
+	f               *Filter
+	userAccessToken string
+	collectionID    string
+	filterID        string
+	datasetID       string
+	edition         string
+	version         string
+	pageDimension   string
+	eTag            string
+
+	// dimensionNames maps the normalised names and labels of the dimensions of the filter to their names
+	dimensionNames map[string]string
+	dimensions     map[string]*uploadedDimension
+	order          []string
+	rejected       []model.RejectedRow
+	rejectedCount  int
+}
+
+// uploadedDimension holds the options uploaded for a dimension, and the number of them applied to the filter
+type uploadedDimension struct {
+	index     map[string]string
+	ambiguous map[string]bool
+	seen      map[string]bool
+	codes     []string
+	applied   int
+}
+
+// addDimensionName allows the rows of the file to refer to the dimension with the provided name by key
+func (u *optionsUpload) addDimensionName(key, name string) {
+	if key == "" {
+		return
+	}
+	if _, ok := u.dimensionNames[normaliseOption(key)]; !ok {
+		u.dimensionNames[normaliseOption(key)] = name
+	}
+}
+
+// read streams the parts of the multipart form, taking the ETag of the page from the form fields that precede the file,
+// and validates the rows of the file without changing the filter
+func (u *optionsUpload) read(ctx context.Context, req *http.Request) error {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return formError{err.Error()}
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return errNoUploadFile
+		}
+		if err != nil {
+			return uploadError(err, formError{err.Error()})
+		}
+
+		switch part.FormName() {
+		case formETagKey:
+			b, err := io.ReadAll(io.LimitReader(part, 1024))
+			if err != nil {
+				return uploadError(err, formError{err.Error()})
+			}
+			if eTag := strings.TrimSpace(string(b)); eTag != "" {
+				u.eTag = eTag
+			}
+		case uploadFileKey:
+			return u.readRows(ctx, part)
+		}
+	}
+}
+
+// readRows reads the rows of the CSV file one at a time, keeping the accepted options of each dimension
+func (u *optionsUpload) readRows(ctx context.Context, r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Warn(ctx, "failed to read uploaded file", log.FormatErrors([]error{err}), log.Data{"filter_id": u.filterID})
+			return uploadError(err, errInvalidCSV)
+		}
+		line, _ := cr.FieldPos(0)
+
+		var dimKey, value string
+		switch len(record) {
+		case 1:
+			dimKey, value = u.pageDimension, record[0]
+		case 2:
+			dimKey, value = record[0], record[1]
+		default:
+			u.reject(line, record, "Expected one or two columns")
+			continue
+		}
+
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if first && isUploadHeader(record) {
+			continue
+		}
+
+		name, ok := u.dimensionNames[normaliseOption(dimKey)]
+		if !ok {
+			u.reject(line, record, "Not a dimension of this filter")
+			continue
+		}
+		if err := u.add(ctx, line, record, name, value); err != nil {
+			return err
+		}
+	}
+}
+
+// isUploadHeader returns true if the provided row is the header row of an uploaded file
+func isUploadHeader(record []string) bool {
+	switch len(record) {
+	case 1:
+		h := normaliseOption(record[0])
+		return h == "code" || h == "option" || h == "label"
+	case 2:
+		return normaliseOption(record[0]) == "dimension"
+	default:
+		return false
+	}
+}
+
+// add validates the uploaded option against the options of the dimension in the dataset, and adds it to the options
+// accepted for the dimension
+func (u *optionsUpload) add(ctx context.Context, line int, record []string, name, value string) error {
+	d, err := u.dimension(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	code, ok := d.index[normaliseOption(value)]
+	if !ok && d.ambiguous[normaliseOption(value)] {
+		u.reject(line, record, "Label of more than one option of "+name+", use its code instead")
+		return nil
+	}
+	if !ok {
+		u.reject(line, record, "Not an option of "+name)
+		return nil
+	}
+	if d.seen[code] {
+		return nil
+	}
+	d.seen[code] = true
+	d.codes = append(d.codes, code)
+	return nil
+}
+
+// dimension returns the uploaded options of a dimension, reading its options from the dataset the first time it is uploaded to
+func (u *optionsUpload) dimension(ctx context.Context, name string) (*uploadedDimension, error) {
+	if d, ok := u.dimensions[name]; ok {
+		return d, nil
+	}
+
+	opts, err := u.f.DatasetClient.GetOptionsInBatches(ctx, u.userAccessToken, "", u.collectionID, u.datasetID, u.edition, u.version, name, u.f.BatchSize, u.f.BatchMaxWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	index, ambiguous := optionIndex(optionLabels(opts))
+	d := &uploadedDimension{
+		index:     index,
+		ambiguous: ambiguous,
+		seen:      make(map[string]bool),
+	}
+	u.dimensions[name] = d
+	u.order = append(u.order, name)
+	return d, nil
+}
+
+// apply sets the accepted options of each dimension in chunks of BatchSizeLimit, once every row of the file has been
+// validated. The first chunk replaces the options selected before the upload, and the following chunks are added to it.
+func (u *optionsUpload) apply(ctx context.Context) (err error) {
+	for _, name := range u.order {
+		d := u.dimensions[name]
+		for len(d.codes[d.applied:]) > 0 {
+			chunk := d.codes[d.applied:]
+			if u.f.BatchSize > 0 && len(chunk) > u.f.BatchSize {
+				chunk = chunk[:u.f.BatchSize]
+			}
+			if d.applied == 0 {
+				u.eTag, err = u.f.FilterClient.SetDimensionValues(ctx, u.userAccessToken, "", u.collectionID, u.filterID, name, chunk, u.eTag)
+			} else {
+				u.eTag, err = u.f.FilterClient.PatchDimensionValues(ctx, u.userAccessToken, "", u.collectionID, u.filterID, name, chunk, []string{}, u.f.BatchSize, u.eTag)
+			}
+			if err != nil {
+				return err
+			}
+			d.applied += len(chunk)
+		}
+	}
+	return nil
+}
+
+// applied returns true if some of the uploaded options were applied to the filter
+func (u *optionsUpload) applied() bool {
+	for _, d := range u.dimensions {
+		if d.applied > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reject records a row of the file that could not be applied to the filter
+func (u *optionsUpload) reject(line int, record []string, reason string) {
+	u.rejectedCount++
+	if len(u.rejected) < maxRejectedRows {
+		u.rejected = append(u.rejected, model.RejectedRow{Line: line, Row: strings.Join(record, ","), Reason: reason})
+	}
+}
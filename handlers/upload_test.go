@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
+	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
+	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	dprequest "github.com/ONSdigital/dp-net/v3/request"
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUploadOptions(t *testing.T) {
+	const mockUserAuthToken = "Foo"
+	const mockCollectionID = "Bar"
+	const filterID = "12345"
+
+	ctx := gomock.Any()
+	cfg := &config.Config{BatchSizeLimit: 2, BatchMaxWorkers: 25}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	filterModel := filter.Model{
+		FilterID: filterID,
+		Links: filter.Links{
+			Version: filter.Link{HRef: "http://localhost:22400/v1/datasets/cpih01/editions/time-series/versions/1"},
+		},
+	}
+	filterDims := filter.Dimensions{Items: []filter.Dimension{{Name: "geography"}, {Name: "aggregate"}}}
+	versionDims := dataset.VersionDimensions{Items: dataset.VersionDimensionItems{
+		{Name: "geography", Label: "Geographic area"},
+		{Name: "aggregate", Label: "Aggregate"},
+	}}
+	geographyOptions := dataset.Options{Items: []dataset.Option{
+		{Option: "K04000001", Label: "England and Wales"},
+		{Option: "E92000001", Label: "England"},
+		{Option: "W92000004", Label: "Wales"},
+	}}
+	aggregateOptions := dataset.Options{Items: []dataset.Option{
+		{Option: "cpih1dim1A0", Label: "Overall Index"},
+	}}
+
+	upload := func(f *Filter, csv, target string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		So(mw.WriteField(formETagKey, testETag(0)), ShouldBeNil)
+		fw, err := mw.CreateFormFile(uploadFileKey, "options.csv")
+		So(err, ShouldBeNil)
+		_, err = fw.Write([]byte(csv))
+		So(err, ShouldBeNil)
+		So(mw.Close(), ShouldBeNil)
+
+		router := mux.NewRouter()
+		router.Path("/filters/{filterID}/dimensions/{name}/list").HandlerFunc(f.AddList())
+		req := httptest.NewRequest("POST", target, body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Add(dprequest.FlorenceHeaderKey, mockUserAuthToken)
+		req.Header.Add(dprequest.CollectionIDHeaderKey, mockCollectionID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("Given a filter with a geography and an aggregate dimension", t, func() {
+		mockFilterClient := NewMockFilterClient(mockCtrl)
+		mockDatasetClient := NewMockDatasetClient(mockCtrl)
+		mockZebedeeClient := NewMockZebedeeClient(mockCtrl)
+		mockRend := NewMockRenderClient(mockCtrl)
+		f := NewFilter(mockRend, mockFilterClient, mockDatasetClient, nil, nil, mockZebedeeClient, "/v1", cfg)
+
+		mockFilterClient.EXPECT().GetJobState(ctx, mockUserAuthToken, "", "", mockCollectionID, filterID).Return(filterModel, testETag(0), nil)
+		mockFilterClient.EXPECT().GetDimensions(ctx, mockUserAuthToken, "", mockCollectionID, filterID, nil).Return(filterDims, testETag(0), nil)
+		mockDatasetClient.EXPECT().GetVersionDimensions(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1").Return(versionDims, nil)
+
+		Convey("When a two column file is uploaded, then its options are validated and set in chunks of BatchSizeLimit, and the accepted and rejected rows are summarised", func() {
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography",
+				cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(geographyOptions, nil)
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "aggregate",
+				cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(aggregateOptions, nil)
+			gomock.InOrder(
+				mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography",
+					[]string{"K04000001", "E92000001"}, testETag(0)).Return(testETag(1), nil),
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography",
+					[]string{"W92000004"}, []string{}, cfg.BatchSizeLimit, testETag(1)).Return(testETag(2), nil),
+				mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "aggregate",
+					[]string{"cpih1dim1A0"}, testETag(2)).Return(testETag(3), nil),
+			)
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+			mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+			var page model.UploadSummary
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "upload-summary").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.UploadSummary)
+			})
+
+			csv := "dimension,option\n" +
+				"geography,K04000001\n" +
+				"Geographic area,england\n" +
+				"geography,Atlantis\n" +
+				"aggregate,Overall Index\n" +
+				"sex,male\n" +
+				"geography,k04000001\n" +
+				"geography,Wales\n"
+			w := upload(f, csv, "/filters/12345/dimensions/geography/list")
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(page.Data.Dimensions, ShouldResemble, []model.UploadedDimension{
+				{Name: "geography", Label: "Geographic area", Accepted: 3, Applied: 3},
+				{Name: "aggregate", Label: "Aggregate", Accepted: 1, Applied: 1},
+			})
+			So(page.Data.Incomplete, ShouldBeFalse)
+			So(page.Data.RejectedCount, ShouldEqual, 2)
+			So(page.Data.Rejected, ShouldResemble, []model.RejectedRow{
+				{Line: 4, Row: "geography,Atlantis", Reason: "Not an option of geography"},
+				{Line: 6, Row: "sex,male", Reason: "Not a dimension of this filter"},
+			})
+			So(page.Data.Continue.URL, ShouldEqual, "/filters/12345/dimensions")
+		})
+
+		Convey("When a one column file is uploaded, then its options are set for the dimension of the page, conditionally on the page ETag", func() {
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography",
+				cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(geographyOptions, nil)
+			mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography",
+				[]string{"W92000004"}, testETag(0)).Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusConflict})
+
+			w := upload(f, "code\nW92000004\n", "/filters/12345/dimensions/geography/list?format=json")
+
+			So(w.Code, ShouldEqual, http.StatusConflict)
+		})
+
+		Convey("When applying the options fails part way, then the summary lists the options that were applied", func() {
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography",
+				cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(geographyOptions, nil)
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "aggregate",
+				cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(aggregateOptions, nil)
+			gomock.InOrder(
+				mockFilterClient.EXPECT().SetDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography",
+					[]string{"K04000001", "E92000001"}, testETag(0)).Return(testETag(1), nil),
+				mockFilterClient.EXPECT().PatchDimensionValues(ctx, mockUserAuthToken, "", mockCollectionID, filterID, "geography",
+					[]string{"W92000004"}, []string{}, cfg.BatchSizeLimit, testETag(1)).Return("", &filter.ErrInvalidFilterAPIResponse{ExpectedCode: http.StatusOK, ActualCode: http.StatusInternalServerError}),
+			)
+			mockDatasetClient.EXPECT().Get(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01").Return(dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}, nil)
+			mockZebedeeClient.EXPECT().GetHomepageContent(ctx, mockUserAuthToken, mockCollectionID, "en", "/").Return(zebedee.HomepageContent{}, nil)
+			mockRend.EXPECT().NewBasePageModel().Return(core.NewPage("", ""))
+			var page model.UploadSummary
+			mockRend.EXPECT().BuildPage(gomock.Any(), gomock.Any(), "upload-summary").Do(func(_ io.Writer, pageModel interface{}, _ string) {
+				page = pageModel.(model.UploadSummary)
+			})
+
+			w := upload(f, "geography,K04000001\ngeography,England\ngeography,Wales\naggregate,cpih1dim1A0\n", "/filters/12345/dimensions/geography/list")
+
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(page.Data.Incomplete, ShouldBeTrue)
+			So(page.Data.Dimensions, ShouldResemble, []model.UploadedDimension{
+				{Name: "geography", Label: "Geographic area", Accepted: 3, Applied: 2},
+				{Name: "aggregate", Label: "Aggregate", Accepted: 1, Applied: 0},
+			})
+		})
+
+		Convey("When the uploaded file is not valid CSV, then a validation error is returned", func() {
+			w := upload(f, "geography,\"K04000001\n", "/filters/12345/dimensions/geography/list?format=json")
+
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Body.String(), ShouldContainSubstring, errInvalidCSV.msg)
+		})
+
+		Convey("When the uploaded file becomes invalid after some valid rows, then the filter is not changed", func() {
+			mockDatasetClient.EXPECT().GetOptionsInBatches(ctx, mockUserAuthToken, "", mockCollectionID, "cpih01", "time-series", "1", "geography",
+				cfg.BatchSizeLimit, cfg.BatchMaxWorkers).Return(geographyOptions, nil)
+
+			w := upload(f, "geography,K04000001\ngeography,England\ngeography,Wales\ngeography,\"W92000004\n", "/filters/12345/dimensions/geography/list?format=json")
+
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Body.String(), ShouldContainSubstring, errInvalidCSV.msg)
+		})
+
+		Convey("When the uploaded file is larger than the configured maximum, then it is rejected without changing the filter", func() {
+			f.maxUploadSize = 64
+			w := upload(f, strings.Repeat("geography,K04000001\n", 10), "/filters/12345/dimensions/geography/list?format=json")
+
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+			So(w.Body.String(), ShouldContainSubstring, errUploadTooLarge.msg)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+)
+
+// fieldError is a formError for one of the fields of a form, so that the form can be shown again with the message
+// next to the field. The field is the ID of the element the message is about
+type fieldError struct {
+	formError
+	field string
+}
+
+// newFieldError returns the error for the form field with the provided ID
+func newFieldError(field, msg string) fieldError {
+	return fieldError{formError: formError{msg}, field: field}
+}
+
+// asFieldError returns the fieldError the error is, or wraps, if any
+func asFieldError(err error) (fieldError, bool) {
+	var fieldErr fieldError
+	ok := errors.As(err, &fieldErr)
+	return fieldErr, ok
+}
+
+// fieldErrors returns the messages shown next to the fields of the form, keyed by the IDs of the fields
+func (e fieldError) fieldErrors() map[string]string {
+	return map[string]string{e.field: e.msg}
+}
+
+// invalidFormMessage returns the message shown above a form when the selection submitted by the user could not be
+// saved because it isn't valid, linking to the field to correct
+func invalidFormMessage(lang string, err fieldError) core.Error {
+	return core.Error{
+		Title:       "There is a problem with your selection",
+		Description: "Your changes have not been saved. Correct the selection below and save it again.",
+		ErrorItems: []core.ErrorItem{{
+			Description: core.Localisation{Text: err.msg},
+			Language:    lang,
+			ID:          err.field,
+			URL:         "#" + err.field,
+		}},
+		Language:  lang,
+		ErrorCode: http.StatusBadRequest,
+	}
+}
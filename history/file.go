@@ -0,0 +1,124 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// File is a Store that keeps the history of each filter in a JSON file of the provided directory,
+// so that it survives restarts of the service
+type File struct {
+	mu    sync.Mutex
+	dir   string
+	limit int
+}
+
+// NewFile returns a file-backed store keeping up to limit changes for each filter in dir, which is created if needed
+func NewFile(dir string, limit int) (*File, error) {
+	if dir == "" {
+		return nil, errors.New("no directory provided for the history store")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &File{dir: dir, limit: limit}, nil
+}
+
+// Push records a change made to a filter, forgetting the oldest one if the limit is reached
+func (s *File) Push(_ context.Context, filterID string, change Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes, err := s.read(filterID)
+	if err != nil {
+		return err
+	}
+	return s.write(filterID, trim(append(changes, change), s.limit))
+}
+
+// Last returns the most recent change made to a filter, if any
+func (s *File) Last(_ context.Context, filterID string) (Change, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes, err := s.read(filterID)
+	if err != nil || len(changes) == 0 {
+		return Change{}, false, err
+	}
+	return changes[len(changes)-1], true, nil
+}
+
+// Pop removes the most recent change made to a filter
+func (s *File) Pop(_ context.Context, filterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes, err := s.read(filterID)
+	if err != nil {
+		return err
+	}
+	if len(changes) <= 1 {
+		path, _ := s.path(filterID)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return s.write(filterID, changes[:len(changes)-1])
+}
+
+// path returns the path of the file holding the history of a filter
+func (s *File) path(filterID string) (string, error) {
+	if filterID == "" || strings.ContainsAny(filterID, `/\.`) {
+		return "", ErrInvalidFilterID
+	}
+	return filepath.Join(s.dir, filterID+".json"), nil
+}
+
+func (s *File) read(filterID string) ([]Change, error) {
+	path, err := s.path(filterID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path) //nolint:gosec // the filter ID can't leave the history directory
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	if err := json.Unmarshal(b, &changes); err != nil {
+		return nil, fmt.Errorf("failed to read history of filter %s: %w", filterID, err)
+	}
+	return changes, nil
+}
+
+// write replaces the history of a filter, through a temporary file so that it is never left half written
+func (s *File) write(filterID string, changes []Change) error {
+	path, err := s.path(filterID)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, filterID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,98 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Store kinds that can be configured
+const (
+	MemoryStore = "memory"
+	FileStore   = "file"
+)
+
+// ErrInvalidFilterID is returned when a filter ID can't be used to store the history of a filter
+var ErrInvalidFilterID = errors.New("invalid filter id")
+
+// Store keeps the most recent changes made to each filter, so that they can be undone
+type Store interface {
+	// Push records a change made to a filter
+	Push(ctx context.Context, filterID string, change Change) error
+	// Last returns the most recent change made to a filter, if any
+	Last(ctx context.Context, filterID string) (Change, bool, error)
+	// Pop removes the most recent change made to a filter, once it has been undone
+	Pop(ctx context.Context, filterID string) error
+}
+
+// Change is a single edit of a filter, as the options it added to and removed from its dimensions
+type Change struct {
+	Dimensions []DimensionChange `json:"dimensions"`
+}
+
+// DimensionChange represents the options added to and removed from a dimension by a change
+type DimensionChange struct {
+	Name    string   `json:"name"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// IsEmpty returns true if the change did not add or remove any option
+func (c Change) IsEmpty() bool {
+	for _, d := range c.Dimensions {
+		if len(d.Added) > 0 || len(d.Removed) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Inverse returns the change that undoes this one
+func (c Change) Inverse() Change {
+	inverse := Change{Dimensions: make([]DimensionChange, 0, len(c.Dimensions))}
+	for _, d := range c.Dimensions {
+		inverse.Dimensions = append(inverse.Dimensions, DimensionChange{Name: d.Name, Added: d.Removed, Removed: d.Added})
+	}
+	return inverse
+}
+
+// Diff returns the change from the options selected in a dimension before an edit to the ones selected after it
+func Diff(name string, before, after []string) DimensionChange {
+	d := DimensionChange{Name: name}
+	selectedBefore := set(before)
+	selectedAfter := set(after)
+	for _, option := range after {
+		if !selectedBefore[option] {
+			d.Added = append(d.Added, option)
+		}
+	}
+	for _, option := range before {
+		if !selectedAfter[option] {
+			d.Removed = append(d.Removed, option)
+		}
+	}
+	return d
+}
+
+// set returns the set of the provided options, as dimensions may have tens of thousands of them
+func set(options []string) map[string]bool {
+	s := make(map[string]bool, len(options))
+	for _, option := range options {
+		s[option] = true
+	}
+	return s
+}
+
+// NewStore returns the store of the provided kind, keeping up to limit changes for each filter.
+// The memory store only keeps the history of up to maxFilters filters, each for ttl after its last change.
+func NewStore(kind, path string, limit, maxFilters int, ttl time.Duration) (Store, error) {
+	switch kind {
+	case MemoryStore:
+		return NewMemory(limit, maxFilters, ttl), nil
+	case FileStore:
+		return NewFile(path, limit)
+	default:
+		return nil, fmt.Errorf("unknown history store: %q", kind)
+	}
+}
@@ -0,0 +1,133 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChange(t *testing.T) {
+	Convey("Diff returns the options added to and removed from a dimension", t, func() {
+		d := Diff("sex", []string{"male", "female"}, []string{"female", "all"})
+		So(d, ShouldResemble, DimensionChange{Name: "sex", Added: []string{"all"}, Removed: []string{"male"}})
+	})
+
+	Convey("Diff keeps the order of the options and ignores the ones selected both before and after", t, func() {
+		d := Diff("age", []string{"1", "2", "3", "4"}, []string{"5", "4", "2", "6"})
+		So(d, ShouldResemble, DimensionChange{Name: "age", Added: []string{"5", "6"}, Removed: []string{"1", "3"}})
+	})
+
+	Convey("Diff of an unchanged dimension is empty", t, func() {
+		d := Diff("sex", []string{"male"}, []string{"male"})
+		So(Change{Dimensions: []DimensionChange{d}}.IsEmpty(), ShouldBeTrue)
+	})
+
+	Convey("The inverse of a change adds the removed options and removes the added ones", t, func() {
+		c := Change{Dimensions: []DimensionChange{{Name: "sex", Added: []string{"all"}, Removed: []string{"male"}}}}
+		So(c.Inverse(), ShouldResemble, Change{Dimensions: []DimensionChange{{Name: "sex", Added: []string{"male"}, Removed: []string{"all"}}}})
+		So(c.IsEmpty(), ShouldBeFalse)
+	})
+}
+
+func TestNewStore(t *testing.T) {
+	Convey("NewStore returns the configured store", t, func() {
+		s, err := NewStore(MemoryStore, "", 10, 100, time.Hour)
+		So(err, ShouldBeNil)
+		So(s, ShouldHaveSameTypeAs, &Memory{})
+
+		s, err = NewStore(FileStore, t.TempDir(), 10, 100, time.Hour)
+		So(err, ShouldBeNil)
+		So(s, ShouldHaveSameTypeAs, &File{})
+	})
+
+	Convey("NewStore fails for an unknown store or a file store without a directory", t, func() {
+		_, err := NewStore("redis", "", 10, 100, time.Hour)
+		So(err, ShouldNotBeNil)
+
+		_, err = NewStore(FileStore, "", 10, 100, time.Hour)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestStores(t *testing.T) {
+	file, err := NewFile(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"memory": NewMemory(2, 100, time.Hour),
+		"file":   file,
+	}
+
+	for name, s := range stores {
+		ctx := context.Background()
+		first := Change{Dimensions: []DimensionChange{{Name: "sex", Added: []string{"male"}}}}
+		second := Change{Dimensions: []DimensionChange{{Name: "sex", Removed: []string{"male"}}}}
+		third := Change{Dimensions: []DimensionChange{{Name: "age", Added: []string{"1", "2"}}}}
+
+		Convey("Given an empty "+name+" store, then there is no change to undo", t, func() {
+			_, ok, err := s.Last(ctx, "filter-1")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			So(s.Pop(ctx, "filter-1"), ShouldBeNil)
+		})
+
+		Convey("Given changes pushed to a "+name+" store, then they are returned most recent first up to the limit", t, func() {
+			So(s.Push(ctx, "filter-1", first), ShouldBeNil)
+			So(s.Push(ctx, "filter-1", second), ShouldBeNil)
+			So(s.Push(ctx, "filter-1", third), ShouldBeNil)
+			So(s.Push(ctx, "filter-2", first), ShouldBeNil)
+
+			last, ok, err := s.Last(ctx, "filter-1")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(last, ShouldResemble, third)
+
+			So(s.Pop(ctx, "filter-1"), ShouldBeNil)
+			last, ok, _ = s.Last(ctx, "filter-1")
+			So(ok, ShouldBeTrue)
+			So(last, ShouldResemble, second)
+
+			So(s.Pop(ctx, "filter-1"), ShouldBeNil)
+			_, ok, _ = s.Last(ctx, "filter-1")
+			So(ok, ShouldBeFalse)
+
+			last, ok, _ = s.Last(ctx, "filter-2")
+			So(ok, ShouldBeTrue)
+			So(last, ShouldResemble, first)
+		})
+	}
+
+	Convey("Given a memory store full of filters, then the history of the least recently used filter is forgotten", t, func() {
+		ctx := context.Background()
+		m := NewMemory(2, 2, time.Hour)
+		change := Change{Dimensions: []DimensionChange{{Name: "sex", Added: []string{"male"}}}}
+		So(m.Push(ctx, "filter-1", change), ShouldBeNil)
+		So(m.Push(ctx, "filter-2", change), ShouldBeNil)
+		_, _, _ = m.Last(ctx, "filter-1")
+		So(m.Push(ctx, "filter-3", change), ShouldBeNil)
+
+		_, ok, _ := m.Last(ctx, "filter-2")
+		So(ok, ShouldBeFalse)
+		_, ok, _ = m.Last(ctx, "filter-1")
+		So(ok, ShouldBeTrue)
+		_, ok, _ = m.Last(ctx, "filter-3")
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Given a memory store without a number of filters configured, then the history of filters is still kept", t, func() {
+		ctx := context.Background()
+		m := NewMemory(2, 0, time.Hour)
+		So(m.Push(ctx, "filter-1", Change{Dimensions: []DimensionChange{{Name: "sex", Added: []string{"male"}}}}), ShouldBeNil)
+
+		_, ok, err := m.Last(ctx, "filter-1")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Given a file store, then filter IDs that could leave its directory are rejected", t, func() {
+		So(file.Push(context.Background(), "../filter-1", Change{}), ShouldEqual, ErrInvalidFilterID)
+	})
+}
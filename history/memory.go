@@ -0,0 +1,74 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/cache"
+)
+
+// Memory is a Store that keeps the history of the filters in memory, so it is lost when the service restarts.
+// The history of a filter is forgotten once it hasn't changed for a while, or once the history of too many other
+// filters changed more recently, so that abandoned filters don't use memory forever.
+type Memory struct {
+	mu      sync.Mutex // serialises the updates of the history of the filters
+	limit   int
+	changes *cache.Cache[[]Change]
+}
+
+// defaultMaxFilters is the number of filters the history is kept for when no number is configured
+const defaultMaxFilters = 10000
+
+// NewMemory returns an in-memory store keeping up to limit changes for each filter. The history of up to maxFilters
+// filters is kept, each for ttl after its last change, or of defaultMaxFilters filters if maxFilters isn't positive.
+func NewMemory(limit, maxFilters int, ttl time.Duration) *Memory {
+	if maxFilters <= 0 {
+		maxFilters = defaultMaxFilters
+	}
+	return &Memory{
+		limit:   limit,
+		changes: cache.New[[]Change](maxFilters, ttl),
+	}
+}
+
+// Push records a change made to a filter, forgetting the oldest one if the limit is reached
+func (m *Memory) Push(_ context.Context, filterID string, change Change) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changes, _ := m.changes.Peek(filterID)
+	m.changes.Set(filterID, trim(append(changes, change), m.limit))
+	return nil
+}
+
+// Last returns the most recent change made to a filter, if any
+func (m *Memory) Last(_ context.Context, filterID string) (Change, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changes, _ := m.changes.Peek(filterID)
+	if len(changes) == 0 {
+		return Change{}, false, nil
+	}
+	return changes[len(changes)-1], true, nil
+}
+
+// Pop removes the most recent change made to a filter
+func (m *Memory) Pop(_ context.Context, filterID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changes, _ := m.changes.Peek(filterID)
+	if len(changes) <= 1 {
+		m.changes.Delete(filterID)
+		return nil
+	}
+	m.changes.Set(filterID, changes[:len(changes)-1])
+	return nil
+}
+
+// trim drops the oldest changes beyond the limit
+func trim(changes []Change, limit int) []Change {
+	if limit > 0 && len(changes) > limit {
+		return changes[len(changes)-limit:]
+	}
+	return changes
+}
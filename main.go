@@ -75,6 +75,16 @@ func run(ctx context.Context) error {
 		err = goerrors.Join(err, otelShutdown(context.Background()))
 	}()
 
+	// Export metrics, which dp-otel-go doesn't set up
+	metricsShutdown, err := service.SetupMetrics(ctx, cfg)
+	if err != nil {
+		log.Error(ctx, "error setting up OpenTelemetry metrics", err)
+	} else {
+		defer func() {
+			err = goerrors.Join(err, metricsShutdown(context.Background()))
+		}()
+	}
+
 	// Start service
 	svc, err := service.Run(ctx, cfg, svcList, BuildTime, GitCommit, Version, svcErrors)
 	if err != nil {
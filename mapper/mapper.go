@@ -3,12 +3,11 @@ package mapper
 import (
 	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
@@ -16,11 +15,14 @@ import (
 	"github.com/ONSdigital/dp-api-clients-go/v2/search"
 	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-cookies/cookies"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/ages"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
 
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/ordinal"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/permalink"
 	core "github.com/ONSdigital/dp-renderer/v2/model"
 	"github.com/ONSdigital/log.go/v2/log"
 )
@@ -31,6 +33,7 @@ const (
 	latest          = "latest"
 	list            = "list"
 	single          = "single"
+	isoDate         = "2006-01-02"
 	sixteensVersion = "a18521a"
 	strRange        = "range"
 	strTime         = "time"
@@ -89,14 +92,18 @@ func CreateFilterOverview(req *http.Request, bp core.Page, dimensions []filter.M
 				}
 			}
 
-			times, err := dates.ConvertToReadable(dimensions[i].Values)
-			if err != nil {
-				log.Warn(ctx, "unable to convert dates to human readable values", log.FormatErrors([]error{err}))
-				fod.AddedCategories = append(fod.AddedCategories, dimensions[i].Values...)
+			format, ok := dates.Detect(dimensions[i].Values)
+			if !ok && len(dimensions[i].Values) > 0 {
+				log.Warn(ctx, "unable to convert dates to human readable values", log.Data{"values": dimensions[i].Values})
 			}
 
-			for _, time := range times {
-				fod.AddedCategories = append(fod.AddedCategories, time.Format("January 2006"))
+			for _, val := range dimensions[i].Values {
+				if !ok {
+					fod.AddedCategories = append(fod.AddedCategories, val)
+					continue
+				}
+				period, _ := format.Parse(val)
+				fod.AddedCategories = append(fod.AddedCategories, period.Label())
 			}
 		} else {
 			fod.AddedCategories = append(fod.AddedCategories, dimensions[i].Values...)
@@ -241,6 +248,8 @@ func CreateListSelectorPage(req *http.Request, bp core.Page, name string, select
 	p.Data.RangeData.URL = fmt.Sprintf("/filters/%s/dimensions/%s/list", fm.FilterID, name)
 
 	p.Data.RemoveAll.URL = fmt.Sprintf("/filters/%s/dimensions/%s/remove-all", fm.FilterID, name)
+	p.Data.Paste = pasteLink(fm.FilterID, name)
+	p.Data.Upload = uploadLink(fm.FilterID, name)
 
 	lookup := getIDNameLookup(allValues)
 
@@ -287,6 +296,35 @@ func CreateListSelectorPage(req *http.Request, bp core.Page, name string, select
 	return p
 }
 
+// CreateOrdinalRange maps the ordered options of a dimension to the range selector of its list selector page.
+// The selected range runs from the first to the last selected option.
+func CreateOrdinalRange(filterID, name string, ordered []ordinal.Option, selectedValues []filter.DimensionOption) model.Ordinal {
+	r := model.Ordinal{
+		URL: fmt.Sprintf("/filters/%s/dimensions/%s/range", filterID, name),
+	}
+
+	selected := make(map[string]bool, len(selectedValues))
+	for _, opt := range selectedValues {
+		selected[opt.Option] = true
+	}
+
+	for _, opt := range ordered {
+		if selected[opt.Code] {
+			if r.From == "" {
+				r.From = opt.Code
+			}
+			r.To = opt.Code
+		}
+		r.Values = append(r.Values, model.Value{
+			Label:      opt.Label,
+			ID:         opt.Code,
+			IsSelected: selected[opt.Code],
+		})
+	}
+
+	return r
+}
+
 // CreatePreviewPage maps data items from API responses to create a preview page
 func CreatePreviewPage(req *http.Request, bp core.Page, dimensions []filter.ModelDimension, fm filter.Model, dst dataset.DatasetDetails, filterOutputID, datasetID, releaseDate, apiRouterVersion string, enableDatasetPreview bool, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.Preview {
 	p := model.Preview{
@@ -376,6 +414,350 @@ func CreatePreviewPage(req *http.Request, bp core.Page, dimensions []filter.Mode
 	return p
 }
 
+// CreateVersionChangesPage maps the options dropped from, or added to, each dimension when a filter is moved to
+// another version of the dataset, to create the page shown before continuing with the new filter
+func CreateVersionChangesPage(req *http.Request, bp core.Page, dst dataset.DatasetDetails, changes []model.DimensionChanges, filterID, datasetID, edition, version, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.VersionChanges {
+	p := model.VersionChanges{
+		Page: bp,
+	}
+	p.FeatureFlags.SixteensVersion = sixteensVersion
+	p.Metadata.Title = "Changes to your filter options"
+	p.BetaBannerEnabled = true
+	p.SearchDisabled = true
+	p.Language = lang
+	p.ServiceMessage = serviceMessage
+	p.EmergencyBanner = mapEmergencyBanner(emergencyBannerContent)
+	p.RemoveGalleryBackground = true
+	p.FeatureFlags.FeedbackAPIURL = cfg.FeedbackAPIURL
+	p.URI = req.URL.Path
+	p.IsInFilterBreadcrumb = true
+
+	mapCookiePreferences(req, &p.CookiesPreferencesSet, &p.CookiesPolicy)
+
+	versionURL := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, version)
+	p.Breadcrumb = append(
+		p.Breadcrumb,
+		core.TaxonomyNode{
+			Title: dst.Title,
+			URI:   fmt.Sprintf("/datasets/%s/editions", dst.ID),
+		}, core.TaxonomyNode{
+			Title: edition,
+			URI:   versionURL,
+		}, core.TaxonomyNode{
+			Title: "Filter options",
+		})
+
+	p.DatasetTitle = dst.Title
+	p.DatasetId = datasetID
+	p.Data.FilterID = filterID
+	p.Data.Edition = edition
+	p.Data.Version = version
+	p.Data.Continue = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions", filterID),
+		Label: "Continue",
+	}
+
+	for i := range changes {
+		if changes[i].Label == "" {
+			changes[i].Label = changes[i].Name
+		}
+	}
+	p.Data.Dimensions = changes
+
+	return p
+}
+
+// CreateImportResultsPage maps the imported options that no longer exist in the dataset version to create the page
+// shown before continuing to the new filter
+func CreateImportResultsPage(req *http.Request, bp core.Page, dst dataset.DatasetDetails, changes []model.DimensionChanges, filterID, datasetID, edition, version, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.ImportResults {
+	p := model.ImportResults{
+		Page: bp,
+	}
+	p.FeatureFlags.SixteensVersion = sixteensVersion
+	p.Metadata.Title = "Options no longer available"
+	p.BetaBannerEnabled = true
+	p.SearchDisabled = true
+	p.Language = lang
+	p.ServiceMessage = serviceMessage
+	p.EmergencyBanner = mapEmergencyBanner(emergencyBannerContent)
+	p.RemoveGalleryBackground = true
+	p.FeatureFlags.FeedbackAPIURL = cfg.FeedbackAPIURL
+	p.URI = req.URL.Path
+	p.IsInFilterBreadcrumb = true
+
+	mapCookiePreferences(req, &p.CookiesPreferencesSet, &p.CookiesPolicy)
+
+	versionURL := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, version)
+	p.Breadcrumb = append(
+		p.Breadcrumb,
+		core.TaxonomyNode{
+			Title: dst.Title,
+			URI:   fmt.Sprintf("/datasets/%s/editions", dst.ID),
+		}, core.TaxonomyNode{
+			Title: edition,
+			URI:   versionURL,
+		}, core.TaxonomyNode{
+			Title: "Filter options",
+		})
+
+	p.DatasetTitle = dst.Title
+	p.DatasetId = datasetID
+	p.Data.FilterID = filterID
+	p.Data.Edition = edition
+	p.Data.Version = version
+	p.Data.Continue = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions", filterID),
+		Label: "Continue",
+	}
+
+	for i := range changes {
+		if changes[i].Label == "" {
+			changes[i].Label = changes[i].Name
+		}
+	}
+	p.Data.Dimensions = changes
+
+	return p
+}
+
+// CreatePasteResultsPage maps the options added to a dimension from a pasted list, and the entries of the list that
+// did not match any option or matched the label of several options, to create the page shown before returning to the dimension
+func CreatePasteResultsPage(req *http.Request, bp core.Page, dst dataset.DatasetDetails, dims dataset.VersionDimensions, added, unmatched, ambiguous []string, filterID, name, datasetID, edition, version, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.PasteResults {
+	p := model.PasteResults{
+		Page: bp,
+	}
+	p.FeatureFlags.SixteensVersion = sixteensVersion
+	p.BetaBannerEnabled = true
+	p.SearchDisabled = true
+	p.Language = lang
+	p.ServiceMessage = serviceMessage
+	p.EmergencyBanner = mapEmergencyBanner(emergencyBannerContent)
+	p.RemoveGalleryBackground = true
+	p.FeatureFlags.FeedbackAPIURL = cfg.FeedbackAPIURL
+	p.URI = req.URL.Path
+	p.IsInFilterBreadcrumb = true
+
+	mapCookiePreferences(req, &p.CookiesPreferencesSet, &p.CookiesPolicy)
+
+	dimLabel := helpers.TitleCaseStr(name)
+	for i := range dims.Items {
+		if dims.Items[i].Name == name && dims.Items[i].Label != "" {
+			dimLabel = dims.Items[i].Label
+		}
+	}
+	p.Metadata.Title = fmt.Sprintf("Options added to %s", dimLabel)
+
+	versionURL := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, version)
+	p.Breadcrumb = append(
+		p.Breadcrumb,
+		core.TaxonomyNode{
+			Title: dst.Title,
+			URI:   fmt.Sprintf("/datasets/%s/editions", dst.ID),
+		}, core.TaxonomyNode{
+			Title: edition,
+			URI:   versionURL,
+		}, core.TaxonomyNode{
+			Title: "Filter options",
+			URI:   fmt.Sprintf("/filters/%s/dimensions", filterID),
+		}, core.TaxonomyNode{
+			Title: dimLabel,
+		})
+
+	p.DatasetTitle = dst.Title
+	p.DatasetId = datasetID
+	p.Data.FilterID = filterID
+	p.Data.DimensionName = name
+	p.Data.DimensionLabel = dimLabel
+	p.Data.Added = added
+	p.Data.Unmatched = unmatched
+	p.Data.Ambiguous = ambiguous
+	p.Data.Continue = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions/%s", filterID, name),
+		Label: "Continue",
+	}
+
+	return p
+}
+
+// CreateUploadSummaryPage maps the number of options accepted for each dimension from an uploaded file, and the rows
+// of the file that were rejected, to create the page shown before returning to the filter overview. If the upload is
+// incomplete, the page tells the user that only some of the accepted options were applied to their filter.
+func CreateUploadSummaryPage(req *http.Request, bp core.Page, dst dataset.DatasetDetails, dims dataset.VersionDimensions, uploaded []model.UploadedDimension, rejected []model.RejectedRow, rejectedCount int, incomplete bool, filterID, datasetID, edition, version, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.UploadSummary {
+	p := model.UploadSummary{
+		Page: bp,
+	}
+	p.FeatureFlags.SixteensVersion = sixteensVersion
+	p.Metadata.Title = "Uploaded filter options"
+	p.BetaBannerEnabled = true
+	p.SearchDisabled = true
+	p.Language = lang
+	p.ServiceMessage = serviceMessage
+	p.EmergencyBanner = mapEmergencyBanner(emergencyBannerContent)
+	p.RemoveGalleryBackground = true
+	p.FeatureFlags.FeedbackAPIURL = cfg.FeedbackAPIURL
+	p.URI = req.URL.Path
+	p.IsInFilterBreadcrumb = true
+
+	mapCookiePreferences(req, &p.CookiesPreferencesSet, &p.CookiesPolicy)
+
+	versionURL := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, version)
+	p.Breadcrumb = append(
+		p.Breadcrumb,
+		core.TaxonomyNode{
+			Title: dst.Title,
+			URI:   fmt.Sprintf("/datasets/%s/editions", dst.ID),
+		}, core.TaxonomyNode{
+			Title: edition,
+			URI:   versionURL,
+		}, core.TaxonomyNode{
+			Title: "Filter options",
+		})
+
+	p.DatasetTitle = dst.Title
+	p.DatasetId = datasetID
+	p.Data.FilterID = filterID
+	p.Data.Continue = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions", filterID),
+		Label: "Continue",
+	}
+
+	for i := range uploaded {
+		for j := range dims.Items {
+			if dims.Items[j].Name == uploaded[i].Name && dims.Items[j].Label != "" {
+				uploaded[i].Label = dims.Items[j].Label
+			}
+		}
+		if uploaded[i].Label == "" {
+			uploaded[i].Label = uploaded[i].Name
+		}
+	}
+	p.Data.Dimensions = uploaded
+	p.Data.Rejected = rejected
+	p.Data.RejectedCount = rejectedCount
+	p.Data.Incomplete = incomplete
+
+	return p
+}
+
+// uploadLink returns the link a CSV file of options is uploaded to
+func uploadLink(filterID, name string) model.Link {
+	return model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions/%s/list", filterID, name),
+		Label: "Upload a CSV file",
+	}
+}
+
+// CreatePermalinkPage maps the link that recreates the selections of a filter to create the page it is shared from
+func CreatePermalinkPage(req *http.Request, bp core.Page, dst dataset.DatasetDetails, permalinkURL, filterID, datasetID, edition, version, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.Permalink {
+	p := model.Permalink{
+		Page: bp,
+	}
+	p.FeatureFlags.SixteensVersion = sixteensVersion
+	p.Metadata.Title = "Share your filter options"
+	p.BetaBannerEnabled = true
+	p.SearchDisabled = true
+	p.Language = lang
+	p.ServiceMessage = serviceMessage
+	p.EmergencyBanner = mapEmergencyBanner(emergencyBannerContent)
+	p.RemoveGalleryBackground = true
+	p.FeatureFlags.FeedbackAPIURL = cfg.FeedbackAPIURL
+	p.URI = req.URL.Path
+	p.IsInFilterBreadcrumb = true
+
+	mapCookiePreferences(req, &p.CookiesPreferencesSet, &p.CookiesPolicy)
+
+	versionURL := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", datasetID, edition, version)
+	p.Breadcrumb = append(
+		p.Breadcrumb,
+		core.TaxonomyNode{
+			Title: dst.Title,
+			URI:   fmt.Sprintf("/datasets/%s/editions", dst.ID),
+		}, core.TaxonomyNode{
+			Title: edition,
+			URI:   versionURL,
+		}, core.TaxonomyNode{
+			Title: "Filter options",
+			URI:   fmt.Sprintf("/filters/%s/dimensions", filterID),
+		}, core.TaxonomyNode{
+			Title: "Share",
+		})
+
+	p.DatasetTitle = dst.Title
+	p.DatasetId = datasetID
+	p.Data.FilterID = filterID
+	p.Data.URL = permalinkURL
+	p.Data.Back = model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions", filterID),
+		Label: "Back to your filter options",
+	}
+
+	return p
+}
+
+// CreateNewFilterPage maps the selections encoded in a permalink to create the page asking the user to confirm the new
+// filter is started, as following a link must not create a filter
+func CreateNewFilterPage(req *http.Request, bp core.Page, dst dataset.DatasetDetails, dims dataset.VersionDimensions, spec permalink.Spec, encodedSpec, lang, serviceMessage string, emergencyBannerContent zebedee.EmergencyBanner) model.NewFilter {
+	p := model.NewFilter{
+		Page: bp,
+	}
+	p.FeatureFlags.SixteensVersion = sixteensVersion
+	p.Metadata.Title = "Start a filter with shared options"
+	p.BetaBannerEnabled = true
+	p.SearchDisabled = true
+	p.Language = lang
+	p.ServiceMessage = serviceMessage
+	p.EmergencyBanner = mapEmergencyBanner(emergencyBannerContent)
+	p.RemoveGalleryBackground = true
+	p.FeatureFlags.FeedbackAPIURL = cfg.FeedbackAPIURL
+	p.URI = req.URL.Path
+
+	mapCookiePreferences(req, &p.CookiesPreferencesSet, &p.CookiesPolicy)
+
+	versionURL := fmt.Sprintf("/datasets/%s/editions/%s/versions/%s", spec.DatasetID, spec.Edition, spec.Version)
+	p.Breadcrumb = append(
+		p.Breadcrumb,
+		core.TaxonomyNode{
+			Title: dst.Title,
+			URI:   fmt.Sprintf("/datasets/%s/editions", dst.ID),
+		}, core.TaxonomyNode{
+			Title: spec.Edition,
+			URI:   versionURL,
+		}, core.TaxonomyNode{
+			Title: "New filter",
+		})
+
+	p.DatasetTitle = dst.Title
+	p.DatasetId = spec.DatasetID
+	p.Data.Spec = encodedSpec
+	for _, d := range spec.Dimensions {
+		label := d.Name
+		for i := range dims.Items {
+			if dims.Items[i].Name == d.Name && dims.Items[i].Label != "" {
+				label = dims.Items[i].Label
+			}
+		}
+		p.Data.Dimensions = append(p.Data.Dimensions, model.PermalinkDimension{Name: d.Name, Label: label, All: d.All, Options: len(d.Options)})
+	}
+	p.Data.Submit = model.Link{
+		URL:   "/filters/new",
+		Label: "Start filter",
+	}
+	p.Data.Cancel = model.Link{
+		URL:   versionURL,
+		Label: "Back to the dataset",
+	}
+
+	return p
+}
+
+// pasteLink returns the link the list of options pasted into a dimension is submitted to
+func pasteLink(filterID, name string) model.Link {
+	return model.Link{
+		URL:   fmt.Sprintf("/filters/%s/dimensions/%s/paste", filterID, name),
+		Label: "Add from a list",
+	}
+}
+
 func getNameIDLookup(vals dataset.Options) map[string]string {
 	lookup := make(map[string]string)
 	for i := range vals.Items {
@@ -461,88 +843,119 @@ func CreateAgePage(req *http.Request, bp core.Page, f filter.Model, d dataset.Da
 
 	p.Data.FormAction.URL = fmt.Sprintf("/filters/%s/dimensions/age/update", f.FilterID)
 
-	// get mapping of labels (keys) to options (values) and initialise aux vars
-	labelIDs := getNameIDLookup(allVals)
-	youngest := math.MaxInt32
-	oldest := math.MinInt32
+	selected := make(map[string]bool, len(selVals.Items))
+	for _, selVal := range selVals.Items {
+		selected[selVal.Option] = true
+	}
 
-	// iterate all values, and add them to the Page in the same order,
-	// setting the 'isSelected' for each one of them (according to selVals)
-	// and setting oldest and youngest values
+	// add all the age values to the Page in the same order as provided by dataset API, setting 'isSelected'
+	// for each one of them. Labels that are not ages, such as "Total", are assumed to be the 'allOptions' value.
+	var ordered []ages.Option
 	for i := range allVals.Items {
-		// if the age Label contains '+', we assume that it is the oldest age value
-		if strings.Contains(allVals.Items[i].Label, "+") {
-			p.Data.Oldest = allVals.Items[i].Label
-		} else {
-			// get the Int values, if there is an error, we assume that 'allOptions' was selected
-			ageInt, err := strconv.Atoi(allVals.Items[i].Label)
-			if err != nil {
-				p.Data.HasAllAges = true
-				p.Data.AllAgesOption = allVals.Items[i].Option
-				continue
-			}
-			// refresh youngest and oldest values if needed
-			if ageInt < youngest {
-				youngest = ageInt
-			}
-			if ageInt > oldest {
-				oldest = ageInt
-			}
-		}
-
-		// find if the option is selected
-		var isSelected bool
-		for _, selVal := range selVals.Items {
-			if selVal.Option == labelIDs[allVals.Items[i].Label] {
-				isSelected = true
-			}
+		a, ok := ages.Parse(allVals.Items[i].Label)
+		if !ok {
+			p.Data.HasAllAges = true
+			p.Data.AllAgesOption = allVals.Items[i].Option
+			continue
 		}
+		ordered = append(ordered, ages.Option{Code: allVals.Items[i].Option, Label: allVals.Items[i].Label, Age: a})
 
-		// append the age value to the page
 		p.Data.Ages = append(p.Data.Ages, model.AgeValue{
-			Option:     labelIDs[allVals.Items[i].Label],
+			Option:     allVals.Items[i].Option,
 			Label:      allVals.Items[i].Label,
-			IsSelected: isSelected,
+			IsSelected: selected[allVals.Items[i].Option],
 		})
 	}
 
-	if p.Data.Youngest == "" && youngest < math.MaxInt32 {
-		p.Data.Youngest = strconv.Itoa(youngest)
-	}
-	if p.Data.Oldest == "" && oldest > math.MinInt32 {
-		p.Data.Oldest = strconv.Itoa(oldest)
+	// the youngest and oldest ages, and the selected range, are found from the ages sorted from the youngest
+	ages.Sort(ordered)
+	if len(ordered) > 0 {
+		p.Data.Youngest = ordered[0].Label
+		p.Data.Oldest = ordered[len(ordered)-1].Label
 	}
 
 	p.Data.CheckedRadio = strRange
+	first, last := -1, -1
+	for i := range ordered {
+		if !selected[ordered[i].Code] {
+			continue
+		}
+		if first < 0 {
+			first = i
+		} else if last < i-1 {
+			// a gap in the selected ages can only be shown as a list
+			p.Data.CheckedRadio = list
+		}
+		last = i
+	}
 
-	for i, val := range p.Data.Ages {
-		if val.IsSelected {
-			for j := i; j < len(p.Data.Ages); j++ {
-				if p.Data.Ages[j].IsSelected {
-					continue
-				}
-				for k := j; k < len(p.Data.Ages); k++ {
-					if p.Data.Ages[k].IsSelected {
-						p.Data.CheckedRadio = list
-						break
-					}
-				}
-			}
+	if p.Data.CheckedRadio == strRange && first >= 0 {
+		p.Data.FirstSelected = ordered[first].Label
+		p.Data.LastSelected = ordered[last].Label
+	}
+
+	return p, nil
+}
+
+// ageBandWidths are the widths in years of the bands computed from the age options
+var ageBandWidths = []int{5, 10}
+
+// CreateAgeBandGroups maps the age options to the sets of bands that can be selected on the age page: bands of
+// ageBandWidths years, and the broad groups provided. Sets with fewer than two bands are left out, as are bands
+// that have no options. A band is selected when all of its options are.
+func CreateAgeBandGroups(allVals dataset.Options, selVals filter.DimensionOptions, broad []string) []model.AgeBands {
+	var opts []ages.Option
+	for i := range allVals.Items {
+		if a, ok := ages.Parse(allVals.Items[i].Label); ok {
+			opts = append(opts, ages.Option{Code: allVals.Items[i].Option, Label: allVals.Items[i].Label, Age: a})
 		}
 	}
+	ages.Sort(opts)
 
-	if p.Data.CheckedRadio == strRange {
-		for _, val := range p.Data.Ages {
-			if val.IsSelected {
-				if p.Data.FirstSelected == "" {
-					p.Data.FirstSelected = val.Label
-				}
-				p.Data.LastSelected = val.Label
+	selected := make(map[string]bool, len(selVals.Items))
+	for _, selVal := range selVals.Items {
+		selected[selVal.Option] = true
+	}
+
+	mapBands := func(title string, bands []ages.Band) model.AgeBands {
+		g := model.AgeBands{Title: title}
+		for _, b := range bands {
+			codes := b.Codes(opts)
+			if len(codes) == 0 {
+				continue
 			}
+			isSelected := true
+			for _, code := range codes {
+				isSelected = isSelected && selected[code]
+			}
+			label := fmt.Sprintf("%d to %d", b.Age.Youngest, b.Age.Oldest)
+			if b.Age.IsOpenEnded() {
+				label = fmt.Sprintf("%d and over", b.Age.Youngest)
+			}
+			g.Bands = append(g.Bands, model.AgeBand{Label: label, Value: b.Label, IsSelected: isSelected})
 		}
+		return g
 	}
 
-	return p, nil
+	var groups []model.AgeBands
+	for _, width := range ageBandWidths {
+		groups = append(groups, mapBands(fmt.Sprintf("%d year age bands", width), ages.Bands(opts, width)))
+	}
+	var broadBands []ages.Band
+	for _, label := range broad {
+		if b, ok := ages.ParseBand(label); ok {
+			broadBands = append(broadBands, b)
+		}
+	}
+	groups = append(groups, mapBands("Broad age groups", broadBands))
+
+	result := groups[:0]
+	for _, g := range groups {
+		if len(g.Bands) > 1 {
+			result = append(result, g)
+		}
+	}
+	return result
 }
 
 // CreateTimePage will create a time selector page based on api response models
@@ -565,9 +978,14 @@ func CreateTimePage(req *http.Request, bp core.Page, f filter.Model, d dataset.D
 		return p, nil
 	}
 
-	if _, err := time.Parse("Jan-06", allVals.Items[0].Option); err == nil {
-		p.Data.Type = "month"
+	format, ok := dates.Detect([]string{allVals.Items[0].Label})
+	if !ok {
+		return p, dates.ErrUnknownFormat
 	}
+	granularity := format.Granularity()
+	p.Data.Type = granularity.String()
+	p.Data.Format = format.Name()
+	p.Data.RelativeUnits = relativeUnits(granularity)
 
 	p.DatasetTitle = d.Title
 	p.FilterID = f.FilterID
@@ -613,65 +1031,70 @@ func CreateTimePage(req *http.Request, bp core.Page, f filter.Model, d dataset.D
 
 	p.Metadata.Title = "Time"
 
-	lookup := getNameIDLookup(allVals)
-
-	allTimes := []string{}
+	times := make([]dates.Option, 0, len(allVals.Items))
+	periods := make(map[string]dates.Period)
 	for i := range allVals.Items {
-		allTimes = append(allTimes, allVals.Items[i].Label)
-	}
-
-	times, err := dates.ConvertToReadable(allTimes)
-	if err != nil {
-		return p, err
+		period, err := format.Parse(allVals.Items[i].Label)
+		if err != nil {
+			return p, err
+		}
+		times = append(times, dates.Option{Code: allVals.Items[i].Option, Label: allVals.Items[i].Label, Period: period})
+		periods[allVals.Items[i].Option] = period
 	}
 
 	// sort just to find first and latest, but not to be used as the order in the UI
-	sortedTimes := make([]time.Time, len(times))
-	copy(sortedTimes, times)
-	dates.Sort(sortedTimes)
+	sortedTimes := slices.Clone(times)
+	dates.SortOptions(sortedTimes)
+	first, last := sortedTimes[0], sortedTimes[len(sortedTimes)-1]
 
 	p.Data.FirstTime = model.TimeValue{
-		Option: lookup[sortedTimes[0].Format("Jan-06")],
-		Month:  sortedTimes[0].Month().String(),
-		Year:   fmt.Sprintf("%d", sortedTimes[0].Year()),
+		Option: first.Code,
+		Month:  first.Period.Part(),
+		Year:   first.Period.YearLabel(),
+		Label:  first.Period.Label(),
 	}
 
 	p.Data.LatestTime = model.TimeValue{
-		Option: lookup[sortedTimes[len(sortedTimes)-1].Format("Jan-06")],
-		Month:  sortedTimes[len(sortedTimes)-1].Month().String(),
-		Year:   fmt.Sprintf("%d", sortedTimes[len(sortedTimes)-1].Year()),
+		Option: last.Code,
+		Month:  last.Period.Part(),
+		Year:   last.Period.YearLabel(),
+		Label:  last.Period.Label(),
 	}
 
-	firstYear := sortedTimes[0].Year()
-	lastYear := sortedTimes[len(sortedTimes)-1].Year()
-	diffYears := lastYear - firstYear
+	// days and weeks are chosen with date pickers rather than month and year selectors
+	if granularity.ChosenByDate() {
+		p.Data.DatePicker = true
+		p.Data.MinDate = first.Period.Start.Format(isoDate)
+		p.Data.MaxDate = last.Period.End().Format(isoDate)
+	}
 
 	p.Data.Years = append(p.Data.Years, "Select")
-	for i := 0; i < diffYears+1; i++ {
-		p.Data.Years = append(p.Data.Years, fmt.Sprintf("%d", firstYear+i))
+	for year := first.Period.Year(); year <= last.Period.Year(); year++ {
+		p.Data.Years = append(p.Data.Years, granularity.YearLabel(year))
 	}
 
-	p.Data.Months = append(p.Data.Months, "Select")
-	for i := 0; i < 12; i++ {
-		p.Data.Months = append(p.Data.Months, time.Month(i+1).String())
+	if parts := granularity.Parts(); len(parts) > 0 && !granularity.ChosenByDate() {
+		p.Data.Months = append(p.Data.Months, "Select")
+		p.Data.Months = append(p.Data.Months, parts...)
 	}
 
 	latestSelected := false
 	for _, val := range times {
 		var isSelected bool
 		for _, selVal := range selVals {
-			if val.Format("Jan-06") == selVal.Option {
+			if val.Code == selVal.Option {
 				isSelected = true
-				if val == sortedTimes[len(sortedTimes)-1] {
+				if val.Code == last.Code {
 					latestSelected = true
 				}
 			}
 		}
 
 		p.Data.Values = append(p.Data.Values, model.TimeValue{
-			Option:     lookup[val.Format("Jan-06")],
-			Month:      val.Month().String(),
-			Year:       fmt.Sprintf("%d", val.Year()),
+			Option:     val.Code,
+			Month:      val.Period.Part(),
+			Year:       val.Period.YearLabel(),
+			Label:      val.Period.Label(),
 			IsSelected: isSelected,
 		})
 	}
@@ -680,112 +1103,96 @@ func CreateTimePage(req *http.Request, bp core.Page, f filter.Model, d dataset.D
 		URL: fmt.Sprintf("/filters/%s/dimensions/time/update", f.FilterID),
 	}
 
+	sortedCodes := make([]string, 0, len(sortedTimes))
+	for _, val := range sortedTimes {
+		sortedCodes = append(sortedCodes, val.Code)
+	}
+
 	if len(selVals) == 1 && latestSelected {
 		p.Data.CheckedRadio = latest
 	} else if len(selVals) == 1 {
 		p.Data.CheckedRadio = single
-		date, err := time.Parse("Jan-06", selVals[0].Option)
-		if err != nil {
-			log.Warn(ctx, "unable to parse date", log.FormatErrors([]error{err}))
+		period, ok := periods[selVals[0].Option]
+		if !ok {
+			log.Warn(ctx, "selected time is not one of the dimension options", log.Data{"option": selVals[0].Option})
+		}
+		p.Data.SelectedStartMonth = period.Part()
+		p.Data.SelectedStartYear = period.YearLabel()
+		if ok && granularity.ChosenByDate() {
+			p.Data.SelectedStartDate = period.Start.Format(isoDate)
 		}
-		p.Data.SelectedStartMonth = date.Month().String()
-		p.Data.SelectedStartYear = fmt.Sprintf("%d", date.Year())
 	} else if len(selVals) == 0 {
 		p.Data.CheckedRadio = ""
 	} else if len(selVals) == len(allVals.Items) {
 		p.Data.CheckedRadio = list
 	} else {
-		if isTimeRange(sortedTimes, selVals) {
+		if isTimeRange(sortedCodes, selVals) {
 			p.Data.CheckedRadio = strRange
 		} else {
 			p.Data.CheckedRadio = list
 		}
 	}
 
-	if p.Data.CheckedRadio == strRange {
-		var selOptions []string
-		for _, val := range selVals {
-			selOptions = append(selOptions, val.Option)
+	var selected []dates.Option
+	for _, selVal := range selVals {
+		period, ok := periods[selVal.Option]
+		if !ok {
+			log.Warn(ctx, "selected time is not one of the dimension options", log.Data{"option": selVal.Option})
+			continue
 		}
+		selected = append(selected, dates.Option{Code: selVal.Option, Period: period})
+	}
+	dates.SortOptions(selected)
 
-		selDates, err := dates.ConvertToReadable(selOptions)
-		if err != nil {
-			log.Warn(ctx, "unable to convert dates to human readable values", log.FormatErrors([]error{err}))
+	if p.Data.CheckedRadio == strRange {
+		p.Data.SelectedStartMonth = selected[0].Period.Part()
+		p.Data.SelectedStartYear = selected[0].Period.YearLabel()
+		p.Data.SelectedEndMonth = selected[len(selected)-1].Period.Part()
+		p.Data.SelectedEndYear = selected[len(selected)-1].Period.YearLabel()
+		if granularity.ChosenByDate() {
+			p.Data.SelectedStartDate = selected[0].Period.Start.Format(isoDate)
+			p.Data.SelectedEndDate = selected[len(selected)-1].Period.End().Format(isoDate)
 		}
-
-		selDates = dates.Sort(selDates)
-
-		p.Data.SelectedStartMonth = selDates[0].Month().String()
-		p.Data.SelectedStartYear = fmt.Sprintf("%d", selDates[0].Year())
-		p.Data.SelectedEndMonth = selDates[len(selDates)-1].Month().String()
-		p.Data.SelectedEndYear = fmt.Sprintf("%d", selDates[len(selDates)-1].Year())
 	}
-	var minYear, maxYear string
+
 	var selectedMonths []string
-	for _, selVal := range selVals {
-		month, err := time.Parse("Jan-06", selVal.Option)
-		if err != nil {
-			log.Error(ctx, "unable to convert date to month value", err)
-			continue
-		}
-		monthStr := month.Format("January")
-		_, found := helpers.StringInSlice(monthStr, selectedMonths)
-		if !found {
-			selectedMonths = append(selectedMonths, monthStr)
-		}
-		yearStr := month.Format("2006")
-		if minYear == "" {
-			minYear = yearStr
-		}
-		if maxYear == "" {
-			maxYear = yearStr
-		}
-		yearInt, err := strconv.Atoi(yearStr)
-		if err != nil {
-			log.Error(ctx, "unable to convert year string to int for comparison", err)
-			continue
-		}
-		maxYearInt, err := strconv.Atoi(maxYear)
-		if err != nil {
-			log.Error(ctx, "unable to convert max year string to int for comparison", err)
-			continue
-		}
-		minYearInt, err := strconv.Atoi(minYear)
-		if err != nil {
-			log.Error(ctx, "unable to convert min year string to int for comparison", err)
-			continue
-		}
-		if yearInt > maxYearInt {
-			maxYear = yearStr
-		} else if yearInt < minYearInt {
-			minYear = yearStr
+	var grouped model.GroupedSelection
+	for _, val := range selected {
+		if !slices.Contains(selectedMonths, val.Period.Part()) {
+			selectedMonths = append(selectedMonths, val.Period.Part())
 		}
 	}
-	var listOfAllMonths []model.Month
-	numberOfMonthsInAYear := 12
-	for i := 0; i < numberOfMonthsInAYear; i++ {
-		monthName := time.Month(i + 1).String()
-		_, isSelected := helpers.StringInSlice(monthName, selectedMonths)
-		singleMonth := model.Month{
-			Name:       monthName,
-			IsSelected: isSelected,
-		}
-		listOfAllMonths = append(listOfAllMonths, singleMonth)
+	if len(selected) > 0 {
+		grouped.YearStart = selected[0].Period.YearLabel()
+		grouped.YearEnd = selected[len(selected)-1].Period.YearLabel()
 	}
-	GroupedSelection := model.GroupedSelection{
-		Months:    listOfAllMonths,
-		YearStart: minYear,
-		YearEnd:   maxYear,
+	for _, part := range granularity.Parts() {
+		grouped.Months = append(grouped.Months, model.Month{
+			Name:       part,
+			IsSelected: slices.Contains(selectedMonths, part),
+		})
 	}
-	p.Data.GroupedSelection = GroupedSelection
+	p.Data.GroupedSelection = grouped
 
 	return p, nil
 }
 
+// relativeUnits returns the units that the latest periods of a time dimension can be chosen in: its own periods,
+// and longer ones for the periods within a year
+func relativeUnits(g dates.Granularity) []string {
+	switch g {
+	case dates.Day:
+		return []string{g.String(), dates.Week.String(), dates.Month.String(), dates.Year.String()}
+	case dates.Week, dates.Month, dates.Quarter:
+		return []string{g.String(), dates.Year.String()}
+	}
+	return []string{g.String()}
+}
+
 // isTimeRange determines if the selected values define a single continuous range of sorted items
-// - sortedTimes is a list of times in the order against which we want to determine the range selection
-// - selVals is a list of selected Options, with the Option value having "Jan-06" format
-func isTimeRange(sortedTimes []time.Time, selVals []filter.DimensionOption) bool {
+// - sortedCodes is a list of time option codes in the order against which we want to determine the range selection
+// - selVals is a list of selected Options
+func isTimeRange(sortedCodes []string, selVals []filter.DimensionOption) bool {
 	// a range has to have at least two items
 	if len(selVals) < 2 {
 		return false
@@ -795,13 +1202,11 @@ func isTimeRange(sortedTimes []time.Time, selVals []filter.DimensionOption) bool
 	inRange := false
 	fullRangeFound := false
 
-	// iterate sortedTimes, we assume that the times are already sorted in the required order to determine the range
-	for _, val := range sortedTimes {
+	// iterate sortedCodes, we assume that the codes are already sorted in the required order to determine the range
+	for _, valueToFind := range sortedCodes {
 		// state variable to determine if val is selected
 		isSelected := false
 
-		valueToFind := val.Format("Jan-06")
-
 		// determine if the time value is selected
 		for _, selVal := range selVals {
 			// if this condition is satisfied, the value is selected
@@ -903,6 +1308,8 @@ func CreateHierarchySearchPage(req *http.Request, bp core.Page, items []search.I
 
 	p.Data.AddAllFilters.URL = curPath + "/add-all"
 	p.Data.RemoveAll.URL = curPath + "/remove-all"
+	p.Data.Paste = pasteLink(f.FilterID, name)
+	p.Data.Upload = uploadLink(f.FilterID, name)
 
 	for option, label := range selectedValueLabels {
 		p.Data.FiltersAdded = append(p.Data.FiltersAdded, model.Filter{
@@ -1087,7 +1494,15 @@ func CreateHierarchyPage(req *http.Request, bp core.Page, h hierarchyClient.Mode
 			break
 		}
 	}
+	for _, child := range h.Children {
+		if child.NumberofChildren > 0 {
+			p.Data.HasDescendants = true
+			break
+		}
+	}
 	p.Data.RemoveAll.URL = curPath + "/remove-all"
+	p.Data.Paste = pasteLink(f.FilterID, name)
+	p.Data.Upload = uploadLink(f.FilterID, name)
 
 	for option, label := range selectedValueLabels {
 		p.Data.FiltersAdded = append(p.Data.FiltersAdded, model.Filter{
@@ -1127,6 +1542,37 @@ func CreateHierarchyPage(req *http.Request, bp core.Page, h hierarchyClient.Mode
 	return p
 }
 
+// CreateHierarchyTree maps a node of a hierarchy and its children to the tree model, marking the selected options
+// and linking to the children of the nodes that have any
+func CreateHierarchyTree(h hierarchyClient.Model, selected filter.DimensionOptions, filterID, name string) model.HierarchyTree {
+	selectedCodes := make(map[string]bool, len(selected.Items))
+	for _, opt := range selected.Items {
+		selectedCodes[opt.Option] = true
+	}
+
+	tree := model.HierarchyTree{
+		Code:     h.Links.Code.ID,
+		Label:    h.Label,
+		HasData:  h.HasData,
+		Selected: selectedCodes[h.Links.Code.ID],
+		Children: make([]model.TreeNode, 0, len(h.Children)),
+	}
+	for _, child := range h.Children {
+		node := model.TreeNode{
+			Code:             child.Links.Code.ID,
+			Label:            child.Label,
+			HasData:          child.HasData,
+			Selected:         selectedCodes[child.Links.Code.ID],
+			NumberOfChildren: child.NumberofChildren,
+		}
+		if child.NumberofChildren > 0 {
+			node.URL = fmt.Sprintf("/filters/%s/dimensions/%s/tree.json?code=%s", filterID, name, url.QueryEscape(child.Links.Code.ID))
+		}
+		tree.Children = append(tree.Children, node)
+	}
+	return tree
+}
+
 // mapCookiePreferences reads cookie policy and preferences cookies and then maps the values to the page model
 func mapCookiePreferences(req *http.Request, preferencesIsSet *bool, policy *core.CookiesPolicy) {
 	preferencesCookie := cookies.GetONSCookiePreferences(req)
@@ -4,15 +4,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/ONSdigital/dp-api-clients-go/v2/dataset"
 	"github.com/ONSdigital/dp-api-clients-go/v2/filter"
 	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
 	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/model"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/ordinal"
 	dprequest "github.com/ONSdigital/dp-net/v3/request"
 	core "github.com/ONSdigital/dp-renderer/v2/model"
 	. "github.com/smartystreets/goconvey/convey"
@@ -778,6 +780,14 @@ func TestCreateHierarchyPage(t *testing.T) {
 			},
 			DimensionName: "DatasetTitle",
 			SearchURL:     "/filters/12349876/dimensions/datasetTitle/search",
+			Paste: model.Link{
+				URL:   "/filters/12349876/dimensions/datasetTitle/paste",
+				Label: "Add from a list",
+			},
+			Upload: model.Link{
+				URL:   "/filters/12349876/dimensions/datasetTitle/list",
+				Label: "Upload a CSV file",
+			},
 		}
 		testHierarchyPage.FilterID = "12349876"
 
@@ -823,26 +833,30 @@ func getExpectedTimePage(datasetID, filterID, lang string) model.Time {
 			LatestTime: model.TimeValue{
 				Month:      "April",
 				Year:       "2007",
+				Label:      "April 2007",
 				Option:     "Apr-07",
 				IsSelected: false,
 			},
 			FirstTime: model.TimeValue{
 				Month:      "April",
 				Year:       "2005",
+				Label:      "April 2005",
 				Option:     "Apr-05",
 				IsSelected: false,
 			},
 			Values: []model.TimeValue{
-				{Month: "April", Year: "2007", Option: "Apr-07", IsSelected: false},
-				{Month: "April", Year: "2005", Option: "Apr-05", IsSelected: false},
-				{Month: "April", Year: "2006", Option: "Apr-06", IsSelected: false},
-				{Month: "June", Year: "2005", Option: "Jun-05", IsSelected: false},
-				{Month: "May", Year: "2005", Option: "May-05", IsSelected: false},
+				{Month: "April", Year: "2007", Label: "April 2007", Option: "Apr-07", IsSelected: false},
+				{Month: "April", Year: "2005", Label: "April 2005", Option: "Apr-05", IsSelected: false},
+				{Month: "April", Year: "2006", Label: "April 2006", Option: "Apr-06", IsSelected: false},
+				{Month: "June", Year: "2005", Label: "June 2005", Option: "Jun-05", IsSelected: false},
+				{Month: "May", Year: "2005", Label: "May 2005", Option: "May-05", IsSelected: false},
 			},
-			Months:     []string{"Select", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
-			Years:      []string{"Select", "2005", "2006", "2007"},
-			FormAction: model.Link{Label: "", URL: "/filters/12349876/dimensions/time/update"},
-			Type:       "month",
+			Months:        []string{"Select", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+			Years:         []string{"Select", "2005", "2006", "2007"},
+			FormAction:    model.Link{Label: "", URL: "/filters/12349876/dimensions/time/update"},
+			Type:          "month",
+			Format:        "Jan-06",
+			RelativeUnits: []string{"month", "year"},
 			GroupedSelection: model.GroupedSelection{
 				Months: []model.Month{
 					{
@@ -933,17 +947,7 @@ func getExpectedTimePage(datasetID, filterID, lang string) model.Time {
 }
 
 func TestIsTimeRange(t *testing.T) {
-	t0, _ := time.Parse("Jan-06", "Jan-21")
-	t1, _ := time.Parse("Jan-06", "Feb-21")
-	t2, _ := time.Parse("Jan-06", "Mar-21")
-	t3, _ := time.Parse("Jan-06", "Apr-21")
-	t4, _ := time.Parse("Jan-06", "May-21")
-	t5, _ := time.Parse("Jan-06", "Jun-21")
-	t6, _ := time.Parse("Jan-06", "Jul-21")
-	t7, _ := time.Parse("Jan-06", "Aug-21")
-	t8, _ := time.Parse("Jan-06", "Sep-21")
-	t9, _ := time.Parse("Jan-06", "Oct-21")
-	sortedTimes := []time.Time{t0, t1, t2, t3, t4, t5, t6, t7, t8, t9}
+	sortedTimes := []string{"Jan-21", "Feb-21", "Mar-21", "Apr-21", "May-21", "Jun-21", "Jul-21", "Aug-21", "Sep-21", "Oct-21"}
 
 	Convey("Given an empty array of selected values", t, func() {
 		selVals := []filter.DimensionOption{}
@@ -1066,7 +1070,7 @@ func TestCreateTimePage(t *testing.T) {
 		emergencyBanner := getTestEmergencyBanner()
 
 		expected := getExpectedTimePage(datasetID, filterModel.FilterID, lang)
-		expected.Data.Values[1] = model.TimeValue{Month: "April", Year: "2005", Option: "Apr-05", IsSelected: true}
+		expected.Data.Values[1] = model.TimeValue{Month: "April", Year: "2005", Label: "April 2005", Option: "Apr-05", IsSelected: true}
 		expected.Data.CheckedRadio = "single"
 		expected.Data.SelectedStartMonth = "April"
 		expected.Data.SelectedStartYear = "2005"
@@ -1094,7 +1098,7 @@ func TestCreateTimePage(t *testing.T) {
 		emergencyBnr := getTestEmergencyBanner()
 
 		expected := getExpectedTimePage(datasetID, filterModel.FilterID, lang)
-		expected.Data.Values[0] = model.TimeValue{Month: "April", Year: "2007", Option: "Apr-07", IsSelected: true}
+		expected.Data.Values[0] = model.TimeValue{Month: "April", Year: "2007", Label: "April 2007", Option: "Apr-07", IsSelected: true}
 		expected.Data.CheckedRadio = "latest"
 		expected.Data.GroupedSelection.Months[3] = model.Month{
 			Name:       "April",
@@ -1121,8 +1125,8 @@ func TestCreateTimePage(t *testing.T) {
 		emergencyBnr := getTestEmergencyBanner()
 
 		expected := getExpectedTimePage(datasetID, filterModel.FilterID, lang)
-		expected.Data.Values[0] = model.TimeValue{Month: "April", Year: "2007", Option: "Apr-07", IsSelected: true}
-		expected.Data.Values[1] = model.TimeValue{Month: "April", Year: "2005", Option: "Apr-05", IsSelected: true}
+		expected.Data.Values[0] = model.TimeValue{Month: "April", Year: "2007", Label: "April 2007", Option: "Apr-07", IsSelected: true}
+		expected.Data.Values[1] = model.TimeValue{Month: "April", Year: "2005", Label: "April 2005", Option: "Apr-05", IsSelected: true}
 		expected.Data.CheckedRadio = "list"
 		expected.Data.GroupedSelection.Months[3] = model.Month{
 			Name:       "April",
@@ -1150,9 +1154,9 @@ func TestCreateTimePage(t *testing.T) {
 		versionDimensions := dataset.VersionDimensions{Items: getTestDatasetDimensions()}
 
 		expected := getExpectedTimePage(datasetID, filterModel.FilterID, lang)
-		expected.Data.Values[1] = model.TimeValue{Month: "April", Year: "2005", Option: "Apr-05", IsSelected: true}
-		expected.Data.Values[4] = model.TimeValue{Month: "May", Year: "2005", Option: "May-05", IsSelected: true}
-		expected.Data.Values[3] = model.TimeValue{Month: "June", Year: "2005", Option: "Jun-05", IsSelected: true}
+		expected.Data.Values[1] = model.TimeValue{Month: "April", Year: "2005", Label: "April 2005", Option: "Apr-05", IsSelected: true}
+		expected.Data.Values[4] = model.TimeValue{Month: "May", Year: "2005", Label: "May 2005", Option: "May-05", IsSelected: true}
+		expected.Data.Values[3] = model.TimeValue{Month: "June", Year: "2005", Label: "June 2005", Option: "Jun-05", IsSelected: true}
 		expected.Data.CheckedRadio = "range"
 		expected.Data.GroupedSelection.Months[3] = model.Month{
 			Name:       "April",
@@ -1203,6 +1207,99 @@ func TestCreateTimePage(t *testing.T) {
 		So(err, ShouldNotBeNil)
 		So(err.Error(), ShouldEqual, "parsing time \"wrongFormat\" as \"Jan-06\": cannot parse \"wrongFormat\" as \"Jan\"")
 	})
+
+	Convey("Given quarterly options with a range of them selected, then CreateTimePage chooses them by quarter and year", t, func() {
+		options := dataset.Options{Items: []dataset.Option{
+			{Label: "2019 Q4", Option: "2019-q4"},
+			{Label: "2020 Q1", Option: "2020-q1"},
+			{Label: "2020 Q2", Option: "2020-q2"},
+			{Label: "2020 Q3", Option: "2020-q3"},
+		}}
+		selectedOptions := []filter.DimensionOption{{Option: "2020-q1"}, {Option: "2019-q4"}}
+
+		timeModelPage, err := CreateTimePage(req, bp, getTestFilter(), getTestDataset(), options, selectedOptions, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
+		So(err, ShouldBeNil)
+		So(timeModelPage.Data.Type, ShouldEqual, "quarter")
+		So(timeModelPage.Data.Format, ShouldEqual, "2006 Q1")
+		So(timeModelPage.Data.Months, ShouldResemble, []string{"Select", "Q1", "Q2", "Q3", "Q4"})
+		So(timeModelPage.Data.Years, ShouldResemble, []string{"Select", "2019", "2020"})
+		So(timeModelPage.Data.LatestTime, ShouldResemble, model.TimeValue{Month: "Q3", Year: "2020", Label: "Q3 2020", Option: "2020-q3"})
+		So(timeModelPage.Data.CheckedRadio, ShouldEqual, "range")
+		So(timeModelPage.Data.SelectedStartMonth, ShouldEqual, "Q4")
+		So(timeModelPage.Data.SelectedStartYear, ShouldEqual, "2019")
+		So(timeModelPage.Data.SelectedEndMonth, ShouldEqual, "Q1")
+		So(timeModelPage.Data.SelectedEndYear, ShouldEqual, "2020")
+	})
+
+	Convey("Given financial year options, then CreateTimePage chooses them by year only", t, func() {
+		options := dataset.Options{Items: []dataset.Option{
+			{Label: "2020-21", Option: "2020-21"},
+			{Label: "2018-19", Option: "2018-19"},
+			{Label: "2019-20", Option: "2019-20"},
+		}}
+		selectedOptions := []filter.DimensionOption{{Option: "2018-19"}}
+
+		timeModelPage, err := CreateTimePage(req, bp, getTestFilter(), getTestDataset(), options, selectedOptions, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
+		So(err, ShouldBeNil)
+		So(timeModelPage.Data.Type, ShouldEqual, "financial year")
+		So(timeModelPage.Data.Months, ShouldBeNil)
+		So(timeModelPage.Data.Years, ShouldResemble, []string{"Select", "2018-19", "2019-20", "2020-21"})
+		So(timeModelPage.Data.FirstTime, ShouldResemble, model.TimeValue{Year: "2018-19", Label: "2018-19", Option: "2018-19"})
+		So(timeModelPage.Data.CheckedRadio, ShouldEqual, "single")
+		So(timeModelPage.Data.SelectedStartYear, ShouldEqual, "2018-19")
+		So(timeModelPage.Data.GroupedSelection, ShouldResemble, model.GroupedSelection{YearStart: "2018-19", YearEnd: "2018-19"})
+	})
+
+	Convey("Given daily options with a range of them selected, then CreateTimePage chooses them with date pickers", t, func() {
+		options := dataset.Options{Items: []dataset.Option{
+			{Label: "2020-12-31", Option: "2020-12-31"},
+			{Label: "2021-01-01", Option: "2021-01-01"},
+			{Label: "2021-01-02", Option: "2021-01-02"},
+			{Label: "2021-01-04", Option: "2021-01-04"},
+		}}
+		selectedOptions := []filter.DimensionOption{{Option: "2021-01-02"}, {Option: "2021-01-01"}}
+
+		timeModelPage, err := CreateTimePage(req, bp, getTestFilter(), getTestDataset(), options, selectedOptions, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
+		So(err, ShouldBeNil)
+		So(timeModelPage.Data.Type, ShouldEqual, "day")
+		So(timeModelPage.Data.DatePicker, ShouldBeTrue)
+		So(timeModelPage.Data.MinDate, ShouldEqual, "2020-12-31")
+		So(timeModelPage.Data.MaxDate, ShouldEqual, "2021-01-04")
+		So(timeModelPage.Data.Months, ShouldBeNil)
+		So(timeModelPage.Data.LatestTime.Label, ShouldEqual, "4 January 2021")
+		So(timeModelPage.Data.CheckedRadio, ShouldEqual, "range")
+		So(timeModelPage.Data.SelectedStartDate, ShouldEqual, "2021-01-01")
+		So(timeModelPage.Data.SelectedEndDate, ShouldEqual, "2021-01-02")
+		So(timeModelPage.Data.GroupedSelection.Months[4], ShouldResemble, model.Month{Name: "Friday", IsSelected: true})
+		So(timeModelPage.Data.RelativeUnits, ShouldResemble, []string{"day", "week", "month", "year"})
+	})
+
+	Convey("Given weekly options, then CreateTimePage lists them by ISO week and year", t, func() {
+		options := dataset.Options{Items: []dataset.Option{
+			{Label: "2020-W52", Option: "2020-W52"},
+			{Label: "2020-W53", Option: "2020-W53"},
+			{Label: "2021-W01", Option: "2021-W01"},
+		}}
+		selectedOptions := []filter.DimensionOption{{Option: "2020-W53"}}
+
+		timeModelPage, err := CreateTimePage(req, bp, getTestFilter(), getTestDataset(), options, selectedOptions, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
+		So(err, ShouldBeNil)
+		So(timeModelPage.Data.Type, ShouldEqual, "week")
+		So(timeModelPage.Data.DatePicker, ShouldBeTrue)
+		So(timeModelPage.Data.MaxDate, ShouldEqual, "2021-01-10")
+		So(timeModelPage.Data.Years, ShouldResemble, []string{"Select", "2020", "2021"})
+		So(timeModelPage.Data.CheckedRadio, ShouldEqual, "single")
+		So(timeModelPage.Data.SelectedStartDate, ShouldEqual, "2020-12-28")
+		So(timeModelPage.Data.GroupedSelection.Months, ShouldHaveLength, 53)
+		So(timeModelPage.Data.GroupedSelection.Months[52], ShouldResemble, model.Month{Name: "Week 53", IsSelected: true})
+	})
+
+	Convey("Given options in a format that isn't recognised, then CreateTimePage returns the expected error", t, func() {
+		options := dataset.Options{Items: []dataset.Option{{Label: "Spring term", Option: "spring"}}}
+
+		_, err := CreateTimePage(req, bp, getTestFilter(), getTestDataset(), options, []filter.DimensionOption{}, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
+		So(err, ShouldEqual, dates.ErrUnknownFormat)
+	})
 }
 
 // getTestDatasetAgeOptions returns an age dataset.Options for testing, with items sorted in a an order that is not from youngest to oldest
@@ -1420,8 +1517,8 @@ func TestCreateAgePage(t *testing.T) {
 					{Label: "90", Option: "90", IsSelected: true},
 				}
 				expectedPageModel.Data.CheckedRadio = "range"
-				expectedPageModel.Data.FirstSelected = "20"
-				expectedPageModel.Data.LastSelected = "90"
+				expectedPageModel.Data.FirstSelected = "10"
+				expectedPageModel.Data.LastSelected = "100+"
 				ageModelPage, err := CreateAgePage(req, bp, filterModel, datasetDetails, allOptions, selectedOptions, versionDimensions, datasetID, apiRouterVersion, lang, serviceMessage, emergencyBanner)
 				So(err, ShouldBeNil)
 				So(ageModelPage, ShouldResemble, expectedPageModel)
@@ -1478,6 +1575,32 @@ func TestCreateAgePage(t *testing.T) {
 		})
 	})
 
+	Convey("Given age options with banded and open-ended labels, and a range of them selected", t, func() {
+		req := httptest.NewRequest("", "/", http.NoBody)
+		allOptions := dataset.Options{Items: []dataset.Option{
+			{Label: "Total", Option: "T"},
+			{Label: "Aged 85 and over", Option: "85+"},
+			{Label: "Aged 5 to 9", Option: "5-9"},
+			{Label: "Under 1", Option: "0"},
+			{Label: "1-4", Option: "1-4"},
+		}}
+		selectedOptions := filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "1-4"}, {Option: "5-9"}}}
+
+		ageModelPage, err := CreateAgePage(req, bp, getTestFilter(), getTestDataset(), allOptions, selectedOptions, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
+
+		Convey("Then the youngest and oldest ages, and the selected range, are found from their labels", func() {
+			So(err, ShouldBeNil)
+			So(ageModelPage.Data.HasAllAges, ShouldBeTrue)
+			So(ageModelPage.Data.AllAgesOption, ShouldEqual, "T")
+			So(ageModelPage.Data.Youngest, ShouldEqual, "Under 1")
+			So(ageModelPage.Data.Oldest, ShouldEqual, "Aged 85 and over")
+			So(ageModelPage.Data.CheckedRadio, ShouldEqual, "range")
+			So(ageModelPage.Data.FirstSelected, ShouldEqual, "1-4")
+			So(ageModelPage.Data.LastSelected, ShouldEqual, "Aged 5 to 9")
+			So(ageModelPage.Data.Ages, ShouldHaveLength, 4)
+		})
+	})
+
 	Convey("calling CreateAgePage with nil request results in an empty age page being generated and the expected error being returned", t, func() {
 		ageModelPage, err := CreateAgePage(nil, bp, filter.Model{}, dataset.DatasetDetails{}, dataset.Options{}, filter.DimensionOptions{}, dataset.VersionDimensions{}, datasetID, apiRouterVersion, lang, "", zebedee.EmergencyBanner{})
 		So(err, ShouldNotBeNil)
@@ -1525,3 +1648,103 @@ func returnCorrectlyFormedEmergencyBanner() zebedee.EmergencyBanner {
 func getTestServiceMessage() string {
 	return "Test service message"
 }
+
+func TestCreateVersionChangesPage(t *testing.T) {
+	Convey("CreateVersionChangesPage maps the changed options of each dimension to the page model", t, func() {
+		req := httptest.NewRequest("GET", "/filters/12345/use-latest-version", http.NoBody)
+		dst := dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}
+		changes := []model.DimensionChanges{
+			{Name: "aggregate", Label: "Aggregate", Dropped: []string{"Bread"}},
+			{Name: "geography", Added: []string{"Wales"}},
+		}
+
+		p := CreateVersionChangesPage(req, core.Page{}, dst, changes, "67890", "cpih01", "time-series", "2", dprequest.DefaultLang, "", zebedee.EmergencyBanner{})
+
+		So(p.Metadata.Title, ShouldEqual, "Changes to your filter options")
+		So(p.DatasetTitle, ShouldEqual, "CPIH")
+		So(p.Data.FilterID, ShouldEqual, "67890")
+		So(p.Data.Edition, ShouldEqual, "time-series")
+		So(p.Data.Version, ShouldEqual, "2")
+		So(p.Data.Continue.URL, ShouldEqual, "/filters/67890/dimensions")
+		So(p.Breadcrumb, ShouldHaveLength, 3)
+		So(p.Breadcrumb[1].URI, ShouldEqual, "/datasets/cpih01/editions/time-series/versions/2")
+		So(p.Data.Dimensions, ShouldHaveLength, 2)
+		So(p.Data.Dimensions[0].Label, ShouldEqual, "Aggregate")
+		So(p.Data.Dimensions[1].Label, ShouldEqual, "geography")
+		So(p.Data.Dimensions[1].Added, ShouldResemble, []string{"Wales"})
+	})
+}
+
+func TestCreatePasteResultsPage(t *testing.T) {
+	Convey("CreatePasteResultsPage maps the added options and the unmatched entries to the page model", t, func() {
+		req := httptest.NewRequest("POST", "/filters/12345/dimensions/geography/paste", http.NoBody)
+		dst := dataset.DatasetDetails{ID: "cpih01", Title: "CPIH"}
+		dims := dataset.VersionDimensions{Items: dataset.VersionDimensionItems{{Name: "geography", Label: "Geographic area"}}}
+
+		p := CreatePasteResultsPage(req, core.Page{}, dst, dims, []string{"Wales"}, []string{"Atlantis"}, []string{"Newport"}, "12345", "geography", "cpih01", "time-series", "2", dprequest.DefaultLang, "", zebedee.EmergencyBanner{})
+
+		So(p.Metadata.Title, ShouldEqual, "Options added to Geographic area")
+		So(p.DatasetTitle, ShouldEqual, "CPIH")
+		So(p.Data.DimensionLabel, ShouldEqual, "Geographic area")
+		So(p.Data.Added, ShouldResemble, []string{"Wales"})
+		So(p.Data.Unmatched, ShouldResemble, []string{"Atlantis"})
+		So(p.Data.Ambiguous, ShouldResemble, []string{"Newport"})
+		So(p.Data.Continue.URL, ShouldEqual, "/filters/12345/dimensions/geography")
+		So(p.Breadcrumb, ShouldHaveLength, 4)
+		So(p.Breadcrumb[2].URI, ShouldEqual, "/filters/12345/dimensions")
+	})
+}
+
+func TestCreateOrdinalRange(t *testing.T) {
+	Convey("CreateOrdinalRange maps the ordered options to a range from the first to the last selected option", t, func() {
+		ordered := []ordinal.Option{{Code: "1", Label: "1 person"}, {Code: "2", Label: "2 people"}, {Code: "3", Label: "3 people"}, {Code: "4", Label: "4 or more people"}}
+		selected := []filter.DimensionOption{{Option: "3"}, {Option: "2"}}
+
+		r := CreateOrdinalRange("12345", "household-size", ordered, selected)
+
+		So(r.URL, ShouldEqual, "/filters/12345/dimensions/household-size/range")
+		So(r.From, ShouldEqual, "2")
+		So(r.To, ShouldEqual, "3")
+		So(r.Values, ShouldHaveLength, 4)
+		So(r.Values[0], ShouldResemble, model.Value{Label: "1 person", ID: "1"})
+		So(r.Values[1].IsSelected, ShouldBeTrue)
+	})
+}
+
+func TestCreateAgeBandGroups(t *testing.T) {
+	Convey("CreateAgeBandGroups maps single year ages to 5 and 10 year bands and the broad groups", t, func() {
+		allOptions := dataset.Options{Items: []dataset.Option{{Label: "Total", Option: "T"}}}
+		for i := 0; i < 20; i++ {
+			allOptions.Items = append(allOptions.Items, dataset.Option{Label: strconv.Itoa(i), Option: strconv.Itoa(i)})
+		}
+		allOptions.Items = append(allOptions.Items, dataset.Option{Label: "20+", Option: "20+"})
+		selectedOptions := filter.DimensionOptions{Items: []filter.DimensionOption{{Option: "5"}, {Option: "6"}, {Option: "7"}, {Option: "8"}, {Option: "9"}, {Option: "10"}}}
+
+		groups := CreateAgeBandGroups(allOptions, selectedOptions, []string{"0-15", "16+", "working age"})
+
+		So(groups, ShouldHaveLength, 3)
+		So(groups[0].Title, ShouldEqual, "5 year age bands")
+		So(groups[0].Bands, ShouldResemble, []model.AgeBand{
+			{Label: "0 to 4", Value: "0-4"},
+			{Label: "5 to 9", Value: "5-9", IsSelected: true},
+			{Label: "10 to 14", Value: "10-14"},
+			{Label: "15 to 19", Value: "15-19"},
+			{Label: "20 and over", Value: "20+"},
+		})
+		So(groups[1].Bands, ShouldHaveLength, 3)
+		So(groups[2].Title, ShouldEqual, "Broad age groups")
+		So(groups[2].Bands, ShouldResemble, []model.AgeBand{
+			{Label: "0 to 15", Value: "0-15"},
+			{Label: "16 and over", Value: "16+"},
+		})
+	})
+
+	Convey("CreateAgeBandGroups leaves out the sets of bands with fewer than two bands", t, func() {
+		allOptions := dataset.Options{Items: []dataset.Option{{Label: "0-15", Option: "a"}, {Label: "16-64", Option: "b"}, {Label: "65+", Option: "c"}}}
+
+		groups := CreateAgeBandGroups(allOptions, filter.DimensionOptions{}, []string{"0-15", "16-64", "65+"})
+
+		So(groups, ShouldHaveLength, 1)
+		So(groups[0].Title, ShouldEqual, "Broad age groups")
+	})
+}
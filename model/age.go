@@ -11,16 +11,33 @@ type Age struct {
 
 // Data represents the data for the age page
 type AgeData struct {
-	Youngest       string     `json:"youngest"`
-	Oldest         string     `json:"oldest"`
-	FirstSelected  string     `json:"first_selected"`
-	LastSelected   string     `json:"last_selected"`
-	Ages           []AgeValue `json:"ages"`
-	CheckedRadio   string     `json:"checked_radio"`
-	FormAction     Link       `json:"form_action"`
-	HasAllAges     bool       `json:"has_all_ages"`
-	AllAgesOption  string     `json:"all_ages_option"`
-	FeedbackAPIURL string     `json:"feedback_api_url"`
+	Youngest       string            `json:"youngest"`
+	Oldest         string            `json:"oldest"`
+	FirstSelected  string            `json:"first_selected"`
+	LastSelected   string            `json:"last_selected"`
+	Ages           []AgeValue        `json:"ages"`
+	CheckedRadio   string            `json:"checked_radio"`
+	FormAction     Link              `json:"form_action"`
+	HasAllAges     bool              `json:"has_all_ages"`
+	AllAgesOption  string            `json:"all_ages_option"`
+	FeedbackAPIURL string            `json:"feedback_api_url"`
+	ETag           string            `json:"etag"`
+	Undo           Link              `json:"undo"`
+	BandGroups     []AgeBands        `json:"band_groups"`
+	FieldErrors    map[string]string `json:"field_errors,omitempty"`
+}
+
+// AgeBands represents a set of bands of ages, such as 5 year bands, that can be selected instead of single ages
+type AgeBands struct {
+	Title string    `json:"title"`
+	Bands []AgeBand `json:"bands"`
+}
+
+// AgeBand represents a single band of ages
+type AgeBand struct {
+	Label      string `json:"label"`
+	Value      string `json:"value"`
+	IsSelected bool   `json:"is_selected"`
 }
 
 // Value represents a single age value
@@ -0,0 +1,26 @@
+package model
+
+import core "github.com/ONSdigital/dp-renderer/v2/model"
+
+// VersionChanges represents the data for the page listing the options affected by moving a filter to another version
+type VersionChanges struct {
+	core.Page
+	Data VersionChangesPage `json:"data"`
+}
+
+// VersionChangesPage represents the metadata for a version changes page
+type VersionChangesPage struct {
+	FilterID   string             `json:"filter_id"`
+	Edition    string             `json:"edition"`
+	Version    string             `json:"version"`
+	Dimensions []DimensionChanges `json:"dimensions"`
+	Continue   Link               `json:"continue"`
+}
+
+// DimensionChanges represents the options of a single dimension that were dropped from, or added to, the filter's version
+type DimensionChanges struct {
+	Name    string   `json:"name"`
+	Label   string   `json:"label"`
+	Dropped []string `json:"dropped"`
+	Added   []string `json:"added"`
+}
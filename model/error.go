@@ -0,0 +1,20 @@
+package model
+
+import (
+	core "github.com/ONSdigital/dp-renderer/v2/model"
+)
+
+// FilterError represents the data to display one of the filter error pages
+type FilterError struct {
+	core.Page
+	Data FilterErrorPage `json:"data"`
+}
+
+// FilterErrorPage represents the links the user can follow to recover from a filter error
+type FilterErrorPage struct {
+	FilterID   string `json:"filter_id,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	DatasetURL string `json:"dataset_url,omitempty"`
+	FilterURL  string `json:"filter_url,omitempty"`
+	RetryURL   string `json:"retry_url,omitempty"`
+}
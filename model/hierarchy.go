@@ -31,7 +31,12 @@ type HierarchyData struct {
 	IsSearchError   bool     `json:"is_search_error"`
 	LandingPageURL  string   `json:"landing_page_url"`
 	HasData         bool     `json:"has_data"`
+	HasDescendants  bool     `json:"has_descendants"`
 	FeedbackAPIURL  string   `json:"feedback_api_url"`
+	Undo            Link     `json:"undo"`
+	Paste           Link     `json:"paste"`
+	Upload          Link     `json:"upload"`
+	ETag            string   `json:"etag"`
 }
 
 // AddAll represents the data to add all options
@@ -56,3 +61,23 @@ type List struct {
 	SubURL   string `json:"sub_url"`
 	HasData  bool   `json:"has_data"`
 }
+
+// HierarchyTree represents a node of a hierarchy with its children, for tree widgets to expand nodes in place
+type HierarchyTree struct {
+	Code     string     `json:"code"`
+	Label    string     `json:"label"`
+	HasData  bool       `json:"has_data"`
+	Selected bool       `json:"selected"`
+	Children []TreeNode `json:"children"`
+	ETag     string     `json:"etag"`
+}
+
+// TreeNode represents a child of a node in a hierarchy tree. URL is the link to its own children, if it has any
+type TreeNode struct {
+	Code             string `json:"code"`
+	Label            string `json:"label"`
+	HasData          bool   `json:"has_data"`
+	Selected         bool   `json:"selected"`
+	NumberOfChildren int    `json:"number_of_children"`
+	URL              string `json:"url,omitempty"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import core "github.com/ONSdigital/dp-renderer/v2/model"
+
+// ImportResults represents the data for the page listing the imported options that no longer exist in the dataset version
+type ImportResults struct {
+	core.Page
+	Data ImportResultsPage `json:"data"`
+}
+
+// ImportResultsPage represents the metadata for an import results page
+type ImportResultsPage struct {
+	FilterID   string             `json:"filter_id"`
+	Edition    string             `json:"edition"`
+	Version    string             `json:"version"`
+	Dimensions []DimensionChanges `json:"dimensions"`
+	Continue   Link               `json:"continue"`
+}
@@ -20,6 +20,10 @@ type FilterOverview struct {
 	DatasetTitle       string        `json:"dataset_title"`
 	HasUnsetDimensions bool          `json:"has_unset_dimensions"`
 	FeedbackAPIURL     string        `json:"feedback_api_url"`
+	Undo               Link          `json:"undo"`
+	Share              Link          `json:"share"`
+	Export             Link          `json:"export"`
+	Import             Link          `json:"import"`
 }
 
 // Dimension represents the data for a single dimension
@@ -0,0 +1,20 @@
+package model
+
+import core "github.com/ONSdigital/dp-renderer/v2/model"
+
+// PasteResults represents the data for the page listing the outcome of pasting a list of options into a dimension
+type PasteResults struct {
+	core.Page
+	Data PasteResultsPage `json:"data"`
+}
+
+// PasteResultsPage represents the metadata for a paste results page
+type PasteResultsPage struct {
+	FilterID       string   `json:"filter_id"`
+	DimensionName  string   `json:"dimension_name"`
+	DimensionLabel string   `json:"dimension_label"`
+	Added          []string `json:"added"`
+	Unmatched      []string `json:"unmatched"`
+	Ambiguous      []string `json:"ambiguous"`
+	Continue       Link     `json:"continue"`
+}
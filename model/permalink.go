@@ -0,0 +1,38 @@
+package model
+
+import core "github.com/ONSdigital/dp-renderer/v2/model"
+
+// Permalink represents the data for the page showing the link that recreates the selections of a filter
+type Permalink struct {
+	core.Page
+	Data PermalinkPage `json:"data"`
+}
+
+// PermalinkPage represents the metadata for a permalink page
+type PermalinkPage struct {
+	FilterID string `json:"filter_id"`
+	URL      string `json:"url"`
+	Back     Link   `json:"back"`
+}
+
+// NewFilter represents the data for the page a permalink opens, asking the user to confirm the new filter is started
+type NewFilter struct {
+	core.Page
+	Data NewFilterPage `json:"data"`
+}
+
+// NewFilterPage represents the metadata for a new filter page. The encoded selections are posted back to start the filter.
+type NewFilterPage struct {
+	Spec       string               `json:"spec"`
+	Dimensions []PermalinkDimension `json:"dimensions"`
+	Submit     Link                 `json:"submit"`
+	Cancel     Link                 `json:"cancel"`
+}
+
+// PermalinkDimension represents the options of a dimension selected by a permalink
+type PermalinkDimension struct {
+	Name    string `json:"name"`
+	Label   string `json:"label"`
+	All     bool   `json:"all"`
+	Options int    `json:"options"`
+}
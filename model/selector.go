@@ -23,6 +23,19 @@ type ListSelector struct {
 	RemoveAll     Link     `json:"remove_all"`
 	RangeData     Range    `json:"range_values"`
 	DatasetTitle  string   `json:"dataset_title"`
+	ETag          string   `json:"etag"`
+	Undo          Link     `json:"undo"`
+	Paste         Link     `json:"paste"`
+	Upload        Link     `json:"upload"`
+	OrdinalRange  Ordinal  `json:"ordinal_range"`
+}
+
+// Ordinal represents the data to select a range of options of a dimension with ordered options
+type Ordinal struct {
+	URL    string  `json:"url"`
+	Values []Value `json:"values"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
 }
 
 // Range represents the data to display a range
@@ -11,27 +11,40 @@ type Time struct {
 
 // Data represents the metadata for the time page
 type TimeData struct {
-	LatestTime         TimeValue        `json:"latest_value"`
-	FirstTime          TimeValue        `json:"fist_time"`
-	Values             []TimeValue      `json:"values"`
-	Months             []string         `json:"months"`
-	Years              []string         `json:"years"`
-	CheckedRadio       string           `json:"checked_radio"`
-	FormAction         Link             `json:"form_action"`
-	SelectedStartMonth string           `json:"selected_start_month"`
-	SelectedStartYear  string           `json:"selected_start_year"`
-	SelectedEndMonth   string           `json:"selected_end_month"`
-	SelectedEndYear    string           `json:"selected_end_year"`
-	Type               string           `json:"type"`
-	DatasetTitle       string           `json:"dataset_title"`
-	GroupedSelection   GroupedSelection `json:"grouped_selection"`
-	FeedbackAPIURL     string           `json:"feedback_api_url"`
+	LatestTime         TimeValue         `json:"latest_value"`
+	FirstTime          TimeValue         `json:"fist_time"`
+	Values             []TimeValue       `json:"values"`
+	Months             []string          `json:"months"`
+	Years              []string          `json:"years"`
+	CheckedRadio       string            `json:"checked_radio"`
+	FormAction         Link              `json:"form_action"`
+	SelectedStartMonth string            `json:"selected_start_month"`
+	SelectedStartYear  string            `json:"selected_start_year"`
+	SelectedEndMonth   string            `json:"selected_end_month"`
+	SelectedEndYear    string            `json:"selected_end_year"`
+	DatePicker         bool              `json:"date_picker"`
+	MinDate            string            `json:"min_date,omitempty"`
+	MaxDate            string            `json:"max_date,omitempty"`
+	SelectedStartDate  string            `json:"selected_start_date,omitempty"`
+	SelectedEndDate    string            `json:"selected_end_date,omitempty"`
+	Type               string            `json:"type"`
+	Format             string            `json:"format"`
+	RelativeCount      string            `json:"relative_count"`
+	RelativeUnit       string            `json:"relative_unit"`
+	RelativeUnits      []string          `json:"relative_units"`
+	DatasetTitle       string            `json:"dataset_title"`
+	GroupedSelection   GroupedSelection  `json:"grouped_selection"`
+	FeedbackAPIURL     string            `json:"feedback_api_url"`
+	ETag               string            `json:"etag"`
+	Undo               Link              `json:"undo"`
+	FieldErrors        map[string]string `json:"field_errors,omitempty"`
 }
 
 // TimeValue represents the data to display a single time value
 type TimeValue struct {
 	Month      string `json:"month,omitempty"`
 	Year       string `json:"year,omitempty"`
+	Label      string `json:"label"`
 	Option     string `json:"option"`
 	IsSelected bool   `json:"is_selected"`
 }
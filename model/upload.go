@@ -0,0 +1,35 @@
+package model
+
+import core "github.com/ONSdigital/dp-renderer/v2/model"
+
+// UploadSummary represents the data for the page summarising the rows of an uploaded CSV file of options
+type UploadSummary struct {
+	core.Page
+	Data UploadSummaryPage `json:"data"`
+}
+
+// UploadSummaryPage represents the metadata for an upload summary page
+type UploadSummaryPage struct {
+	FilterID      string              `json:"filter_id"`
+	Dimensions    []UploadedDimension `json:"dimensions"`
+	Rejected      []RejectedRow       `json:"rejected"`
+	RejectedCount int                 `json:"rejected_count"`
+	Incomplete    bool                `json:"incomplete"`
+	Continue      Link                `json:"continue"`
+}
+
+// UploadedDimension represents a dimension whose selected options were set from an uploaded file. Applied is less than
+// Accepted if the upload failed before all the accepted options were applied to the filter.
+type UploadedDimension struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Accepted int    `json:"accepted"`
+	Applied  int    `json:"applied"`
+}
+
+// RejectedRow represents a row of an uploaded file that could not be applied to the filter
+type RejectedRow struct {
+	Line   int    `json:"line"`
+	Row    string `json:"row"`
+	Reason string `json:"reason"`
+}
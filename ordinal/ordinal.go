@@ -0,0 +1,88 @@
+package ordinal
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotInRange is returned when the first or last option of a range is not one of the ordered options
+var ErrNotInRange = errors.New("option is not one of the dimension options")
+
+// number matches the first number in a label, which may have thousands separators and decimals
+var number = regexp.MustCompile(`\d[\d,]*(\.\d+)?`)
+
+// below are the label prefixes of the options standing for every value below the number that follows them,
+// such as "Under 1" or "Less than £5,000"
+var below = []string{"under", "less than", "below", "up to"}
+
+// Option is an option of a dimension, identified by its code and shown with its label
+type Option struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+// Infer orders the options by the number in their labels, for dimensions such as years, household sizes or
+// income bands. Options with the same number keep the order they were given in. If any label has no number,
+// the dimension is not ordinal and false is returned.
+func Infer(opts []Option) ([]Option, bool) {
+	if len(opts) < 2 {
+		return nil, false
+	}
+
+	keys := make(map[string]float64, len(opts))
+	for _, opt := range opts {
+		key, ok := parse(opt.Label)
+		if !ok {
+			return nil, false
+		}
+		keys[opt.Code] = key
+	}
+
+	ordered := slices.Clone(opts)
+	sort.SliceStable(ordered, func(i, j int) bool { return keys[ordered[i].Code] < keys[ordered[j].Code] })
+	return ordered, true
+}
+
+// parse returns the number an option label is ordered by. Labels for every value below a number are ordered
+// just before the number, so that "Under 5" comes before "5 to 9".
+func parse(label string) (float64, bool) {
+	loc := number.FindStringIndex(label)
+	if loc == nil {
+		return 0, false
+	}
+	key, err := strconv.ParseFloat(strings.ReplaceAll(label[loc[0]:loc[1]], ",", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	prefix := strings.ToLower(label[:loc[0]])
+	for _, b := range below {
+		if strings.Contains(prefix, b) {
+			return key - 0.5, true
+		}
+	}
+	return key, true
+}
+
+// Between returns the codes of the ordered options from the first to the last provided codes inclusive,
+// whichever order the two are given in
+func Between(ordered []Option, first, last string) ([]string, error) {
+	i := slices.IndexFunc(ordered, func(opt Option) bool { return opt.Code == first })
+	j := slices.IndexFunc(ordered, func(opt Option) bool { return opt.Code == last })
+	if i < 0 || j < 0 {
+		return nil, ErrNotInRange
+	}
+	if i > j {
+		i, j = j, i
+	}
+
+	codes := make([]string, 0, j-i+1)
+	for _, opt := range ordered[i : j+1] {
+		codes = append(codes, opt.Code)
+	}
+	return codes, nil
+}
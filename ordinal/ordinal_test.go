@@ -0,0 +1,57 @@
+package ordinal
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInfer(t *testing.T) {
+	Convey("Options with numeric labels are ordered by their numbers", t, func() {
+		ordered, ok := Infer([]Option{
+			{Code: "c", Label: "£20,000 to £29,999"},
+			{Code: "a", Label: "Less than £10,000"},
+			{Code: "d", Label: "£30,000 or more"},
+			{Code: "b", Label: "£10,000 to £19,999"},
+		})
+		So(ok, ShouldBeTrue)
+		So(ordered, ShouldResemble, []Option{
+			{Code: "a", Label: "Less than £10,000"},
+			{Code: "b", Label: "£10,000 to £19,999"},
+			{Code: "c", Label: "£20,000 to £29,999"},
+			{Code: "d", Label: "£30,000 or more"},
+		})
+	})
+
+	Convey("Options with the same number keep their order", t, func() {
+		ordered, ok := Infer([]Option{{Code: "x", Label: "2 people"}, {Code: "y", Label: "2 persons"}, {Code: "z", Label: "1 person"}})
+		So(ok, ShouldBeTrue)
+		So(ordered, ShouldResemble, []Option{{Code: "z", Label: "1 person"}, {Code: "x", Label: "2 people"}, {Code: "y", Label: "2 persons"}})
+	})
+
+	Convey("Dimensions with a label without a number, or a single option, are not ordinal", t, func() {
+		_, ok := Infer([]Option{{Code: "1", Label: "1 person"}, {Code: "t", Label: "Total"}})
+		So(ok, ShouldBeFalse)
+		_, ok = Infer([]Option{{Code: "1", Label: "1 person"}})
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestBetween(t *testing.T) {
+	ordered := []Option{{Code: "2017"}, {Code: "2018"}, {Code: "2019"}, {Code: "2020"}}
+
+	Convey("The codes of a range of options are returned in order, whichever order its ends are given in", t, func() {
+		codes, err := Between(ordered, "2018", "2020")
+		So(err, ShouldBeNil)
+		So(codes, ShouldResemble, []string{"2018", "2019", "2020"})
+
+		codes, err = Between(ordered, "2019", "2017")
+		So(err, ShouldBeNil)
+		So(codes, ShouldResemble, []string{"2017", "2018", "2019"})
+	})
+
+	Convey("A range ending in an unknown option is rejected", t, func() {
+		_, err := Between(ordered, "2018", "2030")
+		So(err, ShouldEqual, ErrNotInRange)
+	})
+}
@@ -0,0 +1,235 @@
+package permalink
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// formatVersion is the first line of every encoded spec, so that the format can evolve without breaking older links
+	formatVersion = "1"
+
+	// allOptions is the token standing for all the options of a dimension
+	allOptions = "*"
+
+	// rangeSeparator separates the first and last codes of a range of consecutive numeric codes.
+	// It is always escaped in codes, so it can't be mistaken for part of one.
+	rangeSeparator = ":"
+
+	// minRangeLength is the number of consecutive numeric codes from which they are encoded as a range
+	minRangeLength = 3
+
+	// maxEncodedLength and maxDecodedLength bound the work done to decode a spec
+	maxEncodedLength = 16 * 1024
+	maxDecodedLength = 1024 * 1024
+
+	// maxRangeOptions bounds the number of options the ranges of a spec can expand to
+	maxRangeOptions = 100000
+)
+
+// ErrInvalidSpec is returned when an encoded spec can't be decoded
+var ErrInvalidSpec = errors.New("invalid filter permalink")
+
+// Spec is the full selection of a filter: the dataset version it filters and the options selected in each dimension
+type Spec struct {
+	DatasetID  string      `json:"dataset_id"`
+	Edition    string      `json:"edition"`
+	Version    string      `json:"version"`
+	Dimensions []Dimension `json:"dimensions"`
+}
+
+// Dimension is the selection of a dimension of a filter: either all of its options, or a list of them
+type Dimension struct {
+	Name    string   `json:"name"`
+	All     bool     `json:"all,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+// Encode returns the compact, URL safe encoding of a spec. Dimensions and options are sorted and de-duplicated
+// first, so that the same selection is always encoded the same way, whatever order it was made in.
+func Encode(s Spec) string {
+	var b strings.Builder
+	b.WriteString(formatVersion)
+	b.WriteByte('\n')
+	b.WriteString(strings.Join([]string{escape(s.DatasetID), escape(s.Edition), escape(s.Version)}, "/"))
+
+	dims := slices.Clone(s.Dimensions)
+	sort.SliceStable(dims, func(i, j int) bool { return dims[i].Name < dims[j].Name })
+	for _, d := range dims {
+		var tokens []string
+		if d.All {
+			tokens = []string{allOptions}
+		} else {
+			tokens = encodeOptions(d.Options)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		b.WriteByte('\n')
+		b.WriteString(escape(d.Name))
+		b.WriteByte('=')
+		b.WriteString(strings.Join(tokens, ","))
+	}
+
+	var buf bytes.Buffer
+	// the compression level is valid, so NewWriter can't fail, and writing to a buffer doesn't fail either
+	zw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = zw.Write([]byte(b.String()))
+	_ = zw.Close()
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// Decode returns the spec encoded by Encode
+func Decode(encoded string) (Spec, error) {
+	if encoded == "" || len(encoded) > maxEncodedLength {
+		return Spec{}, ErrInvalidSpec
+	}
+	compressed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Spec{}, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	text, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxDecodedLength+1))
+	if err != nil {
+		return Spec{}, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	if len(text) > maxDecodedLength {
+		return Spec{}, fmt.Errorf("%w: too large", ErrInvalidSpec)
+	}
+
+	lines := strings.Split(string(text), "\n")
+	if len(lines) < 2 || lines[0] != formatVersion {
+		return Spec{}, fmt.Errorf("%w: unsupported format", ErrInvalidSpec)
+	}
+
+	var s Spec
+	parts := strings.Split(lines[1], "/")
+	if len(parts) != 3 {
+		return Spec{}, fmt.Errorf("%w: invalid dataset version", ErrInvalidSpec)
+	}
+	for i, p := range []*string{&s.DatasetID, &s.Edition, &s.Version} {
+		if *p, err = unescape(parts[i]); err != nil || *p == "" {
+			return Spec{}, fmt.Errorf("%w: invalid dataset version", ErrInvalidSpec)
+		}
+	}
+
+	expanded := 0
+	for _, line := range lines[2:] {
+		name, tokens, ok := strings.Cut(line, "=")
+		if !ok {
+			return Spec{}, fmt.Errorf("%w: invalid dimension", ErrInvalidSpec)
+		}
+		d := Dimension{}
+		if d.Name, err = unescape(name); err != nil || d.Name == "" {
+			return Spec{}, fmt.Errorf("%w: invalid dimension", ErrInvalidSpec)
+		}
+		if tokens == allOptions {
+			d.All = true
+		} else if d.Options, err = decodeOptions(tokens, &expanded); err != nil {
+			return Spec{}, fmt.Errorf("%w: dimension %s: %v", ErrInvalidSpec, d.Name, err)
+		}
+		s.Dimensions = append(s.Dimensions, d)
+	}
+
+	return s, nil
+}
+
+// encodeOptions returns the tokens encoding a list of options. Numeric codes come first, in numeric order, with runs
+// of consecutive codes encoded as a range; other codes follow in lexical order.
+func encodeOptions(options []string) []string {
+	var numbers []int
+	var codes []string
+	seen := make(map[string]bool, len(options))
+	for _, opt := range options {
+		if seen[opt] {
+			continue
+		}
+		seen[opt] = true
+		if n, ok := canonicalInt(opt); ok {
+			numbers = append(numbers, n)
+		} else {
+			codes = append(codes, opt)
+		}
+	}
+	sort.Ints(numbers)
+	sort.Strings(codes)
+
+	tokens := make([]string, 0, len(numbers)+len(codes))
+	for i := 0; i < len(numbers); {
+		j := i
+		for j+1 < len(numbers) && numbers[j+1] == numbers[j]+1 {
+			j++
+		}
+		if j-i+1 >= minRangeLength {
+			tokens = append(tokens, strconv.Itoa(numbers[i])+rangeSeparator+strconv.Itoa(numbers[j]))
+		} else {
+			for k := i; k <= j; k++ {
+				tokens = append(tokens, strconv.Itoa(numbers[k]))
+			}
+		}
+		i = j + 1
+	}
+	for _, code := range codes {
+		tokens = append(tokens, escape(code))
+	}
+	return tokens
+}
+
+// decodeOptions returns the options encoded by encodeOptions, adding the number of options expanded from ranges to expanded
+func decodeOptions(tokens string, expanded *int) ([]string, error) {
+	var options []string
+	for _, token := range strings.Split(tokens, ",") {
+		first, last, isRange := strings.Cut(token, rangeSeparator)
+		if !isRange {
+			opt, err := unescape(token)
+			if err != nil || opt == "" {
+				return nil, fmt.Errorf("invalid option %q", token)
+			}
+			options = append(options, opt)
+			continue
+		}
+
+		from, okFrom := canonicalInt(first)
+		to, okTo := canonicalInt(last)
+		if !okFrom || !okTo || from > to {
+			return nil, fmt.Errorf("invalid range %q", token)
+		}
+		// the range is bounded before it's counted, so that the count can't overflow
+		if to-from >= maxRangeOptions || *expanded+to-from >= maxRangeOptions {
+			return nil, errors.New("too many options")
+		}
+		*expanded += to - from + 1
+		for n := from; n <= to; n++ {
+			options = append(options, strconv.Itoa(n))
+		}
+	}
+	return options, nil
+}
+
+// canonicalInt returns the non-negative integer a code is the canonical decimal form of, so that
+// codes such as "007" or "-1" are kept as they are rather than being encoded in a range
+func canonicalInt(code string) (int, bool) {
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 || strconv.Itoa(n) != code {
+		return 0, false
+	}
+	return n, true
+}
+
+// escape escapes the separators of the encoding in a dataset ID, edition, version, dimension name or option code
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), allOptions, "%2A")
+}
+
+func unescape(s string) (string, error) {
+	return url.QueryUnescape(s)
+}
@@ -0,0 +1,95 @@
+package permalink
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	Convey("Given the full selection of a filter", t, func() {
+		spec := Spec{
+			DatasetID: "cpih01",
+			Edition:   "time-series",
+			Version:   "2",
+			Dimensions: []Dimension{
+				{Name: "geography", Options: []string{"K04000001", "E92000001"}},
+				{Name: "age", Options: []string{"5", "0", "1", "2", "3", "7", "90+", "007", "-1"}},
+				{Name: "aggregate", All: true},
+				{Name: "sex"},
+			},
+		}
+
+		Convey("Then it is decoded back from its encoding, with its dimensions and options in a stable order", func() {
+			decoded, err := Decode(Encode(spec))
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, Spec{
+				DatasetID: "cpih01",
+				Edition:   "time-series",
+				Version:   "2",
+				Dimensions: []Dimension{
+					{Name: "age", Options: []string{"0", "1", "2", "3", "5", "7", "-1", "007", "90+"}},
+					{Name: "aggregate", All: true},
+					{Name: "geography", Options: []string{"E92000001", "K04000001"}},
+				},
+			})
+		})
+
+		Convey("Then consecutive non-negative numeric codes are encoded as a range", func() {
+			So(encodeOptions(spec.Dimensions[1].Options), ShouldResemble, []string{"0:3", "5", "7", "-1", "007", "90%2B"})
+		})
+
+		Convey("Then the same selection made in another order has the same encoding", func() {
+			reordered := Spec{
+				DatasetID: "cpih01",
+				Edition:   "time-series",
+				Version:   "2",
+				Dimensions: []Dimension{
+					{Name: "aggregate", All: true},
+					{Name: "geography", Options: []string{"E92000001", "K04000001", "E92000001"}},
+					{Name: "age", Options: []string{"007", "90+", "7", "5", "3", "2", "1", "0", "-1"}},
+				},
+			}
+			So(Encode(reordered), ShouldEqual, Encode(spec))
+		})
+	})
+
+	Convey("Codes containing the separators of the encoding are escaped", t, func() {
+		spec := Spec{DatasetID: "a/b", Edition: "e", Version: "1", Dimensions: []Dimension{{Name: "x=y", Options: []string{"*", "1:2", "a,b"}}}}
+		decoded, err := Decode(Encode(spec))
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, Spec{DatasetID: "a/b", Edition: "e", Version: "1", Dimensions: []Dimension{{Name: "x=y", Options: []string{"*", "1:2", "a,b"}}}})
+	})
+
+	Convey("Invalid encodings are rejected", t, func() {
+		encode := func(text string) string {
+			var buf bytes.Buffer
+			zw, _ := flate.NewWriter(&buf, flate.BestCompression)
+			_, _ = zw.Write([]byte(text))
+			_ = zw.Close()
+			return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+		}
+
+		for _, encoded := range []string{
+			"",
+			"not base64!",
+			base64.RawURLEncoding.EncodeToString([]byte("not deflate")),
+			encode("2\ncpih01/time-series/1"),
+			encode("1\ncpih01/time-series"),
+			encode("1\ncpih01/time-series/1\nage"),
+			encode("1\ncpih01/time-series/1\nage=5:1"),
+			encode("1\ncpih01/time-series/1\nage=0:1000000"),
+			encode("1\ncpih01/time-series/1\nage=0:9223372036854775807"),
+			encode("1\ncpih01/time-series/1\nage=-9223372036854775808:9223372036854775807"),
+			encode("1\ncpih01/time-series/1\nage=-5:-1"),
+			encode("1\ncpih01/time-series/1\nage=0:60000,0:60000"),
+			encode("1\ncpih01/time-series/1\nage=1,,2"),
+		} {
+			_, err := Decode(encoded)
+			So(err, ShouldWrap, ErrInvalidSpec)
+		}
+	})
+}
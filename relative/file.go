@@ -0,0 +1,95 @@
+package relative
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File is a Store that keeps the rule of each filter in a JSON file of the provided directory,
+// so that it survives restarts of the service
+type File struct {
+	dir string
+}
+
+// NewFile returns a file-backed store keeping the rules in dir, which is created if needed
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		return nil, errors.New("no directory provided for the relative time store")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create relative time directory: %w", err)
+	}
+	return &File{dir: dir}, nil
+}
+
+// Set records the rule chosen for the time dimension of a filter, through a temporary file so that it is never
+// left half written
+func (s *File) Set(_ context.Context, filterID string, rule Rule) error {
+	path, err := s.path(filterID)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, filterID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get returns the rule chosen for the time dimension of a filter, if any
+func (s *File) Get(_ context.Context, filterID string) (Rule, bool, error) {
+	path, err := s.path(filterID)
+	if err != nil {
+		return Rule{}, false, err
+	}
+	b, err := os.ReadFile(path) //nolint:gosec // the filter ID can't leave the rules directory
+	if errors.Is(err, fs.ErrNotExist) {
+		return Rule{}, false, nil
+	}
+	if err != nil {
+		return Rule{}, false, err
+	}
+	var rule Rule
+	if err := json.Unmarshal(b, &rule); err != nil {
+		return Rule{}, false, fmt.Errorf("failed to read relative time rule of filter %s: %w", filterID, err)
+	}
+	return rule, true, nil
+}
+
+// Delete forgets the rule of a filter
+func (s *File) Delete(_ context.Context, filterID string) error {
+	path, err := s.path(filterID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the path of the file holding the rule of a filter
+func (s *File) path(filterID string) (string, error) {
+	if filterID == "" || strings.ContainsAny(filterID, `/\.`) {
+		return "", ErrInvalidFilterID
+	}
+	return filepath.Join(s.dir, filterID+".json"), nil
+}
@@ -0,0 +1,38 @@
+package relative
+
+import (
+	"context"
+	"time"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/cache"
+)
+
+// Memory is a Store that keeps the rules of the filters in memory, so they are lost when the service restarts.
+// The rule of a filter is forgotten once it is older than the time to live, or once the rules of too many other
+// filters were used more recently.
+type Memory struct {
+	rules *cache.Cache[Rule]
+}
+
+// NewMemory returns an in-memory store keeping the rules of up to maxFilters filters, each for ttl after it was set
+func NewMemory(maxFilters int, ttl time.Duration) *Memory {
+	return &Memory{rules: cache.New[Rule](maxFilters, ttl)}
+}
+
+// Set records the rule chosen for the time dimension of a filter
+func (m *Memory) Set(_ context.Context, filterID string, rule Rule) error {
+	m.rules.Set(filterID, rule)
+	return nil
+}
+
+// Get returns the rule chosen for the time dimension of a filter, if any
+func (m *Memory) Get(_ context.Context, filterID string) (Rule, bool, error) {
+	rule, ok := m.rules.Peek(filterID)
+	return rule, ok, nil
+}
+
+// Delete forgets the rule of a filter
+func (m *Memory) Delete(_ context.Context, filterID string) error {
+	m.rules.Delete(filterID)
+	return nil
+}
@@ -0,0 +1,118 @@
+package relative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
+)
+
+// Store kinds that can be configured
+const (
+	MemoryStore = "memory"
+	FileStore   = "file"
+)
+
+// ErrInvalidFilterID is returned when a filter ID can't be used to store the rule of a filter
+var ErrInvalidFilterID = errors.New("invalid filter id")
+
+// ErrInvalidRule is returned when a rule doesn't select any period
+var ErrInvalidRule = errors.New("relative time rules must select at least one period")
+
+// Store keeps the relative time rule chosen for each filter, so that it can be applied again to new versions
+type Store interface {
+	// Set records the rule chosen for the time dimension of a filter
+	Set(ctx context.Context, filterID string, rule Rule) error
+	// Get returns the rule chosen for the time dimension of a filter, if any
+	Get(ctx context.Context, filterID string) (Rule, bool, error)
+	// Delete forgets the rule of a filter, once its time options are chosen some other way
+	Delete(ctx context.Context, filterID string) error
+}
+
+// Rule selects the latest periods of a time dimension, such as the latest 12 months, so that the selection
+// follows the new periods added by each release
+type Rule struct {
+	Count int               `json:"count"`
+	Unit  dates.Granularity `json:"unit"`
+}
+
+// Validate returns an error if the rule can't select any period
+func (r Rule) Validate() error {
+	if r.Count < 1 || r.Unit.String() == "" {
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+// Label returns the rule as it's shown to users
+func (r Rule) Label() string {
+	if r.Count == 1 {
+		return fmt.Sprintf("latest %s", r.Unit)
+	}
+	return fmt.Sprintf("latest %d %ss", r.Count, r.Unit)
+}
+
+// Resolve returns the codes of the options that start within the rule's span before the end of the latest one,
+// from the earliest to the latest
+func (r Rule) Resolve(opts []dates.Option) []string {
+	if len(opts) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(opts)
+	dates.SortOptions(sorted)
+
+	cutoff := r.cutoff(sorted[len(sorted)-1].Period.Start)
+	var codes []string
+	for _, opt := range sorted {
+		if opt.Period.Start.After(cutoff) {
+			codes = append(codes, opt.Code)
+		}
+	}
+	return codes
+}
+
+// cutoff returns the time that the selected periods have to start after for the latest one to start at latest
+func (r Rule) cutoff(latest time.Time) time.Time {
+	switch r.Unit {
+	case dates.Day:
+		return latest.AddDate(0, 0, -r.Count)
+	case dates.Week:
+		return latest.AddDate(0, 0, -7*r.Count)
+	case dates.Month:
+		return latest.AddDate(0, -r.Count, 0)
+	case dates.Quarter:
+		return latest.AddDate(0, -3*r.Count, 0)
+	}
+	return latest.AddDate(-r.Count, 0, 0)
+}
+
+// Matches returns true if the selected codes are the ones the rule resolves to, so that a rule that no longer
+// describes the selection isn't applied again
+func (r Rule) Matches(opts []dates.Option, selected []string) bool {
+	resolved := r.Resolve(opts)
+	if len(resolved) != len(selected) {
+		return false
+	}
+	for _, code := range selected {
+		if !slices.Contains(resolved, code) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewStore returns the store of the provided kind. The memory store only keeps the rules of up to maxFilters filters,
+// each for ttl after it was set.
+func NewStore(kind, path string, maxFilters int, ttl time.Duration) (Store, error) {
+	switch kind {
+	case MemoryStore:
+		return NewMemory(maxFilters, ttl), nil
+	case FileStore:
+		return NewFile(path)
+	default:
+		return nil, fmt.Errorf("unknown relative time store: %q", kind)
+	}
+}
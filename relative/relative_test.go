@@ -0,0 +1,139 @@
+package relative
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/dates"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// monthlyOptions returns the options of a monthly codelist, in the order they are provided
+func monthlyOptions(codes ...string) []dates.Option {
+	opts := make([]dates.Option, 0, len(codes))
+	for _, code := range codes {
+		period, err := dates.Monthly.Parse(code)
+		if err != nil {
+			panic(err)
+		}
+		opts = append(opts, dates.Option{Code: code, Label: code, Period: period})
+	}
+	return opts
+}
+
+func TestRule(t *testing.T) {
+	opts := monthlyOptions("Mar-20", "Jan-19", "Dec-19", "Jan-20", "Feb-20", "Nov-19", "Feb-19")
+
+	Convey("Given a rule for the latest months, then Resolve returns that many of the latest months", t, func() {
+		rule := Rule{Count: 3, Unit: dates.Month}
+		So(rule.Resolve(opts), ShouldResemble, []string{"Jan-20", "Feb-20", "Mar-20"})
+		So(rule.Label(), ShouldEqual, "latest 3 months")
+	})
+
+	Convey("Given a rule for the latest year of a monthly codelist, then Resolve returns the months of the year before the latest month", t, func() {
+		rule := Rule{Count: 1, Unit: dates.Year}
+		So(rule.Resolve(opts), ShouldResemble, []string{"Nov-19", "Dec-19", "Jan-20", "Feb-20", "Mar-20"})
+		So(rule.Label(), ShouldEqual, "latest year")
+	})
+
+	Convey("Given the options a rule resolves to, then the rule matches them in any order", t, func() {
+		rule := Rule{Count: 2, Unit: dates.Month}
+		So(rule.Matches(opts, []string{"Mar-20", "Feb-20"}), ShouldBeTrue)
+		So(rule.Matches(opts, []string{"Mar-20"}), ShouldBeFalse)
+		So(rule.Matches(opts, []string{"Mar-20", "Jan-20"}), ShouldBeFalse)
+	})
+
+	Convey("Given a rule that can't select any period, then it isn't valid", t, func() {
+		So(Rule{Count: 0, Unit: dates.Month}.Validate(), ShouldEqual, ErrInvalidRule)
+		So(Rule{Count: 2}.Validate(), ShouldEqual, ErrInvalidRule)
+		So(Rule{Count: 2, Unit: dates.Quarter}.Validate(), ShouldBeNil)
+	})
+
+	Convey("Given a rule written as JSON, then its unit is written by name", t, func() {
+		b, err := json.Marshal(Rule{Count: 5, Unit: dates.FinancialYear})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"count":5,"unit":"financial year"}`)
+
+		var rule Rule
+		So(json.Unmarshal(b, &rule), ShouldBeNil)
+		So(rule, ShouldResemble, Rule{Count: 5, Unit: dates.FinancialYear})
+	})
+}
+
+func TestNewStore(t *testing.T) {
+	Convey("NewStore returns the configured store", t, func() {
+		s, err := NewStore(MemoryStore, "", 100, time.Hour)
+		So(err, ShouldBeNil)
+		So(s, ShouldHaveSameTypeAs, &Memory{})
+
+		s, err = NewStore(FileStore, t.TempDir(), 100, time.Hour)
+		So(err, ShouldBeNil)
+		So(s, ShouldHaveSameTypeAs, &File{})
+	})
+
+	Convey("NewStore fails for an unknown store or a file store without a directory", t, func() {
+		_, err := NewStore("redis", "", 100, time.Hour)
+		So(err, ShouldNotBeNil)
+
+		_, err = NewStore(FileStore, "", 100, time.Hour)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestStores(t *testing.T) {
+	file, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"memory": NewMemory(100, time.Hour),
+		"file":   file,
+	}
+
+	for name, s := range stores {
+		ctx := context.Background()
+		rule := Rule{Count: 12, Unit: dates.Month}
+
+		Convey("Given an empty "+name+" store, then there is no rule", t, func() {
+			_, ok, err := s.Get(ctx, "filter1")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Given a rule set in a "+name+" store, then it is returned until it is deleted", t, func() {
+			So(s.Set(ctx, "filter2", rule), ShouldBeNil)
+
+			got, ok, err := s.Get(ctx, "filter2")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, rule)
+
+			So(s.Delete(ctx, "filter2"), ShouldBeNil)
+			_, ok, err = s.Get(ctx, "filter2")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	}
+
+	Convey("Given a memory store full of filters, then the rule of the least recently used filter is forgotten", t, func() {
+		ctx := context.Background()
+		m := NewMemory(2, time.Hour)
+		rule := Rule{Count: 12, Unit: dates.Month}
+		So(m.Set(ctx, "filter1", rule), ShouldBeNil)
+		So(m.Set(ctx, "filter2", rule), ShouldBeNil)
+		_, _, _ = m.Get(ctx, "filter1")
+		So(m.Set(ctx, "filter3", rule), ShouldBeNil)
+
+		_, ok, _ := m.Get(ctx, "filter2")
+		So(ok, ShouldBeFalse)
+		_, ok, _ = m.Get(ctx, "filter1")
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Given a file store, then filter IDs that could leave its directory are rejected", t, func() {
+		err := file.Set(context.Background(), "../filter", Rule{Count: 1, Unit: dates.Year})
+		So(err, ShouldEqual, ErrInvalidFilterID)
+	})
+}
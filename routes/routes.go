@@ -10,9 +10,13 @@ import (
 	"github.com/ONSdigital/dp-api-clients-go/v2/hierarchy"
 	"github.com/ONSdigital/dp-api-clients-go/v2/search"
 	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/cache"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/flatten"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/handlers"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/helpers"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/history"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
 	render "github.com/ONSdigital/dp-renderer/v2"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/gorilla/mux"
@@ -23,8 +27,13 @@ import (
 type Clients struct {
 	Filter             *filter.Client
 	Dataset            *dataset.Client
+	DatasetCache       *cache.Dataset
 	Hierarchy          *hierarchy.Client
+	HierarchyCache     *cache.Hierarchy
+	Flattening         flatten.Rules
 	HealthcheckHandler func(w http.ResponseWriter, req *http.Request)
+	History            history.Store
+	RelativeTime       relative.Store
 	Render             *render.Render
 	Search             *search.Client
 	Zebedee            *zebedee.Client
@@ -37,17 +46,43 @@ func Init(ctx context.Context, r *mux.Router, cfg *config.Config, clients *Clien
 		log.Warn(ctx, "failed to obtain an api router version. Will assume that it is un-versioned", log.FormatErrors([]error{err}))
 	}
 
-	f := handlers.NewFilter(clients.Render, clients.Filter, clients.Dataset,
-		clients.Hierarchy, clients.Search, clients.Zebedee, apiRouterVersion, cfg)
+	var datasetClient handlers.DatasetClient = clients.Dataset
+	if clients.DatasetCache != nil {
+		datasetClient = clients.DatasetCache
+	}
+
+	var hierarchyClient handlers.HierarchyClient = clients.Hierarchy
+	if clients.HierarchyCache != nil {
+		hierarchyClient = clients.HierarchyCache
+	}
+
+	f := handlers.NewFilter(clients.Render, clients.Filter, datasetClient,
+		hierarchyClient, clients.Search, clients.Zebedee, apiRouterVersion, cfg)
+	f.History = clients.History
+	f.RelativeTime = clients.RelativeTime
+	if clients.Flattening != nil {
+		f.Flattening = clients.Flattening
+	}
+
+	// Keep the filter job and the dataset it filters for the whole request, as several handlers and helpers need them
+	r.Use(handlers.ResolveFilter)
 
 	r.StrictSlash(true).Path("/health").HandlerFunc(clients.HealthcheckHandler)
 
+	r.StrictSlash(true).Path("/datasets/{datasetID}/editions/{edition}/versions/{version}/filter").Methods("POST").HandlerFunc(f.CreateFilter())
+
 	r.Path("/filter-outputs/{filterOutputID}.json").Methods("GET").HandlerFunc(f.GetFilterJob())
 	r.StrictSlash(true).Path("/filter-outputs/{filterOutputID}").Methods("GET").HandlerFunc(f.OutputPage())
 
+	r.StrictSlash(true).Path("/filters/new").Methods("GET").HandlerFunc(f.ConfirmNewFilterFromPermalink())
+	r.StrictSlash(true).Path("/filters/new").Methods("POST").HandlerFunc(f.NewFilterFromPermalink())
+	r.StrictSlash(true).Path("/filters/import").Methods("POST").HandlerFunc(f.ImportSelections())
 	r.StrictSlash(true).Path("/filters/{filterID}/submit").Methods("POST").HandlerFunc(f.Submit())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions").Methods("GET").HandlerFunc(f.FilterOverview())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/clear-all").HandlerFunc(f.FilterOverviewClearAll())
+	r.StrictSlash(true).Path("/filters/{filterID}/undo").Methods("GET").HandlerFunc(f.Undo())
+	r.StrictSlash(true).Path("/filters/{filterID}/permalink").Methods("GET").HandlerFunc(f.Permalink())
+	r.Path("/filters/{filterID}/selections.json").Methods("GET").HandlerFunc(f.ExportSelections())
 
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/time").Methods("GET").HandlerFunc(f.Time())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/time/update").Methods("POST").HandlerFunc(f.UpdateTime())
@@ -66,12 +101,24 @@ func Init(ctx context.Context, r *mux.Router, cfg *config.Config, clients *Clien
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/{parent}/remove/{option}").HandlerFunc(f.DimensionRemoveOne())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/remove/{option}").HandlerFunc(f.DimensionRemoveOne())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/list").Methods("POST").HandlerFunc(f.AddList())
+	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/range").Methods("POST").HandlerFunc(f.UpdateRange())
+	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/paste").Methods("POST").HandlerFunc(f.PasteOptions())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}{uri:.*}/remove-all").HandlerFunc(f.DimensionRemoveAll())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/options.json").HandlerFunc(f.GetSelectedDimensionOptionsJSON())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/all-options.json").HandlerFunc(f.GetAllDimensionOptionsJSON())
+	r.Path("/filters/{filterID}/dimensions/{name}/tree.json").Methods("GET").HandlerFunc(f.HierarchyTree())
 	r.StrictSlash(true).Path("/filters/{filterID}/dimensions/{name}/{code}").Methods("GET").HandlerFunc(f.Hierarchy())
 
 	r.StrictSlash(true).Path("/filters/{filterID}/use-latest-version").HandlerFunc(f.UseLatest())
+	r.StrictSlash(true).Path("/filters/{filterID}/use-version").HandlerFunc(f.UseVersion())
+
+	// Allow authorised users to flush the cached versions and hierarchy nodes
+	if clients.DatasetCache != nil {
+		r.Path("/dataset-cache").Methods("DELETE").Handler(profileMiddleware(cfg.PprofToken)(flushHandler(clients.DatasetCache)))
+	}
+	if clients.HierarchyCache != nil {
+		r.Path("/hierarchy-cache").Methods("DELETE").Handler(profileMiddleware(cfg.PprofToken)(flushHandler(clients.HierarchyCache)))
+	}
 
 	// Enable profiling endpoint for authorised users
 	if cfg.EnableProfiler {
@@ -80,6 +127,15 @@ func Init(ctx context.Context, r *mux.Router, cfg *config.Config, clients *Clien
 	}
 }
 
+// flushHandler forgets all the values of the provided cache
+func flushHandler(c interface{ Flush() }) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		c.Flush()
+		log.Info(req.Context(), "cache flushed", log.Data{"path": req.URL.Path})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 // profileMiddleware to validate auth token before accessing endpoint
 func profileMiddleware(token string) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
@@ -0,0 +1,92 @@
+package selections
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SchemaVersion is the version of the document schema written by this service. It is increased whenever a change
+// to the schema would prevent older versions of the service from reading the documents written by newer ones.
+const SchemaVersion = 1
+
+// maxDocumentSize bounds the size of the documents that are read
+const maxDocumentSize = 10 * 1024 * 1024
+
+// ErrInvalidDocument is returned when a document can't be read
+var ErrInvalidDocument = errors.New("invalid selections document")
+
+// Document is the definition of a filter that can be kept alongside the outputs it produced, to reproduce them later:
+// the dataset version it filters, and the options selected in each of its dimensions
+type Document struct {
+	SchemaVersion int         `json:"schema_version"`
+	Dataset       Dataset     `json:"dataset"`
+	Dimensions    []Dimension `json:"dimensions"`
+}
+
+// Dataset identifies the dataset version a filter applies to
+type Dataset struct {
+	ID      string `json:"id"`
+	Title   string `json:"title,omitempty"`
+	Edition string `json:"edition"`
+	Version string `json:"version"`
+}
+
+// Dimension holds the options selected in a dimension of a filter
+type Dimension struct {
+	Name    string   `json:"name"`
+	Label   string   `json:"label,omitempty"`
+	Options []Option `json:"options"`
+}
+
+// Option is a selected option, with its label for the benefit of the people reading the document
+type Option struct {
+	Code  string `json:"code"`
+	Label string `json:"label,omitempty"`
+}
+
+// Codes returns the codes of the options selected in the dimension
+func (d Dimension) Codes() []string {
+	codes := make([]string, 0, len(d.Options))
+	for _, opt := range d.Options {
+		codes = append(codes, opt.Code)
+	}
+	return codes
+}
+
+// Write writes the document as indented JSON, so that it can be read and compared by people
+func Write(w io.Writer, doc Document) error {
+	doc.SchemaVersion = SchemaVersion
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Read reads a document written by Write, or by an older version of the service
+func Read(r io.Reader) (Document, error) {
+	var doc Document
+	dec := json.NewDecoder(io.LimitReader(r, maxDocumentSize))
+	if err := dec.Decode(&doc); err != nil {
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	switch {
+	case doc.SchemaVersion < 1 || doc.SchemaVersion > SchemaVersion:
+		return Document{}, fmt.Errorf("%w: unsupported schema version %d", ErrInvalidDocument, doc.SchemaVersion)
+	case doc.Dataset.ID == "" || doc.Dataset.Edition == "" || doc.Dataset.Version == "":
+		return Document{}, fmt.Errorf("%w: missing dataset version", ErrInvalidDocument)
+	}
+	for _, d := range doc.Dimensions {
+		if d.Name == "" {
+			return Document{}, fmt.Errorf("%w: missing dimension name", ErrInvalidDocument)
+		}
+		for _, opt := range d.Options {
+			if opt.Code == "" {
+				return Document{}, fmt.Errorf("%w: missing option code in dimension %s", ErrInvalidDocument, d.Name)
+			}
+		}
+	}
+
+	return doc, nil
+}
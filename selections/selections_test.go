@@ -0,0 +1,47 @@
+package selections
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteRead(t *testing.T) {
+	Convey("Given the selections of a filter", t, func() {
+		doc := Document{
+			Dataset: Dataset{ID: "cpih01", Title: "CPIH", Edition: "time-series", Version: "2"},
+			Dimensions: []Dimension{
+				{Name: "geography", Label: "Geographic area", Options: []Option{{Code: "K04000001", Label: "England and Wales"}}},
+				{Name: "sex", Options: []Option{}},
+			},
+		}
+
+		Convey("Then they are written with the current schema version and read back", func() {
+			var buf bytes.Buffer
+			So(Write(&buf, doc), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "{\n  \"schema_version\": 1,")
+
+			read, err := Read(&buf)
+			So(err, ShouldBeNil)
+			doc.SchemaVersion = SchemaVersion
+			So(read, ShouldResemble, doc)
+			So(read.Dimensions[0].Codes(), ShouldResemble, []string{"K04000001"})
+		})
+	})
+
+	Convey("Documents that can't be used to recreate a filter are rejected", t, func() {
+		for _, doc := range []string{
+			`not json`,
+			`{"dataset":{"id":"cpih01","edition":"time-series","version":"2"}}`,
+			`{"schema_version":2,"dataset":{"id":"cpih01","edition":"time-series","version":"2"}}`,
+			`{"schema_version":1,"dataset":{"id":"cpih01","edition":"time-series"}}`,
+			`{"schema_version":1,"dataset":{"id":"cpih01","edition":"time-series","version":"2"},"dimensions":[{"options":[]}]}`,
+			`{"schema_version":1,"dataset":{"id":"cpih01","edition":"time-series","version":"2"},"dimensions":[{"name":"sex","options":[{"label":"Male"}]}]}`,
+		} {
+			_, err := Read(strings.NewReader(doc))
+			So(err, ShouldWrap, ErrInvalidDocument)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// SetupMetrics registers the global MeterProvider, exporting the metrics of the service, such as the filter reads
+// that were retried, to the same OTLP endpoint as the traces. If it doesn't return an error, shutdown must be called
+// to flush the last metrics.
+func SetupMetrics(ctx context.Context, cfg *config.Config) (shutdown func(context.Context) error, err error) {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(cfg.OTServiceName),
+			attribute.String("application", cfg.OTServiceName),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(cfg.OTExporterOTLPEndpoint), otlpmetricgrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(meterProvider)
+
+	return meterProvider.Shutdown, nil
+}
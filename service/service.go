@@ -10,10 +10,14 @@ import (
 	"github.com/ONSdigital/dp-api-clients-go/v2/search"
 	"github.com/ONSdigital/dp-api-clients-go/v2/zebedee"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/assets"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/cache"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/config"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/flatten"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/handlers"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/history"
+	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/relative"
 	"github.com/ONSdigital/dp-frontend-filter-dataset-controller/routes"
 	render "github.com/ONSdigital/dp-renderer/v2"
-	"github.com/ONSdigital/dp-renderer/v2/middleware/renderror"
 	"github.com/ONSdigital/log.go/v2/log"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
@@ -54,6 +58,37 @@ func Run(ctx context.Context, cfg *config.Config, serviceList *ExternalServiceLi
 		Zebedee:   zebedee.NewWithHealthClient(svc.routerHealthClient),
 	}
 
+	// Cache the options and dimensions of published versions, which never change
+	if cfg.DatasetCacheSizeMB > 0 {
+		svc.clients.DatasetCache = cache.NewDataset(svc.clients.Dataset, cfg.DatasetCacheSizeMB<<20, cfg.DatasetCacheTTL)
+	}
+
+	// Cache the hierarchy nodes, which never change for an instance
+	if cfg.HierarchyCacheSize > 0 {
+		svc.clients.HierarchyCache = cache.NewHierarchy(svc.clients.Hierarchy, cfg.HierarchyCacheSize, cfg.HierarchyCacheTTL)
+	}
+
+	// Initialise the store of the changes to filters that users can undo
+	svc.clients.History, err = history.NewStore(cfg.UndoHistoryStore, cfg.UndoHistoryPath, cfg.UndoHistoryLimit, cfg.UndoHistoryMaxFilters, cfg.UndoHistoryTTL)
+	if err != nil {
+		log.Error(ctx, "failed to create undo history store", err)
+		return nil, err
+	}
+
+	// Initialise the store of the relative time rules that are applied again to new versions
+	svc.clients.RelativeTime, err = relative.NewStore(cfg.RelativeTimeStore, cfg.RelativeTimePath, cfg.RelativeTimeMaxFilters, cfg.RelativeTimeTTL)
+	if err != nil {
+		log.Error(ctx, "failed to create relative time store", err)
+		return nil, err
+	}
+
+	// Load the rules flattening the top level of hierarchies, such as the UK geography
+	svc.clients.Flattening, err = flatten.Load(cfg.HierarchyFlatteningPath)
+	if err != nil {
+		log.Error(ctx, "failed to load hierarchy flattening rules", err)
+		return nil, err
+	}
+
 	// Get healthcheck with checkers
 	svc.HealthCheck, err = serviceList.GetHealthCheck(cfg, buildTime, gitCommit, version)
 	if err != nil {
@@ -69,7 +104,7 @@ func Run(ctx context.Context, cfg *config.Config, serviceList *ExternalServiceLi
 	r := mux.NewRouter()
 	r.Use(otelmux.Middleware(cfg.OTServiceName))
 	middleware := []alice.Constructor{
-		renderror.Handler(svc.clients.Render),
+		handlers.ErrorPages(svc.clients.Render),
 	}
 	newAlice := alice.New(middleware...).Then(r)
 	routes.Init(ctx, r, cfg, svc.clients)